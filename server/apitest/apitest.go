@@ -0,0 +1,153 @@
+// Package apitest runs the API's endpoints against in-memory stores so handlers can be tested end to end without a
+// database or Google.
+//
+// A Harness serves requests through the same handlers.Loader the server uses:
+//
+//     h := apitest.New(t)
+//     defer h.Close()
+//
+//     _, token := h.SeedUser(db.User{FirstName: "Jane"})
+//     h.Get("/api/v1/errors", token).AssertOK()
+package apitest
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/Noah-Huppert/squad-up/server/handlers"
+    "github.com/Noah-Huppert/squad-up/server/models"
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+)
+
+// Google API client id id tokens from the fake Google server are issued for
+const ClientId = "apitest.apps.googleusercontent.com"
+
+// Harness serves API requests from an in-memory AppContext.
+type Harness struct {
+    // Context endpoints are served with, its stores can be used to set up and inspect state
+    Ctx *models.AppContext
+    // Fake Google server used to login
+    Google *FakeGoogle
+
+    t *testing.T
+    mux *http.ServeMux
+}
+
+// New creates a Harness with empty stores. Must be closed once done.
+func New (t *testing.T) *Harness {
+    google := NewFakeGoogle(ClientId)
+
+    config := models.Config{
+        GAPIClientId: ClientId,
+        GoogleTokenInfoURL: google.TokenInfoURL(),
+        JWTServerURI: "squad-up@apitest/api/v1",
+        JWTHMACKey: "apitest-hmac-key",
+        RequestTimeout: 5 * time.Second,
+        IdempotencyRetention: time.Hour,
+    }
+
+    h := &Harness{
+        Ctx: models.NewMemoryAppContext(config),
+        Google: google,
+        t: t,
+        mux: http.NewServeMux(),
+    }
+
+    handlers.NewLoader(h.mux, h.Ctx).Load()
+
+    return h
+}
+
+// Close stops the fake Google server.
+func (h *Harness) Close () {
+    h.Google.Close()
+}
+
+// SeedUser saves a user and returns it with an access token which authenticates as them. Fails the test if the user
+// can not be saved.
+func (h *Harness) SeedUser (user db.User) (*db.User, string) {
+    if err := h.Ctx.Users.Create(context.Background(), &user); err != nil {
+        h.t.Fatalf("error seeding user: %s", err)
+    }
+
+    return &user, h.Token(user.ID)
+}
+
+// Token mints an access token for the user with the provided id.
+func (h *Harness) Token (userId int) string {
+    token, err := handlers.IssueAccessToken(h.Ctx, userId)
+    if err != nil {
+        h.t.Fatalf("error issuing access token: %s", err)
+    }
+
+    return token
+}
+
+// NewRequest creates a request authenticated with the provided access token, unauthenticated if the token is empty.
+func (h *Harness) NewRequest (method, path, token string, body io.Reader) *http.Request {
+    r := httptest.NewRequest(method, path, body)
+
+    if token != "" {
+        r.Header.Set("Authorization", "Bearer " + token)
+    }
+
+    return r
+}
+
+// Do serves a request.
+func (h *Harness) Do (r *http.Request) *Response {
+    w := httptest.NewRecorder()
+    h.mux.ServeHTTP(w, r)
+
+    return newResponse(h.t, r, w)
+}
+
+// Get makes a GET request.
+func (h *Harness) Get (path, token string) *Response {
+    return h.Do(h.NewRequest(http.MethodGet, path, token, nil))
+}
+
+// PostForm makes a POST request with form encoded values.
+func (h *Harness) PostForm (path, token string, values url.Values) *Response {
+    r := h.NewRequest(http.MethodPost, path, token, strings.NewReader(values.Encode()))
+    r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+    return h.Do(r)
+}
+
+// DoJSON makes a request with a JSON encoded body.
+func (h *Harness) DoJSON (method, path, token string, body interface{}) *Response {
+    b, err := json.Marshal(body)
+    if err != nil {
+        h.t.Fatalf("error encoding request body: %s", err)
+    }
+
+    r := h.NewRequest(method, path, token, bytes.NewReader(b))
+    r.Header.Set("Content-Type", "application/json")
+
+    return h.Do(r)
+}
+
+// Login exchanges an id token from the fake Google server for an access token. Fails the test if login fails.
+func (h *Harness) Login (identity GoogleIdentity) string {
+    res := h.PostForm("/api/v1/auth/token/google", "", url.Values{
+        "id_token": {h.Google.IdToken(identity)},
+    })
+
+    env := res.AssertOK()
+
+    token, _ := env["access_token"].(string)
+    if token == "" {
+        h.t.Fatalf("login response did not include access token: %s", res.Body.String())
+    }
+
+    return token
+}
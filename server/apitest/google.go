@@ -0,0 +1,88 @@
+package apitest
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "sync"
+)
+
+// GoogleIdentity is the profile information Google returns for an id token.
+type GoogleIdentity struct {
+    // Google account id
+    Sub string
+    Email string
+    EmailVerified bool
+    GivenName string
+    FamilyName string
+    Picture string
+    Locale string
+}
+
+// FakeGoogle is an HTTP server which imitates Google's id token info endpoint. Id tokens are only valid if they were
+// created by FakeGoogle.IdToken.
+type FakeGoogle struct {
+    *httptest.Server
+
+    // Google API client id which id tokens are issued for
+    ClientId string
+
+    mutex sync.Mutex
+    tokens map[string]GoogleIdentity
+}
+
+// NewFakeGoogle starts a fake Google server which issues id tokens for the provided client id. Must be closed once
+// done.
+func NewFakeGoogle (clientId string) *FakeGoogle {
+    g := &FakeGoogle{ClientId: clientId, tokens: make(map[string]GoogleIdentity)}
+    g.Server = httptest.NewServer(http.HandlerFunc(g.tokenInfo))
+
+    return g
+}
+
+// TokenInfoURL returns the URL of the fake id token info endpoint, for use as Config.GoogleTokenInfoURL.
+func (g *FakeGoogle) TokenInfoURL () string {
+    return g.URL + "/oauth2/v3/tokeninfo"
+}
+
+// IdToken returns a new id token for the provided identity.
+func (g *FakeGoogle) IdToken (identity GoogleIdentity) string {
+    g.mutex.Lock()
+    defer g.mutex.Unlock()
+
+    token := "fake-id-token-" + strconv.Itoa(len(g.tokens) + 1)
+    g.tokens[token] = identity
+
+    return token
+}
+
+// tokenInfo serves the profile information of the id token in the "id_token" query parameter. Responds with a 400 like
+// Google does if the token is not known.
+func (g *FakeGoogle) tokenInfo (w http.ResponseWriter, r *http.Request) {
+    g.mutex.Lock()
+    identity, ok := g.tokens[r.URL.Query().Get("id_token")]
+    g.mutex.Unlock()
+
+    w.Header().Set("Content-Type", "application/json")
+
+    if ok == false {
+        w.WriteHeader(http.StatusBadRequest)
+        json.NewEncoder(w).Encode(map[string]string{
+            "error_description": "Invalid Value",
+        })
+        return
+    }
+
+    // Google encodes booleans as strings
+    json.NewEncoder(w).Encode(map[string]string{
+        "aud": g.ClientId,
+        "sub": identity.Sub,
+        "email": identity.Email,
+        "email_verified": strconv.FormatBool(identity.EmailVerified),
+        "given_name": identity.GivenName,
+        "family_name": identity.FamilyName,
+        "picture": identity.Picture,
+        "locale": identity.Locale,
+    })
+}
@@ -0,0 +1,68 @@
+package apitest
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+// Response is the result of a request served by a Harness.
+type Response struct {
+    *httptest.ResponseRecorder
+
+    // Request which was served
+    Request *http.Request
+
+    t *testing.T
+}
+
+func newResponse (t *testing.T, r *http.Request, w *httptest.ResponseRecorder) *Response {
+    return &Response{w, r, t}
+}
+
+// Envelope decodes the response's JSON body. Fails the test if the body is not a JSON object.
+func (r *Response) Envelope () map[string]interface{} {
+    var env map[string]interface{}
+    if err := json.Unmarshal(r.Body.Bytes(), &env); err != nil {
+        r.t.Fatalf("%s %s: response is not a JSON object: %s: %s", r.Request.Method, r.Request.URL, err, r.Body.String())
+    }
+
+    return env
+}
+
+// Decode decodes the value of a key in the response's JSON envelope into v, ex: Decode("user", &user).
+func (r *Response) Decode (key string, v interface{}) {
+    raw := make(map[string]json.RawMessage)
+    if err := json.Unmarshal(r.Body.Bytes(), &raw); err != nil {
+        r.t.Fatalf("%s %s: response is not a JSON object: %s", r.Request.Method, r.Request.URL, err)
+    }
+
+    if err := json.Unmarshal(raw[key], v); err != nil {
+        r.t.Fatalf("%s %s: error decoding \"%s\": %s", r.Request.Method, r.Request.URL, key, err)
+    }
+}
+
+// AssertOK fails the test unless the response succeeded without an error. Returns the response's envelope.
+func (r *Response) AssertOK () map[string]interface{} {
+    env := r.Envelope()
+
+    if r.Code != http.StatusOK || env["error"] != nil {
+        r.t.Fatalf("%s %s: expected success, got %d: %s", r.Request.Method, r.Request.URL, r.Code, r.Body.String())
+    }
+
+    return env
+}
+
+// AssertError fails the test unless the response is the error with the provided HTTP status code and id. Returns the
+// error object.
+func (r *Response) AssertError (code int, id string) map[string]interface{} {
+    env := r.Envelope()
+
+    apiErr, _ := env["error"].(map[string]interface{})
+    if r.Code != code || apiErr == nil || apiErr["id"] != id {
+        r.t.Fatalf("%s %s: expected error \"%s\" (%d), got %d: %s", r.Request.Method, r.Request.URL, id, code, r.Code, r.Body.String())
+    }
+
+    return apiErr
+}
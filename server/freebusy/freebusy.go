@@ -0,0 +1,147 @@
+// Package freebusy merges the busy times of users into a timeline of when they are free.
+//
+// Intervals are half-open: an interval which ends at 10:00 does not overlap one which starts at 10:00. Only times are
+// handled, never what users are busy with, so timelines can be shown to other users.
+package freebusy
+
+import (
+    "sort"
+    "time"
+)
+
+// Interval is a span of time from Start until End.
+type Interval struct {
+    Start time.Time `json:"starts_at"`
+    End time.Time `json:"ends_at"`
+}
+
+// Overlaps reports if two intervals share some time.
+func (i Interval) Overlaps (other Interval) bool {
+    return i.Start.Before(other.End) && other.Start.Before(i.End)
+}
+
+// byStart sorts intervals by start time, then end time.
+type byStart []Interval
+
+func (l byStart) Len () int { return len(l) }
+func (l byStart) Swap (i, j int) { l[i], l[j] = l[j], l[i] }
+func (l byStart) Less (i, j int) bool {
+    if l[i].Start.Equal(l[j].Start) {
+        return l[i].End.Before(l[j].End)
+    }
+
+    return l[i].Start.Before(l[j].Start)
+}
+
+// Merge returns the time covered by intervals as a sorted list of intervals which do not overlap or touch. Empty
+// intervals are dropped. The provided list is not modified.
+func Merge (intervals []Interval) []Interval {
+    sorted := make([]Interval, 0, len(intervals))
+    for _, interval := range intervals {
+        if interval.End.After(interval.Start) {
+            sorted = append(sorted, interval)
+        }
+    }
+
+    sort.Sort(byStart(sorted))
+
+    var merged []Interval
+    for _, interval := range sorted {
+        if last := len(merged) - 1; last >= 0 && interval.Start.After(merged[last].End) == false {
+            if interval.End.After(merged[last].End) {
+                merged[last].End = interval.End
+            }
+
+            continue
+        }
+
+        merged = append(merged, interval)
+    }
+
+    return merged
+}
+
+// Clip returns the parts of merged intervals which are between from and to.
+func Clip (merged []Interval, from, to time.Time) []Interval {
+    var clipped []Interval
+    for _, interval := range merged {
+        if interval.Overlaps(Interval{from, to}) == false {
+            continue
+        }
+
+        if interval.Start.Before(from) {
+            interval.Start = from
+        }
+        if interval.End.After(to) {
+            interval.End = to
+        }
+
+        clipped = append(clipped, interval)
+    }
+
+    return clipped
+}
+
+// Free returns the gaps between merged intervals from from until to.
+func Free (merged []Interval, from, to time.Time) []Interval {
+    var free []Interval
+
+    start := from
+    for _, interval := range Clip(merged, from, to) {
+        if interval.Start.After(start) {
+            free = append(free, Interval{start, interval.Start})
+        }
+
+        start = interval.End
+    }
+
+    if to.After(start) {
+        free = append(free, Interval{start, to})
+    }
+
+    return free
+}
+
+// Slot is a step of a timeline and how many users are available during all of it.
+type Slot struct {
+    Interval
+    // Number of users who are free for the whole slot
+    Available int `json:"available"`
+    // Number of users who are busy for some of the slot
+    Busy int `json:"busy"`
+}
+
+// Timeline splits the time from from until to into slots of step length and counts how many users are available in
+// each. busy has the merged busy intervals of each user. The last slot is shorter if step does not divide the range.
+func Timeline (busy [][]Interval, from, to time.Time, step time.Duration) []Slot {
+    var slots []Slot
+    if step <= 0 {
+        return slots
+    }
+
+    // Index of the first interval of each user which could overlap the next slot
+    next := make([]int, len(busy))
+
+    for start := from; start.Before(to); start = start.Add(step) {
+        slot := Slot{Interval: Interval{start, start.Add(step)}}
+        if slot.End.After(to) {
+            slot.End = to
+        }
+
+        for user, intervals := range busy {
+            for next[user] < len(intervals) && intervals[next[user]].End.After(slot.Start) == false {
+                next[user]++
+            }
+
+            if next[user] < len(intervals) && intervals[next[user]].Overlaps(slot.Interval) {
+                slot.Busy++
+            } else {
+                slot.Available++
+            }
+        }
+
+        slots = append(slots, slot)
+    }
+
+    return slots
+}
@@ -0,0 +1,73 @@
+package freebusy
+
+import (
+    "testing"
+    "time"
+
+    "github.com/stretchr/testify/assert"
+)
+
+// Creates an interval between two times of 2030-06-01 UTC, in 15:04 format
+func at (start, end string) Interval {
+    parse := func (clock string) time.Time {
+        t, err := time.Parse("2006-01-02 15:04", "2030-06-01 " + clock)
+        if err != nil {
+            panic(err)
+        }
+
+        return t
+    }
+
+    return Interval{parse(start), parse(end)}
+}
+
+func TestMerge(t *testing.T) {
+    a := assert.New(t)
+
+    // Overlapping and touching intervals are merged, empty ones dropped
+    a.Equal([]Interval{at("08:00", "11:00"), at("13:00", "14:00")}, Merge([]Interval{
+        at("13:00", "14:00"),
+        at("09:00", "10:00"),
+        at("08:00", "09:30"),
+        at("10:00", "11:00"),
+        at("09:15", "09:45"),
+        at("12:00", "12:00"),
+    }))
+
+    a.Nil(Merge(nil))
+}
+
+func TestFree(t *testing.T) {
+    a := assert.New(t)
+    busy := []Interval{at("07:00", "09:00"), at("10:00", "11:00"), at("12:00", "13:00")}
+    day := at("08:00", "12:30")
+
+    a.Equal([]Interval{at("08:00", "09:00"), at("10:00", "11:00"), at("12:00", "12:30")}, Clip(busy, day.Start, day.End))
+    a.Equal([]Interval{at("09:00", "10:00"), at("11:00", "12:00")}, Free(busy, day.Start, day.End))
+    a.Equal([]Interval{day}, Free(nil, day.Start, day.End))
+}
+
+func TestTimeline(t *testing.T) {
+    a := assert.New(t)
+    busy := [][]Interval{
+        {at("09:00", "09:30")},
+        {at("09:15", "09:45"), at("10:30", "11:00")},
+        nil,
+    }
+    day := at("09:00", "10:45")
+
+    slots := Timeline(busy, day.Start, day.End, 30 * time.Minute)
+    a.Len(slots, 4)
+
+    var available []int
+    for _, slot := range slots {
+        a.Equal(len(busy), slot.Available + slot.Busy)
+        available = append(available, slot.Available)
+    }
+
+    // Busy for part of a slot counts as busy, the last slot is cut short at the end of the range
+    a.Equal([]int{1, 2, 3, 2}, available)
+    a.Equal(at("10:30", "10:45"), slots[3].Interval)
+
+    a.Nil(Timeline(busy, day.Start, day.End, 0))
+}
@@ -0,0 +1,414 @@
+package handlers
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/Noah-Huppert/squad-up/server/models"
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+)
+
+// Path personal data exports are served from
+const exportPath = "/api/v1/users/me/export"
+
+// Default time deleted accounts can be restored for, used if Config.AccountDeletionGracePeriod is not set
+const defaultAccountDeletionGracePeriod = 30 * 24 * time.Hour
+
+// accountDeletionGracePeriod returns how long deleted accounts can be restored for.
+func accountDeletionGracePeriod (ctx *models.AppContext) time.Duration {
+    if ctx.Config.AccountDeletionGracePeriod > 0 {
+        return ctx.Config.AccountDeletionGracePeriod
+    }
+
+    return defaultAccountDeletionGracePeriod
+}
+
+type deletionResponse struct {
+    // Time after which the account's personal data will be removed, the account can be restored by logging in until
+    // then
+    PurgeAfter time.Time `json:"purge_after"`
+}
+
+// deleteAccount soft deletes a user and revokes their access tokens. Serves DELETE /api/v1/users/me.
+func deleteAccount (reqCtx context.Context, ctx *models.AppContext, user *db.User) (interface{}, *models.APIError) {
+    now := time.Now()
+    user.TokensRevokedAt = &now
+
+    err := ctx.Users.Update(reqCtx, user)
+    if err == nil {
+        err = ctx.Users.SoftDelete(reqCtx, user.ID)
+    }
+    if err != nil {
+        if ctxErr := models.ContextError(reqCtx); ctxErr != nil {
+            return nil, ctxErr
+        }
+
+        fmt.Printf("Error deleting user: %s\n", err)
+        return nil, models.ErrDeletingUser.New()
+    }
+
+    return deletionResponse{now.Add(accountDeletionGracePeriod(ctx))}, nil
+}
+
+// restoreDeletedUser restores the account of a user who deleted it but has not been purged yet. Access tokens issued
+// before the account was restored stay revoked. Returns models.ErrNotFound if there is no such account.
+func restoreDeletedUser (reqCtx context.Context, ctx *models.AppContext, googleId string) (*db.User, error) {
+    user, err := ctx.Users.FindDeletedByIdentity(reqCtx, googleId)
+    if err != nil {
+        return nil, err
+    }
+
+    if err := ctx.Users.Restore(reqCtx, user.ID); err != nil {
+        return nil, err
+    }
+
+    now := time.Now()
+    user.DeletedAt = nil
+    user.TokensRevokedAt = &now
+
+    if err := ctx.Users.Update(reqCtx, user); err != nil {
+        return nil, err
+    }
+
+    return user, nil
+}
+
+// PurgeDeletedUsers removes the personal data of users who deleted their account longer than the grace period ago.
+// Runs every interval, never returns.
+func PurgeDeletedUsers (ctx *models.AppContext, interval time.Duration) {
+    for range time.Tick(interval) {
+        purgeDeletedUsers(ctx, time.Now().Add(-accountDeletionGracePeriod(ctx)))
+    }
+}
+
+// purgeDeletedUsers anonymizes users deleted before the cutoff and removes their uploaded files.
+func purgeDeletedUsers (ctx *models.AppContext, cutoff time.Time) {
+    c := context.Background()
+
+    users, err := ctx.Users.FindDeletedBefore(c, cutoff)
+    if err != nil {
+        fmt.Printf("Error finding deleted users to purge: %s\n", err)
+        return
+    }
+
+    for i := range users {
+        user := &users[i]
+        avatarVersion := user.AvatarVersion
+
+        if err := purgeUser(c, ctx, user); err != nil {
+            fmt.Printf("Error purging user %d: %s\n", user.ID, err)
+            continue
+        }
+
+        deleteAvatar(ctx, userAvatarPrefix(user.ID), avatarVersion)
+    }
+}
+
+// purgeUser removes a deleted user's personal data in a transaction, so users whose purge failed are tried again.
+// Stores which save data about a user must be purged here, and exported by ExportHandler.
+func purgeUser (c context.Context, ctx *models.AppContext, user *db.User) error {
+    promoted := make(map[int][]db.RSVP)
+    var deletedSquads []db.Squad
+
+    err := ctx.Transaction(c, func (tx *models.AppContext) error {
+        // Links and emails of invites the user sent stop working
+        if err := tx.Invites.DeleteByCreator(c, user.ID); err != nil {
+            return err
+        }
+
+        // Seats the user had go to waitlisted users
+        rsvps, err := tx.RSVPs.FindByUser(c, user.ID)
+        if err != nil {
+            return err
+        } else if err := tx.RSVPs.DeleteByUser(c, user.ID); err != nil {
+            return err
+        }
+
+        for _, rsvp := range rsvps {
+            seated, err := tx.RSVPs.Reseat(c, rsvp.EventID)
+            if err != nil && err != models.ErrNotFound {
+                return err
+            }
+
+            promoted[rsvp.EventID] = seated
+        }
+
+        if err := tx.Availability.DeleteVotesByUser(c, user.ID); err != nil {
+            return err
+        }
+
+        if err := tx.Polls.DeleteVotesByUser(c, user.ID); err != nil {
+            return err
+        }
+
+        if err := tx.Busy.DeleteByUser(c, user.ID); err != nil {
+            return err
+        }
+
+        if err := tx.Feeds.DeleteByUser(c, user.ID); err != nil {
+            return err
+        }
+
+        // Events no one else can see
+        if err := tx.Events.DeletePersonal(c, user.ID); err != nil {
+            return err
+        }
+
+        deletedSquads, err = purgeMemberships(c, tx, user)
+        if err != nil {
+            return err
+        }
+
+        user.Anonymize()
+        return tx.Users.Purge(c, user)
+    })
+    if err != nil {
+        return err
+    }
+
+    for eventId, seated := range promoted {
+        if len(seated) == 0 {
+            continue
+        }
+
+        if event, err := ctx.Events.FindById(c, eventId); err == nil {
+            notifyPromoted(ctx, *event, seated)
+        } else {
+            fmt.Printf("Error finding event to notify promoted users of: %s\n", err)
+        }
+    }
+
+    for _, squad := range deletedSquads {
+        deleteAvatar(ctx, squadAvatarPrefix(squad.ID), squad.AvatarVersion)
+    }
+
+    return nil
+}
+
+// purgeMemberships removes a deleted user from their squads. Squads they own are given to their most privileged
+// other member, the one who joined first if several have the same role. Squads which have no other members are
+// deleted with their events, and returned so their avatars can be deleted once the purge is saved.
+func purgeMemberships (c context.Context, tx *models.AppContext, user *db.User) ([]db.Squad, error) {
+    memberships, err := tx.Squads.FindMembershipsByUser(c, user.ID)
+    if err != nil {
+        return nil, err
+    }
+
+    var deleted []db.Squad
+    for _, membership := range memberships {
+        if membership.Role != db.SquadRoleOwner {
+            if err := tx.Squads.RemoveMember(c, membership.SquadID, user.ID); err != nil {
+                return nil, err
+            }
+
+            continue
+        }
+
+        squad, err := tx.Squads.FindById(c, membership.SquadID)
+        if err != nil {
+            return nil, err
+        }
+
+        members, err := tx.Squads.FindMemberships(c, squad.ID)
+        if err != nil {
+            return nil, err
+        }
+
+        var successor *db.SquadMembership
+        for i := range members {
+            if members[i].UserID == user.ID {
+                continue
+            } else if successor == nil || models.RoleRank(members[i].Role) > models.RoleRank(successor.Role) {
+                successor = &members[i]
+            }
+        }
+
+        if successor == nil {
+            if err := tx.Events.DeleteBySquad(c, squad.ID); err != nil {
+                return nil, err
+            } else if err := tx.Squads.Delete(c, squad.ID); err != nil {
+                return nil, err
+            }
+
+            deleted = append(deleted, *squad)
+            continue
+        }
+
+        successor.Role = db.SquadRoleOwner
+        squad.OwnerID = successor.UserID
+
+        if err := tx.Squads.UpdateMembership(c, successor); err != nil {
+            return nil, err
+        } else if err := tx.Squads.Update(c, squad); err != nil {
+            return nil, err
+        } else if err := tx.Squads.RemoveMember(c, squad.ID, user.ID); err != nil {
+            return nil, err
+        }
+    }
+
+    return deleted, nil
+}
+
+// ExportHandler serves a copy of all the personal data stored about the authenticated user. Stores which save data
+// about a user must be exported here, and purged by purgeUser.
+//
+// GET /api/v1/users/me/export
+type ExportHandler struct {}
+
+type exportResponse struct {
+    ExportedAt time.Time `json:"exported_at"`
+    Account accountExport `json:"account"`
+    // Squads user is a member of
+    SquadMemberships []db.SquadMembership `json:"squad_memberships"`
+    // Squads user owns
+    OwnedSquads []db.Squad `json:"owned_squads"`
+    // Invites user created
+    SquadInvites []db.SquadInvite `json:"squad_invites"`
+    // Events user created, in squads or personal
+    Events []db.Event `json:"events"`
+    // User's responses to events, with their notes
+    RSVPs []db.RSVP `json:"rsvps"`
+    // User's answers to availability polls
+    AvailabilityVotes []db.AvailabilityVote `json:"availability_votes"`
+    // User's ballots in polls, including anonymous ones
+    PollVotes []db.PollVote `json:"poll_votes"`
+    // Times user is busy, entered or imported from their calendars
+    BusyBlocks []db.BusyBlock `json:"busy_blocks"`
+    // Calendar feeds user subscribed to, with their links
+    CalendarFeeds []feedView `json:"calendar_feeds"`
+}
+
+// Everything stored in a user's row, including fields which are never served elsewhere
+type accountExport struct {
+    db.User
+    GoogleID string `json:"google_account_id"`
+    // URLs of uploaded profile picture thumbnails by their width
+    Thumbnails map[string]string `json:"profile_picture_thumbnails,omitempty"`
+}
+
+func (h ExportHandler) Serve (reqCtx context.Context, ctx *models.AppContext, r *http.Request) (interface{}, *models.APIError) {
+    user, apiErr := currentUser(reqCtx, ctx, r)
+    if apiErr != nil {
+        return nil, apiErr
+    }
+
+    return methodHandlers{
+        http.MethodGet: func () (interface{}, *models.APIError) {
+            return h.export(reqCtx, ctx, user)
+        },
+    }.serveMethod(r)
+}
+
+// export collects all the data stored about a user.
+func (h ExportHandler) export (reqCtx context.Context, ctx *models.AppContext, user *db.User) (interface{}, *models.APIError) {
+    memberships, err := ctx.Squads.FindMembershipsByUser(reqCtx, user.ID, models.ExpandMembershipSquad)
+    if err != nil {
+        return nil, internalError(reqCtx, models.ErrFindingSquad, "exporting squad memberships", err)
+    }
+
+    if memberships == nil {
+        memberships = []db.SquadMembership{}
+    }
+
+    owned := []db.Squad{}
+    for _, membership := range memberships {
+        if membership.Squad != nil && membership.Squad.OwnerID == user.ID {
+            owned = append(owned, *membership.Squad)
+        }
+    }
+
+    invites, err := ctx.Invites.FindByCreator(reqCtx, user.ID)
+    if err != nil {
+        return nil, internalError(reqCtx, models.ErrFindingSquad, "exporting squad invites", err)
+    }
+
+    if invites == nil {
+        invites = []db.SquadInvite{}
+    }
+
+    events, err := ctx.Events.FindByCreator(reqCtx, user.ID)
+    if err != nil {
+        return nil, internalError(reqCtx, models.ErrFindingEvent, "exporting events", err)
+    }
+
+    if events == nil {
+        events = []db.Event{}
+    }
+
+    rsvps, err := ctx.RSVPs.FindByUser(reqCtx, user.ID)
+    if err != nil {
+        return nil, internalError(reqCtx, models.ErrFindingEvent, "exporting rsvps", err)
+    }
+
+    if rsvps == nil {
+        rsvps = []db.RSVP{}
+    }
+
+    availabilityVotes, err := ctx.Availability.FindVotesByUser(reqCtx, user.ID)
+    if err != nil {
+        return nil, internalError(reqCtx, models.ErrFindingPoll, "exporting availability votes", err)
+    }
+
+    if availabilityVotes == nil {
+        availabilityVotes = []db.AvailabilityVote{}
+    }
+
+    pollVotes, err := ctx.Polls.FindVotesByUser(reqCtx, user.ID)
+    if err != nil {
+        return nil, internalError(reqCtx, models.ErrFindingPoll, "exporting poll votes", err)
+    }
+
+    if pollVotes == nil {
+        pollVotes = []db.PollVote{}
+    }
+
+    busy, err := ctx.Busy.FindByUser(reqCtx, user.ID)
+    if err != nil {
+        return nil, internalError(reqCtx, models.ErrFindingBusy, "exporting busy blocks", err)
+    }
+
+    if busy == nil {
+        busy = []db.BusyBlock{}
+    }
+
+    feeds, err := ctx.Feeds.FindByUser(reqCtx, user.ID)
+    if err != nil {
+        return nil, internalError(reqCtx, models.ErrFindingFeed, "exporting calendar feeds", err)
+    }
+
+    feedViews := []feedView{}
+    for _, feed := range feeds {
+        feedViews = append(feedViews, viewFeed(ctx, feed))
+    }
+
+    return exportResponse{
+        ExportedAt: time.Now(),
+        Account: exportAccount(user),
+        SquadMemberships: memberships,
+        OwnedSquads: owned,
+        SquadInvites: invites,
+        Events: events,
+        RSVPs: rsvps,
+        AvailabilityVotes: availabilityVotes,
+        PollVotes: pollVotes,
+        BusyBlocks: busy,
+        CalendarFeeds: feedViews,
+    }, nil
+}
+
+// exportAccount returns the export of a user's account.
+func exportAccount (user *db.User) accountExport {
+    account := accountExport{User: *user, GoogleID: user.GoogleID}
+
+    if user.AvatarVersion != "" {
+        account.Thumbnails = make(map[string]string, len(avatarSizes))
+        for _, size := range avatarSizes {
+            account.Thumbnails[strconv.Itoa(size)] = "/" + avatarKey(userAvatarPrefix(user.ID), user.AvatarVersion, size)
+        }
+    }
+
+    return account
+}
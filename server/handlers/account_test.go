@@ -0,0 +1,96 @@
+package handlers_test
+
+import (
+    "context"
+    "net/http"
+    "strconv"
+    "testing"
+    "time"
+
+    "github.com/Noah-Huppert/squad-up/server/apitest"
+    "github.com/Noah-Huppert/squad-up/server/models"
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+    "github.com/Noah-Huppert/squad-up/server/voting"
+    "github.com/stretchr/testify/assert"
+)
+
+func TestExportHandler(t *testing.T) {
+    a := assert.New(t)
+    h := apitest.New(t)
+    defer h.Close()
+
+    user, token := h.SeedUser(db.User{GoogleID: "1001", FirstName: "Jane", Email: "jane@example.com", Locale: "fr"})
+
+    squadId := createSquad(h, token, map[string]string{"name": "Hikers"})
+    createInvite(h, token, squadId, map[string]interface{}{"email": "john@example.com"})
+
+    eventId := createEvent(h, token, map[string]interface{}{"squad_id": squadId, "title": "Hike", "starts_at": "2030-06-01T15:00:00Z", "ends_at": "2030-06-01T18:00:00Z"})
+    h.DoJSON(http.MethodPut, "/api/v1/events/" + strconv.Itoa(eventId) + "/rsvps/me", token, map[string]interface{}{"response": "yes", "note": "Bringing snacks"}).AssertOK()
+
+    c := context.Background()
+    poll := &db.AvailabilityPoll{SquadID: squadId, Title: "Climb", Status: db.AvailabilityPollOpen, Slots: []db.AvailabilitySlot{{StartsAt: time.Now(), EndsAt: time.Now().Add(time.Hour)}}}
+    a.Nil(h.Ctx.Availability.Create(c, poll))
+    a.Nil(h.Ctx.Availability.Vote(c, poll.ID, user.ID, []db.AvailabilityVote{{SlotID: poll.Slots[0].ID, Answer: db.AvailabilityIfNeedBe}}))
+
+    ballot := &db.Poll{SquadID: &squadId, Question: "Where?", Method: string(voting.Single), Anonymous: true, Options: []db.PollOption{{Label: "Crag"}, {Label: "Gym", Position: 1}}}
+    a.Nil(h.Ctx.Polls.Create(c, ballot))
+    a.Nil(h.Ctx.Polls.Vote(c, ballot.ID, user.ID, []db.PollVote{{OptionID: ballot.Options[1].ID, Rank: 1}}))
+
+    h.DoJSON(http.MethodPost, "/api/v1/feeds", token, map[string]interface{}{"squad_id": squadId}).AssertOK()
+
+    a.Nil(h.Ctx.Busy.ReplaceImported(c, user.ID, []db.BusyBlock{{StartsAt: time.Now(), EndsAt: time.Now().Add(time.Hour)}}))
+
+    export := h.Get("/api/v1/users/me/export", token).AssertOK()
+    account := export["account"].(map[string]interface{})
+    a.Equal("1001", account["google_account_id"])
+    a.Equal("jane@example.com", account["email"])
+    a.Equal("fr", account["locale"])
+
+    a.Len(export["squad_memberships"], 1)
+    a.Equal("Hikers", export["owned_squads"].([]interface{})[0].(map[string]interface{})["name"])
+    a.Equal("Hike", export["events"].([]interface{})[0].(map[string]interface{})["title"])
+    a.Equal("john@example.com", export["squad_invites"].([]interface{})[0].(map[string]interface{})["email"])
+    a.Equal("Bringing snacks", export["rsvps"].([]interface{})[0].(map[string]interface{})["note"])
+    a.Equal("if_need_be", export["availability_votes"].([]interface{})[0].(map[string]interface{})["answer"])
+    a.Equal(float64(ballot.Options[1].ID), export["poll_votes"].([]interface{})[0].(map[string]interface{})["option_id"])
+    a.Equal(db.BusySourceImport, export["busy_blocks"].([]interface{})[0].(map[string]interface{})["source"])
+    feed := export["calendar_feeds"].([]interface{})[0].(map[string]interface{})
+    a.Equal(float64(squadId), feed["squad_id"])
+    a.Contains(feed["url"], ".ics")
+}
+
+func TestDeleteAccount(t *testing.T) {
+    a := assert.New(t)
+    h := apitest.New(t)
+    defer h.Close()
+
+    token := h.Login(jane)
+    user, err := h.Ctx.Users.FindByIdentity(context.Background(), jane.Sub)
+    a.Nil(err)
+
+    res := h.DoJSON(http.MethodDelete, "/api/v1/users/me", token, nil)
+    a.NotEmpty(res.AssertOK()["purge_after"])
+
+    // Access token no longer works
+    h.Get("/api/v1/users/me", token).AssertError(http.StatusUnauthorized, models.ErrInvalidAccessToken.Id)
+
+    // Logging in during grace period restores account
+    h.Login(jane)
+
+    restored, err := h.Ctx.Users.FindByIdentity(context.Background(), jane.Sub)
+    a.Nil(err)
+    a.Equal(user.ID, restored.ID)
+}
+
+func TestCurrentUser_RevokedToken(t *testing.T) {
+    h := apitest.New(t)
+    defer h.Close()
+
+    user, token := h.SeedUser(db.User{FirstName: "Jane"})
+
+    revoked := time.Now().Add(time.Minute)
+    user.TokensRevokedAt = &revoked
+    h.Ctx.Users.Update(context.Background(), user)
+
+    h.Get("/api/v1/users/me", token).AssertError(http.StatusUnauthorized, models.ErrInvalidAccessToken.Id)
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/Noah-Huppert/squad-up/server/models"
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+
+    "github.com/SermoDigital/jose/crypto"
+    "github.com/SermoDigital/jose/jws"
+    "github.com/satori/go.uuid"
+)
+
+// How long access tokens are valid for
+const accessTokenLifetime = 14 * 24 * time.Hour// 2 weeks
+
+// bearerToken returns the access token provided in the request's Authorization header. Returns an empty string if
+// the request does not have a bearer token.
+func bearerToken(r *http.Request) string {
+    header := r.Header.Get("Authorization")
+    if len(header) <= len("Bearer ") || strings.EqualFold(header[:len("Bearer ")], "Bearer ") == false {
+        return ""
+    }
+
+    return strings.TrimSpace(header[len("Bearer "):])
+}
+
+// IssueAccessToken creates an access token which authenticates requests as the user with the provided id.
+func IssueAccessToken(ctx *models.AppContext, userId int) (string, error) {
+    claims := jws.Claims{}
+    claims.SetIssuer(ctx.Config.JWTServerURI)
+    claims.SetSubject(strconv.Itoa(userId))
+    claims.SetAudience(ctx.Config.JWTServerURI)
+    claims.SetExpiration(time.Now().Add(accessTokenLifetime))
+    claims.SetIssuedAt(time.Now())
+    claims.SetJWTID(uuid.NewV4().String())
+
+    jwt := jws.NewJWT(claims, crypto.SigningMethodHS512)
+
+    accessToken, err := jwt.Serialize([]byte(ctx.Config.JWTHMACKey))
+    if err != nil {
+        return "", err
+    }
+
+    return string(accessToken), nil
+}
+
+// authenticate verifies the access token provided with a request and returns the id of the user it was issued to.
+//
+// Access tokens are issued by IssueAccessToken. They are JWTs signed with the Config.JWTHMACKey whose subject is
+// the user's id.
+func authenticate(ctx *models.AppContext, r *http.Request) (int, *models.APIError) {
+    userId, _, apiErr := parseAccessToken(ctx, r)
+    return userId, apiErr
+}
+
+// parseAccessToken verifies the access token provided with a request. Returns the id of the user it was issued to and
+// the time it was issued.
+func parseAccessToken(ctx *models.AppContext, r *http.Request) (int, time.Time, *models.APIError) {
+    token := bearerToken(r)
+    if token == "" {
+        return 0, time.Time{}, models.ErrMissingAccessToken.New()
+    }
+
+    invalidErr := models.ErrInvalidAccessToken.New()
+
+    // Check signature, expiration and not before
+    jwt, err := jws.ParseJWT([]byte(token))
+    if err != nil {
+        return 0, time.Time{}, invalidErr
+    }
+
+    if err = jwt.Validate([]byte(ctx.Config.JWTHMACKey), crypto.SigningMethodHS512); err != nil {
+        return 0, time.Time{}, invalidErr
+    }
+
+    // Check token was issued by and for us
+    claims := jwt.Claims()
+
+    if iss, ok := claims.Issuer(); ok == false || iss != ctx.Config.JWTServerURI {
+        return 0, time.Time{}, invalidErr
+    }
+
+    aud, ok := claims.Audience()
+    if ok == false || len(aud) != 1 || aud[0] != ctx.Config.JWTServerURI {
+        return 0, time.Time{}, invalidErr
+    }
+
+    issuedAt, ok := claims.IssuedAt()
+    if ok == false {
+        return 0, time.Time{}, invalidErr
+    }
+
+    // Get user id
+    sub, ok := claims.Subject()
+    if ok == false {
+        return 0, time.Time{}, invalidErr
+    }
+
+    userId, err := strconv.Atoi(sub)
+    if err != nil {
+        return 0, time.Time{}, invalidErr
+    }
+
+    return userId, issuedAt, nil
+}
+
+// currentUser authenticates a request and loads the user it was made by. Access tokens which were revoked are not
+// accepted.
+func currentUser(reqCtx context.Context, ctx *models.AppContext, r *http.Request) (*db.User, *models.APIError) {
+    userId, issuedAt, apiErr := parseAccessToken(ctx, r)
+    if apiErr != nil {
+        return nil, apiErr
+    }
+
+    user, err := ctx.Users.FindById(reqCtx, userId)
+    if err == models.ErrNotFound {// Token outlived user
+        return nil, models.ErrInvalidAccessToken.New()
+    } else if err != nil {
+        if ctxErr := models.ContextError(reqCtx); ctxErr != nil {
+            return nil, ctxErr
+        }
+
+        fmt.Printf("Error loading authenticated user: %s\n", err)
+        return nil, models.ErrFindingUser.New()
+    }
+
+    // The issued at claim only has second precision
+    if user.TokensRevokedAt != nil && issuedAt.Before(user.TokensRevokedAt.Truncate(time.Second)) {
+        return nil, models.ErrInvalidAccessToken.New()
+    }
+
+    return user, nil
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+    "context"
+    "net/http"
+    "sort"
+    "strings"
+
+    "github.com/Noah-Huppert/squad-up/server/models"
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+)
+
+// squadPolicy returns the permissions of squad roles.
+func squadPolicy (ctx *models.AppContext) models.Policy {
+    if ctx.Config.Policy != nil {
+        return ctx.Config.Policy
+    }
+
+    return models.DefaultPolicy
+}
+
+// squadRequest is a request to an endpoint of a squad the viewer can see.
+type squadRequest struct {
+    reqCtx context.Context
+    ctx *models.AppContext
+    r *http.Request
+    viewer *db.User
+    access squadAccess
+    // Values of the route's "*" path segments, in order
+    params []string
+}
+
+// squadRoute declares an endpoint under /api/v1/squads/{id} and who can use it.
+type squadRoute struct {
+    method string
+    // Path after the squad id, without slashes at either end. "*" segments match any value.
+    path string
+    // Permission the viewer's role must have, empty if anyone who can see the squad can use the route. Checks which
+    // depend on the request's data, ex: which member is being removed, are done by serve.
+    permission models.Permission
+    // If the route can be used on archived squads. Routes with safe methods always can.
+    archived bool
+    serve func (req squadRequest) (interface{}, *models.APIError)
+}
+
+// match reports if a path matches the route's, and returns the values of its "*" segments.
+func (route squadRoute) match (parts []string) ([]string, bool) {
+    var pattern []string
+    if route.path != "" {
+        pattern = strings.Split(route.path, "/")
+    }
+
+    if len(pattern) != len(parts) {
+        return nil, false
+    }
+
+    var params []string
+    for i, segment := range pattern {
+        if segment == "*" {
+            params = append(params, parts[i])
+        } else if segment != parts[i] {
+            return nil, false
+        }
+    }
+
+    return params, true
+}
+
+// serveSquadRoute serves a request with the route matching its method and path, after checking the viewer is allowed
+// to use it. parts are the segments of the path after the squad id.
+func serveSquadRoute (routes []squadRoute, req squadRequest, parts []string) (interface{}, *models.APIError) {
+    var allowed []string
+
+    for _, route := range routes {
+        params, ok := route.match(parts)
+        if ok == false {
+            continue
+        } else if route.method != req.r.Method {
+            allowed = append(allowed, route.method)
+            continue
+        }
+
+        if route.permission != "" {
+            if apiErr := squadPolicy(req.ctx).Check(req.access.role(), route.permission); apiErr != nil {
+                return nil, apiErr
+            }
+        }
+
+        if req.access.squad.Archived() && route.archived == false && isSafeMethod(route.method) == false {
+            return nil, models.ErrSquadArchived.New()
+        }
+
+        req.params = params
+        return route.serve(req)
+    }
+
+    if len(allowed) == 0 {
+        return nil, models.ErrEndpointNotFound.New(req.r.URL.Path)
+    }
+
+    sort.Strings(allowed)
+    return nil, models.ErrMethodNotAllowed.New(req.r.Method, strings.Join(allowed, ", "))
+}
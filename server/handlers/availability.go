@@ -0,0 +1,446 @@
+package handlers
+
+import (
+    "context"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/Noah-Huppert/squad-up/server/models"
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+)
+
+// Path availability poll endpoints are registered under
+const availabilityPath = "/api/v1/availability-polls"
+
+// Max number of time slots a poll can propose
+const maxPollSlots = 30
+
+// Valid values of db.AvailabilityVote.Answer
+var availabilityAnswers = []string{db.AvailabilityYes, db.AvailabilityIfNeedBe, db.AvailabilityNo}
+
+// AvailabilityHandler serves availability polls, which help a squad find a time that works for most of its members.
+//
+//     GET    /api/v1/availability-polls?squad_id={id}  Squad's polls, newest first
+//     POST   /api/v1/availability-polls                Create poll, see availabilityPollRequest
+//     GET    /api/v1/availability-polls/{id}           View poll, its slots ranked from best to worst and the
+//                                                      viewer's answers
+//     DELETE /api/v1/availability-polls/{id}           Delete poll
+//     PUT    /api/v1/availability-polls/{id}/votes/me  Answer which slots work for the viewer, see voteRequest
+//     POST   /api/v1/availability-polls/{id}/finalize  Pick a slot, creating a squad event at that time
+//
+// Members whose role has the models.PermRSVP permission can see polls and vote. Polls are created by members with the
+// models.PermCreateEvents permission, and managed like the events they turn into: by their creator while they can
+// create events, or by members with the models.PermManageEvents permission.
+type AvailabilityHandler struct {}
+
+type availabilityPollsResponse struct {
+    Polls []db.AvailabilityPoll `json:"polls"`
+}
+
+type availabilityPollResponse struct {
+    Poll db.AvailabilityPoll `json:"poll"`
+    // Slots from best to worst, and who answered what for each
+    Ranking []models.SlotRanking `json:"ranking"`
+    // Viewer's answers, by slot id
+    Votes map[string]string `json:"votes"`
+}
+
+// pollAccess is an availability poll loaded for a request and the viewer's membership in its squad.
+type pollAccess struct {
+    poll *db.AvailabilityPoll
+    squad squadAccess
+}
+
+// canManage reports if the viewer can finalize or delete the poll.
+func (a pollAccess) canManage (policy models.Policy, viewerId int) bool {
+    role := a.squad.role()
+
+    return policy.Allows(role, models.PermManageEvents) ||
+        (a.poll.CreatorID == viewerId && policy.Allows(role, models.PermCreateEvents))
+}
+
+// checkManageable returns an error if the viewer can not finalize or delete the poll.
+func (a pollAccess) checkManageable (ctx *models.AppContext, viewerId int) *models.APIError {
+    if a.canManage(squadPolicy(ctx), viewerId) == false {
+        return models.ErrPermissionDenied.New(string(models.PermManageEvents))
+    } else if a.squad.squad.Archived() {
+        return models.ErrSquadArchived.New()
+    }
+
+    return nil
+}
+
+func (h AvailabilityHandler) Serve (reqCtx context.Context, ctx *models.AppContext, r *http.Request) (interface{}, *models.APIError) {
+    viewer, apiErr := currentUser(reqCtx, ctx, r)
+    if apiErr != nil {
+        return nil, apiErr
+    }
+
+    parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, availabilityPath), "/"), "/")
+
+    // Collection
+    if parts[0] == "" {
+        return methodHandlers{
+            http.MethodGet: func () (interface{}, *models.APIError) {
+                return h.list(reqCtx, ctx, r, viewer)
+            },
+            http.MethodPost: func () (interface{}, *models.APIError) {
+                return h.create(reqCtx, ctx, r, viewer)
+            },
+        }.serveMethod(r)
+    }
+
+    access, apiErr := loadPoll(reqCtx, ctx, parts[0], viewer.ID)
+    if apiErr != nil {
+        return nil, apiErr
+    }
+
+    switch {
+    case len(parts) == 1:
+        return methodHandlers{
+            http.MethodGet: func () (interface{}, *models.APIError) {
+                return h.view(reqCtx, ctx, access, viewer)
+            },
+            http.MethodDelete: func () (interface{}, *models.APIError) {
+                return h.remove(reqCtx, ctx, access, viewer)
+            },
+        }.serveMethod(r)
+    case len(parts) == 3 && parts[1] == "votes" && parts[2] == "me":
+        return methodHandlers{
+            http.MethodPut: func () (interface{}, *models.APIError) {
+                return h.vote(reqCtx, ctx, r, access, viewer)
+            },
+        }.serveMethod(r)
+    case len(parts) == 2 && parts[1] == "finalize":
+        return methodHandlers{
+            http.MethodPost: func () (interface{}, *models.APIError) {
+                return h.finalize(reqCtx, ctx, r, access, viewer)
+            },
+        }.serveMethod(r)
+    }
+
+    return nil, models.ErrEndpointNotFound.New(r.URL.Path)
+}
+
+// loadPoll loads the availability poll with the provided id and the viewer's membership in its squad. Users who can
+// not vote in the squad get the same models.ErrPollNotFound error as if the poll did not exist.
+func loadPoll (reqCtx context.Context, ctx *models.AppContext, id string, viewerId int) (pollAccess, *models.APIError) {
+    var access pollAccess
+
+    pollId, err := strconv.Atoi(id)
+    if err != nil {
+        return access, models.ErrPollNotFound.New(id)
+    }
+
+    access.poll, err = ctx.Availability.FindById(reqCtx, pollId)
+    if err == models.ErrNotFound {
+        return access, models.ErrPollNotFound.New(id)
+    } else if err != nil {
+        return access, internalError(reqCtx, models.ErrFindingPoll, "finding availability poll", err)
+    }
+
+    access.squad.squad, err = ctx.Squads.FindById(reqCtx, access.poll.SquadID)
+    if err != nil {
+        return access, internalError(reqCtx, models.ErrFindingPoll, "finding poll squad", err)
+    }
+
+    access.squad.membership, err = ctx.Squads.FindMembership(reqCtx, access.poll.SquadID, viewerId)
+    if err == models.ErrNotFound {
+        access.squad.membership = nil
+    } else if err != nil {
+        return access, internalError(reqCtx, models.ErrFindingPoll, "finding squad membership", err)
+    }
+
+    if squadPolicy(ctx).Allows(access.squad.role(), models.PermRSVP) == false {
+        return access, models.ErrPollNotFound.New(id)
+    }
+
+    return access, nil
+}
+
+// list returns a squad's polls.
+func (h AvailabilityHandler) list (reqCtx context.Context, ctx *models.AppContext, r *http.Request, viewer *db.User) (interface{}, *models.APIError) {
+    id := r.URL.Query().Get("squad_id")
+    if id == "" {
+        return nil, models.ErrMissingField.New("squad_id")
+    }
+
+    access, apiErr := loadSquad(reqCtx, ctx, id, viewer.ID)
+    if apiErr != nil {
+        return nil, apiErr
+    } else if apiErr := squadPolicy(ctx).Check(access.role(), models.PermRSVP); apiErr != nil {
+        return nil, apiErr
+    }
+
+    polls, err := ctx.Availability.FindBySquad(reqCtx, access.squad.ID)
+    if err != nil {
+        return nil, internalError(reqCtx, models.ErrFindingPoll, "listing availability polls", err)
+    }
+
+    if polls == nil {
+        polls = []db.AvailabilityPoll{}
+    }
+
+    return availabilityPollsResponse{polls}, nil
+}
+
+// Time proposed by an availability poll, in RFC 3339 format
+type slotRequest struct {
+    StartsAt string `json:"starts_at"`
+    EndsAt string `json:"ends_at"`
+}
+
+// Body of a request to create an availability poll
+type availabilityPollRequest struct {
+    SquadID int `json:"squad_id"`
+    Title *string `json:"title"`
+    Description *string `json:"description"`
+    // Defaults to the creator's time zone
+    Timezone *string `json:"timezone"`
+    Slots []slotRequest `json:"slots"`
+}
+
+// create saves a new availability poll created by the viewer.
+func (h AvailabilityHandler) create (reqCtx context.Context, ctx *models.AppContext, r *http.Request, viewer *db.User) (interface{}, *models.APIError) {
+    var req availabilityPollRequest
+    if apiErr := decodeJSONBody(r, &req); apiErr != nil {
+        return nil, apiErr
+    }
+
+    if req.SquadID == 0 {
+        return nil, models.ErrMissingField.New("squad_id")
+    }
+
+    access, apiErr := loadSquad(reqCtx, ctx, strconv.Itoa(req.SquadID), viewer.ID)
+    if apiErr != nil {
+        return nil, apiErr
+    } else if apiErr := squadPolicy(ctx).Check(access.role(), models.PermCreateEvents); apiErr != nil {
+        return nil, apiErr
+    } else if access.squad.Archived() {
+        return nil, models.ErrSquadArchived.New()
+    }
+
+    poll := db.AvailabilityPoll{
+        SquadID: access.squad.ID,
+        CreatorID: viewer.ID,
+        Timezone: viewer.Timezone,
+        Status: db.AvailabilityPollOpen,
+    }
+    if poll.Timezone == "" {
+        poll.Timezone = "UTC"
+    }
+
+    apiErr = applyTextFields([]textField{
+        {"title", req.Title, maxEventTitleLength, &poll.Title},
+        {"description", req.Description, maxEventDescriptionLength, &poll.Description},
+    })
+    if apiErr != nil {
+        return nil, apiErr
+    } else if poll.Title == "" {
+        return nil, models.ErrMissingField.New("title")
+    }
+
+    if req.Timezone != nil {
+        if poll.Timezone, apiErr = parseTimezone(*req.Timezone); apiErr != nil {
+            return nil, apiErr
+        }
+    }
+
+    if len(req.Slots) == 0 {
+        return nil, models.ErrMissingField.New("slots")
+    } else if len(req.Slots) > maxPollSlots {
+        return nil, models.ErrFieldOutOfRange.New("slots", "1", strconv.Itoa(maxPollSlots))
+    }
+
+    for _, s := range req.Slots {
+        var slot db.AvailabilitySlot
+        if slot.StartsAt, apiErr = parseTime("starts_at", s.StartsAt); apiErr != nil {
+            return nil, apiErr
+        } else if slot.EndsAt, apiErr = parseTime("ends_at", s.EndsAt); apiErr != nil {
+            return nil, apiErr
+        } else if slot.EndsAt.After(slot.StartsAt) == false {
+            return nil, models.ErrInvalidTimeRange.New("starts_at", "ends_at")
+        }
+
+        poll.Slots = append(poll.Slots, slot)
+    }
+
+    if err := ctx.Availability.Create(reqCtx, &poll); err != nil {
+        return nil, internalError(reqCtx, models.ErrSavingPoll, "creating availability poll", err)
+    }
+
+    return availabilityPollResponse{Poll: poll, Ranking: []models.SlotRanking{}, Votes: map[string]string{}}, nil
+}
+
+// view returns a poll with its slots ranked by how well they work for the squad's members.
+func (h AvailabilityHandler) view (reqCtx context.Context, ctx *models.AppContext, access pollAccess, viewer *db.User) (interface{}, *models.APIError) {
+    votes, err := ctx.Availability.FindVotes(reqCtx, access.poll.ID)
+    if err != nil {
+        return nil, internalError(reqCtx, models.ErrFindingPoll, "listing availability votes", err)
+    }
+
+    memberships, err := ctx.Squads.FindMemberships(reqCtx, access.poll.SquadID)
+    if err != nil {
+        return nil, internalError(reqCtx, models.ErrFindingPoll, "listing squad members", err)
+    }
+
+    // Members who can vote are expected to
+    policy := squadPolicy(ctx)
+    var voters []int
+    for _, membership := range memberships {
+        if policy.Allows(membership.Role, models.PermRSVP) {
+            voters = append(voters, membership.UserID)
+        }
+    }
+
+    resp := availabilityPollResponse{
+        Poll: *access.poll,
+        Ranking: models.RankSlots(access.poll.Slots, votes, voters),
+        Votes: make(map[string]string),
+    }
+
+    for _, vote := range votes {
+        if vote.UserID == viewer.ID {
+            resp.Votes[strconv.Itoa(vote.SlotID)] = vote.Answer
+        }
+    }
+
+    return resp, nil
+}
+
+// Body of a request to vote in an availability poll. Slots which are not included are left unanswered.
+type voteRequest struct {
+    // Answers by slot id, one of the db.Availability answer constants
+    Votes map[string]string `json:"votes"`
+}
+
+// vote replaces the viewer's answers in a poll.
+func (h AvailabilityHandler) vote (reqCtx context.Context, ctx *models.AppContext, r *http.Request, access pollAccess, viewer *db.User) (interface{}, *models.APIError) {
+    if access.poll.Finalized() {
+        return nil, models.ErrPollClosed.New()
+    } else if access.squad.squad.Archived() {
+        return nil, models.ErrSquadArchived.New()
+    }
+
+    var req voteRequest
+    if apiErr := decodeJSONBody(r, &req); apiErr != nil {
+        return nil, apiErr
+    }
+
+    var votes []db.AvailabilityVote
+    for id, answer := range req.Votes {
+        slotId, err := strconv.Atoi(id)
+        if err != nil || hasSlot(*access.poll, slotId) == false {
+            return nil, models.ErrSlotNotFound.New(id)
+        }
+
+        answer = strings.TrimSpace(answer)
+        if answer != db.AvailabilityYes && answer != db.AvailabilityIfNeedBe && answer != db.AvailabilityNo {
+            return nil, models.ErrInvalidChoice.New("answer", answer, strings.Join(availabilityAnswers, ", "))
+        }
+
+        votes = append(votes, db.AvailabilityVote{SlotID: slotId, Answer: answer})
+    }
+
+    err := ctx.Availability.Vote(reqCtx, access.poll.ID, viewer.ID, votes)
+    if err == models.ErrPollFinalized {
+        return nil, models.ErrPollClosed.New()
+    } else if err != nil {
+        return nil, internalError(reqCtx, models.ErrSavingPoll, "saving availability votes", err)
+    }
+
+    return h.view(reqCtx, ctx, access, viewer)
+}
+
+// hasSlot reports if a poll proposes the slot with the provided id.
+func hasSlot (poll db.AvailabilityPoll, slotId int) bool {
+    for _, slot := range poll.Slots {
+        if slot.ID == slotId {
+            return true
+        }
+    }
+
+    return false
+}
+
+// Body of a request to finalize an availability poll
+type finalizeRequest struct {
+    SlotID int `json:"slot_id"`
+}
+
+// finalize picks one of a poll's slots and creates a squad event at that time. The poll is closed so votes no longer
+// change.
+func (h AvailabilityHandler) finalize (reqCtx context.Context, ctx *models.AppContext, r *http.Request, access pollAccess, viewer *db.User) (interface{}, *models.APIError) {
+    if apiErr := access.checkManageable(ctx, viewer.ID); apiErr != nil {
+        return nil, apiErr
+    } else if access.poll.Finalized() {
+        return nil, models.ErrPollClosed.New()
+    }
+
+    var req finalizeRequest
+    if apiErr := decodeJSONBody(r, &req); apiErr != nil {
+        return nil, apiErr
+    }
+
+    var slot *db.AvailabilitySlot
+    for i := range access.poll.Slots {
+        if access.poll.Slots[i].ID == req.SlotID {
+            slot = &access.poll.Slots[i]
+        }
+    }
+
+    if req.SlotID == 0 {
+        return nil, models.ErrMissingField.New("slot_id")
+    } else if slot == nil {
+        return nil, models.ErrSlotNotFound.New(strconv.Itoa(req.SlotID))
+    }
+
+    poll := access.poll
+    event := db.Event{
+        Title: poll.Title,
+        Description: poll.Description,
+        StartsAt: slot.StartsAt,
+        EndsAt: slot.EndsAt,
+        Timezone: poll.Timezone,
+        Visibility: db.EventVisibilityPrivate,
+        Status: db.EventStatusScheduled,
+        CreatorID: viewer.ID,
+        SquadID: &poll.SquadID,
+    }
+
+    err := ctx.Transaction(reqCtx, func (tx *models.AppContext) error {
+        if err := tx.Events.Create(reqCtx, &event); err != nil {
+            return err
+        }
+
+        err := tx.Availability.Finalize(reqCtx, poll.ID, event.ID)
+        if err == models.ErrPollFinalized {
+            return models.ErrPollClosed.New()
+        }
+
+        return err
+    })
+    if err != nil {
+        return nil, transactionError(reqCtx, models.ErrSavingPoll, "finalizing availability poll", err)
+    }
+
+    return eventResponse{event}, nil
+}
+
+// remove deletes a poll. Events created from finalized polls are kept.
+func (h AvailabilityHandler) remove (reqCtx context.Context, ctx *models.AppContext, access pollAccess, viewer *db.User) (interface{}, *models.APIError) {
+    if apiErr := access.checkManageable(ctx, viewer.ID); apiErr != nil {
+        return nil, apiErr
+    }
+
+    if err := ctx.Availability.Delete(reqCtx, access.poll.ID); err != nil {
+        return nil, internalError(reqCtx, models.ErrSavingPoll, "deleting availability poll", err)
+    }
+
+    now := time.Now()
+    access.poll.DeletedAt = &now
+
+    return availabilityPollResponse{Poll: *access.poll, Ranking: []models.SlotRanking{}, Votes: map[string]string{}}, nil
+}
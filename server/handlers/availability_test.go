@@ -0,0 +1,80 @@
+package handlers_test
+
+import (
+    "context"
+    "net/http"
+    "strconv"
+    "testing"
+
+    "github.com/Noah-Huppert/squad-up/server/apitest"
+    "github.com/Noah-Huppert/squad-up/server/models"
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+    "github.com/stretchr/testify/assert"
+)
+
+func TestAvailabilityHandler(t *testing.T) {
+    a := assert.New(t)
+    h := apitest.New(t)
+    defer h.Close()
+
+    _, ownerToken := h.SeedUser(db.User{FirstName: "Jane", Email: "jane@example.com", Timezone: "America/New_York"})
+    member, memberToken := h.SeedUser(db.User{FirstName: "John", Email: "john@example.com"})
+    _, strangerToken := h.SeedUser(db.User{FirstName: "Eve"})
+
+    squadId := createSquad(h, ownerToken, map[string]string{"name": "Hikers"})
+    a.Nil(h.Ctx.Squads.AddMember(context.Background(), &db.SquadMembership{SquadID: squadId, UserID: member.ID, Role: db.SquadRoleMember}))
+
+    body := map[string]interface{}{
+        "squad_id": squadId,
+        "title": "Hike",
+        "slots": []map[string]string{
+            {"starts_at": "2030-06-01T09:00:00-04:00", "ends_at": "2030-06-01T13:00:00-04:00"},
+            {"starts_at": "2030-06-02T09:00:00-04:00", "ends_at": "2030-06-02T13:00:00-04:00"},
+        },
+    }
+
+    // Members can not create polls
+    h.DoJSON(http.MethodPost, "/api/v1/availability-polls", memberToken, body).AssertError(http.StatusForbidden, models.ErrPermissionDenied.Id)
+
+    var poll db.AvailabilityPoll
+    res := h.DoJSON(http.MethodPost, "/api/v1/availability-polls", ownerToken, body)
+    res.AssertOK()
+    res.Decode("poll", &poll)
+    a.Len(poll.Slots, 2)
+    a.Equal("America/New_York", poll.Timezone)
+
+    path := "/api/v1/availability-polls/" + strconv.Itoa(poll.ID)
+    saturday, sunday := strconv.Itoa(poll.Slots[0].ID), strconv.Itoa(poll.Slots[1].ID)
+
+    h.Get(path, strangerToken).AssertError(http.StatusNotFound, models.ErrPollNotFound.Id)
+    a.Len(h.Get("/api/v1/availability-polls?squad_id=" + strconv.Itoa(squadId), memberToken).AssertOK()["polls"], 1)
+
+    // Vote
+    h.DoJSON(http.MethodPut, path + "/votes/me", memberToken, map[string]interface{}{"votes": map[string]string{"0": "yes"}}).AssertError(http.StatusUnprocessableEntity, models.ErrSlotNotFound.Id)
+    h.DoJSON(http.MethodPut, path + "/votes/me", memberToken, map[string]interface{}{"votes": map[string]string{saturday: "sure"}}).AssertError(http.StatusUnprocessableEntity, models.ErrInvalidChoice.Id)
+
+    h.DoJSON(http.MethodPut, path + "/votes/me", memberToken, map[string]interface{}{"votes": map[string]string{saturday: "if_need_be", sunday: "yes"}}).AssertOK()
+    env := h.DoJSON(http.MethodPut, path + "/votes/me", ownerToken, map[string]interface{}{"votes": map[string]string{saturday: "yes"}}).AssertOK()
+    a.Equal(map[string]interface{}{saturday: "yes"}, env["votes"])
+
+    // If need be answers count for half, the owner has not answered for Sunday
+    ranking := env["ranking"].([]interface{})
+    best, second := ranking[0].(map[string]interface{}), ranking[1].(map[string]interface{})
+    a.Equal(float64(poll.Slots[0].ID), best["slot"].(map[string]interface{})["id"])
+    a.Equal(1.5, best["score"])
+    a.Len(best["missing"], 0)
+    a.Equal(1.0, second["score"])
+    a.Len(second["missing"], 1)
+
+    // Finalize, which creates an event and closes the poll
+    h.DoJSON(http.MethodPost, path + "/finalize", memberToken, map[string]int{"slot_id": poll.Slots[1].ID}).AssertError(http.StatusForbidden, models.ErrPermissionDenied.Id)
+
+    event := h.DoJSON(http.MethodPost, path + "/finalize", ownerToken, map[string]int{"slot_id": poll.Slots[1].ID}).AssertOK()["event"].(map[string]interface{})
+    a.Equal("Hike", event["title"])
+    a.Equal("2030-06-02T13:00:00Z", event["starts_at"])
+    a.Equal(float64(squadId), event["squad_id"])
+
+    a.Equal(event["id"], h.Get(path, memberToken).AssertOK()["poll"].(map[string]interface{})["event_id"])
+    h.DoJSON(http.MethodPut, path + "/votes/me", memberToken, map[string]interface{}{"votes": map[string]string{saturday: "no"}}).AssertError(http.StatusConflict, models.ErrPollClosed.Id)
+    h.DoJSON(http.MethodPost, path + "/finalize", ownerToken, map[string]int{"slot_id": poll.Slots[0].ID}).AssertError(http.StatusConflict, models.ErrPollClosed.Id)
+}
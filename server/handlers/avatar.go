@@ -0,0 +1,251 @@
+package handlers
+
+import (
+    "bytes"
+    "context"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "net/http"
+    "path"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/Noah-Huppert/squad-up/server/imaging"
+    "github.com/Noah-Huppert/squad-up/server/models"
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+)
+
+// Path profile pictures are uploaded to
+const avatarUploadPath = "/api/v1/users/me/avatar"
+
+// Path avatar thumbnails are served from. Thumbnails are served from the blob with the key of the path without the
+// leading slash.
+const avatarsPath = "/avatars/"
+
+// Max size of an uploaded profile picture file
+const maxAvatarBytes = 5 << 20// 5 MB
+
+// Max size of the parts of an upload request other than the file
+const maxMultipartOverheadBytes = 64 << 10
+
+// Max dimensions of an uploaded profile picture, in pixels
+const maxAvatarPixels = 24000000
+
+// Width of each square thumbnail generated from an uploaded profile picture. db.User.ProfilePictureUrl is the last
+// one.
+var avatarSizes = []int{64, 128, 256}
+
+// Thumbnails never change once uploaded, a new picture gets a new version
+const avatarCacheControl = "public, max-age=31536000, immutable"
+
+// AvatarHandler lets users upload their own profile picture.
+//
+// POST /api/v1/users/me/avatar takes the picture as the "picture" file of a multipart form. Square thumbnails are
+// generated from it in each of the avatarSizes, and the user's profile picture is set to the largest.
+//
+// DELETE /api/v1/users/me/avatar removes an uploaded profile picture.
+type AvatarHandler struct {}
+
+type avatarResponse struct {
+    User db.User `json:"user"`
+    // URLs of thumbnails by their width
+    Thumbnails map[string]string `json:"thumbnails"`
+}
+
+func (h AvatarHandler) Serve (reqCtx context.Context, ctx *models.AppContext, r *http.Request) (interface{}, *models.APIError) {
+    user, apiErr := currentUser(reqCtx, ctx, r)
+    if apiErr != nil {
+        return nil, apiErr
+    }
+
+    return methodHandlers{
+        http.MethodPost: func () (interface{}, *models.APIError) {
+            return h.upload(reqCtx, ctx, r, user)
+        },
+        http.MethodDelete: func () (interface{}, *models.APIError) {
+            return h.remove(reqCtx, ctx, user)
+        },
+    }.serveMethod(r)
+}
+
+// upload saves thumbnails of the uploaded picture and sets it as the user's profile picture.
+func (h AvatarHandler) upload (reqCtx context.Context, ctx *models.AppContext, r *http.Request, user *db.User) (interface{}, *models.APIError) {
+    prefix := userAvatarPrefix(user.ID)
+
+    version, thumbnails, apiErr := saveAvatarUpload(reqCtx, ctx, r, prefix)
+    if apiErr != nil {
+        return nil, apiErr
+    }
+
+    oldVersion := user.AvatarVersion
+    user.AvatarVersion = version
+    user.ProfilePictureUrl = largestThumbnail(prefix, version)
+
+    if err := ctx.Users.Update(reqCtx, user); err != nil {
+        deleteAvatar(ctx, prefix, version)
+        return nil, avatarSaveError(reqCtx, err)
+    }
+
+    deleteAvatar(ctx, prefix, oldVersion)
+
+    return avatarResponse{*user, thumbnails}, nil
+}
+
+// saveAvatarUpload reads the picture uploaded as the "picture" file of a multipart form, and saves square thumbnails
+// of it in each of the avatarSizes. Thumbnails are saved under a new version, so cached thumbnails of an old picture
+// are not served. Returns the version and the URLs of the thumbnails by their width.
+func saveAvatarUpload (reqCtx context.Context, ctx *models.AppContext, r *http.Request, prefix string) (string, map[string]string, *models.APIError) {
+    tooLargeErr := models.ErrAvatarTooLarge.New(strconv.Itoa(maxAvatarBytes >> 20) + " MB")
+
+    if r.ContentLength > maxAvatarBytes + maxMultipartOverheadBytes {
+        return "", nil, tooLargeErr
+    }
+
+    // Read picture
+    r.Body = http.MaxBytesReader(nil, r.Body, maxAvatarBytes + maxMultipartOverheadBytes)
+
+    file, _, err := r.FormFile("picture")
+    if err == http.ErrMissingFile {
+        return "", nil, models.ErrMissingParam.New("picture")
+    } else if err != nil {
+        return "", nil, models.ErrInvalidMultipartBody.New()
+    }
+    defer file.Close()
+
+    data, err := ioutil.ReadAll(io.LimitReader(file, maxAvatarBytes + 1))
+    if err != nil {
+        return "", nil, models.ErrReadingRequestBody.New()
+    } else if len(data) > maxAvatarBytes {
+        return "", nil, tooLargeErr
+    }
+
+    // Decoding and re-encoding the picture strips its metadata
+    img, err := imaging.Decode(data, maxAvatarPixels)
+    if err == imaging.ErrTooManyPixels {
+        return "", nil, models.ErrImageTooManyPixels.New(strconv.Itoa(maxAvatarPixels / 1000000))
+    } else if err != nil {
+        return "", nil, models.ErrUnsupportedImageType.New(strings.Join(imaging.Formats, ", "))
+    }
+
+    version := strconv.FormatInt(time.Now().UnixNano(), 36)
+    thumbnails := make(map[string]string, len(avatarSizes))
+
+    for _, size := range avatarSizes {
+        if ctxErr := models.ContextError(reqCtx); ctxErr != nil {
+            deleteAvatar(ctx, prefix, version)
+            return "", nil, ctxErr
+        }
+
+        thumb, err := imaging.EncodePNG(imaging.Thumbnail(img, size))
+        if err == nil {
+            err = ctx.Blobs.Put(reqCtx, avatarKey(prefix, version, size), "image/png", thumb)
+        }
+        if err != nil {
+            deleteAvatar(ctx, prefix, version)
+            return "", nil, avatarSaveError(reqCtx, err)
+        }
+
+        thumbnails[strconv.Itoa(size)] = "/" + avatarKey(prefix, version, size)
+    }
+
+    return version, thumbnails, nil
+}
+
+// remove deletes the user's uploaded profile picture.
+func (h AvatarHandler) remove (reqCtx context.Context, ctx *models.AppContext, user *db.User) (interface{}, *models.APIError) {
+    oldVersion := user.AvatarVersion
+    if oldVersion == "" {
+        return userResponse{*user}, nil
+    }
+
+    user.AvatarVersion = ""
+    user.ProfilePictureUrl = ""
+
+    if err := ctx.Users.Update(reqCtx, user); err != nil {
+        return nil, avatarSaveError(reqCtx, err)
+    }
+
+    deleteAvatar(ctx, userAvatarPrefix(user.ID), oldVersion)
+
+    return userResponse{*user}, nil
+}
+
+// avatarSaveError returns the APIError for an error which occurred while saving a profile picture.
+func avatarSaveError (reqCtx context.Context, err error) *models.APIError {
+    if ctxErr := models.ContextError(reqCtx); ctxErr != nil {
+        return ctxErr
+    }
+
+    fmt.Printf("Error saving profile picture: %s\n", err)
+    return models.ErrSavingAvatar.New()
+}
+
+// userAvatarPrefix returns the blob key prefix a user's profile picture thumbnails are saved under.
+func userAvatarPrefix (userId int) string {
+    return path.Join("avatars", strconv.Itoa(userId))
+}
+
+// squadAvatarPrefix returns the blob key prefix a squad's avatar thumbnails are saved under.
+func squadAvatarPrefix (squadId int) string {
+    return path.Join("avatars", "squads", strconv.Itoa(squadId))
+}
+
+// avatarKey returns the blob key of an avatar thumbnail.
+func avatarKey (prefix, version string, size int) string {
+    return path.Join(prefix, version, strconv.Itoa(size) + ".png")
+}
+
+// largestThumbnail returns the URL of the largest thumbnail of an avatar.
+func largestThumbnail (prefix, version string) string {
+    return "/" + avatarKey(prefix, version, avatarSizes[len(avatarSizes) - 1])
+}
+
+// deleteAvatar removes the thumbnails of a version of an avatar. Not cancelled with the request so thumbnails are not
+// left behind. Failures are only logged since the thumbnails are no longer referenced.
+func deleteAvatar (ctx *models.AppContext, prefix, version string) {
+    if version == "" {
+        return
+    }
+
+    for _, size := range avatarSizes {
+        if err := ctx.Blobs.Delete(context.Background(), avatarKey(prefix, version, size)); err != nil {
+            fmt.Printf("Error deleting profile picture thumbnail: %s\n", err)
+        }
+    }
+}
+
+// serveAvatar serves a profile picture thumbnail from the BlobStore.
+func serveAvatar (ctx *models.AppContext, w http.ResponseWriter, r *http.Request) {
+    instrument(avatarsPath, w, r, func (w http.ResponseWriter, r *http.Request) {
+        if isSafeMethod(r.Method) == false {
+            http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+            return
+        }
+
+        key := strings.TrimPrefix(r.URL.Path, "/")
+
+        blob, err := ctx.Blobs.Get(r.Context(), key)
+        if err == models.ErrNotFound || err == models.ErrInvalidBlobKey {
+            http.NotFound(w, r)
+            return
+        } else if err != nil {
+            fmt.Printf("Error loading profile picture thumbnail: %s\n", err)
+            http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+            return
+        }
+
+        w.Header().Set("Content-Type", blob.ContentType)
+        w.Header().Set("Cache-Control", avatarCacheControl)
+        w.Header().Set("ETag", bodyETag(blob.Data))
+        w.Header().Set("X-Content-Type-Options", "nosniff")
+
+        if notModified(r, w.Header().Get("ETag")) {
+            w.WriteHeader(http.StatusNotModified)
+            return
+        }
+
+        http.ServeContent(w, r, path.Base(key), blob.ModTime, bytes.NewReader(blob.Data))
+    })
+}
@@ -0,0 +1,75 @@
+package handlers_test
+
+import (
+    "bytes"
+    "image"
+    "image/png"
+    "mime/multipart"
+    "net/http"
+    "testing"
+
+    "github.com/Noah-Huppert/squad-up/server/apitest"
+    "github.com/Noah-Huppert/squad-up/server/models"
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+    "github.com/stretchr/testify/assert"
+)
+
+// Creates a request which uploads a profile picture
+func uploadRequest (h *apitest.Harness, token string, picture []byte) *http.Request {
+    var body bytes.Buffer
+    form := multipart.NewWriter(&body)
+
+    part, _ := form.CreateFormFile("picture", "me.png")
+    part.Write(picture)
+    form.Close()
+
+    r := h.NewRequest(http.MethodPost, "/api/v1/users/me/avatar", token, &body)
+    r.Header.Set("Content-Type", form.FormDataContentType())
+
+    return r
+}
+
+func TestAvatarHandler(t *testing.T) {
+    a := assert.New(t)
+    h := apitest.New(t)
+    defer h.Close()
+
+    _, token := h.SeedUser(db.User{FirstName: "Jane"})
+
+    var picture bytes.Buffer
+    a.Nil(png.Encode(&picture, image.NewNRGBA(image.Rect(0, 0, 300, 200))))
+
+    res := h.Do(uploadRequest(h, token, picture.Bytes()))
+    env := res.AssertOK()
+
+    thumbnails := env["thumbnails"].(map[string]interface{})
+    a.Len(thumbnails, 3)
+
+    url := env["user"].(map[string]interface{})["profile_picture_url"].(string)
+    a.Equal(thumbnails["256"], url)
+
+    // Thumbnails are served with long lived cache headers
+    thumb := h.Get(url, "")
+    a.Equal(http.StatusOK, thumb.Code)
+    a.Equal("image/png", thumb.Header().Get("Content-Type"))
+    a.Contains(thumb.Header().Get("Cache-Control"), "immutable")
+
+    img, err := png.Decode(thumb.Body)
+    a.Nil(err)
+    a.Equal(image.Rect(0, 0, 256, 256), img.Bounds())
+
+    // Removing picture deletes thumbnails
+    h.DoJSON(http.MethodDelete, "/api/v1/users/me/avatar", token, nil).AssertOK()
+    a.Equal(http.StatusNotFound, h.Get(url, "").Code)
+}
+
+func TestAvatarHandler_Invalid(t *testing.T) {
+    h := apitest.New(t)
+    defer h.Close()
+
+    _, token := h.SeedUser(db.User{FirstName: "Jane"})
+
+    h.Do(uploadRequest(h, token, []byte("not an image"))).AssertError(http.StatusUnsupportedMediaType, models.ErrUnsupportedImageType.Id)
+    h.Do(uploadRequest(h, token, make([]byte, 6 << 20))).AssertError(http.StatusRequestEntityTooLarge, models.ErrAvatarTooLarge.Id)
+    h.DoJSON(http.MethodPost, "/api/v1/users/me/avatar", token, nil).AssertError(http.StatusBadRequest, models.ErrInvalidMultipartBody.Id)
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+    "encoding/json"
+    "io"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+    "unicode/utf8"
+
+    "github.com/Noah-Huppert/squad-up/server/models"
+)
+
+// Max size of a JSON request body
+const maxJSONBodyBytes = 1 << 20// 1 MB
+
+// decodeJSONBody decodes a request's JSON object body into v. Returns a models.ErrInvalidJSONBody error if the body is
+// not a JSON object.
+func decodeJSONBody (r *http.Request, v interface{}) *models.APIError {
+    if err := json.NewDecoder(io.LimitReader(r.Body, maxJSONBodyBytes)).Decode(v); err != nil {
+        return models.ErrInvalidJSONBody.New()
+    }
+
+    return nil
+}
+
+// textField is a text value from a request body which is copied to a model field if it was provided.
+type textField struct {
+    // Name of field in request body
+    field string
+    // Value from request body, nil if not provided
+    value *string
+    // Max length in characters
+    max int
+    // Model field value is copied to
+    dest *string
+}
+
+// applyTextFields trims the provided values and copies them to their model fields. Returns a models.ErrFieldTooLong
+// error if a value is too long.
+func applyTextFields (fields []textField) *models.APIError {
+    for _, f := range fields {
+        if f.value == nil {
+            continue
+        }
+
+        value := strings.TrimSpace(*f.value)
+        if utf8.RuneCountInString(value) > f.max {
+            return models.ErrFieldTooLong.New(f.field, strconv.Itoa(f.max))
+        }
+
+        *f.dest = value
+    }
+
+    return nil
+}
+
+// parseTimezone trims an IANA time zone name and checks it is valid. Returns a models.ErrInvalidTimezone error if it
+// is not. "Local" is not valid since it depends on the server.
+func parseTimezone (timezone string) (string, *models.APIError) {
+    timezone = strings.TrimSpace(timezone)
+    if _, err := time.LoadLocation(timezone); err != nil || timezone == "" || strings.EqualFold(timezone, "Local") {
+        return "", models.ErrInvalidTimezone.New(timezone)
+    }
+
+    return timezone, nil
+}
+
+// parseTime parses an RFC 3339 time from a request and converts it to UTC. Returns a models.ErrInvalidTime error if it
+// is not valid.
+func parseTime (field, value string) (time.Time, *models.APIError) {
+    t, err := time.Parse(time.RFC3339, strings.TrimSpace(value))
+    if err != nil {
+        return time.Time{}, models.ErrInvalidTime.New(field)
+    }
+
+    return t.UTC(), nil
+}
+
+// methodHandlers serves each HTTP method with a different function. Endpoints which support multiple methods return
+// the result of serveMethod from their Serve method.
+type methodHandlers map[string]func () (interface{}, *models.APIError)
+
+// serveMethod calls the function for the request's method. Returns a models.ErrMethodNotAllowed error if the endpoint
+// does not support the method.
+func (m methodHandlers) serveMethod (r *http.Request) (interface{}, *models.APIError) {
+    if serve, ok := m[r.Method]; ok {
+        return serve()
+    }
+
+    allowed := make([]string, 0, len(m))
+    for method := range m {
+        allowed = append(allowed, method)
+    }
+    sort.Strings(allowed)
+
+    return nil, models.ErrMethodNotAllowed.New(r.Method, strings.Join(allowed, ", "))
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+    "bytes"
+    "context"
+    "io"
+    "io/ioutil"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/Noah-Huppert/squad-up/server/ical"
+    "github.com/Noah-Huppert/squad-up/server/models"
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+)
+
+// Path busy block endpoints are registered under
+const busyPath = "/api/v1/busy"
+
+// Limits of calendar imports
+const (
+    maxCalendarBytes = 5 << 20// 5 MB
+    // Max number of busy blocks an import creates, later events are skipped
+    maxImportedBlocks = 5000
+)
+
+// BusyHandler serves the viewer's busy blocks, the times they are not available besides the events they are going to.
+//
+//     GET    /api/v1/busy?from={time}&to={time}  Viewer's busy blocks in a time range, see eventRange
+//     POST   /api/v1/busy                        Add a busy block, see busyRequest
+//     DELETE /api/v1/busy/{id}                   Delete a busy block
+//     PUT    /api/v1/busy/import                 Replace imported busy blocks with the events of the iCalendar file
+//                                                in the request body, for the next year
+//     DELETE /api/v1/busy/import                 Delete imported busy blocks
+//
+// Busy blocks only have times. Other users see them merged with the viewer's events, see FreeBusyHandler.
+type BusyHandler struct {}
+
+type busyBlocksResponse struct {
+    Blocks []db.BusyBlock `json:"busy_blocks"`
+}
+
+type busyBlockResponse struct {
+    Block db.BusyBlock `json:"busy_block"`
+}
+
+type busyImportResponse struct {
+    // Number of busy blocks created
+    Imported int `json:"imported"`
+}
+
+func (h BusyHandler) Serve (reqCtx context.Context, ctx *models.AppContext, r *http.Request) (interface{}, *models.APIError) {
+    viewer, apiErr := currentUser(reqCtx, ctx, r)
+    if apiErr != nil {
+        return nil, apiErr
+    }
+
+    id := strings.Trim(strings.TrimPrefix(r.URL.Path, busyPath), "/")
+
+    switch id {
+    case "":
+        return methodHandlers{
+            http.MethodGet: func () (interface{}, *models.APIError) {
+                return h.list(reqCtx, ctx, r, viewer)
+            },
+            http.MethodPost: func () (interface{}, *models.APIError) {
+                return h.create(reqCtx, ctx, r, viewer)
+            },
+        }.serveMethod(r)
+    case "import":
+        return methodHandlers{
+            http.MethodPut: func () (interface{}, *models.APIError) {
+                return h.importCalendar(reqCtx, ctx, r, viewer)
+            },
+            http.MethodDelete: func () (interface{}, *models.APIError) {
+                if err := ctx.Busy.ReplaceImported(reqCtx, viewer.ID, nil); err != nil {
+                    return nil, internalError(reqCtx, models.ErrSavingBusy, "deleting imported busy blocks", err)
+                }
+
+                return busyImportResponse{0}, nil
+            },
+        }.serveMethod(r)
+    }
+
+    return methodHandlers{
+        http.MethodDelete: func () (interface{}, *models.APIError) {
+            return h.remove(reqCtx, ctx, id, viewer)
+        },
+    }.serveMethod(r)
+}
+
+// list returns the viewer's busy blocks in a time range.
+func (h BusyHandler) list (reqCtx context.Context, ctx *models.AppContext, r *http.Request, viewer *db.User) (interface{}, *models.APIError) {
+    from, to, apiErr := eventRange(r)
+    if apiErr != nil {
+        return nil, apiErr
+    }
+
+    blocks, err := ctx.Busy.Find(reqCtx, []int{viewer.ID}, from, to)
+    if err != nil {
+        return nil, internalError(reqCtx, models.ErrFindingBusy, "listing busy blocks", err)
+    }
+
+    if blocks == nil {
+        blocks = []db.BusyBlock{}
+    }
+
+    return busyBlocksResponse{blocks}, nil
+}
+
+// Body of a request to add a busy block, times are in RFC 3339 format
+type busyRequest struct {
+    StartsAt string `json:"starts_at"`
+    EndsAt string `json:"ends_at"`
+}
+
+// create saves a busy block entered by the viewer.
+func (h BusyHandler) create (reqCtx context.Context, ctx *models.AppContext, r *http.Request, viewer *db.User) (interface{}, *models.APIError) {
+    var req busyRequest
+    if apiErr := decodeJSONBody(r, &req); apiErr != nil {
+        return nil, apiErr
+    }
+
+    block := db.BusyBlock{UserID: viewer.ID, Source: db.BusySourceManual}
+
+    var apiErr *models.APIError
+    if block.StartsAt, apiErr = parseTime("starts_at", req.StartsAt); apiErr != nil {
+        return nil, apiErr
+    } else if block.EndsAt, apiErr = parseTime("ends_at", req.EndsAt); apiErr != nil {
+        return nil, apiErr
+    } else if block.EndsAt.After(block.StartsAt) == false {
+        return nil, models.ErrInvalidTimeRange.New("starts_at", "ends_at")
+    } else if block.EndsAt.Sub(block.StartsAt) > maxEventRangeDays * 24 * time.Hour {
+        return nil, models.ErrTimeRangeTooLong.New(strconv.Itoa(maxEventRangeDays))
+    }
+
+    if err := ctx.Busy.Create(reqCtx, &block); err != nil {
+        return nil, internalError(reqCtx, models.ErrSavingBusy, "creating busy block", err)
+    }
+
+    return busyBlockResponse{block}, nil
+}
+
+// remove deletes one of the viewer's busy blocks. Blocks of other users are not found.
+func (h BusyHandler) remove (reqCtx context.Context, ctx *models.AppContext, id string, viewer *db.User) (interface{}, *models.APIError) {
+    blockId, err := strconv.Atoi(id)
+    if err != nil {
+        return nil, models.ErrBusyBlockNotFound.New(id)
+    }
+
+    block, err := ctx.Busy.FindById(reqCtx, blockId)
+    if err == models.ErrNotFound || (err == nil && block.UserID != viewer.ID) {
+        return nil, models.ErrBusyBlockNotFound.New(id)
+    } else if err != nil {
+        return nil, internalError(reqCtx, models.ErrFindingBusy, "finding busy block", err)
+    }
+
+    if err := ctx.Busy.Delete(reqCtx, block.ID); err != nil {
+        return nil, internalError(reqCtx, models.ErrSavingBusy, "deleting busy block", err)
+    }
+
+    now := time.Now()
+    block.DeletedAt = &now
+
+    return busyBlockResponse{*block}, nil
+}
+
+// importCalendar replaces the viewer's imported busy blocks with the times of the events in an iCalendar file. Only
+// times in the next maxEventRangeDays days are imported, floating times are in the viewer's time zone.
+func (h BusyHandler) importCalendar (reqCtx context.Context, ctx *models.AppContext, r *http.Request, viewer *db.User) (interface{}, *models.APIError) {
+    tooLargeErr := models.ErrCalendarTooLarge.New(strconv.Itoa(maxCalendarBytes >> 20) + " MB")
+    if r.ContentLength > maxCalendarBytes {
+        return nil, tooLargeErr
+    }
+
+    data, err := ioutil.ReadAll(io.LimitReader(r.Body, maxCalendarBytes + 1))
+    if err != nil {
+        return nil, models.ErrInvalidCalendar.New()
+    } else if len(data) > maxCalendarBytes {
+        return nil, tooLargeErr
+    }
+
+    cal, err := ical.Parse(bytes.NewReader(data))
+    if err != nil {
+        return nil, models.ErrInvalidCalendar.New()
+    }
+
+    loc := time.UTC
+    if viewer.Timezone != "" {
+        if userLoc, err := time.LoadLocation(viewer.Timezone); err == nil {
+            loc = userLoc
+        }
+    }
+
+    from := time.Now().UTC()
+    to := from.AddDate(0, 0, maxEventRangeDays)
+
+    var blocks []db.BusyBlock
+    for _, interval := range models.BusyFromCalendar(cal, loc, from, to, maxImportedBlocks) {
+        blocks = append(blocks, db.BusyBlock{StartsAt: interval.Start, EndsAt: interval.End})
+    }
+
+    if err := ctx.Busy.ReplaceImported(reqCtx, viewer.ID, blocks); err != nil {
+        return nil, internalError(reqCtx, models.ErrSavingBusy, "importing busy blocks", err)
+    }
+
+    return busyImportResponse{len(blocks)}, nil
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+    "context"
+    "net/http"
+
+    "github.com/Noah-Huppert/squad-up/server/models"
+)
+
+// ErrorCatalogHandler lists every error the API can return so clients can switch on error ids.
+type ErrorCatalogHandler struct {}
+
+type errorDefResponse struct {
+    Id string `json:"id"`
+    HTTPCode int `json:"http_code"`
+    // Message template in the request's locale
+    Message string `json:"message"`
+    // Names of parameters referenced in the message template
+    Params []string `json:"params"`
+    DocsURL string `json:"docs_url"`
+}
+
+type errorCatalogResponse struct {
+    Errors []errorDefResponse `json:"errors"`
+}
+
+// Serve lists the error catalog with messages in the request's locale.
+func (h ErrorCatalogHandler) Serve (reqCtx context.Context, ctx *models.AppContext, r *http.Request) (interface{}, *models.APIError) {
+    locale := requestLocale(ctx, r)
+
+    resp := errorCatalogResponse{}
+    for _, def := range models.ErrorDefs() {
+        params := def.Params
+        if params == nil {
+            params = []string{}
+        }
+
+        resp.Errors = append(resp.Errors, errorDefResponse{
+            Id: def.Id,
+            HTTPCode: def.HTTPCode,
+            Message: def.Template(locale),
+            Params: params,
+            DocsURL: def.DocsURL(),
+        })
+    }
+
+    return resp, nil
+}
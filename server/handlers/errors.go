@@ -0,0 +1,20 @@
+package handlers
+
+import (
+    "context"
+    "fmt"
+
+    "github.com/Noah-Huppert/squad-up/server/models"
+)
+
+// internalError logs an unexpected error, ex: from a store, and returns the catalog error to serve for it. If the
+// request was cancelled or timed out the error is most likely caused by that, so the request's context error is
+// returned instead.
+func internalError (reqCtx context.Context, def *models.ErrorDef, action string, err error) *models.APIError {
+    if ctxErr := models.ContextError(reqCtx); ctxErr != nil {
+        return ctxErr
+    }
+
+    fmt.Printf("Error %s: %s\n", action, err)
+    return def.New()
+}
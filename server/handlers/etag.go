@@ -0,0 +1,130 @@
+package handlers
+
+import (
+    "crypto/sha1"
+    "encoding/hex"
+    "net/http"
+    "strings"
+
+    "github.com/Noah-Huppert/squad-up/server/models"
+)
+
+// ETagger is implemented by endpoint results which know their own version. If a result returned by
+// EndpointHandler.Serve implements ETagger its ETag is combined with a hash of the response body. The hash makes
+// responses which differ by viewer or expansions have different tags, while the version allows update endpoints to
+// compare the If-Match header against the version of the resource a client received from a GET.
+type ETagger interface {
+    // ETag returns a quoted entity tag, ex: "\"1a2b3c\""
+    ETag() string
+}
+
+// bodyETag computes a strong entity tag from the bytes of a response body.
+func bodyETag(body []byte) string {
+    sum := sha1.Sum(body)
+    return "\"" + hex.EncodeToString(sum[:]) + "\""
+}
+
+// resultETag returns the entity tag for an endpoint result, a hash of the serialized body. If the result implements
+// ETagger its version is put in front of the hash, ex: "\"v1-1a2b3c\"".
+func resultETag(res interface{}, body []byte) string {
+    etag := bodyETag(body)
+
+    if tagger, ok := res.(ETagger); ok {
+        if version := tagger.ETag(); version != "" {
+            return strings.TrimSuffix(version, "\"") + "-" + strings.TrimPrefix(etag, "\"")
+        }
+    }
+
+    return etag
+}
+
+// etagVersion returns the version part of an entity tag made by resultETag. Tags without a body hash are returned as
+// is.
+func etagVersion(etag string) string {
+    if i := strings.LastIndex(etag, "-"); i != -1 && strings.HasSuffix(etag, "\"") {
+        return etag[:i] + "\""
+    }
+
+    return etag
+}
+
+// etagMatches reports if the provided entity tag is listed in the value of an If-Match or If-None-Match header.
+//
+// If weak is true the weak comparison function from RFC 7232 is used (The "W/" prefix is ignored), this is what
+// If-None-Match requires. Otherwise the strong comparison function is used, which If-Match requires.
+func etagMatches(header, etag string, weak bool) bool {
+    header = strings.TrimSpace(header)
+    if header == "" {
+        return false
+    }
+
+    // "*" matches any current representation
+    if header == "*" {
+        return true
+    }
+
+    for _, candidate := range strings.Split(header, ",") {
+        candidate = strings.TrimSpace(candidate)
+
+        if strings.HasPrefix(candidate, "W/") {
+            // Weak tags never match under strong comparison
+            if weak == false {
+                continue
+            }
+
+            candidate = candidate[2:]
+        }
+
+        if candidate == strings.TrimPrefix(etag, "W/") && (weak || strings.HasPrefix(etag, "W/") == false) {
+            return true
+        }
+    }
+
+    return false
+}
+
+// isSafeMethod reports if the HTTP method only retrieves a representation.
+func isSafeMethod(method string) bool {
+    return method == http.MethodGet || method == http.MethodHead
+}
+
+// notModified reports if a response with the provided entity tag does not have to be sent because the client already
+// has it cached.
+func notModified(r *http.Request, etag string) bool {
+    if isSafeMethod(r.Method) == false {
+        return false
+    }
+
+    return etagMatches(r.Header.Get("If-None-Match"), etag, true)
+}
+
+// checkIfMatch should be called by endpoint handlers before they modify a resource. current is the resource as it
+// exists before the modification. Returns a models.ErrPreconditionFailed error if the client sent an If-Match header
+// which does not match the current version of the resource. Requests without an If-Match header are allowed through.
+//
+// Only the version of the listed tags is compared, so a tag received from any representation of the resource matches.
+// Handlers must then save the resource with a store's UpdateIfUnmodified method, see hasIfMatch.
+func checkIfMatch(r *http.Request, current ETagger) *models.APIError {
+    header := r.Header.Get("If-Match")
+    if header == "" {
+        return nil
+    }
+
+    candidates := strings.Split(header, ",")
+    for i, candidate := range candidates {
+        candidates[i] = etagVersion(strings.TrimSpace(candidate))
+    }
+
+    if etagMatches(strings.Join(candidates, ","), current.ETag(), false) == false {
+        return models.ErrPreconditionFailed.New()
+    }
+
+    return nil
+}
+
+// hasIfMatch reports if a request must only modify a resource if it is still the version checkIfMatch checked. If so
+// handlers must save it with a store's UpdateIfUnmodified method, and return a models.ErrPreconditionFailed error if
+// it returns models.ErrModified.
+func hasIfMatch(r *http.Request) bool {
+    return r.Header.Get("If-Match") != ""
+}
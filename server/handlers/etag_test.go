@@ -0,0 +1,122 @@
+package handlers
+
+import (
+    "context"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "github.com/Noah-Huppert/squad-up/server/models"
+    "github.com/stretchr/testify/assert"
+)
+
+// Endpoint handler which always returns the same result
+type staticHandler struct {
+    Result interface{}
+}
+
+func (h staticHandler) Serve (reqCtx context.Context, ctx *models.AppContext, r *http.Request) (interface{}, *models.APIError) {
+    return h.Result, nil
+}
+
+// AppContextProvider which provides an empty context
+type emptyCtxProvider struct {}
+
+func (p emptyCtxProvider) Ctx () *models.AppContext {
+    return &models.AppContext{}
+}
+
+type staticResult struct {
+    Value string `json:"value"`
+}
+
+type versionedResult struct {
+    Value string `json:"value"`
+}
+
+func (v versionedResult) ETag () string {
+    return "\"v1\""
+}
+
+func TestEtagMatches(t *testing.T) {
+    a := assert.New(t)
+
+    a.True(etagMatches("\"abc\"", "\"abc\"", false))
+    a.True(etagMatches("\"xyz\", \"abc\"", "\"abc\"", false))
+    a.True(etagMatches("*", "\"abc\"", false))
+    a.False(etagMatches("", "\"abc\"", true))
+    a.False(etagMatches("\"xyz\"", "\"abc\"", true))
+
+    // Weak tags only match with weak comparison
+    a.True(etagMatches("W/\"abc\"", "\"abc\"", true))
+    a.False(etagMatches("W/\"abc\"", "\"abc\"", false))
+}
+
+func TestHandler_ServeHTTP_ETag(t *testing.T) {
+    a := assert.New(t)
+    h := handler{EndpointHandler: staticHandler{staticResult{"hello"}}, AppContextProvider: emptyCtxProvider{}}
+
+    // First request gets full response with ETag
+    w := httptest.NewRecorder()
+    h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+    etag := w.Header().Get("ETag")
+    a.Equal(http.StatusOK, w.Code)
+    a.NotEmpty(etag)
+
+    // Revalidating with the ETag gets a 304 without a body
+    r := httptest.NewRequest(http.MethodGet, "/", nil)
+    r.Header.Set("If-None-Match", etag)
+
+    w = httptest.NewRecorder()
+    h.ServeHTTP(w, r)
+
+    a.Equal(http.StatusNotModified, w.Code)
+    a.Empty(w.Body.String())
+
+    // Stale ETag gets the full response
+    r = httptest.NewRequest(http.MethodGet, "/", nil)
+    r.Header.Set("If-None-Match", "\"stale\"")
+
+    w = httptest.NewRecorder()
+    h.ServeHTTP(w, r)
+
+    a.Equal(http.StatusOK, w.Code)
+}
+
+func TestHandler_ServeHTTP_ETagger(t *testing.T) {
+    a := assert.New(t)
+    h := handler{EndpointHandler: staticHandler{versionedResult{"hello"}}, AppContextProvider: emptyCtxProvider{}}
+
+    w := httptest.NewRecorder()
+    h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+    // Version is followed by a hash of the body, so other representations of the same version have other tags
+    etag := w.Header().Get("ETag")
+    a.True(strings.HasPrefix(etag, "\"v1-"), etag)
+    a.Equal("\"v1\"", etagVersion(etag))
+
+    h.EndpointHandler = staticHandler{versionedResult{"bye"}}
+    w = httptest.NewRecorder()
+    h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+    a.NotEqual(etag, w.Header().Get("ETag"))
+    a.Equal("\"v1\"", etagVersion(w.Header().Get("ETag")))
+}
+
+func TestCheckIfMatch(t *testing.T) {
+    a := assert.New(t)
+
+    r := httptest.NewRequest(http.MethodPut, "/", nil)
+    a.Nil(checkIfMatch(r, versionedResult{}))
+
+    r.Header.Set("If-Match", "\"v1\"")
+    a.Nil(checkIfMatch(r, versionedResult{}))
+
+    r.Header.Set("If-Match", "\"v0-1a2b\", \"v1-3c4d\"")
+    a.Nil(checkIfMatch(r, versionedResult{}))
+
+    r.Header.Set("If-Match", "\"v0\"")
+    a.Equal(models.ErrPreconditionFailed.Id, checkIfMatch(r, versionedResult{}).Id)
+}
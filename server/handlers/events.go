@@ -0,0 +1,613 @@
+package handlers
+
+import (
+    "context"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/Noah-Huppert/squad-up/server/models"
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+    "github.com/Noah-Huppert/squad-up/server/recur"
+)
+
+// Path event endpoints are registered under
+const eventsPath = "/api/v1/events"
+
+// Max lengths of event fields, in characters
+const (
+    maxEventTitleLength = 100
+    maxEventDescriptionLength = 2000
+    maxEventLocationLength = 200
+)
+
+// Time ranges events are listed for
+const (
+    defaultEventRange = 31 * 24 * time.Hour
+    maxEventRangeDays = 366
+)
+
+// Valid values of db.Event fields which can be set by users
+var (
+    eventVisibilities = []string{db.EventVisibilityPrivate, db.EventVisibilityPublic}
+    eventStatuses = []string{db.EventStatusDraft, db.EventStatusScheduled}
+)
+
+// EventsHandler serves events and their RSVPs.
+//
+//     GET    /api/v1/events                Events the user can see which overlap the ?from and ?to times, by default
+//                                          the next 31 days. ?squad_id only lists one squad's events. Recurring events
+//                                          are listed as their occurrences.
+//     POST   /api/v1/events                Create event, a squad event if "squad_id" is set
+//     GET    /api/v1/events/{id}           View event
+//     PATCH  /api/v1/events/{id}           Edit event
+//     DELETE /api/v1/events/{id}           Delete event
+//     POST   /api/v1/events/{id}/cancel    Cancel event
+//     GET    /api/v1/events/{id}/rsvps     See who is coming
+//     PUT    /api/v1/events/{id}/rsvps/me  Respond, see rsvpRequest
+//     DELETE /api/v1/events/{id}/rsvps/me  Remove response
+//
+// Personal events can only be edited by their creator. Squad events can be edited by their creator while their role
+// has the models.PermCreateEvents permission, and by members whose role has the models.PermManageEvents permission.
+// Drafts can only be seen by the users who can edit them.
+//
+// Recurring events are series which repeat according to their "rrule". Occurrences are addressed with the id of their
+// series and an ?occurrence query parameter set to their original start time, they are only saved as events of their
+// own once they are changed or someone RSVPs. Changes to an occurrence apply to the occurrences selected by the ?scope
+// query parameter: "this" (default), "following" or "all". RSVPs are made to occurrences, not series.
+type EventsHandler struct {}
+
+// Expansions implements ExpandingEndpointHandler.
+func (h EventsHandler) Expansions () map[string]string {
+    return map[string]string{
+        "creator": models.ExpandEventCreator,
+        "squad": models.ExpandEventSquad,
+    }
+}
+
+type eventResponse struct {
+    Event db.Event `json:"event"`
+}
+
+// ETag implements ETagger so PATCH requests can be made conditional on the version of the event a client has.
+func (r eventResponse) ETag () string {
+    return r.Event.ETag()
+}
+
+type eventsResponse struct {
+    Events []db.Event `json:"events"`
+}
+
+// eventAccess is an event loaded for a request and the viewer's role in its squad.
+type eventAccess struct {
+    event *db.Event
+    // Squad of squad events, nil for personal events
+    squad *db.Squad
+    // Viewer's role in the event's squad, empty if they are not a member or it is a personal event
+    role string
+    // Series the event is an occurrence of, nil if it is not an occurrence
+    series *db.Event
+}
+
+// canEdit reports if the viewer can change the event.
+func (a eventAccess) canEdit (policy models.Policy, viewerId int) bool {
+    if a.event.SquadID == nil {
+        return a.event.CreatorID == viewerId
+    }
+
+    return policy.Allows(a.role, models.PermManageEvents) ||
+        (a.event.CreatorID == viewerId && policy.Allows(a.role, models.PermCreateEvents))
+}
+
+// canView reports if the viewer can see the event.
+func (a eventAccess) canView (policy models.Policy, viewerId int) bool {
+    switch {
+    case a.canEdit(policy, viewerId):
+        return true
+    case a.event.Status == db.EventStatusDraft:
+        return false
+    case a.event.Visibility == db.EventVisibilityPublic:
+        return true
+    }
+
+    return a.event.SquadID != nil && a.role != ""
+}
+
+func (h EventsHandler) Serve (reqCtx context.Context, ctx *models.AppContext, r *http.Request) (interface{}, *models.APIError) {
+    viewer, apiErr := currentUser(reqCtx, ctx, r)
+    if apiErr != nil {
+        return nil, apiErr
+    }
+
+    parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, eventsPath), "/"), "/")
+
+    // Collection
+    if parts[0] == "" {
+        return methodHandlers{
+            http.MethodGet: func () (interface{}, *models.APIError) {
+                return h.list(reqCtx, ctx, r, viewer)
+            },
+            http.MethodPost: func () (interface{}, *models.APIError) {
+                return h.create(reqCtx, ctx, r, viewer)
+            },
+        }.serveMethod(r)
+    }
+
+    access, apiErr := loadEvent(reqCtx, ctx, parts[0], viewer.ID, expansions(r)...)
+    if apiErr != nil {
+        return nil, apiErr
+    } else if apiErr := loadOccurrence(reqCtx, ctx, r, &access, expansions(r)...); apiErr != nil {
+        return nil, apiErr
+    }
+
+    switch {
+    case len(parts) == 1:
+        return methodHandlers{
+            http.MethodGet: func () (interface{}, *models.APIError) {
+                return eventResponse{*access.event}, nil
+            },
+            http.MethodPatch: func () (interface{}, *models.APIError) {
+                return h.update(reqCtx, ctx, r, access, viewer)
+            },
+            http.MethodDelete: func () (interface{}, *models.APIError) {
+                return h.remove(reqCtx, ctx, r, access, viewer)
+            },
+        }.serveMethod(r)
+    case len(parts) == 2 && parts[1] == "cancel":
+        return methodHandlers{
+            http.MethodPost: func () (interface{}, *models.APIError) {
+                return h.cancel(reqCtx, ctx, r, access, viewer)
+            },
+        }.serveMethod(r)
+    case len(parts) >= 2 && parts[1] == "rsvps" && access.event.Recurring():
+        return nil, models.ErrOccurrenceRequired.New()
+    case len(parts) == 2 && parts[1] == "rsvps":
+        return methodHandlers{
+            http.MethodGet: func () (interface{}, *models.APIError) {
+                return h.rsvps(reqCtx, ctx, access)
+            },
+        }.serveMethod(r)
+    case len(parts) == 3 && parts[1] == "rsvps" && parts[2] == "me":
+        return methodHandlers{
+            http.MethodPut: func () (interface{}, *models.APIError) {
+                return h.respond(reqCtx, ctx, r, access, viewer)
+            },
+            http.MethodDelete: func () (interface{}, *models.APIError) {
+                return h.unrespond(reqCtx, ctx, access, viewer)
+            },
+        }.serveMethod(r)
+    }
+
+    return nil, models.ErrEndpointNotFound.New(r.URL.Path)
+}
+
+// loadEvent loads the event with the provided id, and the viewer's role in its squad. Events the viewer can not see
+// result in the same models.ErrEventNotFound error as if they did not exist.
+func loadEvent (reqCtx context.Context, ctx *models.AppContext, id string, viewerId int, expand ...string) (eventAccess, *models.APIError) {
+    var access eventAccess
+
+    eventId, err := strconv.Atoi(id)
+    if err != nil {
+        return access, models.ErrEventNotFound.New(id)
+    }
+
+    access.event, err = ctx.Events.FindById(reqCtx, eventId, expand...)
+    if err == models.ErrNotFound {
+        return access, models.ErrEventNotFound.New(id)
+    } else if err != nil {
+        return access, internalError(reqCtx, models.ErrFindingEvent, "finding event", err)
+    }
+
+    if access.event.SquadID != nil {
+        access.squad, err = ctx.Squads.FindById(reqCtx, *access.event.SquadID)
+        if err != nil {
+            return access, internalError(reqCtx, models.ErrFindingEvent, "finding event squad", err)
+        }
+
+        membership, err := ctx.Squads.FindMembership(reqCtx, access.squad.ID, viewerId)
+        if err == nil {
+            access.role = membership.Role
+        } else if err != models.ErrNotFound {
+            return access, internalError(reqCtx, models.ErrFindingEvent, "finding squad membership", err)
+        }
+    }
+
+    if access.canView(squadPolicy(ctx), viewerId) == false {
+        return access, models.ErrEventNotFound.New(id)
+    }
+
+    return access, nil
+}
+
+// checkEditable returns an error if the viewer can not change the event.
+func checkEditable (ctx *models.AppContext, access eventAccess, viewerId int) *models.APIError {
+    if access.canEdit(squadPolicy(ctx), viewerId) == false {
+        return models.ErrPermissionDenied.New(string(models.PermManageEvents))
+    }
+
+    if access.squad != nil && access.squad.Archived() {
+        return models.ErrSquadArchived.New()
+    }
+
+    return nil
+}
+
+// eventRange returns the time range events are listed for, from the ?from and ?to query parameters.
+func eventRange (r *http.Request) (time.Time, time.Time, *models.APIError) {
+    query := r.URL.Query()
+
+    from := time.Now().UTC()
+    if value := query.Get("from"); value != "" {
+        var apiErr *models.APIError
+        if from, apiErr = parseTime("from", value); apiErr != nil {
+            return from, from, apiErr
+        }
+    }
+
+    to := from.Add(defaultEventRange)
+    if value := query.Get("to"); value != "" {
+        var apiErr *models.APIError
+        if to, apiErr = parseTime("to", value); apiErr != nil {
+            return from, to, apiErr
+        }
+    }
+
+    if to.After(from) == false {
+        return from, to, models.ErrInvalidTimeRange.New("from", "to")
+    } else if to.Sub(from) > maxEventRangeDays * 24 * time.Hour {
+        return from, to, models.ErrTimeRangeTooLong.New(strconv.Itoa(maxEventRangeDays))
+    }
+
+    return from, to, nil
+}
+
+// list returns the events the viewer can see in a time range. By default these are their personal events and the
+// events of their squads.
+func (h EventsHandler) list (reqCtx context.Context, ctx *models.AppContext, r *http.Request, viewer *db.User) (interface{}, *models.APIError) {
+    from, to, apiErr := eventRange(r)
+    if apiErr != nil {
+        return nil, apiErr
+    }
+
+    filter := models.EventFilter{From: from, To: to}
+    roles := make(map[int]string)
+
+    if id := r.URL.Query().Get("squad_id"); id != "" {
+        access, apiErr := loadSquad(reqCtx, ctx, id, viewer.ID)
+        if apiErr != nil {
+            return nil, apiErr
+        }
+
+        filter.SquadIDs = []int{access.squad.ID}
+        roles[access.squad.ID] = access.role()
+    } else {
+        memberships, err := ctx.Squads.FindMembershipsByUser(reqCtx, viewer.ID)
+        if err != nil {
+            return nil, internalError(reqCtx, models.ErrFindingEvent, "listing squad memberships", err)
+        }
+
+        filter.PersonalOf = viewer.ID
+        for _, membership := range memberships {
+            filter.SquadIDs = append(filter.SquadIDs, membership.SquadID)
+            roles[membership.SquadID] = membership.Role
+        }
+    }
+
+    events, err := ctx.Events.Find(reqCtx, filter, expansions(r)...)
+    if err != nil {
+        return nil, internalError(reqCtx, models.ErrFindingEvent, "listing events", err)
+    }
+
+    events, apiErr = expandSeries(reqCtx, ctx, events, from, to)
+    if apiErr != nil {
+        return nil, apiErr
+    }
+
+    // Hide drafts the viewer can not edit
+    policy := squadPolicy(ctx)
+    visible := []db.Event{}
+    for i := range events {
+        access := eventAccess{event: &events[i]}
+        if events[i].SquadID != nil {
+            access.role = roles[*events[i].SquadID]
+        }
+
+        if access.canView(policy, viewer.ID) {
+            visible = append(visible, events[i])
+        }
+    }
+
+    return eventsResponse{visible}, nil
+}
+
+// Fields of an event which can be set by the users who can edit it. Fields which are not included in a request are
+// left as is.
+type eventPatch struct {
+    Title *string `json:"title"`
+    Description *string `json:"description"`
+    StartsAt *string `json:"starts_at"`
+    EndsAt *string `json:"ends_at"`
+    Timezone *string `json:"timezone"`
+    // RFC 5545 recurrence rule, with or without the "RRULE:" prefix. Empty to stop repeating. Only series can repeat.
+    RRule *string `json:"rrule"`
+    // Changing the location without providing coordinates clears them
+    Location *string `json:"location"`
+    Latitude *float64 `json:"latitude"`
+    Longitude *float64 `json:"longitude"`
+    // Lowering the capacity does not take seats from users who have them
+    Capacity *int `json:"capacity"`
+    Visibility *string `json:"visibility"`
+    Status *string `json:"status"`
+}
+
+// apply validates an eventPatch and copies its values to an event.
+func (p eventPatch) apply (event *db.Event) *models.APIError {
+    oldLocation := event.Location
+
+    apiErr := applyTextFields([]textField{
+        {"title", p.Title, maxEventTitleLength, &event.Title},
+        {"description", p.Description, maxEventDescriptionLength, &event.Description},
+        {"location", p.Location, maxEventLocationLength, &event.Location},
+    })
+    if apiErr != nil {
+        return apiErr
+    }
+
+    if event.Title == "" {
+        return models.ErrMissingField.New("title")
+    }
+
+    // Times
+    if p.StartsAt != nil {
+        if event.StartsAt, apiErr = parseTime("starts_at", *p.StartsAt); apiErr != nil {
+            return apiErr
+        }
+    } else if event.StartsAt.IsZero() {
+        return models.ErrMissingField.New("starts_at")
+    }
+
+    if p.EndsAt != nil {
+        if event.EndsAt, apiErr = parseTime("ends_at", *p.EndsAt); apiErr != nil {
+            return apiErr
+        }
+    } else if event.EndsAt.IsZero() {
+        return models.ErrMissingField.New("ends_at")
+    }
+
+    if event.EndsAt.After(event.StartsAt) == false {
+        return models.ErrInvalidTimeRange.New("starts_at", "ends_at")
+    }
+
+    if p.Timezone != nil {
+        if event.Timezone, apiErr = parseTimezone(*p.Timezone); apiErr != nil {
+            return apiErr
+        }
+    }
+
+    // Recurrence, occurrences are repeated by their series
+    if p.RRule != nil {
+        value := strings.TrimSpace(*p.RRule)
+        if value == "" {
+            event.RRule = ""
+        } else if rule, err := recur.Parse(value); err != nil || event.Occurrence() {
+            return models.ErrInvalidRRule.New(value)
+        } else {
+            event.RRule = rule.String()
+        }
+    }
+
+    if err := models.SetRecursUntil(event); err != nil {
+        return models.ErrInvalidRRule.New(event.RRule)
+    }
+
+    // Coordinates
+    if p.Latitude != nil || p.Longitude != nil {
+        if p.Latitude == nil {
+            return models.ErrMissingField.New("latitude")
+        } else if p.Longitude == nil {
+            return models.ErrMissingField.New("longitude")
+        } else if *p.Latitude < -90 || *p.Latitude > 90 {
+            return models.ErrFieldOutOfRange.New("latitude", "-90", "90")
+        } else if *p.Longitude < -180 || *p.Longitude > 180 {
+            return models.ErrFieldOutOfRange.New("longitude", "-180", "180")
+        }
+
+        event.Latitude = p.Latitude
+        event.Longitude = p.Longitude
+    } else if event.Location != oldLocation {
+        event.Latitude = nil
+        event.Longitude = nil
+    }
+
+    if p.Capacity != nil {
+        if *p.Capacity < 0 || *p.Capacity > maxEventCapacity {
+            return models.ErrFieldOutOfRange.New("capacity", "0", strconv.Itoa(maxEventCapacity))
+        }
+
+        event.Capacity = *p.Capacity
+    }
+
+    // Choices
+    if p.Visibility != nil {
+        visibility := strings.TrimSpace(*p.Visibility)
+        if visibility != db.EventVisibilityPrivate && visibility != db.EventVisibilityPublic {
+            return models.ErrInvalidChoice.New("visibility", visibility, strings.Join(eventVisibilities, ", "))
+        }
+
+        event.Visibility = visibility
+    }
+
+    if p.Status != nil {
+        status := strings.TrimSpace(*p.Status)
+        if status != db.EventStatusDraft && status != db.EventStatusScheduled {
+            return models.ErrInvalidChoice.New("status", status, strings.Join(eventStatuses, ", "))
+        }
+
+        event.Status = status
+    }
+
+    return nil
+}
+
+// Body of a request to create an event
+type eventRequest struct {
+    eventPatch
+    // Squad the event belongs to, a personal event is created if not set
+    SquadID *int `json:"squad_id"`
+}
+
+// create saves a new event created by the viewer.
+func (h EventsHandler) create (reqCtx context.Context, ctx *models.AppContext, r *http.Request, viewer *db.User) (interface{}, *models.APIError) {
+    var req eventRequest
+    if apiErr := decodeJSONBody(r, &req); apiErr != nil {
+        return nil, apiErr
+    }
+
+    event := db.Event{
+        CreatorID: viewer.ID,
+        Timezone: viewer.Timezone,
+        Visibility: db.EventVisibilityPrivate,
+        Status: db.EventStatusScheduled,
+    }
+    if event.Timezone == "" {
+        event.Timezone = "UTC"
+    }
+
+    if req.SquadID != nil {
+        access, apiErr := loadSquad(reqCtx, ctx, strconv.Itoa(*req.SquadID), viewer.ID)
+        if apiErr != nil {
+            return nil, apiErr
+        }
+
+        if apiErr := squadPolicy(ctx).Check(access.role(), models.PermCreateEvents); apiErr != nil {
+            return nil, apiErr
+        } else if access.squad.Archived() {
+            return nil, models.ErrSquadArchived.New()
+        }
+
+        event.SquadID = &access.squad.ID
+    }
+
+    if apiErr := req.apply(&event); apiErr != nil {
+        return nil, apiErr
+    }
+
+    if err := ctx.Events.Create(reqCtx, &event); err != nil {
+        return nil, internalError(reqCtx, models.ErrSavingEvent, "creating event", err)
+    }
+
+    return eventResponse{event}, nil
+}
+
+// update edits an event.
+func (h EventsHandler) update (reqCtx context.Context, ctx *models.AppContext, r *http.Request, access eventAccess, viewer *db.User) (interface{}, *models.APIError) {
+    if apiErr := checkEditable(ctx, access, viewer.ID); apiErr != nil {
+        return nil, apiErr
+    }
+
+    if access.event.Cancelled() {
+        return nil, models.ErrEventCancelled.New()
+    }
+
+    if apiErr := checkIfMatch(r, access.event); apiErr != nil {
+        return nil, apiErr
+    }
+
+    var patch eventPatch
+    if apiErr := decodeJSONBody(r, &patch); apiErr != nil {
+        return nil, apiErr
+    }
+
+    scope, apiErr := eventScope(r, access)
+    if apiErr != nil {
+        return nil, apiErr
+    } else if scope != scopeThis {
+        return h.updateSeries(reqCtx, ctx, access, scope, patch)
+    }
+
+    oldCapacity := access.event.Capacity
+    if apiErr := patch.apply(access.event); apiErr != nil {
+        return nil, apiErr
+    }
+
+    var err error
+    if hasIfMatch(r) && access.unsaved() == false {
+        err = ctx.Events.UpdateIfUnmodified(reqCtx, access.event)
+    } else {
+        err = saveEvent(reqCtx, ctx, access, access.event)
+    }
+
+    if err == models.ErrModified {
+        return nil, models.ErrPreconditionFailed.New()
+    } else if err != nil {
+        return nil, internalError(reqCtx, models.ErrSavingEvent, "saving event", err)
+    }
+
+    // Seats added to the event go to waitlisted users
+    if access.event.Capacity != oldCapacity {
+        promoted, err := ctx.RSVPs.Reseat(reqCtx, access.event.ID)
+        if err != nil {
+            return nil, internalError(reqCtx, models.ErrSavingRSVP, "seating waitlisted rsvps", err)
+        }
+
+        notifyPromoted(ctx, *access.event, promoted)
+    }
+
+    return eventResponse{*access.event}, nil
+}
+
+// cancel marks an event as not taking place. Cancelled events are kept so attendees can see what happened to them.
+func (h EventsHandler) cancel (reqCtx context.Context, ctx *models.AppContext, r *http.Request, access eventAccess, viewer *db.User) (interface{}, *models.APIError) {
+    if apiErr := checkEditable(ctx, access, viewer.ID); apiErr != nil {
+        return nil, apiErr
+    }
+
+    scope, apiErr := eventScope(r, access)
+    if apiErr != nil {
+        return nil, apiErr
+    } else if scope != scopeThis {
+        return h.cancelSeries(reqCtx, ctx, access, scope)
+    }
+
+    event := access.event
+    if event.Cancelled() {
+        return eventResponse{*event}, nil
+    }
+
+    now := time.Now()
+    event.Status = db.EventStatusCancelled
+    event.CancelledAt = &now
+
+    if err := saveEvent(reqCtx, ctx, access, event); err != nil {
+        return nil, internalError(reqCtx, models.ErrSavingEvent, "cancelling event", err)
+    }
+
+    return eventResponse{*event}, nil
+}
+
+// remove deletes an event.
+func (h EventsHandler) remove (reqCtx context.Context, ctx *models.AppContext, r *http.Request, access eventAccess, viewer *db.User) (interface{}, *models.APIError) {
+    if apiErr := checkEditable(ctx, access, viewer.ID); apiErr != nil {
+        return nil, apiErr
+    }
+
+    scope, apiErr := eventScope(r, access)
+    switch {
+    case apiErr != nil:
+        return nil, apiErr
+    case scope != scopeThis:
+        return h.removeSeries(reqCtx, ctx, access, scope)
+    case access.series != nil:
+        return h.removeOccurrence(reqCtx, ctx, access)
+    }
+
+    if err := ctx.Events.Delete(reqCtx, access.event.ID); err != nil {
+        return nil, internalError(reqCtx, models.ErrSavingEvent, "deleting event", err)
+    }
+
+    now := time.Now()
+    access.event.DeletedAt = &now
+
+    return eventResponse{*access.event}, nil
+}
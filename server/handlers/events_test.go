@@ -0,0 +1,201 @@
+package handlers_test
+
+import (
+    "context"
+    "net/http"
+    "strconv"
+    "testing"
+
+    "github.com/Noah-Huppert/squad-up/server/apitest"
+    "github.com/Noah-Huppert/squad-up/server/models"
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+    "github.com/stretchr/testify/assert"
+)
+
+// Creates an event through the API and returns its id
+func createEvent (h *apitest.Harness, token string, body map[string]interface{}) int {
+    res := h.DoJSON(http.MethodPost, "/api/v1/events", token, body)
+
+    var event db.Event
+    res.AssertOK()
+    res.Decode("event", &event)
+
+    return event.ID
+}
+
+func TestEventsHandler(t *testing.T) {
+    a := assert.New(t)
+    h := apitest.New(t)
+    defer h.Close()
+
+    _, token := h.SeedUser(db.User{FirstName: "Jane", Email: "jane@example.com", Timezone: "America/New_York"})
+    _, strangerToken := h.SeedUser(db.User{FirstName: "Eve"})
+
+    id := createEvent(h, token, map[string]interface{}{
+        "title": "Hike",
+        "starts_at": "2030-06-01T09:00:00-04:00",
+        "ends_at": "2030-06-01T13:00:00-04:00",
+        "location": "Blue Hills",
+        "latitude": 42.2,
+        "longitude": -71.1,
+    })
+    path := "/api/v1/events/" + strconv.Itoa(id)
+
+    // Times are stored in UTC with the creator's time zone
+    event := h.Get(path, token).AssertOK()["event"].(map[string]interface{})
+    a.Equal("2030-06-01T13:00:00Z", event["starts_at"])
+    a.Equal("America/New_York", event["timezone"])
+    a.Equal(42.2, event["latitude"])
+
+    // Personal events are private by default
+    h.Get(path, strangerToken).AssertError(http.StatusNotFound, models.ErrEventNotFound.Id)
+
+    // Validation
+    h.DoJSON(http.MethodPatch, path, token, map[string]string{"ends_at": "2030-06-01T08:00:00Z"}).AssertError(http.StatusUnprocessableEntity, models.ErrInvalidTimeRange.Id)
+    h.DoJSON(http.MethodPatch, path, token, map[string]string{"starts_at": "tomorrow"}).AssertError(http.StatusUnprocessableEntity, models.ErrInvalidTime.Id)
+    h.DoJSON(http.MethodPatch, path, token, map[string]string{"status": "done"}).AssertError(http.StatusUnprocessableEntity, models.ErrInvalidChoice.Id)
+
+    // Moving the location clears its coordinates
+    event = h.DoJSON(http.MethodPatch, path, token, map[string]string{"location": "Mount Monadnock"}).AssertOK()["event"].(map[string]interface{})
+    a.Nil(event["latitude"])
+
+    // List by date range
+    a.Len(h.Get("/api/v1/events?from=2030-06-01T00:00:00Z&to=2030-06-02T00:00:00Z", token).AssertOK()["events"], 1)
+    a.Len(h.Get("/api/v1/events?from=2030-06-02T00:00:00Z&to=2030-06-03T00:00:00Z", token).AssertOK()["events"], 0)
+    h.Get("/api/v1/events?from=2030-01-01T00:00:00Z&to=2032-01-01T00:00:00Z", token).AssertError(http.StatusUnprocessableEntity, models.ErrTimeRangeTooLong.Id)
+
+    // Cancelled events can not be edited
+    a.Equal("cancelled", h.DoJSON(http.MethodPost, path + "/cancel", token, nil).AssertOK()["event"].(map[string]interface{})["status"])
+    h.DoJSON(http.MethodPatch, path, token, map[string]string{"title": "Climb"}).AssertError(http.StatusConflict, models.ErrEventCancelled.Id)
+
+    // Delete
+    h.DoJSON(http.MethodDelete, path, token, nil).AssertOK()
+    h.Get(path, token).AssertError(http.StatusNotFound, models.ErrEventNotFound.Id)
+}
+
+func TestEventsHandler_Squad(t *testing.T) {
+    a := assert.New(t)
+    h := apitest.New(t)
+    defer h.Close()
+
+    _, ownerToken := h.SeedUser(db.User{FirstName: "Jane", Email: "jane@example.com"})
+    organizer, organizerToken := h.SeedUser(db.User{FirstName: "John", Email: "john@example.com"})
+    member, memberToken := h.SeedUser(db.User{FirstName: "Bob", Email: "bob@example.com"})
+
+    squadId := createSquad(h, ownerToken, map[string]string{"name": "Hikers"})
+    a.Nil(h.Ctx.Squads.AddMember(context.Background(), &db.SquadMembership{SquadID: squadId, UserID: organizer.ID, Role: db.SquadRoleOrganizer}))
+    a.Nil(h.Ctx.Squads.AddMember(context.Background(), &db.SquadMembership{SquadID: squadId, UserID: member.ID, Role: db.SquadRoleMember}))
+
+    body := map[string]interface{}{
+        "squad_id": squadId,
+        "title": "Hike",
+        "starts_at": "2030-06-01T13:00:00Z",
+        "ends_at": "2030-06-01T17:00:00Z",
+    }
+
+    // Members can not create events
+    h.DoJSON(http.MethodPost, "/api/v1/events", memberToken, body).AssertError(http.StatusForbidden, models.ErrPermissionDenied.Id)
+
+    id := createEvent(h, organizerToken, body)
+    path := "/api/v1/events/" + strconv.Itoa(id)
+
+    // Members see squad events, but can only edit their own
+    a.Len(h.Get("/api/v1/events?from=2030-06-01T00:00:00Z&squad_id=" + strconv.Itoa(squadId), memberToken).AssertOK()["events"], 1)
+    h.DoJSON(http.MethodPatch, path, memberToken, map[string]string{"title": "Mine"}).AssertError(http.StatusForbidden, models.ErrPermissionDenied.Id)
+
+    // Managers can edit any event
+    h.DoJSON(http.MethodPatch, path, ownerToken, map[string]string{"status": "draft"}).AssertOK()
+
+    // Drafts are hidden from members
+    a.Len(h.Get("/api/v1/events?from=2030-06-01T00:00:00Z", memberToken).AssertOK()["events"], 0)
+    h.Get(path, memberToken).AssertError(http.StatusNotFound, models.ErrEventNotFound.Id)
+    a.Len(h.Get("/api/v1/events?from=2030-06-01T00:00:00Z", organizerToken).AssertOK()["events"], 1)
+}
+
+// Returns the events listed for a time range
+func listEvents (h *apitest.Harness, token, from, to string) []map[string]interface{} {
+    var events []map[string]interface{}
+    for _, event := range h.Get("/api/v1/events?from=" + from + "&to=" + to, token).AssertOK()["events"].([]interface{}) {
+        events = append(events, event.(map[string]interface{}))
+    }
+
+    return events
+}
+
+func TestEventsHandler_Recurring(t *testing.T) {
+    a := assert.New(t)
+    h := apitest.New(t)
+    defer h.Close()
+
+    _, token := h.SeedUser(db.User{FirstName: "Jane", Email: "jane@example.com", Timezone: "America/New_York"})
+
+    h.DoJSON(http.MethodPost, "/api/v1/events", token, map[string]interface{}{
+        "title": "Run",
+        "starts_at": "2030-03-05T19:00:00-05:00",
+        "ends_at": "2030-03-05T20:00:00-05:00",
+        "rrule": "FREQ=HOURLY",
+    }).AssertError(http.StatusUnprocessableEntity, models.ErrInvalidRRule.Id)
+
+    // Weekly on Tuesdays at 7 PM, across the start of daylight saving time on March 10th
+    id := createEvent(h, token, map[string]interface{}{
+        "title": "Run",
+        "starts_at": "2030-03-05T19:00:00-05:00",
+        "ends_at": "2030-03-05T20:00:00-05:00",
+        "rrule": "RRULE:FREQ=WEEKLY;BYDAY=TU;COUNT=6",
+    })
+    path := "/api/v1/events/" + strconv.Itoa(id)
+    a.Equal("FREQ=WEEKLY;COUNT=6;BYDAY=TU", h.Get(path, token).AssertOK()["event"].(map[string]interface{})["rrule"])
+
+    events := listEvents(h, token, "2030-03-01T00:00:00Z", "2030-04-01T00:00:00Z")
+    a.Len(events, 4)
+    a.Equal("2030-03-06T00:00:00Z", events[0]["starts_at"])
+    a.Equal("2030-03-12T23:00:00Z", events[1]["starts_at"])
+    a.Equal(float64(id), events[1]["parent_id"])
+
+    // RSVPs are made to occurrences, which are saved with the first response
+    h.DoJSON(http.MethodPut, path + "/rsvps/me", token, map[string]string{"response": "yes"}).AssertError(http.StatusUnprocessableEntity, models.ErrOccurrenceRequired.Id)
+    h.Get(path + "?occurrence=2030-03-13T23:00:00Z", token).AssertError(http.StatusNotFound, models.ErrOccurrenceNotFound.Id)
+
+    second := path + "?occurrence=2030-03-12T23:00:00Z"
+    h.DoJSON(http.MethodPut, "/api/v1/events/" + strconv.Itoa(id) + "/rsvps/me?occurrence=2030-03-12T23:00:00Z", token, map[string]string{"response": "yes"}).AssertOK()
+    occurrence := h.Get(second, token).AssertOK()["event"].(map[string]interface{})
+    a.NotEqual(float64(id), occurrence["id"])
+    a.Equal(float64(id), occurrence["parent_id"])
+
+    // Edit this occurrence
+    h.DoJSON(http.MethodPatch, path + "?occurrence=2030-03-19T23:00:00Z", token, map[string]string{"title": "Long Run"}).AssertOK()
+
+    // Edit all, moving them an hour later on the wall clock. Changes made to single occurrences are kept.
+    h.DoJSON(http.MethodPatch, path + "?occurrence=2030-03-26T23:00:00Z&scope=all", token, map[string]string{
+        "starts_at": "2030-03-26T20:00:00-04:00",
+        "ends_at": "2030-03-26T21:00:00-04:00",
+    }).AssertOK()
+
+    events = listEvents(h, token, "2030-03-01T00:00:00Z", "2030-04-01T00:00:00Z")
+    a.Len(events, 4)
+    a.Equal("2030-03-06T01:00:00Z", events[0]["starts_at"])
+    a.Equal("2030-03-13T00:00:00Z", events[1]["starts_at"])
+    a.Equal(occurrence["id"], events[1]["id"])
+    a.Equal("Long Run", events[2]["title"])
+    a.Len(h.Get("/api/v1/events/" + strconv.Itoa(int(occurrence["id"].(float64))) + "/rsvps", token).AssertOK()["going"], 1)
+
+    // Edit this and following, which splits the series
+    res := h.DoJSON(http.MethodPatch, path + "?occurrence=2030-03-27T00:00:00Z&scope=following", token, map[string]string{"title": "Spring Run"})
+    following := res.AssertOK()["event"].(map[string]interface{})
+    a.NotEqual(float64(id), following["parent_id"])
+    a.Equal("FREQ=WEEKLY;COUNT=3;BYDAY=TU", h.Get(path, token).AssertOK()["event"].(map[string]interface{})["rrule"])
+
+    events = listEvents(h, token, "2030-03-01T00:00:00Z", "2030-05-01T00:00:00Z")
+    a.Len(events, 6)
+    a.Equal("Run", events[0]["title"])
+    a.Equal("Spring Run", events[3]["title"])
+    a.Equal("Spring Run", events[5]["title"])
+
+    // Delete this occurrence, then the rest of the original series
+    h.DoJSON(http.MethodDelete, path + "?occurrence=2030-03-06T01:00:00Z", token, nil).AssertOK()
+    a.Len(listEvents(h, token, "2030-03-01T00:00:00Z", "2030-05-01T00:00:00Z"), 5)
+
+    h.DoJSON(http.MethodDelete, path + "?scope=this", token, nil).AssertError(http.StatusUnprocessableEntity, models.ErrOccurrenceRequired.Id)
+    h.DoJSON(http.MethodDelete, path, token, nil).AssertOK()
+    a.Len(listEvents(h, token, "2030-03-01T00:00:00Z", "2030-05-01T00:00:00Z"), 3)
+}
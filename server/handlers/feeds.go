@@ -0,0 +1,497 @@
+package handlers
+
+import (
+    "bytes"
+    "context"
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "fmt"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/Noah-Huppert/squad-up/server/ical"
+    "github.com/Noah-Huppert/squad-up/server/models"
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+    "github.com/Noah-Huppert/squad-up/server/recur"
+)
+
+// Path calendar feed endpoints are registered under
+const feedsPath = "/api/v1/feeds"
+
+// Path calendar feeds are served from, calendar apps subscribe to /calendars/{token}.ics
+const calendarsPath = "/calendars/"
+
+// Range of events in calendar feeds
+const (
+    // Events which ended up to this many days ago stay in feeds, so they do not disappear from calendars right away
+    feedPastDays = 30
+    // Time zones are defined for this many years after the last event of a feed starts, recurring events go on after
+    feedTimezoneYears = 5
+)
+
+// How often calendar apps should refresh feeds, an iCalendar DURATION
+const feedRefreshInterval = "PT1H"
+
+// FeedsHandler manages the viewer's calendar feeds, secret links calendar apps subscribe to.
+//
+//     GET    /api/v1/feeds       Viewer's feeds
+//     POST   /api/v1/feeds       Create a feed of the viewer's events, or of a squad's events if squad_id is set.
+//                                Replaces the previous feed of the same events, revoking its link.
+//     DELETE /api/v1/feeds/{id}  Revoke a feed
+//
+// Feeds are served without an access token by serveCalendarFeed, the signed token in their link authenticates them.
+type FeedsHandler struct {}
+
+// feedView is a feed with the links calendar apps subscribe to.
+type feedView struct {
+    db.CalendarFeed
+    URL string `json:"url"`
+    // URL with the webcal scheme, which opens calendar apps
+    WebcalURL string `json:"webcal_url"`
+}
+
+type feedResponse struct {
+    Feed feedView `json:"feed"`
+}
+
+type feedsResponse struct {
+    Feeds []feedView `json:"feeds"`
+}
+
+// Body of a request to create a feed
+type feedRequest struct {
+    // Squad whose events the feed covers, the viewer's own events if nil
+    SquadID *int `json:"squad_id"`
+}
+
+// feedToken returns the token which identifies a feed in its link. Tokens are signed so the ids of feeds can not be
+// guessed.
+func feedToken (ctx *models.AppContext, feed db.CalendarFeed) string {
+    return strconv.Itoa(feed.ID) + "." + feedSignature(ctx, feed.ID, feed.Nonce)
+}
+
+// feedSignature returns the signature of a feed's token.
+func feedSignature (ctx *models.AppContext, id int, nonce string) string {
+    mac := hmac.New(sha256.New, []byte(ctx.Config.JWTHMACKey))
+    mac.Write([]byte("calendar-feed:" + strconv.Itoa(id) + ":" + nonce))
+
+    return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// viewFeed returns the feed with its links.
+func viewFeed (ctx *models.AppContext, feed db.CalendarFeed) feedView {
+    link := strings.TrimSuffix(ctx.Config.PublicURL, "/") + calendarsPath + feedToken(ctx, feed) + ".ics"
+
+    webcal := link
+    if i := strings.Index(link, "://"); i >= 0 {
+        webcal = "webcal" + link[i:]
+    }
+
+    return feedView{feed, link, webcal}
+}
+
+func (h FeedsHandler) Serve (reqCtx context.Context, ctx *models.AppContext, r *http.Request) (interface{}, *models.APIError) {
+    viewer, apiErr := currentUser(reqCtx, ctx, r)
+    if apiErr != nil {
+        return nil, apiErr
+    }
+
+    id := strings.Trim(strings.TrimPrefix(r.URL.Path, feedsPath), "/")
+
+    if id == "" {
+        return methodHandlers{
+            http.MethodGet: func () (interface{}, *models.APIError) {
+                return h.list(reqCtx, ctx, viewer)
+            },
+            http.MethodPost: func () (interface{}, *models.APIError) {
+                return h.create(reqCtx, ctx, r, viewer)
+            },
+        }.serveMethod(r)
+    }
+
+    return methodHandlers{
+        http.MethodDelete: func () (interface{}, *models.APIError) {
+            return h.remove(reqCtx, ctx, id, viewer)
+        },
+    }.serveMethod(r)
+}
+
+// list returns the viewer's feeds.
+func (h FeedsHandler) list (reqCtx context.Context, ctx *models.AppContext, viewer *db.User) (interface{}, *models.APIError) {
+    feeds, err := ctx.Feeds.FindByUser(reqCtx, viewer.ID)
+    if err != nil {
+        return nil, internalError(reqCtx, models.ErrFindingFeed, "listing calendar feeds", err)
+    }
+
+    views := []feedView{}
+    for _, feed := range feeds {
+        views = append(views, viewFeed(ctx, feed))
+    }
+
+    return feedsResponse{views}, nil
+}
+
+// create creates a feed of the viewer's events, or of the events of one of their squads.
+func (h FeedsHandler) create (reqCtx context.Context, ctx *models.AppContext, r *http.Request, viewer *db.User) (interface{}, *models.APIError) {
+    var req feedRequest
+    if apiErr := decodeJSONBody(r, &req); apiErr != nil {
+        return nil, apiErr
+    }
+
+    feed := db.CalendarFeed{UserID: viewer.ID}
+
+    if req.SquadID != nil {
+        access, apiErr := loadSquad(reqCtx, ctx, strconv.Itoa(*req.SquadID), viewer.ID)
+        if apiErr != nil {
+            return nil, apiErr
+        } else if access.role() == "" {
+            return nil, models.ErrMemberNotFound.New(strconv.Itoa(viewer.ID))
+        }
+
+        feed.SquadID = &access.squad.ID
+    }
+
+    nonce := make([]byte, 16)
+    if _, err := rand.Read(nonce); err != nil {
+        return nil, internalError(reqCtx, models.ErrSavingFeed, "generating feed nonce", err)
+    }
+    feed.Nonce = base64.RawURLEncoding.EncodeToString(nonce)
+
+    if err := ctx.Feeds.Create(reqCtx, &feed); err != nil {
+        return nil, internalError(reqCtx, models.ErrSavingFeed, "creating calendar feed", err)
+    }
+
+    return feedResponse{viewFeed(ctx, feed)}, nil
+}
+
+// remove revokes one of the viewer's feeds. Feeds of other users are not found.
+func (h FeedsHandler) remove (reqCtx context.Context, ctx *models.AppContext, id string, viewer *db.User) (interface{}, *models.APIError) {
+    feedId, err := strconv.Atoi(id)
+    if err != nil {
+        return nil, models.ErrFeedNotFound.New(id)
+    }
+
+    feed, err := ctx.Feeds.FindById(reqCtx, feedId)
+    if err == models.ErrNotFound || (err == nil && feed.UserID != viewer.ID) {
+        return nil, models.ErrFeedNotFound.New(id)
+    } else if err != nil {
+        return nil, internalError(reqCtx, models.ErrFindingFeed, "finding calendar feed", err)
+    }
+
+    if err := ctx.Feeds.Delete(reqCtx, feed.ID); err != nil {
+        return nil, internalError(reqCtx, models.ErrSavingFeed, "deleting calendar feed", err)
+    }
+
+    now := time.Now()
+    feed.DeletedAt = &now
+
+    return feedResponse{viewFeed(ctx, *feed)}, nil
+}
+
+// findFeed returns the feed identified by a token and its user. Returns models.ErrNotFound if the token is not valid,
+// the feed was revoked, or its user revoked their tokens or deleted their account since it was created.
+func findFeed (reqCtx context.Context, ctx *models.AppContext, token string) (*db.CalendarFeed, *db.User, error) {
+    parts := strings.SplitN(token, ".", 2)
+    if len(parts) != 2 {
+        return nil, nil, models.ErrNotFound
+    }
+
+    id, err := strconv.Atoi(parts[0])
+    if err != nil {
+        return nil, nil, models.ErrNotFound
+    }
+
+    feed, err := ctx.Feeds.FindById(reqCtx, id)
+    if err != nil {
+        return nil, nil, err
+    } else if hmac.Equal([]byte(parts[1]), []byte(feedSignature(ctx, feed.ID, feed.Nonce))) == false {
+        return nil, nil, models.ErrNotFound
+    }
+
+    user, err := ctx.Users.FindById(reqCtx, feed.UserID)
+    if err != nil {
+        return nil, nil, err
+    } else if user.TokensRevokedAt != nil && feed.CreatedAt.Before(*user.TokensRevokedAt) {
+        return nil, nil, models.ErrNotFound
+    }
+
+    return feed, user, nil
+}
+
+// serveCalendarFeed serves the iCalendar file of a feed. Links of feeds which do not exist, or whose user left the
+// squad, are not found.
+func serveCalendarFeed (ctx *models.AppContext, w http.ResponseWriter, r *http.Request) {
+    instrument(calendarsPath, w, r, func (w http.ResponseWriter, r *http.Request) {
+        if isSafeMethod(r.Method) == false {
+            http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+            return
+        }
+
+        token := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, calendarsPath), ".ics")
+
+        feed, user, err := findFeed(r.Context(), ctx, token)
+        var cal ical.Component
+        if err == nil {
+            cal, err = feedCalendar(r.Context(), ctx, *feed, *user)
+        }
+
+        if err == models.ErrNotFound {
+            http.NotFound(w, r)
+            return
+        } else if err != nil {
+            fmt.Printf("Error serving calendar feed: %s\n", err)
+            http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+            return
+        }
+
+        var body bytes.Buffer
+        if err := ical.Write(&body, cal); err != nil {
+            fmt.Printf("Error writing calendar feed: %s\n", err)
+            http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+            return
+        }
+
+        w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+        // Links are secret, shared caches must not keep feeds
+        w.Header().Set("Cache-Control", "private, no-cache")
+        w.Header().Set("ETag", bodyETag(body.Bytes()))
+        w.Header().Set("X-Content-Type-Options", "nosniff")
+
+        if notModified(r, w.Header().Get("ETag")) {
+            w.WriteHeader(http.StatusNotModified)
+            return
+        }
+
+        if r.Method == http.MethodGet {
+            w.Write(body.Bytes())
+        }
+    })
+}
+
+// feedCalendar returns the VCALENDAR of a feed's events, from feedPastDays days ago to maxEventRangeDays days from
+// now. Recurring events are written once with their rule, changed occurrences are written as overrides of their
+// series. Drafts are left out, cancelled events are kept with a CANCELLED status so calendars remove them. Returns
+// models.ErrNotFound if the user is no longer a member of the feed's squad.
+func feedCalendar (reqCtx context.Context, ctx *models.AppContext, feed db.CalendarFeed, user db.User) (ical.Component, error) {
+    now := time.Now().UTC()
+    filter := models.EventFilter{From: now.AddDate(0, 0, -feedPastDays), To: now.AddDate(0, 0, maxEventRangeDays)}
+    roles := make(map[int]string)
+    name := "Squad Up"
+
+    if feed.SquadID != nil {
+        membership, err := ctx.Squads.FindMembership(reqCtx, *feed.SquadID, user.ID, models.ExpandMembershipSquad)
+        if err != nil {
+            return ical.Component{}, err
+        }
+
+        filter.SquadIDs = []int{membership.SquadID}
+        roles[membership.SquadID] = membership.Role
+        if membership.Squad != nil {
+            name = membership.Squad.Name
+        }
+    } else {
+        memberships, err := ctx.Squads.FindMembershipsByUser(reqCtx, user.ID)
+        if err != nil {
+            return ical.Component{}, err
+        }
+
+        filter.PersonalOf = user.ID
+        for _, membership := range memberships {
+            filter.SquadIDs = append(filter.SquadIDs, membership.SquadID)
+            roles[membership.SquadID] = membership.Role
+        }
+    }
+
+    events, err := ctx.Events.Find(reqCtx, filter)
+    if err != nil {
+        return ical.Component{}, err
+    }
+
+    policy := squadPolicy(ctx)
+    published := func (event db.Event) bool {
+        access := eventAccess{event: &event}
+        if event.SquadID != nil {
+            access.role = roles[*event.SquadID]
+        }
+
+        return event.Status != db.EventStatusDraft && access.canView(policy, user.ID)
+    }
+
+    // Occurrences are written with their series, which may have started before the feed's range
+    var series []db.Event
+    var seriesIds []int
+    var single []db.Event
+    for _, event := range events {
+        switch {
+        case published(event) == false || event.Occurrence():
+            continue
+        case event.Recurring():
+            series = append(series, event)
+            seriesIds = append(seriesIds, event.ID)
+        default:
+            single = append(single, event)
+        }
+    }
+
+    instances, err := ctx.Events.FindOccurrences(reqCtx, seriesIds)
+    if err != nil {
+        return ical.Component{}, err
+    }
+
+    cal := ical.Component{
+        Name: "VCALENDAR",
+        Props: []ical.Property{
+            {Name: "VERSION", Value: "2.0"},
+            {Name: "PRODID", Value: "-//Squad Up//Squad Up//EN"},
+            {Name: "CALSCALE", Value: "GREGORIAN"},
+            {Name: "X-WR-CALNAME", Value: ical.EscapeText(name)},
+            {Name: "REFRESH-INTERVAL", Params: map[string]string{"VALUE": "DURATION"}, Value: feedRefreshInterval},
+            {Name: "X-PUBLISHED-TTL", Value: feedRefreshInterval},
+        },
+    }
+    if user.Timezone != "" {
+        cal.Props = append(cal.Props, ical.Property{Name: "X-WR-TIMEZONE", Value: user.Timezone})
+    }
+
+    zones := newFeedZones()
+    uidHost := feedUIDHost(ctx)
+
+    for i := range series {
+        cal.Components = append(cal.Components, feedEvent(series[i], nil, zones, uidHost))
+
+        for _, instance := range instances {
+            if *instance.ParentID == series[i].ID && published(instance) {
+                cal.Components = append(cal.Components, feedEvent(instance, &series[i], zones, uidHost))
+            }
+        }
+    }
+
+    for _, event := range single {
+        cal.Components = append(cal.Components, feedEvent(event, nil, zones, uidHost))
+    }
+
+    // Time zones are defined before the events which use them
+    cal.Components = append(zones.components(filter.To.AddDate(feedTimezoneYears, 0, 0)), cal.Components...)
+
+    return cal, nil
+}
+
+// feedZones collects the time zones of a feed's events and when they are first used.
+type feedZones struct {
+    locs []*time.Location
+    // Earliest time each zone is used at, by name
+    from map[string]time.Time
+}
+
+func newFeedZones () *feedZones {
+    return &feedZones{from: make(map[string]time.Time)}
+}
+
+// use records that an event's times are written in its time zone, and returns that zone. Events whose time zone is
+// not valid are written in UTC.
+func (z *feedZones) use (event db.Event) *time.Location {
+    loc, err := time.LoadLocation(event.Timezone)
+    if err != nil || event.Timezone == "" || loc == time.UTC {
+        return time.UTC
+    }
+
+    start := event.StartsAt
+    if event.OriginalStartsAt != nil && event.OriginalStartsAt.Before(start) {
+        start = *event.OriginalStartsAt
+    }
+
+    if from, ok := z.from[loc.String()]; ok == false {
+        z.locs = append(z.locs, loc)
+        z.from[loc.String()] = start
+    } else if start.Before(from) {
+        z.from[loc.String()] = start
+    }
+
+    return loc
+}
+
+// components returns the VTIMEZONE components of the zones used, from their first use until to.
+func (z *feedZones) components (to time.Time) []ical.Component {
+    var components []ical.Component
+    for _, loc := range z.locs {
+        components = append(components, ical.Timezone(loc, z.from[loc.String()], to))
+    }
+
+    return components
+}
+
+// feedUIDHost returns the domain event UIDs end with, the host of Config.PublicURL.
+func feedUIDHost (ctx *models.AppContext) string {
+    if u, err := url.Parse(ctx.Config.PublicURL); err == nil && u.Host != "" {
+        return u.Host
+    }
+
+    return "squad-up"
+}
+
+// feedEvent returns the VEVENT of an event, with times in its time zone. Occurrences are overrides of their series,
+// they share its UID and are identified by their original start time in the series' time zone.
+func feedEvent (event db.Event, series *db.Event, zones *feedZones, uidHost string) ical.Component {
+    loc := zones.use(event)
+
+    uidId := event.ID
+    if series != nil {
+        uidId = series.ID
+    }
+
+    status := "CONFIRMED"
+    if event.Cancelled() {
+        status = "CANCELLED"
+    }
+
+    vevent := ical.Component{
+        Name: "VEVENT",
+        Props: []ical.Property{
+            {Name: "UID", Value: "event-" + strconv.Itoa(uidId) + "@" + uidHost},
+            // Feeds have no METHOD, so DTSTAMP is the time the event last changed
+            {Name: "DTSTAMP", Value: ical.FormatUTC(event.UpdatedAt)},
+            {Name: "CREATED", Value: ical.FormatUTC(event.CreatedAt)},
+            {Name: "LAST-MODIFIED", Value: ical.FormatUTC(event.UpdatedAt)},
+            {Name: "SEQUENCE", Value: strconv.Itoa(event.Sequence)},
+            ical.TimeProperty("DTSTART", event.StartsAt, loc),
+            ical.TimeProperty("DTEND", event.EndsAt, loc),
+            {Name: "SUMMARY", Value: ical.EscapeText(event.Title)},
+            {Name: "STATUS", Value: status},
+        },
+    }
+
+    if series != nil && event.OriginalStartsAt != nil {
+        vevent.Props = append(vevent.Props, ical.TimeProperty("RECURRENCE-ID", *event.OriginalStartsAt, zones.use(*series)))
+    }
+
+    if event.Recurring() {
+        // Rules are written as parsed, so UNTIL is in UTC as required with a TZID
+        rrule := event.RRule
+        if rule, err := recur.Parse(event.RRule); err == nil {
+            rrule = rule.String()
+        }
+        vevent.Props = append(vevent.Props, ical.Property{Name: "RRULE", Value: rrule})
+
+        if len(event.ExDates) > 0 {
+            vevent.Props = append(vevent.Props, ical.TimesProperty("EXDATE", event.ExDates, loc))
+        }
+    }
+
+    if event.Description != "" {
+        vevent.Props = append(vevent.Props, ical.Property{Name: "DESCRIPTION", Value: ical.EscapeText(event.Description)})
+    }
+    if event.Location != "" {
+        vevent.Props = append(vevent.Props, ical.Property{Name: "LOCATION", Value: ical.EscapeText(event.Location)})
+    }
+    if event.Latitude != nil && event.Longitude != nil {
+        geo := strconv.FormatFloat(*event.Latitude, 'f', -1, 64) + ";" + strconv.FormatFloat(*event.Longitude, 'f', -1, 64)
+        vevent.Props = append(vevent.Props, ical.Property{Name: "GEO", Value: geo})
+    }
+
+    return vevent
+}
@@ -0,0 +1,150 @@
+package handlers_test
+
+import (
+    "context"
+    "net/http"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/Noah-Huppert/squad-up/server/apitest"
+    "github.com/Noah-Huppert/squad-up/server/ical"
+    "github.com/Noah-Huppert/squad-up/server/models"
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+    "github.com/stretchr/testify/assert"
+)
+
+func TestFeedsHandler(t *testing.T) {
+    a := assert.New(t)
+    h := apitest.New(t)
+    defer h.Close()
+    h.Ctx.Config.PublicURL = "https://squad.example.com/"
+
+    _, ownerToken := h.SeedUser(db.User{FirstName: "Jane", Email: "jane@example.com", Timezone: "America/New_York"})
+    member, memberToken := h.SeedUser(db.User{FirstName: "John", Email: "john@example.com"})
+    _, strangerToken := h.SeedUser(db.User{FirstName: "Eve"})
+
+    squadId := createSquad(h, ownerToken, map[string]string{"name": "Hikers"})
+    a.Nil(h.Ctx.Squads.AddMember(context.Background(), &db.SquadMembership{SquadID: squadId, UserID: member.ID, Role: db.SquadRoleMember}))
+
+    // Feeds only cover the next year, so times are relative to now
+    base := time.Now().UTC().Truncate(time.Hour).Add(48 * time.Hour)
+    at := func (hours float64) string {
+        return base.Add(time.Duration(hours * float64(time.Hour))).Format(time.RFC3339)
+    }
+
+    seriesId := createEvent(h, ownerToken, map[string]interface{}{
+        "squad_id": squadId, "title": "Run, then coffee", "starts_at": at(0), "ends_at": at(1),
+        "timezone": "America/New_York", "rrule": "FREQ=WEEKLY;COUNT=4",
+    })
+    hikeId := createEvent(h, ownerToken, map[string]interface{}{"squad_id": squadId, "title": "Hike", "starts_at": at(2), "ends_at": at(5), "timezone": "UTC"})
+    createEvent(h, ownerToken, map[string]interface{}{"squad_id": squadId, "title": "Secret", "starts_at": at(3), "ends_at": at(4), "status": "draft"})
+    createEvent(h, memberToken, map[string]interface{}{"title": "Dentist", "starts_at": at(6), "ends_at": at(7)})
+
+    var feed map[string]interface{}
+    res := h.DoJSON(http.MethodPost, "/api/v1/feeds", memberToken, map[string]interface{}{"squad_id": squadId})
+    res.AssertOK()
+    res.Decode("feed", &feed)
+
+    url := feed["url"].(string)
+    a.True(strings.HasPrefix(url, "https://squad.example.com/calendars/"), url)
+    a.Equal("webcal" + strings.TrimPrefix(url, "https"), feed["webcal_url"])
+    path := strings.TrimPrefix(url, "https://squad.example.com")
+
+    // Feeds are served without an access token
+    fetch := func (path string) ical.Component {
+        res := h.Get(path, "")
+        a.Equal(http.StatusOK, res.Code)
+        a.Equal("text/calendar; charset=utf-8", res.Header().Get("Content-Type"))
+
+        cal, err := ical.Parse(res.Body)
+        a.Nil(err)
+
+        return cal
+    }
+    findEvent := func (cal ical.Component, uid string) []ical.Component {
+        var found []ical.Component
+        for _, event := range cal.Children("VEVENT") {
+            if event.Value("UID") == uid {
+                found = append(found, event)
+            }
+        }
+
+        return found
+    }
+    seriesUid := "event-" + strconv.Itoa(seriesId) + "@squad.example.com"
+    hikeUid := "event-" + strconv.Itoa(hikeId) + "@squad.example.com"
+
+    cal := fetch(path)
+    a.Equal("Hikers", cal.Value("X-WR-CALNAME"))
+    a.Len(cal.Children("VEVENT"), 2)
+
+    // Series are written once with their rule, in their time zone
+    a.Equal("America/New_York", cal.Children("VTIMEZONE")[0].Value("TZID"))
+    series := findEvent(cal, seriesUid)[0]
+    a.Equal("FREQ=WEEKLY;COUNT=4", series.Value("RRULE"))
+    a.Equal("America/New_York", series.Prop("DTSTART").Params["TZID"])
+    a.Equal("Run\\, then coffee", series.Value("SUMMARY"))
+    a.Equal("0", series.Value("SEQUENCE"))
+    a.Equal("CONFIRMED", series.Value("STATUS"))
+
+    start, _, err := series.Prop("DTSTART").Time(time.UTC)
+    a.Nil(err)
+    a.True(base.Equal(start))
+    a.Equal(base.Add(2 * time.Hour).Format("20060102T150405Z"), findEvent(cal, hikeUid)[0].Value("DTSTART"))
+
+    // Unchanged feeds are not sent again
+    etag := h.Get(path, "").Header().Get("ETag")
+    req := h.NewRequest(http.MethodGet, path, "", nil)
+    req.Header.Set("If-None-Match", etag)
+    a.Equal(http.StatusNotModified, h.Do(req).Code)
+
+    // Changes bump the sequence, occurrences changed on their own are overrides of their series
+    h.DoJSON(http.MethodPatch, "/api/v1/events/" + strconv.Itoa(seriesId), ownerToken, map[string]string{"title": "Run"}).AssertOK()
+    h.DoJSON(http.MethodPatch, "/api/v1/events/" + strconv.Itoa(seriesId) + "?occurrence=" + at(7 * 24), ownerToken, map[string]string{"starts_at": at(7 * 24 + 1), "ends_at": at(7 * 24 + 2)}).AssertOK()
+    h.DoJSON(http.MethodPost, "/api/v1/events/" + strconv.Itoa(hikeId) + "/cancel", ownerToken, nil).AssertOK()
+
+    cal = fetch(path)
+    occurrences := findEvent(cal, seriesUid)
+    a.Len(occurrences, 2)
+    a.Equal("1", occurrences[0].Value("SEQUENCE"))
+    a.Equal("Run", occurrences[0].Value("SUMMARY"))
+    a.Nil(occurrences[0].Prop("RECURRENCE-ID"))
+
+    recurrenceId, _, err := occurrences[1].Prop("RECURRENCE-ID").Time(time.UTC)
+    a.Nil(err)
+    a.True(base.Add(7 * 24 * time.Hour).Equal(recurrenceId))
+    a.Nil(occurrences[1].Prop("RRULE"))
+
+    a.Equal("CANCELLED", findEvent(cal, hikeUid)[0].Value("STATUS"))
+    a.Equal("1", findEvent(cal, hikeUid)[0].Value("SEQUENCE"))
+
+    // The member's own feed also has their personal events
+    var own map[string]interface{}
+    res = h.DoJSON(http.MethodPost, "/api/v1/feeds", memberToken, map[string]interface{}{})
+    res.AssertOK()
+    res.Decode("feed", &own)
+    ownPath := strings.TrimPrefix(own["url"].(string), "https://squad.example.com")
+    a.Len(fetch(ownPath).Children("VEVENT"), 4)
+    a.Len(h.Get("/api/v1/feeds", memberToken).AssertOK()["feeds"], 2)
+
+    // Creating a feed again revokes the previous link
+    res = h.DoJSON(http.MethodPost, "/api/v1/feeds", memberToken, map[string]interface{}{})
+    res.AssertOK()
+    a.Equal(http.StatusNotFound, h.Get(ownPath, "").Code)
+    a.Len(h.Get("/api/v1/feeds", memberToken).AssertOK()["feeds"], 2)
+
+    // Tokens must be signed
+    tampered := strings.TrimSuffix(path, ".ics") + "x.ics"
+    a.Equal(http.StatusNotFound, h.Get(tampered, "").Code)
+
+    // Feeds of squads stop working once the user leaves
+    a.Nil(h.Ctx.Squads.RemoveMember(context.Background(), squadId, member.ID))
+    a.Equal(http.StatusNotFound, h.Get(path, "").Code)
+
+    h.DoJSON(http.MethodPost, "/api/v1/feeds", strangerToken, map[string]interface{}{"squad_id": squadId}).AssertError(http.StatusNotFound, models.ErrSquadNotFound.Id)
+    h.DoJSON(http.MethodDelete, "/api/v1/feeds/" + strconv.Itoa(int(feed["id"].(float64))), strangerToken, nil).AssertError(http.StatusNotFound, models.ErrFeedNotFound.Id)
+    h.DoJSON(http.MethodDelete, "/api/v1/feeds/" + strconv.Itoa(int(feed["id"].(float64))), memberToken, nil).AssertOK()
+    a.Len(h.Get("/api/v1/feeds", memberToken).AssertOK()["feeds"], 1)
+}
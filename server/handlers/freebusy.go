@@ -0,0 +1,235 @@
+package handlers
+
+import (
+    "context"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/Noah-Huppert/squad-up/server/freebusy"
+    "github.com/Noah-Huppert/squad-up/server/models"
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+)
+
+// Path of the free/busy endpoint
+const freeBusyPath = "/api/v1/freebusy"
+
+// Limits of free/busy timelines
+const (
+    defaultSlotMinutes = 30
+    minSlotMinutes = 5
+    maxSlotMinutes = 24 * 60
+    // Max number of slots in a timeline, longer ranges need longer slots
+    maxFreeBusySlots = 2000
+    // Max number of users listed by id
+    maxFreeBusyUsers = 100
+)
+
+// FreeBusyHandler serves the merged free/busy timeline of users.
+//
+//     GET /api/v1/freebusy?squad_id={id}&from={time}&to={time}&slot_minutes={n}
+//     GET /api/v1/freebusy?user_ids={id},{id}&from={time}&to={time}&slot_minutes={n}
+//
+// Users are busy during their busy blocks, their personal events and the events they are going to. Only when users
+// are busy is returned, never what they are busy with. The viewer can see the free/busy times of the users they share
+// a squad with, members of a squad whose role has the models.PermRSVP permission can list its members by squad_id.
+//
+// The time range defaults to the next 31 days like events, see eventRange. It is split into slots of slot_minutes,
+// 30 by default, which count how many users are available.
+type FreeBusyHandler struct {}
+
+// userBusy is when a user is busy.
+type userBusy struct {
+    UserID int `json:"user_id"`
+    Busy []freebusy.Interval `json:"busy"`
+}
+
+type freeBusyResponse struct {
+    From time.Time `json:"from"`
+    To time.Time `json:"to"`
+    SlotMinutes int `json:"slot_minutes"`
+    // Merged busy times of each user, in the order they were requested
+    Users []userBusy `json:"users"`
+    // Times every user is free
+    Free []freebusy.Interval `json:"free"`
+    Slots []freebusy.Slot `json:"slots"`
+}
+
+func (h FreeBusyHandler) Serve (reqCtx context.Context, ctx *models.AppContext, r *http.Request) (interface{}, *models.APIError) {
+    viewer, apiErr := currentUser(reqCtx, ctx, r)
+    if apiErr != nil {
+        return nil, apiErr
+    }
+
+    return methodHandlers{
+        http.MethodGet: func () (interface{}, *models.APIError) {
+            return h.timeline(reqCtx, ctx, r, viewer)
+        },
+    }.serveMethod(r)
+}
+
+// timeline returns when users are free and busy in a time range.
+func (h FreeBusyHandler) timeline (reqCtx context.Context, ctx *models.AppContext, r *http.Request, viewer *db.User) (interface{}, *models.APIError) {
+    from, to, apiErr := eventRange(r)
+    if apiErr != nil {
+        return nil, apiErr
+    }
+
+    slotMinutes := defaultSlotMinutes
+    if value := r.URL.Query().Get("slot_minutes"); value != "" {
+        var err error
+        if slotMinutes, err = strconv.Atoi(value); err != nil || slotMinutes < minSlotMinutes || slotMinutes > maxSlotMinutes {
+            return nil, models.ErrFieldOutOfRange.New("slot_minutes", strconv.Itoa(minSlotMinutes), strconv.Itoa(maxSlotMinutes))
+        }
+    }
+
+    step := time.Duration(slotMinutes) * time.Minute
+    if to.Sub(from) > step * maxFreeBusySlots {
+        min := int((to.Sub(from) / maxFreeBusySlots + time.Minute - 1) / time.Minute)
+        return nil, models.ErrFieldOutOfRange.New("slot_minutes", strconv.Itoa(min), strconv.Itoa(maxSlotMinutes))
+    }
+
+    userIds, apiErr := freeBusyUsers(reqCtx, ctx, r, viewer)
+    if apiErr != nil {
+        return nil, apiErr
+    }
+
+    busy, apiErr := loadBusy(reqCtx, ctx, userIds, from, to)
+    if apiErr != nil {
+        return nil, apiErr
+    }
+
+    resp := freeBusyResponse{From: from, To: to, SlotMinutes: slotMinutes, Users: []userBusy{}}
+
+    var all []freebusy.Interval
+    timelines := make([][]freebusy.Interval, len(userIds))
+    for i, userId := range userIds {
+        timelines[i] = busy[userId]
+        all = append(all, busy[userId]...)
+
+        user := userBusy{UserID: userId, Busy: busy[userId]}
+        if user.Busy == nil {
+            user.Busy = []freebusy.Interval{}
+        }
+
+        resp.Users = append(resp.Users, user)
+    }
+
+    resp.Free = freebusy.Free(freebusy.Merge(all), from, to)
+    resp.Slots = freebusy.Timeline(timelines, from, to, step)
+    if resp.Free == nil {
+        resp.Free = []freebusy.Interval{}
+    }
+
+    return resp, nil
+}
+
+// freeBusyUsers returns the ids of the users whose free/busy times are requested, from the squad_id or user_ids query
+// parameters. Users who do not share a squad with the viewer are not found.
+func freeBusyUsers (reqCtx context.Context, ctx *models.AppContext, r *http.Request, viewer *db.User) ([]int, *models.APIError) {
+    query := r.URL.Query()
+
+    if id := query.Get("squad_id"); id != "" {
+        access, apiErr := loadSquad(reqCtx, ctx, id, viewer.ID)
+        if apiErr != nil {
+            return nil, apiErr
+        } else if apiErr := squadPolicy(ctx).Check(access.role(), models.PermRSVP); apiErr != nil {
+            return nil, apiErr
+        }
+
+        memberships, err := ctx.Squads.FindMemberships(reqCtx, access.squad.ID)
+        if err != nil {
+            return nil, internalError(reqCtx, models.ErrFindingBusy, "listing squad members", err)
+        }
+
+        userIds := make([]int, len(memberships))
+        for i, membership := range memberships {
+            userIds[i] = membership.UserID
+        }
+
+        return userIds, nil
+    }
+
+    if query.Get("user_ids") == "" {
+        return nil, models.ErrMissingField.New("user_ids")
+    }
+
+    ids := strings.Split(query.Get("user_ids"), ",")
+    if len(ids) > maxFreeBusyUsers {
+        return nil, models.ErrFieldOutOfRange.New("user_ids", "1", strconv.Itoa(maxFreeBusyUsers))
+    }
+
+    coMembers, err := ctx.Squads.FindCoMemberIds(reqCtx, viewer.ID)
+    if err != nil {
+        return nil, internalError(reqCtx, models.ErrFindingBusy, "listing co-members", err)
+    }
+
+    visible := map[int]bool{viewer.ID: true}
+    for _, id := range coMembers {
+        visible[id] = true
+    }
+
+    var userIds []int
+    listed := make(map[int]bool)
+    for _, id := range ids {
+        userId, err := strconv.Atoi(strings.TrimSpace(id))
+        if err != nil || visible[userId] == false {
+            return nil, models.ErrUserNotFound.New(strings.TrimSpace(id))
+        }
+
+        if listed[userId] == false {
+            listed[userId] = true
+            userIds = append(userIds, userId)
+        }
+    }
+
+    return userIds, nil
+}
+
+// loadBusy returns the merged busy times of users between from and to: their busy blocks, their personal events and
+// the events they are going to. Cancelled events do not count.
+func loadBusy (reqCtx context.Context, ctx *models.AppContext, userIds []int, from, to time.Time) (map[int][]freebusy.Interval, *models.APIError) {
+    blocks, err := ctx.Busy.Find(reqCtx, userIds, from, to)
+    if err != nil {
+        return nil, internalError(reqCtx, models.ErrFindingBusy, "listing busy blocks", err)
+    }
+
+    busy := make(map[int][]freebusy.Interval)
+    for _, block := range blocks {
+        busy[block.UserID] = append(busy[block.UserID], freebusy.Interval{Start: block.StartsAt, End: block.EndsAt})
+    }
+
+    for _, userId := range userIds {
+        events, err := ctx.Events.Find(reqCtx, models.EventFilter{From: from, To: to, PersonalOf: userId})
+        if err != nil {
+            return nil, internalError(reqCtx, models.ErrFindingBusy, "listing personal events", err)
+        }
+
+        events, apiErr := expandSeries(reqCtx, ctx, events, from, to)
+        if apiErr != nil {
+            return nil, apiErr
+        }
+
+        rsvps, err := ctx.RSVPs.FindByUser(reqCtx, userId, models.ExpandRSVPEvent)
+        if err != nil {
+            return nil, internalError(reqCtx, models.ErrFindingBusy, "listing RSVPs", err)
+        }
+
+        for _, rsvp := range rsvps {
+            if rsvp.Going() && rsvp.Event != nil {
+                events = append(events, *rsvp.Event)
+            }
+        }
+
+        for _, event := range events {
+            if event.Cancelled() == false && event.Recurring() == false {
+                busy[userId] = append(busy[userId], freebusy.Interval{Start: event.StartsAt, End: event.EndsAt})
+            }
+        }
+
+        busy[userId] = freebusy.Clip(freebusy.Merge(busy[userId]), from, to)
+    }
+
+    return busy, nil
+}
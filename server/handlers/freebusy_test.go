@@ -0,0 +1,101 @@
+package handlers_test
+
+import (
+    "context"
+    "net/http"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/Noah-Huppert/squad-up/server/apitest"
+    "github.com/Noah-Huppert/squad-up/server/models"
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+    "github.com/stretchr/testify/assert"
+)
+
+func TestFreeBusyHandler(t *testing.T) {
+    a := assert.New(t)
+    h := apitest.New(t)
+    defer h.Close()
+
+    owner, ownerToken := h.SeedUser(db.User{FirstName: "Jane", Email: "jane@example.com"})
+    member, memberToken := h.SeedUser(db.User{FirstName: "John", Email: "john@example.com"})
+    _, strangerToken := h.SeedUser(db.User{FirstName: "Eve"})
+
+    squadId := createSquad(h, ownerToken, map[string]string{"name": "Hikers"})
+    a.Nil(h.Ctx.Squads.AddMember(context.Background(), &db.SquadMembership{SquadID: squadId, UserID: member.ID, Role: db.SquadRoleMember}))
+
+    // Imports only cover the next year, so times are relative to now
+    base := time.Now().UTC().Truncate(time.Hour).Add(48 * time.Hour)
+    at := func (hours float64) string {
+        return base.Add(time.Duration(hours * float64(time.Hour))).Format(time.RFC3339)
+    }
+    icsAt := func (hours float64) string {
+        return base.Add(time.Duration(hours * float64(time.Hour))).Format("20060102T150405Z")
+    }
+
+    // Busy blocks
+    h.DoJSON(http.MethodPost, "/api/v1/busy", memberToken, map[string]string{"starts_at": at(1), "ends_at": at(0)}).AssertError(http.StatusUnprocessableEntity, models.ErrInvalidTimeRange.Id)
+
+    var block db.BusyBlock
+    res := h.DoJSON(http.MethodPost, "/api/v1/busy", memberToken, map[string]string{"starts_at": at(0), "ends_at": at(1)})
+    res.AssertOK()
+    res.Decode("busy_block", &block)
+    a.Equal(db.BusySourceManual, block.Source)
+
+    h.DoJSON(http.MethodDelete, "/api/v1/busy/" + strconv.Itoa(block.ID), strangerToken, nil).AssertError(http.StatusNotFound, models.ErrBusyBlockNotFound.Id)
+
+    // Importing replaces the previous import
+    importCalendar := func (events ...string) *apitest.Response {
+        ics := "BEGIN:VCALENDAR\r\n" + strings.Join(events, "") + "END:VCALENDAR\r\n"
+        return h.Do(h.NewRequest(http.MethodPut, "/api/v1/busy/import", memberToken, strings.NewReader(ics)))
+    }
+    event := func (start, end float64) string {
+        return "BEGIN:VEVENT\r\nSUMMARY:Dentist\r\nDTSTART:" + icsAt(start) + "\r\nDTEND:" + icsAt(end) + "\r\nEND:VEVENT\r\n"
+    }
+
+    a.Equal(float64(2), importCalendar(event(5, 6), event(7, 8)).AssertOK()["imported"])
+    a.Equal(float64(1), importCalendar(event(0.5, 2)).AssertOK()["imported"])
+    h.Do(h.NewRequest(http.MethodPut, "/api/v1/busy/import", memberToken, strings.NewReader("not a calendar"))).AssertError(http.StatusUnprocessableEntity, models.ErrInvalidCalendar.Id)
+
+    blocks := h.Get("/api/v1/busy?from=" + at(0) + "&to=" + at(24), memberToken).AssertOK()["busy_blocks"].([]interface{})
+    a.Len(blocks, 2)
+
+    // Events the member is going to and the owner's personal events
+    eventId := createEvent(h, ownerToken, map[string]interface{}{"squad_id": squadId, "title": "Hike", "starts_at": at(12), "ends_at": at(13)})
+    h.DoJSON(http.MethodPut, "/api/v1/events/" + strconv.Itoa(eventId) + "/rsvps/me", memberToken, map[string]string{"response": "yes"}).AssertOK()
+    createEvent(h, ownerToken, map[string]interface{}{"title": "Dinner", "starts_at": at(2), "ends_at": at(3)})
+
+    env := h.Get("/api/v1/freebusy?squad_id=" + strconv.Itoa(squadId) + "&from=" + at(0) + "&to=" + at(24) + "&slot_minutes=60", ownerToken).AssertOK()
+    users := env["users"].([]interface{})
+    a.Len(users, 2)
+
+    busyOf := make(map[float64][]interface{})
+    for _, user := range users {
+        busyOf[user.(map[string]interface{})["user_id"].(float64)] = user.(map[string]interface{})["busy"].([]interface{})
+    }
+
+    // Overlapping blocks are merged, and only times are returned
+    a.Equal([]interface{}{
+        map[string]interface{}{"starts_at": at(0), "ends_at": at(2)},
+        map[string]interface{}{"starts_at": at(12), "ends_at": at(13)},
+    }, busyOf[float64(member.ID)])
+    a.Equal([]interface{}{map[string]interface{}{"starts_at": at(2), "ends_at": at(3)}}, busyOf[float64(owner.ID)])
+
+    a.Equal([]interface{}{
+        map[string]interface{}{"starts_at": at(3), "ends_at": at(12)},
+        map[string]interface{}{"starts_at": at(13), "ends_at": at(24)},
+    }, env["free"])
+
+    slots := env["slots"].([]interface{})
+    a.Len(slots, 24)
+    for i, available := range map[int]float64{0: 1, 1: 1, 2: 1, 3: 2, 12: 1} {
+        a.Equal(available, slots[i].(map[string]interface{})["available"], "slot %d", i)
+    }
+
+    // Only users who share a squad with the viewer can be listed
+    a.Len(h.Get("/api/v1/freebusy?user_ids=" + strconv.Itoa(owner.ID) + "&from=" + at(0) + "&to=" + at(24), memberToken).AssertOK()["users"], 1)
+    h.Get("/api/v1/freebusy?user_ids=" + strconv.Itoa(member.ID), strangerToken).AssertError(http.StatusNotFound, models.ErrUserNotFound.Id)
+    h.Get("/api/v1/freebusy?user_ids=" + strconv.Itoa(member.ID) + "&slot_minutes=1", ownerToken).AssertError(http.StatusUnprocessableEntity, models.ErrFieldOutOfRange.Id)
+}
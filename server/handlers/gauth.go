@@ -1,18 +1,16 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
+	"net/url"
     "fmt"
     "time"
 
 	"github.com/Noah-Huppert/squad-up/server/models"
     "github.com/Noah-Huppert/squad-up/server/models/db"
-
-    "github.com/satori/go.uuid"
-    "github.com/SermoDigital/jose/jws"
-    "github.com/SermoDigital/jose/crypto"
 )
 
 type ExchangeTokenHandler struct {}
@@ -20,37 +18,54 @@ type ExchangeTokenHandler struct {}
 type exchangeResponse struct {
     User db.User `json:"user"`
     AccessToken string `json:"access_token"`
+    // Squad the user joined by accepting an invite
+    JoinedSquadID int `json:"joined_squad_id,omitempty"`
 }
 
-// Exchange users Google Id Token for a Squad Up API token, essentially the "login" endpoint.
-func (h ExchangeTokenHandler) Serve (ctx *models.AppContext, r *http.Request) (interface{}, *models.APIError) {
+// Exchange users Google Id Token for a Squad Up API token, essentially the "login" endpoint. An "invite" token can be
+// passed to join a squad at the same time.
+func (h ExchangeTokenHandler) Serve (reqCtx context.Context, ctx *models.AppContext, r *http.Request) (interface{}, *models.APIError) {
 	httpResp := exchangeResponse{}
 
 	// Get id_token passed in request
 	idToken := r.PostFormValue("id_token")
 	if len(idToken) == 0 {
-		err := &models.APIError{"missing_param", "`id_token` must be provided as a post parameter", http.StatusUnprocessableEntity}
+		err := models.ErrMissingParam.New("id_token")
 		return nil, err
 	}
 
 	// Make request to token info Gapi. This lets Google take care of
 	// verifying the id token. If the token is valid it also provides
 	// us with some basic profile info
-	res, err := http.Get("https://www.googleapis.com/oauth2/v3/tokeninfo?id_token=" + idToken)
+	verifyStart := time.Now()
+	tokenInfoURL := ctx.Config.GoogleTokenInfoURL
+	if tokenInfoURL == "" {
+		tokenInfoURL = models.GoogleTokenInfoURL
+	}
+
+	res, err := httpGet(reqCtx, ctx, tokenInfoURL + "?id_token=" + url.QueryEscape(idToken))
 	if err != nil {
+		// Request was abandoned, not Google's fault
+		if ctxErr := models.ContextError(reqCtx); ctxErr != nil {
+			return nil, ctxErr
+		}
+
+		googleTokenVerificationFailures.Inc("http")
 		fmt.Printf("Error sending HTTP request to verify id token: %s\n", err)
 
-		err := &models.APIError{"http_err_verifying_id_token", "An error occured while contacting Google servers to verify your identity", http.StatusInternalServerError}
+		err := models.ErrHTTPVerifyingIdToken.New()
 		return nil, err
 	}
 
 	// Read response body
 	body, err := ioutil.ReadAll(res.Body)
 	res.Body.Close()
+	googleTokenVerificationDuration.Observe(time.Since(verifyStart).Seconds())
 	if err != nil {
+		googleTokenVerificationFailures.Inc("read")
 		fmt.Printf("Error reading body of response to verify id token %s\n", err)
 
-		err := &models.APIError{"body_read_err_verifying_id_token", "We couldn't read the Google server's response while verifying your identity", http.StatusInternalServerError}
+		err := models.ErrBodyReadVerifyingIdToken.New()
 		return nil, err
 	}
 
@@ -83,55 +98,109 @@ func (h ExchangeTokenHandler) Serve (ctx *models.AppContext, r *http.Request) (i
 
 	err = json.Unmarshal(body, &resp)
 	if err != nil {
+		googleTokenVerificationFailures.Inc("parse")
 		fmt.Printf("Error decoding json response: %s\n", err)
 
-		err := &models.APIError{"json_parse_err_verifying_id_token", "We couldn't understand the response the Google server's gave us while verifying your identity", http.StatusInternalServerError}
+		err := models.ErrJSONParseVerifyingIdToken.New()
 		return nil, err
 	}
 
 	// Check
 	// Check that aud is our client id
 	if resp.Aud != ctx.Config.GAPIClientId {
-		err := &models.APIError{"invalid_id_token", "Google login not valid", http.StatusUnauthorized}
+		googleTokenVerificationFailures.Inc("invalid_token")
+		err := models.ErrInvalidIdToken.New()
 		return nil, err
 	}
 
 	// Check that email is verified
 	if resp.EmailVerified == false {
-		err := &models.APIError{"email_not_verified", "Your email is not verifeid with Google", http.StatusUnauthorized}
+		googleTokenVerificationFailures.Inc("email_not_verified")
+		err := models.ErrEmailNotVerified.New()
 		return nil, err
 	}
 
-    // Find or create User
-    var user db.User
-    ctx.Db.FirstOrCreate(&user,
-                        db.User{
-                            FirstName: resp.GivenName,
-                            LastName: resp.FamilyName,
-                            Email: resp.Email,
-                            ProfilePictureUrl: resp.Picture,
-                        })
-    httpResp.User = user
+    // Invite to accept once logged in, checked first so a bad invite does not create an account
+    var invite *db.SquadInvite
+    if token := r.PostFormValue("invite"); token != "" {
+        var apiErr *models.APIError
+        if invite, apiErr = findInvite(reqCtx, ctx, token); apiErr != nil {
+            return nil, apiErr
+        }
+    }
 
-    // Issue Access Token
-    claims := jws.Claims{}
-    claims.SetIssuer(ctx.Config.JWTServerURI)
-    claims.SetSubject(string(user.ID))
-    claims.SetAudience(ctx.Config.JWTServerURI)
-    claims.SetExpiration(time.Now().AddDate(0, 0, 14))// 2 weeks
-    claims.SetIssuedAt(time.Now())
-    claims.SetJWTID(uuid.NewV4().String())
+    // Find or create the user and accept the invite together, so new users are not left without the squad they were
+    // invited to
+    var user *db.User
+    err = ctx.Transaction(reqCtx, func (tx *models.AppContext) error {
+        var err error
+        user, err = findOrCreateUser(reqCtx, tx, db.User{
+            GoogleID: resp.Sub,
+            FirstName: resp.GivenName,
+            LastName: resp.FamilyName,
+            Email: resp.Email,
+            ProfilePictureUrl: resp.Picture,
+            Locale: resp.Locale,
+        })
+        if err != nil {
+            return err
+        }
+
+        if invite != nil {
+            if _, apiErr := acceptInvite(reqCtx, tx, invite, user); apiErr != nil {
+                return apiErr
+            }
+
+            httpResp.JoinedSquadID = invite.SquadID
+        }
+
+        return nil
+    })
+    if err != nil {
+        return nil, transactionError(reqCtx, models.ErrFindingUser, "finding or creating user", err)
+    }
+    httpResp.User = *user
 
-    jwt := jws.NewJWT(claims, crypto.SigningMethodHS512)
+    // Serialize response for the user who just logged in, so they can see their own private fields
+    setViewer(r, user.ID)
 
-    accessToken, err := jwt.Serialize([]byte(ctx.Config.JWTHMACKey))
+    // Issue Access Token
+    accessToken, err := IssueAccessToken(ctx, user.ID)
     if err != nil {
         fmt.Println("Error serializing jwt: " + err.Error())
-        err := &models.APIError{"err_generating_access_token", "An internal error occured while generating the access token", http.StatusInternalServerError}
+        err := models.ErrGeneratingAccessToken.New()
         return nil, err
     }
 
-    httpResp.AccessToken = string(accessToken)
+    httpResp.AccessToken = accessToken
 
 	return httpResp, nil
 }
+
+// findOrCreateUser returns the user with the Google account id of the provided profile, creating them if they do not
+// exist. Other profile fields are only set when the user is created. Returns models.ErrEmailLinked if the profile's
+// email belongs to a user who logs in with another Google account.
+func findOrCreateUser (reqCtx context.Context, ctx *models.AppContext, profile db.User) (*db.User, error) {
+    user, err := ctx.Users.FindByIdentity(reqCtx, profile.GoogleID)
+    if err == models.ErrNotFound {
+        // Logging in during the deletion grace period restores the account
+        user, err = restoreDeletedUser(reqCtx, ctx, profile.GoogleID)
+    }
+    if err == models.ErrNotFound {
+        // Users created before Google account ids were stored are found by their email
+        user, err = ctx.Users.FindByEmail(reqCtx, profile.Email)
+        if err == nil && user.GoogleID != "" {
+            // Recycled addresses and aliases must not take over the account of the Google account it is linked to
+            user, err = nil, models.ErrEmailLinked.New()
+        } else if err == nil {
+            user.GoogleID = profile.GoogleID
+            err = ctx.Users.Update(reqCtx, user)
+        }
+    }
+    if err == models.ErrNotFound {
+        user = &profile
+        err = ctx.Users.Create(reqCtx, user)
+    }
+
+    return user, err
+}
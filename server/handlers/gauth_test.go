@@ -0,0 +1,112 @@
+package handlers_test
+
+import (
+    "context"
+    "net/http"
+    "net/url"
+    "strings"
+    "testing"
+
+    "github.com/Noah-Huppert/squad-up/server/apitest"
+    "github.com/Noah-Huppert/squad-up/server/models"
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+    "github.com/stretchr/testify/assert"
+)
+
+var jane = apitest.GoogleIdentity{
+    Sub: "1001",
+    Email: "jane@example.com",
+    EmailVerified: true,
+    GivenName: "Jane",
+    FamilyName: "Doe",
+    Locale: "fr",
+}
+
+func TestExchangeTokenHandler(t *testing.T) {
+    a := assert.New(t)
+    h := apitest.New(t)
+    defer h.Close()
+
+    res := h.PostForm("/api/v1/auth/token/google", "", url.Values{"id_token": {h.Google.IdToken(jane)}})
+    res.AssertOK()
+
+    var user db.User
+    res.Decode("user", &user)
+    a.Equal("Jane", user.FirstName)
+    a.Equal("jane@example.com", user.Email)
+
+    // User which just logged in can see their private fields
+    a.Equal("fr", res.Envelope()["user"].(map[string]interface{})["locale"])
+
+    // Logging in again finds the same user
+    h.Login(jane)
+
+    saved, err := h.Ctx.Users.FindByIdentity(context.Background(), jane.Sub)
+    a.Nil(err)
+    a.Equal(user.ID, saved.ID)
+}
+
+func TestExchangeTokenHandler_Errors(t *testing.T) {
+    h := apitest.New(t)
+    defer h.Close()
+
+    path := "/api/v1/auth/token/google"
+
+    h.PostForm(path, "", url.Values{}).AssertError(http.StatusUnprocessableEntity, models.ErrMissingParam.Id)
+    h.PostForm(path, "", url.Values{"id_token": {"forged"}}).AssertError(http.StatusUnauthorized, models.ErrInvalidIdToken.Id)
+
+    unverified := jane
+    unverified.EmailVerified = false
+
+    h.PostForm(path, "", url.Values{"id_token": {h.Google.IdToken(unverified)}}).AssertError(http.StatusUnauthorized, models.ErrEmailNotVerified.Id)
+}
+
+func TestExchangeTokenHandler_Idempotent(t *testing.T) {
+    a := assert.New(t)
+    h := apitest.New(t)
+    defer h.Close()
+
+    _, token := h.SeedUser(db.User{GoogleID: jane.Sub, Email: jane.Email})
+    form := url.Values{"id_token": {h.Google.IdToken(jane)}}
+
+    send := func () *apitest.Response {
+        r := h.NewRequest(http.MethodPost, "/api/v1/auth/token/google", token, strings.NewReader(form.Encode()))
+        r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+        r.Header.Set("Idempotency-Key", "login-1")
+
+        return h.Do(r)
+    }
+
+    first := send()
+    first.AssertOK()
+
+    // Retry is replayed instead of issuing another access token
+    retry := send()
+    retry.AssertOK()
+    a.Equal("true", retry.Header().Get("Idempotent-Replayed"))
+    a.Equal(first.Envelope()["access_token"], retry.Envelope()["access_token"])
+}
+
+func TestExchangeTokenHandler_LinkByEmail(t *testing.T) {
+    a := assert.New(t)
+    h := apitest.New(t)
+    defer h.Close()
+
+    // Users created before Google account ids were stored are linked on their next login
+    legacy, _ := h.SeedUser(db.User{Email: jane.Email})
+
+    var user db.User
+    res := h.PostForm("/api/v1/auth/token/google", "", url.Values{"id_token": {h.Google.IdToken(jane)}})
+    res.AssertOK()
+    res.Decode("user", &user)
+    a.Equal(legacy.ID, user.ID)
+
+    // Another Google account with the same email can not take the account over
+    other := jane
+    other.Sub = "2002"
+    h.PostForm("/api/v1/auth/token/google", "", url.Values{"id_token": {h.Google.IdToken(other)}}).AssertError(http.StatusConflict, models.ErrEmailLinked.Id)
+
+    saved, err := h.Ctx.Users.FindById(context.Background(), legacy.ID)
+    a.Nil(err)
+    a.Equal(jane.Sub, saved.GoogleID)
+}
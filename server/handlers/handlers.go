@@ -1,8 +1,11 @@
 package handlers
 
 import (
+    "context"
     "net/http"
+    "time"
 
+    "github.com/Noah-Huppert/squad-up/server/metrics"
     "github.com/Noah-Huppert/squad-up/server/models"
     "github.com/Noah-Huppert/squad-up/server/models/utils"
 
@@ -16,10 +19,12 @@ import (
 // the state of the application.
 type EndpointHandler interface {
     // Serve is called by the `handler` struct defined in this file (handlers.go)
-    // Given application context and an http request.
+    // Given the request's context, application context and an http request.
+    // The request context is cancelled if the client disconnects or the endpoint's timeout passes, it should be passed
+    // to any outbound HTTP requests or database calls so they stop early.
     // Returns an interface to serve back to the client (Cannot contain the "error" key) and a point to an models.APIError
     // both can be nil
-    Serve (ctx *models.AppContext, r *http.Request) (interface{}, *models.APIError)
+    Serve (reqCtx context.Context, ctx *models.AppContext, r *http.Request) (interface{}, *models.APIError)
 }
 
 // handler is the custom http.Handler used to serve our web app endpoints. Calls the EndpointHandler.Serve method to get
@@ -29,34 +34,86 @@ type handler struct {
     EndpointHandler
     // Embedded AppContextProvider used to get the context for the EndpointHandler.Serve method.
     models.AppContextProvider
+    // Path handler is registered at, used to label metrics
+    route string
+    // Max time EndpointHandler.Serve can run for, no limit if 0
+    timeout time.Duration
 }
 
 // ServeHTTP calls the custom EndpointHandler to handle the request and serves the result.
 func (h handler) ServeHTTP (w http.ResponseWriter, r *http.Request) {
-    // Call EndpointHandler.Serve
-    hdlrRes, hdlrErr := h.Serve(h.Ctx(), r)
+    instrument(h.route, w, r, func (w http.ResponseWriter, r *http.Request) {
+        // Mutating requests can be made safe to retry with an idempotency key
+        if key := r.Header.Get(idempotencyKeyHeader); key != "" && isSafeMethod(r.Method) == false {
+            h.serveIdempotent(w, r, key)
+            return
+        }
+
+        h.serve(w, r)
+    })
+}
+
+// serve calls EndpointHandler.Serve and writes the result.
+func (h handler) serve (w http.ResponseWriter, r *http.Request) {
+    r, expandErr := parseExpansions(r, h.EndpointHandler)
+    if expandErr != nil {
+        h.serveError(w, r, expandErr)
+        return
+    }
+
+    r = withViewerState(r)
+
+    // Cancel work if request takes too long
+    reqCtx := r.Context()
+    if h.timeout > 0 {
+        var cancel context.CancelFunc
+        reqCtx, cancel = context.WithTimeout(reqCtx, h.timeout)
+        defer cancel()
+
+        r = r.WithContext(reqCtx)
+    }
 
+    hdlrRes, hdlrErr := h.Serve(reqCtx, h.Ctx(), r)
+
+    // If the handler failed because the request was cancelled or timed out report that instead. Handlers which finished
+    // their work anyway keep their result, as it has already been saved.
+    if hdlrErr != nil {
+        if ctxErr := models.ContextError(reqCtx); ctxErr != nil {
+            hdlrRes, hdlrErr = nil, ctxErr
+        }
+    }
+
+    h.respond(w, r, hdlrRes, hdlrErr)
+}
+
+// serveError writes an error response without calling EndpointHandler.Serve.
+func (h handler) serveError (w http.ResponseWriter, r *http.Request, apiErr *models.APIError) {
+    h.respond(w, r, nil, apiErr)
+}
+
+// respond serializes an endpoint handler result and error as JSON and writes it.
+func (h handler) respond (w http.ResponseWriter, r *http.Request, hdlrRes interface{}, hdlrErr *models.APIError) {
     // convert endpoint handler result into a map
-    var resMap map[string]interface{}
+    resMap := make(map[string]interface{}, 0)
 
     // Set to value if error occurs in the conversion process, if not nil will replace
     // hdlrErr in response
     var convertErr *models.APIError
 
-    // Check that result is indeed a struct
-    if structs.IsStruct(hdlrRes) == false {// If hdlrRes is not a struct print and set error
+    // Check that result is indeed a struct. A nil result is allowed, ex: when the handler only returned an error
+    if hdlrRes != nil && structs.IsStruct(hdlrRes) == false {// If hdlrRes is not a struct print and set error
         fmt.Println("Endpoint handler returned invalid type (Non struct) as result")
-        convertErr = &models.APIError{"endpoint_handler_invalid_result_type", "The handler for this endpoint returned a result with an invalid type", http.StatusInternalServerError}
-    } else {// If hdlrRes is a struct convert to map[string]interface{}
-        resStruct := structs.New(hdlrRes)
-
-        m, err := utils.ToMap(resStruct)
+        convertErr = models.ErrEndpointHandlerInvalidResultType.New()
+    } else if hdlrRes != nil {// If hdlrRes is a struct convert to map[string]interface{}
+        // Only include fields the user viewing the response is allowed to see
+        m, err := utils.ToMapFor(hdlrRes, requestViewer(h.Ctx(), r))
         if err != nil {
-            fmt.Println("Error converting resStruct into map: " + err.Error())
-            convertErr = &models.APIError{"err_converting_endpoint_handler_result", "An internal error occured in an intermedierary json conversion step", http.StatusInternalServerError}
+            fmt.Println("Error converting endpoint handler result into map: " + err.Error())
+            convertErr = models.ErrConvertingEndpointHandlerResult.New()
         }
 
         resMap = m
+        pruneFields(r, resMap)
     }
 
     // Replace hdlrErr with any conversion error that may have occurred.
@@ -68,25 +125,58 @@ func (h handler) ServeHTTP (w http.ResponseWriter, r *http.Request) {
         hdlrErr = convertErr
     }
 
-    // Assign error to "error" key
-    resMap["error"] = hdlrErr
+    // Render error message in the client's language
+    if hdlrErr != nil {
+        apiErrors.Inc(hdlrErr.Id)
+        hdlrErr = hdlrErr.Localize(requestLocale(h.Ctx(), r))
+    }
+
+    // Clients which prefer RFC 7807 problem details get errors in that format instead of the usual envelope
+    contentType := "application/json"
+    var body interface{} = resMap
+
+    if hdlrErr != nil && wantsProblemJSON(r) {
+        contentType = models.ProblemContentType
+        body = models.NewProblem(hdlrErr, r.URL.RequestURI())
+    } else {
+        // Assign error to "error" key
+        resMap["error"] = hdlrErr
+    }
 
     // Encode response in json
-	bytes, err := json.Marshal(resMap)
+	bytes, err := json.Marshal(body)
 	if err != nil {// Handle encoding error
 		fmt.Println("Error marshalling response into JSON: " + err.Error())
 
         // Manually serve encoding error
+        hdlrErr = models.APIErrorErrorMarshallingHTTPResponse
         bytes = []byte(models.APIErrorManualMarshalledErrorMarshallingHTTPResponse)
 
-        // Set HTTP response code
-        hdlrErr = models.APIErrorErrorMarshallingHTTPResponse
-        return
+        if contentType == models.ProblemContentType {
+            bytes = []byte(models.ProblemManualMarshalledErrorMarshallingHTTPResponse)
+        }
 	}
 
 	// Set headers
-	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Type", contentType)
+    w.Header().Set("Vary", "Authorization, Accept")
+
+    // Conditional request handling, only successful responses are versioned
+    if hdlrErr == nil {
+        etag := resultETag(hdlrRes, bytes)
+        w.Header().Set("ETag", etag)
+
+        // Require clients revalidate cached responses
+        if isSafeMethod(r.Method) {
+            w.Header().Set("Cache-Control", "private, no-cache")
+        }
 
+        // Client already has current version
+        if notModified(r, etag) {
+            w.WriteHeader(http.StatusNotModified)
+            return
+        }
+    }
 
 	// Send response with custom status code
 	if hdlrErr == nil {
@@ -124,9 +214,16 @@ func (l Loader) Ctx () *models.AppContext {
     return l.ctx
 }
 
-// register's the provided handler for the provided path with the http.ServeMux
+// register's the provided handler for the provided path with the http.ServeMux. Requests to the endpoint time out
+// after Config.RequestTimeout.
 func (l Loader) registerEndpoint(path string, eHdlr EndpointHandler) {
-    hdlr := handler{eHdlr, l}
+    l.registerEndpointTimeout(path, eHdlr, l.ctx.Config.RequestTimeout)
+}
+
+// registerEndpointTimeout registers a handler like registerEndpoint, but with a custom timeout. Used by endpoints
+// which are expected to be slower than usual.
+func (l Loader) registerEndpointTimeout(path string, eHdlr EndpointHandler, timeout time.Duration) {
+    hdlr := handler{eHdlr, l, path, timeout}
 
     l.mux.Handle(path, hdlr)
 }
@@ -152,5 +249,42 @@ func (l Loader) Load() {
     l.mux.HandleFunc("/", ServeIndex)
 
     // API
-    l.registerEndpoint("/api/v1/auth/token/google", ExchangeTokenHandler{})
+    l.registerEndpointTimeout("/api/v1/auth/token/google", ExchangeTokenHandler{}, 20 * time.Second)
+    l.registerEndpoint("/api/v1/errors", ErrorCatalogHandler{})
+    l.registerEndpoint(usersPath, UsersHandler{})
+    l.registerEndpoint(avatarUploadPath, AvatarHandler{})
+    l.registerEndpoint(exportPath, ExportHandler{})
+    l.registerEndpoint(squadsPath, SquadsHandler{})
+    l.registerEndpoint(squadsPath + "/", SquadsHandler{})
+    l.registerEndpoint(invitesPath, InvitesHandler{})
+    l.registerEndpoint(eventsPath, EventsHandler{})
+    l.registerEndpoint(eventsPath + "/", EventsHandler{})
+    l.registerEndpoint(availabilityPath, AvailabilityHandler{})
+    l.registerEndpoint(availabilityPath + "/", AvailabilityHandler{})
+    l.registerEndpoint(pollsPath, PollsHandler{})
+    l.registerEndpoint(pollsPath + "/", PollsHandler{})
+    l.registerEndpoint(busyPath, BusyHandler{})
+    l.registerEndpoint(busyPath + "/", BusyHandler{})
+    l.registerEndpoint(freeBusyPath, FreeBusyHandler{})
+    l.registerEndpoint(suggestionsPath, SuggestionsHandler{})
+    l.registerEndpoint(feedsPath, FeedsHandler{})
+    l.registerEndpoint(feedsPath + "/", FeedsHandler{})
+    l.mux.HandleFunc(avatarsPath, func (w http.ResponseWriter, r *http.Request) {
+        serveAvatar(l.ctx, w, r)
+    })
+    l.mux.HandleFunc(calendarsPath, func (w http.ResponseWriter, r *http.Request) {
+        serveCalendarFeed(l.ctx, w, r)
+    })
+
+    // Metrics are served by MetricsHandler, on a separate listener
+    registerDBMetrics(l.ctx)
+}
+
+// MetricsHandler returns a handler which serves metrics at /metrics. Metrics are not authenticated, so the handler
+// should only be served on an internal address.
+func MetricsHandler () http.Handler {
+    mux := http.NewServeMux()
+    mux.Handle("/metrics", metrics.Handler(metrics.DefaultRegistry))
+
+    return mux
 }
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+    "bytes"
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "io/ioutil"
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/Noah-Huppert/squad-up/server/models"
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+)
+
+// Name of header clients use to make a mutating request safe to retry.
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// Max length of an Idempotency-Key header value.
+const idempotencyKeyMaxLen = 255
+
+// Retention window used if Config.IdempotencyRetention is not set.
+const defaultIdempotencyRetention = 24 * time.Hour
+
+// recordingResponseWriter passes a response through to the client while keeping a copy of the status code and body
+// so it can be stored for replay.
+type recordingResponseWriter struct {
+    http.ResponseWriter
+    status int
+    body bytes.Buffer
+}
+
+func (w *recordingResponseWriter) WriteHeader(code int) {
+    w.status = code
+    w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *recordingResponseWriter) Write(p []byte) (int, error) {
+    if w.status == 0 {
+        w.status = http.StatusOK
+    }
+
+    w.body.Write(p)
+    return w.ResponseWriter.Write(p)
+}
+
+// idempotencyRetention returns how long idempotency records are kept for.
+func idempotencyRetention(ctx *models.AppContext) time.Duration {
+    if ctx.Config.IdempotencyRetention <= 0 {
+        return defaultIdempotencyRetention
+    }
+
+    return ctx.Config.IdempotencyRetention
+}
+
+// requestHash returns a hash which identifies the contents of a request. Used to make sure a reused idempotency key is
+// for the same request.
+func requestHash(r *http.Request, body []byte) string {
+    h := sha256.New()
+    h.Write([]byte(r.Header.Get("Content-Type")))
+    h.Write([]byte{0})
+    h.Write([]byte(r.URL.RawQuery))
+    h.Write([]byte{0})
+    h.Write(body)
+
+    return hex.EncodeToString(h.Sum(nil))
+}
+
+// replayIdempotentResponse writes a stored response back to the client exactly as it was first served.
+func replayIdempotentResponse(w http.ResponseWriter, rec db.IdempotencyRecord) {
+    if rec.ContentType != "" {
+        w.Header().Set("Content-Type", rec.ContentType)
+    }
+
+    if rec.ETag != "" {
+        w.Header().Set("ETag", rec.ETag)
+    }
+
+    w.Header().Set("Idempotent-Replayed", "true")
+    w.WriteHeader(rec.StatusCode)
+    w.Write(rec.Body)
+}
+
+// serveIdempotent handles a mutating request which was made with an Idempotency-Key header.
+//
+// The first request for a (user, key, route) inserts a pending record before it is handled. The unique index on
+// those columns guarantees only one concurrent request wins the insert, any others are told the request is in progress.
+// Once the winner has been handled its response is saved to the record and replayed to any later retries.
+//
+// Server errors (5xx) and cancelled requests are not saved so that clients can retry them. Requests which are not
+// authenticated are handled normally, as keys could not be scoped to a user.
+func (h handler) serveIdempotent(w http.ResponseWriter, r *http.Request, key string) {
+    ctx := h.Ctx()
+
+    userId, authErr := authenticate(ctx, r)
+    if authErr != nil {
+        h.serve(w, r)
+        return
+    }
+
+    if len(key) > idempotencyKeyMaxLen {
+        h.serveError(w, r, models.ErrInvalidIdempotencyKey.New(strconv.Itoa(idempotencyKeyMaxLen)))
+        return
+    }
+
+    // Read body so it can be hashed, then put it back for the endpoint handler
+    body, err := ioutil.ReadAll(r.Body)
+    r.Body.Close()
+    if err != nil {
+        fmt.Printf("Error reading request body for idempotency check: %s\n", err)
+        h.serveError(w, r, models.ErrReadingRequestBody.New())
+        return
+    }
+    r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+    rec := db.IdempotencyRecord{
+        UserID: userId,
+        Key: key,
+        Route: r.Method + " " + r.URL.Path,
+        RequestHash: requestHash(r, body),
+    }
+
+    // Claim key
+    existing, err := ctx.Idempotency.Claim(r.Context(), &rec)
+    if err != nil {
+        fmt.Printf("Error saving idempotency record: %s\n", err)
+        h.serveError(w, r, models.ErrSavingIdempotencyKey.New())
+        return
+    }
+
+    // Key was already claimed
+    if existing != nil {
+        switch {
+        case existing.CreatedAt.Before(time.Now().Add(-idempotencyRetention(ctx))):
+            // Expired, forget it and handle the request like it is new
+            if err := ctx.Idempotency.Delete(r.Context(), existing); err != nil {
+                fmt.Printf("Error deleting expired idempotency record: %s\n", err)
+                h.serveError(w, r, models.ErrSavingIdempotencyKey.New())
+                return
+            }
+
+            h.serveIdempotent(w, r, key)
+        case existing.RequestHash != rec.RequestHash:
+            h.serveError(w, r, models.ErrIdempotencyKeyReused.New())
+        case existing.Completed == false:
+            w.Header().Set("Retry-After", "1")
+            h.serveError(w, r, models.ErrIdempotencyKeyInProgress.New())
+        default:
+            replayIdempotentResponse(w, *existing)
+        }
+
+        return
+    }
+
+    // Handle request and save response
+    recorder := &recordingResponseWriter{ResponseWriter: w}
+    h.serve(recorder, r)
+
+    // The request context may have been cancelled by now, but the claim must still be released or completed
+    if recorder.status >= 500 || recorder.status == models.StatusClientClosedRequest {
+        if err := ctx.Idempotency.Delete(context.Background(), &rec); err != nil {
+            fmt.Printf("Error releasing idempotency key: %s\n", err)
+        }
+
+        return
+    }
+
+    rec.Completed = true
+    rec.StatusCode = recorder.status
+    rec.ContentType = recorder.Header().Get("Content-Type")
+    rec.ETag = recorder.Header().Get("ETag")
+    rec.Body = recorder.body.Bytes()
+
+    if err := ctx.Idempotency.Complete(context.Background(), &rec); err != nil {
+        fmt.Printf("Error saving idempotent response: %s\n", err)
+    }
+}
+
+// PurgeIdempotencyRecords deletes idempotency records older than the retention window every interval. Blocks forever,
+// so should be run in its own goroutine.
+func PurgeIdempotencyRecords(ctx *models.AppContext, interval time.Duration) {
+    for range time.Tick(interval) {
+        cutoff := time.Now().Add(-idempotencyRetention(ctx))
+
+        if err := ctx.Idempotency.PurgeBefore(context.Background(), cutoff); err != nil {
+            fmt.Printf("Error purging expired idempotency records: %s\n", err)
+        }
+    }
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+
+    "github.com/Noah-Huppert/squad-up/server/models"
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+    "github.com/stretchr/testify/assert"
+)
+
+// AppContextProvider which always provides the same context
+type fixedCtxProvider struct {
+    ctx *models.AppContext
+}
+
+func (p fixedCtxProvider) Ctx () *models.AppContext {
+    return p.ctx
+}
+
+// Endpoint handler whose client goes away while it runs, the first time it is called
+type abandonedHandler struct {
+    cancel context.CancelFunc
+    calls *int
+}
+
+func (h abandonedHandler) Serve (reqCtx context.Context, ctx *models.AppContext, r *http.Request) (interface{}, *models.APIError) {
+    *h.calls++
+    if *h.calls == 1 {
+        h.cancel()
+        return nil, internalError(reqCtx, models.ErrSavingUser, "saving user", reqCtx.Err())
+    }
+
+    return staticResult{"done"}, nil
+}
+
+func TestHandler_ServeIdempotent_Canceled(t *testing.T) {
+    a := assert.New(t)
+
+    ctx := models.NewMemoryAppContext(models.Config{JWTServerURI: "squad-up@test/api/v1", JWTHMACKey: "test-hmac-key"})
+    user := db.User{FirstName: "Jane"}
+    a.Nil(ctx.Users.Create(context.Background(), &user))
+    token, err := IssueAccessToken(ctx, user.ID)
+    a.Nil(err)
+
+    calls := 0
+    send := func () *httptest.ResponseRecorder {
+        reqCtx, cancel := context.WithCancel(context.Background())
+        defer cancel()
+
+        h := handler{EndpointHandler: abandonedHandler{cancel, &calls}, AppContextProvider: fixedCtxProvider{ctx}}
+
+        r := httptest.NewRequest(http.MethodPost, "/", nil).WithContext(reqCtx)
+        r.Header.Set("Authorization", "Bearer " + token)
+        r.Header.Set(idempotencyKeyHeader, "save-1")
+
+        w := httptest.NewRecorder()
+        h.ServeHTTP(w, r)
+
+        return w
+    }
+
+    a.Equal(models.StatusClientClosedRequest, send().Code)
+
+    // The cancellation is not replayed, the retry is handled
+    w := send()
+    a.Equal(http.StatusOK, w.Code)
+    a.Empty(w.Header().Get("Idempotent-Replayed"))
+    a.Equal(2, calls)
+}
+
+// IdempotencyStore which can not delete records
+type undeletableIdempotencyStore struct {
+    models.IdempotencyStore
+}
+
+func (s undeletableIdempotencyStore) Delete (c context.Context, rec *db.IdempotencyRecord) error {
+    return errors.New("database is read only")
+}
+
+func TestHandler_ServeIdempotent_Expired(t *testing.T) {
+    a := assert.New(t)
+
+    ctx := models.NewMemoryAppContext(models.Config{JWTServerURI: "squad-up@test/api/v1", JWTHMACKey: "test-hmac-key", IdempotencyRetention: time.Hour})
+    ctx.Idempotency = undeletableIdempotencyStore{ctx.Idempotency}
+    user := db.User{FirstName: "Jane"}
+    a.Nil(ctx.Users.Create(context.Background(), &user))
+    token, err := IssueAccessToken(ctx, user.ID)
+    a.Nil(err)
+
+    // Record was claimed before the retention window
+    rec := db.IdempotencyRecord{UserID: user.ID, Key: "save-1", Route: "POST /", RequestHash: "old", Completed: true}
+    _, err = ctx.Idempotency.Claim(context.Background(), &rec)
+    a.Nil(err)
+    rec.CreatedAt = time.Now().Add(-2 * time.Hour)
+    a.Nil(ctx.Idempotency.Complete(context.Background(), &rec))
+
+    h := handler{EndpointHandler: staticHandler{staticResult{"done"}}, AppContextProvider: fixedCtxProvider{ctx}}
+
+    r := httptest.NewRequest(http.MethodPost, "/", nil)
+    r.Header.Set("Authorization", "Bearer " + token)
+    r.Header.Set(idempotencyKeyHeader, "save-1")
+
+    w := httptest.NewRecorder()
+    h.ServeHTTP(w, r)
+
+    a.Equal(http.StatusInternalServerError, w.Code)
+    a.Contains(w.Body.String(), models.ErrSavingIdempotencyKey.Id)
+}
@@ -0,0 +1,371 @@
+package handlers
+
+import (
+    "context"
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "net/http"
+    "net/mail"
+    "strconv"
+    "strings"
+    "time"
+
+    sqmail "github.com/Noah-Huppert/squad-up/server/mail"
+    "github.com/Noah-Huppert/squad-up/server/models"
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+)
+
+// Path invites are previewed and accepted under
+const invitesPath = "/api/v1/invites/"
+
+// Lifetime of invites, in hours
+const (
+    defaultInviteHours = 7 * 24
+    maxInviteHours = 30 * 24
+)
+
+// Max number of times an invite link can be accepted, emailed invites can only be accepted once
+const maxInviteUses = 1000
+
+// inviteView is an invite shown to the squad's managers, with the link they can share.
+type inviteView struct {
+    db.SquadInvite
+    Token string `json:"token"`
+    URL string `json:"url"`
+}
+
+type inviteResponse struct {
+    Invite inviteView `json:"invite"`
+}
+
+type invitesResponse struct {
+    Invites []inviteView `json:"invites"`
+}
+
+// invitePreview is what someone who has an invite can see before accepting it, which includes some details of private
+// squads.
+type invitePreview struct {
+    Squad db.Squad `json:"squad"`
+    Role string `json:"role"`
+    ExpiresAt time.Time `json:"expires_at"`
+    CreatedBy *db.User `json:"created_by,omitempty"`
+}
+
+type invitePreviewResponse struct {
+    Invite invitePreview `json:"invite"`
+}
+
+// inviteToken returns the token which identifies an invite in its link. Tokens are signed so the ids of invites can not
+// be guessed.
+func inviteToken (ctx *models.AppContext, invite db.SquadInvite) string {
+    return strconv.Itoa(invite.ID) + "." + inviteSignature(ctx, invite.ID, invite.Nonce)
+}
+
+// inviteSignature returns the signature of an invite's token.
+func inviteSignature (ctx *models.AppContext, id int, nonce string) string {
+    mac := hmac.New(sha256.New, []byte(ctx.Config.JWTHMACKey))
+    mac.Write([]byte("squad-invite:" + strconv.Itoa(id) + ":" + nonce))
+
+    return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// viewInvite returns the invite with its link.
+func viewInvite (ctx *models.AppContext, invite db.SquadInvite) inviteView {
+    token := inviteToken(ctx, invite)
+    return inviteView{invite, token, strings.TrimSuffix(ctx.Config.PublicURL, "/") + "/join/" + token}
+}
+
+// findInvite returns the invite identified by a token, with its squad. Returns models.ErrInviteNotFound if the token is
+// not valid, or an error describing why the invite can not be accepted.
+func findInvite (reqCtx context.Context, ctx *models.AppContext, token string, expand ...string) (*db.SquadInvite, *models.APIError) {
+    parts := strings.SplitN(token, ".", 2)
+    if len(parts) != 2 {
+        return nil, models.ErrInviteNotFound.New()
+    }
+
+    id, err := strconv.Atoi(parts[0])
+    if err != nil {
+        return nil, models.ErrInviteNotFound.New()
+    }
+
+    invite, err := ctx.Invites.FindById(reqCtx, id, append(expand, models.ExpandInviteSquad)...)
+    if err == models.ErrNotFound {
+        return nil, models.ErrInviteNotFound.New()
+    } else if err != nil {
+        return nil, internalError(reqCtx, models.ErrFindingSquad, "finding invite", err)
+    }
+
+    if hmac.Equal([]byte(parts[1]), []byte(inviteSignature(ctx, invite.ID, invite.Nonce))) == false || invite.Squad == nil {
+        return nil, models.ErrInviteNotFound.New()
+    }
+
+    if apiErr := inviteUnusableError(*invite, time.Now()); apiErr != nil {
+        return nil, apiErr
+    }
+
+    return invite, nil
+}
+
+// inviteUnusableError returns an error describing why an invite can not be accepted, nil if it can be.
+func inviteUnusableError (invite db.SquadInvite, now time.Time) *models.APIError {
+    switch {
+    case invite.RevokedAt != nil:
+        return models.ErrInviteRevoked.New()
+    case now.Before(invite.ExpiresAt) == false:
+        return models.ErrInviteExpired.New()
+    case invite.MaxUses != 0 && invite.Uses >= invite.MaxUses:
+        return models.ErrInviteUsedUp.New()
+    }
+
+    return nil
+}
+
+// acceptInvite adds a user to the invite's squad. Users who are already members keep their role and do not use up the
+// invite. Should be called in a transaction, so the invite is not used if adding the member fails.
+func acceptInvite (reqCtx context.Context, ctx *models.AppContext, invite *db.SquadInvite, user *db.User) (*db.SquadMembership, *models.APIError) {
+    if invite.Email != "" && strings.EqualFold(invite.Email, user.Email) == false {
+        return nil, models.ErrInviteEmailMismatch.New()
+    }
+
+    membership, err := ctx.Squads.FindMembership(reqCtx, invite.SquadID, user.ID)
+    if err == nil {
+        return membership, nil
+    } else if err != models.ErrNotFound {
+        return nil, internalError(reqCtx, models.ErrFindingSquad, "finding squad membership", err)
+    }
+
+    if invite.Squad.Archived() {
+        return nil, models.ErrSquadArchived.New()
+    }
+
+    // Another request may have used up or revoked the invite since it was loaded
+    now := time.Now()
+    if err := ctx.Invites.Use(reqCtx, invite.ID, now); err == models.ErrNotFound {
+        if current, err := ctx.Invites.FindById(reqCtx, invite.ID); err == nil {
+            if apiErr := inviteUnusableError(*current, now); apiErr != nil {
+                return nil, apiErr
+            }
+        }
+
+        return nil, models.ErrInviteUsedUp.New()
+    } else if err != nil {
+        return nil, internalError(reqCtx, models.ErrSavingInvite, "using invite", err)
+    }
+
+    membership = &db.SquadMembership{SquadID: invite.SquadID, UserID: user.ID, Role: invite.Role}
+    if err := ctx.Squads.AddMember(reqCtx, membership); err != nil {
+        return nil, internalError(reqCtx, models.ErrSavingSquad, "adding squad member", err)
+    }
+
+    return membership, nil
+}
+
+// transactionError returns the APIError which caused an AppContext.Transaction to fail.
+func transactionError (reqCtx context.Context, def *models.ErrorDef, action string, err error) *models.APIError {
+    if apiErr, ok := err.(*models.APIError); ok {
+        return apiErr
+    }
+
+    return internalError(reqCtx, def, action, err)
+}
+
+// listInvites returns the squad's invites which can still be accepted.
+func (h SquadsHandler) listInvites (q squadRequest) (interface{}, *models.APIError) {
+    invites, err := q.ctx.Invites.FindUsable(q.reqCtx, q.access.squad.ID, time.Now(), models.ExpandInviteCreatedBy)
+    if err != nil {
+        return nil, internalError(q.reqCtx, models.ErrFindingSquad, "listing invites", err)
+    }
+
+    views := make([]inviteView, len(invites))
+    for i, invite := range invites {
+        views[i] = viewInvite(q.ctx, invite)
+    }
+
+    return invitesResponse{views}, nil
+}
+
+// Options of a new invite
+type inviteRequest struct {
+    // Address to email the invite to, an invite link is created if empty
+    Email string `json:"email"`
+    Role string `json:"role"`
+    ExpiresInHours *int `json:"expires_in_hours"`
+    // Defaults to 1 for emailed invites and unlimited for links
+    MaxUses *int `json:"max_uses"`
+}
+
+// createInvite creates an invite link, or emails an invite.
+func (h SquadsHandler) createInvite (q squadRequest) (interface{}, *models.APIError) {
+    reqCtx, ctx, access, viewer := q.reqCtx, q.ctx, q.access, q.viewer
+
+    var req inviteRequest
+    if apiErr := decodeJSONBody(q.r, &req); apiErr != nil {
+        return nil, apiErr
+    }
+
+    invite := db.SquadInvite{SquadID: access.squad.ID, CreatedByID: viewer.ID, Role: db.SquadRoleMember}
+
+    // Email
+    if email := strings.TrimSpace(req.Email); email != "" {
+        addr, err := mail.ParseAddress(email)
+        if err != nil || addr.Address != email {
+            return nil, models.ErrInvalidEmail.New(email)
+        }
+
+        invite.Email = email
+        invite.MaxUses = 1
+    }
+
+    // Role, inviting users with any other role than member requires being able to give it to members
+    if req.Role != "" && req.Role != db.SquadRoleMember {
+        if req.Role == db.SquadRoleOwner || models.ValidRole(req.Role) == false {
+            return nil, models.ErrInvalidSquadRole.New(req.Role, strings.Join(models.Roles[1:], ", "))
+        } else if squadPolicy(ctx).CanAssignRole(access.role(), req.Role) == false {
+            return nil, models.ErrPermissionDenied.New(string(models.PermManageRoles))
+        }
+
+        invite.Role = req.Role
+    }
+
+    // Limits
+    hours := defaultInviteHours
+    if req.ExpiresInHours != nil {
+        if hours = *req.ExpiresInHours; hours < 1 || hours > maxInviteHours {
+            return nil, models.ErrFieldOutOfRange.New("expires_in_hours", "1", strconv.Itoa(maxInviteHours))
+        }
+    }
+    invite.ExpiresAt = time.Now().Add(time.Duration(hours) * time.Hour)
+
+    if req.MaxUses != nil {
+        if *req.MaxUses < 0 || *req.MaxUses > maxInviteUses {
+            return nil, models.ErrFieldOutOfRange.New("max_uses", "0", strconv.Itoa(maxInviteUses))
+        }
+
+        invite.MaxUses = *req.MaxUses
+    }
+
+    nonce := make([]byte, 16)
+    if _, err := rand.Read(nonce); err != nil {
+        return nil, internalError(reqCtx, models.ErrSavingInvite, "generating invite nonce", err)
+    }
+    invite.Nonce = base64.RawURLEncoding.EncodeToString(nonce)
+
+    if err := ctx.Invites.Create(reqCtx, &invite); err != nil {
+        return nil, internalError(reqCtx, models.ErrSavingInvite, "creating invite", err)
+    }
+
+    view := viewInvite(ctx, invite)
+
+    if invite.Email != "" {
+        msg := sqmail.Message{
+            To: invite.Email,
+            Subject: viewer.Name() + " invited you to join " + access.squad.Name + " on Squad Up",
+            Body: viewer.Name() + " invited you to join " + access.squad.Name + " on Squad Up.\n\n" +
+                "Accept the invite here: " + view.URL + "\n\n" +
+                "This invite expires on " + invite.ExpiresAt.UTC().Format("January 2, 2006 at 15:04 MST") + ".\n",
+        }
+
+        if err := ctx.Mailer.Send(reqCtx, msg); err != nil {
+            return nil, internalError(reqCtx, models.ErrSendingInviteEmail, "sending invite email", err)
+        }
+    }
+
+    return inviteResponse{view}, nil
+}
+
+// revokeInvite stops an invite from being accepted.
+func (h SquadsHandler) revokeInvite (q squadRequest) (interface{}, *models.APIError) {
+    reqCtx, ctx, access := q.reqCtx, q.ctx, q.access
+
+    inviteId, err := strconv.Atoi(q.params[0])
+    if err != nil {
+        return nil, models.ErrInviteNotFound.New()
+    }
+
+    invite, err := ctx.Invites.FindById(reqCtx, inviteId)
+    if err == models.ErrNotFound || (err == nil && invite.SquadID != access.squad.ID) {
+        return nil, models.ErrInviteNotFound.New()
+    } else if err != nil {
+        return nil, internalError(reqCtx, models.ErrFindingSquad, "finding invite", err)
+    }
+
+    if invite.RevokedAt == nil {
+        now := time.Now()
+        invite.RevokedAt = &now
+
+        if err := ctx.Invites.Update(reqCtx, invite); err != nil {
+            return nil, internalError(reqCtx, models.ErrSavingInvite, "revoking invite", err)
+        }
+    }
+
+    return inviteResponse{viewInvite(ctx, *invite)}, nil
+}
+
+// InvitesHandler lets people who were sent an invite join a squad.
+//
+//     GET  /api/v1/invites/{token}         Preview the invite's squad, does not require authentication
+//     POST /api/v1/invites/{token}/accept  Join the squad
+//
+// Invites can also be accepted while logging in, see ExchangeTokenHandler.
+type InvitesHandler struct {}
+
+func (h InvitesHandler) Serve (reqCtx context.Context, ctx *models.AppContext, r *http.Request) (interface{}, *models.APIError) {
+    parts := strings.Split(strings.TrimPrefix(r.URL.Path, invitesPath), "/")
+
+    switch {
+    case len(parts) == 1 && parts[0] != "":
+        return methodHandlers{
+            http.MethodGet: func () (interface{}, *models.APIError) {
+                return h.preview(reqCtx, ctx, parts[0])
+            },
+        }.serveMethod(r)
+    case len(parts) == 2 && parts[1] == "accept":
+        return methodHandlers{
+            http.MethodPost: func () (interface{}, *models.APIError) {
+                return h.accept(reqCtx, ctx, r, parts[0])
+            },
+        }.serveMethod(r)
+    }
+
+    return nil, models.ErrEndpointNotFound.New(r.URL.Path)
+}
+
+// preview shows which squad an invite is for.
+func (h InvitesHandler) preview (reqCtx context.Context, ctx *models.AppContext, token string) (interface{}, *models.APIError) {
+    invite, apiErr := findInvite(reqCtx, ctx, token, models.ExpandInviteCreatedBy)
+    if apiErr != nil {
+        return nil, apiErr
+    }
+
+    return invitePreviewResponse{invitePreview{*invite.Squad, invite.Role, invite.ExpiresAt, invite.CreatedBy}}, nil
+}
+
+// accept adds the authenticated user to the invite's squad.
+func (h InvitesHandler) accept (reqCtx context.Context, ctx *models.AppContext, r *http.Request, token string) (interface{}, *models.APIError) {
+    user, apiErr := currentUser(reqCtx, ctx, r)
+    if apiErr != nil {
+        return nil, apiErr
+    }
+
+    invite, apiErr := findInvite(reqCtx, ctx, token)
+    if apiErr != nil {
+        return nil, apiErr
+    }
+
+    var membership *db.SquadMembership
+    err := ctx.Transaction(reqCtx, func (tx *models.AppContext) error {
+        var apiErr *models.APIError
+        if membership, apiErr = acceptInvite(reqCtx, tx, invite, user); apiErr != nil {
+            return apiErr
+        }
+
+        return nil
+    })
+    if err != nil {
+        return nil, transactionError(reqCtx, models.ErrSavingSquad, "accepting invite", err)
+    }
+
+    return squadResponse{*invite.Squad, membership.Role}, nil
+}
@@ -0,0 +1,97 @@
+package handlers_test
+
+import (
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "testing"
+
+    "github.com/Noah-Huppert/squad-up/server/apitest"
+    "github.com/Noah-Huppert/squad-up/server/mail"
+    "github.com/Noah-Huppert/squad-up/server/models"
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+    "github.com/stretchr/testify/assert"
+)
+
+// Creates an invite through the API and returns its token
+func createInvite (h *apitest.Harness, token string, squadId int, body map[string]interface{}) string {
+    res := h.DoJSON(http.MethodPost, "/api/v1/squads/" + strconv.Itoa(squadId) + "/invites", token, body)
+    return res.AssertOK()["invite"].(map[string]interface{})["token"].(string)
+}
+
+func TestInvitesHandler_Link(t *testing.T) {
+    a := assert.New(t)
+    h := apitest.New(t)
+    defer h.Close()
+
+    _, ownerToken := h.SeedUser(db.User{FirstName: "Jane", Email: "jane@example.com"})
+    _, johnToken := h.SeedUser(db.User{FirstName: "John", Email: "john@example.com"})
+    _, eveToken := h.SeedUser(db.User{FirstName: "Eve", Email: "eve@example.com"})
+
+    id := createSquad(h, ownerToken, map[string]string{"name": "Hikers"})
+    path := "/api/v1/squads/" + strconv.Itoa(id)
+
+    // Only managers can invite
+    h.DoJSON(http.MethodPost, path + "/invites", johnToken, map[string]interface{}{}).AssertError(http.StatusNotFound, models.ErrSquadNotFound.Id)
+    h.DoJSON(http.MethodPost, path + "/invites", ownerToken, map[string]interface{}{"max_uses": -1}).AssertError(http.StatusUnprocessableEntity, models.ErrFieldOutOfRange.Id)
+
+    token := createInvite(h, ownerToken, id, map[string]interface{}{"max_uses": 1})
+
+    // Anyone with the link can preview the private squad
+    env := h.Get("/api/v1/invites/" + token, "").AssertOK()
+    a.Equal("Hikers", env["invite"].(map[string]interface{})["squad"].(map[string]interface{})["name"])
+
+    // Tampered tokens are rejected
+    h.Get("/api/v1/invites/" + token + "x", "").AssertError(http.StatusNotFound, models.ErrInviteNotFound.Id)
+
+    // Accept
+    env = h.DoJSON(http.MethodPost, "/api/v1/invites/" + token + "/accept", johnToken, nil).AssertOK()
+    a.Equal("member", env["role"])
+    a.Len(h.Get(path + "/members", ownerToken).AssertOK()["members"], 2)
+
+    // Accepting again does not use the invite up, but it is now used up for others
+    h.DoJSON(http.MethodPost, "/api/v1/invites/" + token + "/accept", eveToken, nil).AssertError(http.StatusGone, models.ErrInviteUsedUp.Id)
+    a.Len(h.Get(path + "/invites", ownerToken).AssertOK()["invites"], 0)
+
+    // Revoke
+    token = createInvite(h, ownerToken, id, map[string]interface{}{})
+    a.Len(h.Get(path + "/invites", ownerToken).AssertOK()["invites"], 1)
+
+    inviteId := strings.SplitN(token, ".", 2)[0]
+    h.DoJSON(http.MethodDelete, path + "/invites/" + inviteId, ownerToken, nil).AssertOK()
+    h.DoJSON(http.MethodPost, "/api/v1/invites/" + token + "/accept", eveToken, nil).AssertError(http.StatusGone, models.ErrInviteRevoked.Id)
+}
+
+func TestInvitesHandler_EmailAtLogin(t *testing.T) {
+    a := assert.New(t)
+    h := apitest.New(t)
+    defer h.Close()
+
+    _, ownerToken := h.SeedUser(db.User{FirstName: "Jane", Email: "jane@example.com"})
+    id := createSquad(h, ownerToken, map[string]string{"name": "Hikers"})
+
+    h.DoJSON(http.MethodPost, "/api/v1/squads/" + strconv.Itoa(id) + "/invites", ownerToken, map[string]interface{}{"email": "not an email"}).AssertError(http.StatusUnprocessableEntity, models.ErrInvalidEmail.Id)
+    token := createInvite(h, ownerToken, id, map[string]interface{}{"email": "bob@example.com"})
+
+    // Invite is emailed with its link
+    sent := h.Ctx.Mailer.(*mail.MemoryMailer).Sent()
+    if a.Len(sent, 1) {
+        a.Equal("bob@example.com", sent[0].To)
+        a.Contains(sent[0].Body, "/join/" + token)
+    }
+
+    // Only the invited address can accept
+    eve := apitest.GoogleIdentity{Sub: "2002", Email: "eve@example.com", EmailVerified: true, GivenName: "Eve"}
+    res := h.PostForm("/api/v1/auth/token/google", "", url.Values{"id_token": {h.Google.IdToken(eve)}, "invite": {token}})
+    res.AssertError(http.StatusForbidden, models.ErrInviteEmailMismatch.Id)
+
+    // New user joins the squad when they log in
+    bob := apitest.GoogleIdentity{Sub: "2001", Email: "bob@example.com", EmailVerified: true, GivenName: "Bob"}
+    res = h.PostForm("/api/v1/auth/token/google", "", url.Values{"id_token": {h.Google.IdToken(bob)}, "invite": {token}})
+    env := res.AssertOK()
+    a.Equal(float64(id), env["joined_squad_id"])
+
+    squads := h.Get("/api/v1/squads", env["access_token"].(string)).AssertOK()["squads"]
+    a.Len(squads, 1)
+}
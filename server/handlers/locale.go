@@ -0,0 +1,27 @@
+package handlers
+
+import (
+    "net/http"
+
+    "github.com/Noah-Huppert/squad-up/server/models"
+)
+
+// requestLocale determines the locale messages should be rendered in for a request. Uses the best supported locale
+// from the Accept-Language header. If the header is missing or lists no supported locales the locale Google gave the
+// authenticated user is used. Falls back to models.DefaultLocale.
+func requestLocale (ctx *models.AppContext, r *http.Request) string {
+    if locale, ok := models.NegotiateLocale(r.Header.Get("Accept-Language")); ok {
+        return locale
+    }
+
+    userId, authErr := authenticate(ctx, r)
+    if authErr == nil {
+        if user, err := ctx.Users.FindById(r.Context(), userId); err == nil {
+            if locale, ok := models.SupportedLocale(user.Locale); ok {
+                return locale
+            }
+        }
+    }
+
+    return models.DefaultLocale
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/Noah-Huppert/squad-up/server/metrics"
+    "github.com/Noah-Huppert/squad-up/server/models"
+)
+
+var (
+    httpRequests = metrics.NewCounterVec("squadup_http_requests_total", "Number of API requests handled.", "route", "method", "status")
+    httpRequestDuration = metrics.NewHistogramVec("squadup_http_request_duration_seconds", "Time taken to handle API requests.", nil, "route", "method", "status")
+    apiErrors = metrics.NewCounterVec("squadup_api_errors_total", "Number of API errors served, by error id.", "id")
+    googleTokenVerificationDuration = metrics.NewHistogramVec("squadup_google_token_verification_duration_seconds", "Time taken by Google to verify id tokens.", nil)
+    googleTokenVerificationFailures = metrics.NewCounterVec("squadup_google_token_verification_failures_total", "Number of Google id tokens which could not be verified.", "reason")
+)
+
+// statusResponseWriter records the status code of a response.
+type statusResponseWriter struct {
+    http.ResponseWriter
+    status int
+}
+
+func (w *statusResponseWriter) WriteHeader (code int) {
+    if w.status == 0 {
+        w.status = code
+    }
+
+    w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusResponseWriter) Write (p []byte) (int, error) {
+    if w.status == 0 {
+        w.status = http.StatusOK
+    }
+
+    return w.ResponseWriter.Write(p)
+}
+
+// metricsMethod returns the value of the method label for a request method. Methods clients can make up are labelled
+// "other", so they can not create new series.
+func metricsMethod (method string) string {
+    switch method {
+    case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete,
+        http.MethodOptions:
+        return method
+    }
+
+    return "other"
+}
+
+// instrument calls next and records the request count and latency.
+func instrument (route string, w http.ResponseWriter, r *http.Request, next func (http.ResponseWriter, *http.Request)) {
+    start := time.Now()
+    sw := &statusResponseWriter{ResponseWriter: w}
+
+    next(sw, r)
+
+    method, status := metricsMethod(r.Method), strconv.Itoa(sw.status)
+    httpRequests.Inc(route, method, status)
+    httpRequestDuration.Observe(time.Since(start).Seconds(), route, method, status)
+}
+
+// registerDBMetrics exposes the database connection pool's stats.
+func registerDBMetrics (ctx *models.AppContext) {
+    if ctx.Db == nil {
+        return
+    }
+
+    sqlDB := ctx.Db.DB()
+
+    metrics.NewGaugeFunc("squadup_db_open_connections", "Number of established database connections, in use and idle.", func () float64 {
+        return float64(sqlDB.Stats().OpenConnections)
+    })
+    metrics.NewGaugeFunc("squadup_db_in_use_connections", "Number of database connections currently in use.", func () float64 {
+        return float64(sqlDB.Stats().InUse)
+    })
+    metrics.NewGaugeFunc("squadup_db_idle_connections", "Number of idle database connections.", func () float64 {
+        return float64(sqlDB.Stats().Idle)
+    })
+    metrics.NewCounterFunc("squadup_db_wait_count_total", "Number of times a request waited for a database connection.", func () float64 {
+        return float64(sqlDB.Stats().WaitCount)
+    })
+    metrics.NewCounterFunc("squadup_db_wait_duration_seconds_total", "Time spent waiting for database connections.", func () float64 {
+        return sqlDB.Stats().WaitDuration.Seconds()
+    })
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    "github.com/stretchr/testify/assert"
+)
+
+func TestMetricsMethod(t *testing.T) {
+    a := assert.New(t)
+
+    a.Equal(http.MethodPatch, metricsMethod(http.MethodPatch))
+    a.Equal("other", metricsMethod("PROPFIND"))
+    a.Equal("other", metricsMethod("get"))
+}
+
+func TestMetricsHandler(t *testing.T) {
+    a := assert.New(t)
+
+    w := httptest.NewRecorder()
+    MetricsHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+    a.Equal(http.StatusOK, w.Code)
+    a.Contains(w.Body.String(), "squadup_http_requests_total")
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+    "net/http"
+    "strconv"
+    "strings"
+
+    "github.com/Noah-Huppert/squad-up/server/models"
+)
+
+// acceptQuality returns the quality value the Accept header gives a media type. Ranges like "application/*" and
+// "*/*" are considered, the most specific matching range is used. Returns -1 if no range matches.
+func acceptQuality (accept, mediaType string) float64 {
+    quality := -1.0
+    specificity := -1
+
+    for _, part := range strings.Split(accept, ",") {
+        fields := strings.Split(part, ";")
+        mediaRange := strings.ToLower(strings.TrimSpace(fields[0]))
+
+        q := 1.0
+        for _, param := range fields[1:] {
+            param = strings.TrimSpace(param)
+            if strings.HasPrefix(param, "q=") {
+                if parsed, err := strconv.ParseFloat(param[2:], 64); err == nil {
+                    q = parsed
+                }
+            }
+        }
+
+        var s int
+        switch {
+        case mediaRange == mediaType:
+            s = 2
+        case mediaRange == "*/*":
+            s = 0
+        case strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(mediaType, mediaRange[:len(mediaRange) - 1]):
+            s = 1
+        default:
+            continue
+        }
+
+        if s > specificity {
+            specificity = s
+            quality = q
+        }
+    }
+
+    return quality
+}
+
+// wantsProblemJSON reports if the client prefers errors as RFC 7807 problem details. The client must explicitly list
+// models.ProblemContentType in its Accept header, with a quality at least as high as application/json.
+func wantsProblemJSON (r *http.Request) bool {
+    accept := r.Header.Get("Accept")
+    if strings.Contains(strings.ToLower(accept), models.ProblemContentType) == false {
+        return false
+    }
+
+    problemQ := acceptQuality(accept, models.ProblemContentType)
+    return problemQ > 0 && problemQ >= acceptQuality(accept, "application/json")
+}
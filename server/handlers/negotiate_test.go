@@ -0,0 +1,113 @@
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+
+    "github.com/Noah-Huppert/squad-up/server/models"
+    "github.com/stretchr/testify/assert"
+)
+
+// Endpoint handler which always returns the same error
+type errorHandler struct {
+    Err *models.APIError
+}
+
+func (h errorHandler) Serve (reqCtx context.Context, ctx *models.AppContext, r *http.Request) (interface{}, *models.APIError) {
+    return nil, h.Err
+}
+
+func TestWantsProblemJSON(t *testing.T) {
+    a := assert.New(t)
+
+    matrix := map[string]bool{
+        "": false,
+        "*/*": false,
+        "application/json": false,
+        "application/problem+json": true,
+        "application/json, application/problem+json": true,
+        "application/json;q=0.9, application/problem+json": true,
+        "application/json, application/problem+json;q=0.5": false,
+        "application/problem+json;q=0": false,
+    }
+
+    for accept, expected := range matrix {
+        r := httptest.NewRequest(http.MethodGet, "/", nil)
+        r.Header.Set("Accept", accept)
+
+        a.Equal(expected, wantsProblemJSON(r), "Accept: " + accept)
+    }
+}
+
+func TestHandler_ServeHTTP_Problem(t *testing.T) {
+    a := assert.New(t)
+    h := handler{EndpointHandler: errorHandler{models.ErrMissingParam.New("id_token")}, AppContextProvider: emptyCtxProvider{}}
+
+    r := httptest.NewRequest(http.MethodPost, "/api/v1/auth/token/google?x=1", nil)
+    r.Header.Set("Accept", models.ProblemContentType)
+
+    w := httptest.NewRecorder()
+    h.ServeHTTP(w, r)
+
+    a.Equal(http.StatusUnprocessableEntity, w.Code)
+    a.Equal(models.ProblemContentType, w.Header().Get("Content-Type"))
+
+    var problem map[string]interface{}
+    a.Nil(json.Unmarshal(w.Body.Bytes(), &problem))
+
+    a.Equal(map[string]interface{}{
+        "type": models.ErrorDocsURL + "#missing_param",
+        "title": "Unprocessable Entity",
+        "status": float64(422),
+        "detail": "`id_token` must be provided as a post parameter",
+        "instance": "/api/v1/auth/token/google?x=1",
+        "id": "missing_param",
+    }, problem)
+
+    // Envelope format is still the default
+    w = httptest.NewRecorder()
+    h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+
+    var envelope map[string]map[string]interface{}
+    a.Nil(json.Unmarshal(w.Body.Bytes(), &envelope))
+    a.Equal("missing_param", envelope["error"]["id"])
+}
+
+// Endpoint handler which waits for its request to be cancelled, then fails like a store call would unless it finishes
+type slowHandler struct {
+    finishes bool
+}
+
+func (h slowHandler) Serve (reqCtx context.Context, ctx *models.AppContext, r *http.Request) (interface{}, *models.APIError) {
+    <-reqCtx.Done()
+
+    if h.finishes {
+        return staticResult{"too late"}, nil
+    }
+
+    return nil, models.ErrFindingUser.New()
+}
+
+func TestHandler_ServeHTTP_Timeout(t *testing.T) {
+    a := assert.New(t)
+    h := handler{EndpointHandler: slowHandler{}, AppContextProvider: emptyCtxProvider{}, timeout: time.Millisecond}
+
+    w := httptest.NewRecorder()
+    h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+    a.Equal(http.StatusServiceUnavailable, w.Code)
+    a.Contains(w.Body.String(), models.ErrRequestTimeout.Id)
+
+    // Handlers which finished anyway keep their result
+    h.EndpointHandler = slowHandler{finishes: true}
+
+    w = httptest.NewRecorder()
+    h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+    a.Equal(http.StatusOK, w.Code)
+    a.Contains(w.Body.String(), "too late")
+}
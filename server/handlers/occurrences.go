@@ -0,0 +1,448 @@
+package handlers
+
+import (
+    "context"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/Noah-Huppert/squad-up/server/models"
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+)
+
+// Max number of occurrences of each recurring event listed
+const maxListedOccurrences = 500
+
+// Which occurrences of a recurring event a change applies to, from the ?scope query parameter
+const (
+    // Only the occurrence, the default for occurrences
+    scopeThis = "this"
+    // The occurrence and the ones after it, which are split into a new series
+    scopeFollowing = "following"
+    // Every occurrence, the only scope of changes made to a series directly
+    scopeAll = "all"
+)
+
+var eventScopes = []string{scopeThis, scopeFollowing, scopeAll}
+
+// eventScope returns which occurrences a change made through a request applies to. Changes to events which do not
+// repeat have the scopeThis scope.
+func eventScope (r *http.Request, access eventAccess) (string, *models.APIError) {
+    scope := r.URL.Query().Get("scope")
+    if scope != "" && scope != scopeThis && scope != scopeFollowing && scope != scopeAll {
+        return "", models.ErrInvalidChoice.New("scope", scope, strings.Join(eventScopes, ", "))
+    }
+
+    switch {
+    case access.event.Recurring():
+        if scope != "" && scope != scopeAll {
+            return "", models.ErrOccurrenceRequired.New()
+        }
+
+        return scopeAll, nil
+    case access.series == nil || scope == "":
+        return scopeThis, nil
+    }
+
+    return scope, nil
+}
+
+// loadOccurrence loads the series of an occurrence. If the event is a series and the ?occurrence query parameter is
+// set, the event is replaced by the occurrence which starts at that time, generated from the series if not saved.
+func loadOccurrence (reqCtx context.Context, ctx *models.AppContext, r *http.Request, access *eventAccess, expand ...string) *models.APIError {
+    event := access.event
+
+    if event.ParentID != nil {
+        series, err := ctx.Events.FindById(reqCtx, *event.ParentID)
+        if err != nil {
+            return internalError(reqCtx, models.ErrFindingEvent, "finding event series", err)
+        }
+
+        access.series = series
+        return nil
+    }
+
+    value := r.URL.Query().Get("occurrence")
+    if value == "" {
+        return nil
+    } else if event.Recurring() == false {
+        return models.ErrOccurrenceNotFound.New(value)
+    }
+
+    start, apiErr := parseTime("occurrence", value)
+    if apiErr != nil {
+        return apiErr
+    }
+
+    rule, loc, err := models.SeriesRule(*event)
+    if err != nil {
+        return internalError(reqCtx, models.ErrFindingEvent, "parsing recurrence rule", err)
+    }
+
+    if event.ExDates.Contains(start) || rule.Includes(event.StartsAt, loc, start) == false {
+        return models.ErrOccurrenceNotFound.New(value)
+    }
+
+    instances, err := ctx.Events.FindOccurrences(reqCtx, []int{event.ID})
+    if err != nil {
+        return internalError(reqCtx, models.ErrFindingEvent, "finding occurrence", err)
+    }
+
+    occurrence := models.Occurrence(*event, start)
+    for _, instance := range instances {
+        if instance.OriginalStartsAt.Equal(start) {
+            saved, err := ctx.Events.FindById(reqCtx, instance.ID, expand...)
+            if err != nil {
+                return internalError(reqCtx, models.ErrFindingEvent, "finding occurrence", err)
+            }
+
+            occurrence = *saved
+        }
+    }
+
+    access.series, access.event = event, &occurrence
+
+    return nil
+}
+
+// unsaved reports if the event is an occurrence which was generated from its series.
+func (a eventAccess) unsaved () bool {
+    return a.series != nil && a.event.ID == a.series.ID
+}
+
+// saveEvent saves changes to an event. Occurrences generated from their series are saved as new events.
+func saveEvent (reqCtx context.Context, ctx *models.AppContext, access eventAccess, event *db.Event) error {
+    if access.unsaved() == false {
+        return ctx.Events.Update(reqCtx, event)
+    }
+
+    event.ID = 0
+    event.TableMetadata = db.TableMetadata{}
+
+    return ctx.Events.Create(reqCtx, event)
+}
+
+// expandSeries replaces the recurring events in a list with their occurrences which end after from and start before
+// to. Saved occurrences in the range are already in the list since they are regular events.
+func expandSeries (reqCtx context.Context, ctx *models.AppContext, events []db.Event, from, to time.Time) ([]db.Event, *models.APIError) {
+    var seriesIds []int
+    for _, event := range events {
+        if event.Recurring() {
+            seriesIds = append(seriesIds, event.ID)
+        }
+    }
+
+    if len(seriesIds) == 0 {
+        return events, nil
+    }
+
+    instances, err := ctx.Events.FindOccurrences(reqCtx, seriesIds)
+    if err != nil {
+        return nil, internalError(reqCtx, models.ErrFindingEvent, "listing occurrences", err)
+    }
+
+    saved := make(map[int][]db.Event)
+    for _, instance := range instances {
+        saved[*instance.ParentID] = append(saved[*instance.ParentID], instance)
+    }
+
+    var expanded []db.Event
+    for _, event := range events {
+        if event.Recurring() == false {
+            expanded = append(expanded, event)
+            continue
+        }
+
+        occurrences, err := models.ExpandSeries(event, saved[event.ID], from, to, maxListedOccurrences)
+        if err != nil {
+            return nil, internalError(reqCtx, models.ErrFindingEvent, "expanding recurring event", err)
+        }
+
+        expanded = append(expanded, occurrences...)
+    }
+
+    models.SortEvents(expanded)
+
+    return expanded, nil
+}
+
+// seriesChange is a change to the occurrences of a series in a scope other than scopeThis.
+type seriesChange struct {
+    // Series being changed. A new series when the change applies to following occurrences.
+    series *db.Event
+    // Series the new series was split from, ending before it. Nil if the whole series is changed.
+    truncated *db.Event
+    // Saved occurrences in the scope
+    instances []db.Event
+}
+
+// loadSeriesChange loads the occurrences a change to an event applies to. Changing the following occurrences from the
+// first one changes the whole series.
+func loadSeriesChange (reqCtx context.Context, ctx *models.AppContext, access eventAccess, scope string) (seriesChange, *models.APIError) {
+    series := *access.event
+    if access.series != nil {
+        series = *access.series
+    }
+
+    change := seriesChange{series: &series}
+
+    instances, err := ctx.Events.FindOccurrences(reqCtx, []int{series.ID})
+    if err != nil {
+        return change, internalError(reqCtx, models.ErrFindingEvent, "finding occurrences", err)
+    }
+
+    if scope != scopeFollowing || access.event.OriginalStartsAt.After(series.StartsAt) == false {
+        change.instances = instances
+        return change, nil
+    }
+
+    at := *access.event.OriginalStartsAt
+    following, err := models.SplitSeries(&series, at)
+    if err != nil {
+        return change, internalError(reqCtx, models.ErrSavingEvent, "splitting series", err)
+    }
+
+    change.series, change.truncated = &following, &series
+    for _, instance := range instances {
+        if instance.OriginalStartsAt.Before(at) == false {
+            change.instances = append(change.instances, instance)
+        }
+    }
+
+    return change, nil
+}
+
+// save saves the changed series and occurrences. Occurrences split from their series are moved to the new one.
+func (c seriesChange) save (reqCtx context.Context, tx *models.AppContext) error {
+    if c.truncated != nil {
+        if err := tx.Events.Update(reqCtx, c.truncated); err != nil {
+            return err
+        } else if err := tx.Events.Create(reqCtx, c.series); err != nil {
+            return err
+        }
+    } else if err := tx.Events.Update(reqCtx, c.series); err != nil {
+        return err
+    }
+
+    for i := range c.instances {
+        c.instances[i].ParentID = &c.series.ID
+        if err := tx.Events.Update(reqCtx, &c.instances[i]); err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
+
+// view returns the event a change was made through, as it is after the change. start is the time the occurrence
+// starts at according to the changed series, ignored for changes made to a series directly.
+func (c seriesChange) view (access eventAccess, start time.Time) db.Event {
+    if access.series == nil {
+        return *c.series
+    }
+
+    for _, instance := range c.instances {
+        if instance.OriginalStartsAt.Equal(start) {
+            return instance
+        }
+    }
+
+    return models.Occurrence(*c.series, start)
+}
+
+// updateSeries applies a patch made to an occurrence, or a series, to the occurrences in scope. Times are moved by as
+// much as the occurrence was, on the wall clock of the series' time zone. Fields included in the patch overwrite
+// changes made to single occurrences, other fields are left as is.
+func (h EventsHandler) updateSeries (reqCtx context.Context, ctx *models.AppContext, access eventAccess, scope string, patch eventPatch) (interface{}, *models.APIError) {
+    // Validate times against the occurrence they were changed on
+    occurrence := *access.event
+    edited := occurrence
+    times := patch
+    times.RRule = nil
+    if apiErr := times.apply(&edited); apiErr != nil {
+        return nil, apiErr
+    }
+
+    change, apiErr := loadSeriesChange(reqCtx, ctx, access, scope)
+    if apiErr != nil {
+        return nil, apiErr
+    }
+
+    _, loc, err := models.SeriesRule(*change.series)
+    if err != nil {
+        return nil, internalError(reqCtx, models.ErrSavingEvent, "parsing recurrence rule", err)
+    }
+
+    move := func (t time.Time) time.Time {
+        return models.ShiftLocal(t, loc, occurrence.StartsAt, edited.StartsAt)
+    }
+    retimed := patch.StartsAt != nil || patch.EndsAt != nil
+
+    // Fields are applied before times, so the times of the occurrence are not copied to others
+    fields := patch
+    fields.StartsAt, fields.EndsAt = nil, nil
+
+    retime := func (event *db.Event) {
+        duration := event.EndsAt.Sub(event.StartsAt)
+        if retimed {
+            duration = edited.EndsAt.Sub(edited.StartsAt)
+        }
+
+        event.StartsAt = move(event.StartsAt)
+        event.EndsAt = event.StartsAt.Add(duration)
+    }
+
+    series := change.series
+    if apiErr := fields.apply(series); apiErr != nil {
+        return nil, apiErr
+    }
+
+    retime(series)
+    exDates := make(db.TimeList, len(series.ExDates))
+    for i, date := range series.ExDates {
+        exDates[i] = move(date)
+    }
+    series.ExDates = exDates
+
+    if err := models.SetRecursUntil(series); err != nil {
+        return nil, models.ErrInvalidRRule.New(series.RRule)
+    }
+
+    fields.RRule = nil
+    for i := range change.instances {
+        instance := &change.instances[i]
+        if apiErr := fields.apply(instance); apiErr != nil {
+            return nil, apiErr
+        }
+
+        retime(instance)
+        start := move(*instance.OriginalStartsAt)
+        instance.OriginalStartsAt = &start
+    }
+
+    // Seats added to occurrences go to their waitlisted users
+    promoted := make(map[int][]db.RSVP)
+
+    err = ctx.Transaction(reqCtx, func (tx *models.AppContext) error {
+        if err := change.save(reqCtx, tx); err != nil {
+            return err
+        }
+
+        if patch.Capacity != nil {
+            for i, instance := range change.instances {
+                rsvps, err := tx.RSVPs.Reseat(reqCtx, instance.ID)
+                if err != nil {
+                    return err
+                }
+
+                promoted[i] = rsvps
+            }
+        }
+
+        return nil
+    })
+    if err != nil {
+        return nil, internalError(reqCtx, models.ErrSavingEvent, "saving series", err)
+    }
+
+    for i, rsvps := range promoted {
+        notifyPromoted(ctx, change.instances[i], rsvps)
+    }
+
+    start := edited.StartsAt
+    if occurrence.OriginalStartsAt != nil {
+        start = move(*occurrence.OriginalStartsAt)
+    }
+
+    return eventResponse{change.view(access, start)}, nil
+}
+
+// cancelSeries cancels the occurrences of a series in scope.
+func (h EventsHandler) cancelSeries (reqCtx context.Context, ctx *models.AppContext, access eventAccess, scope string) (interface{}, *models.APIError) {
+    change, apiErr := loadSeriesChange(reqCtx, ctx, access, scope)
+    if apiErr != nil {
+        return nil, apiErr
+    }
+
+    now := time.Now()
+    cancel := func (event *db.Event) {
+        if event.Cancelled() == false {
+            event.Status = db.EventStatusCancelled
+            event.CancelledAt = &now
+        }
+    }
+
+    cancel(change.series)
+    for i := range change.instances {
+        cancel(&change.instances[i])
+    }
+
+    err := ctx.Transaction(reqCtx, func (tx *models.AppContext) error {
+        return change.save(reqCtx, tx)
+    })
+    if err != nil {
+        return nil, internalError(reqCtx, models.ErrSavingEvent, "cancelling series", err)
+    }
+
+    start := access.event.StartsAt
+    if access.event.OriginalStartsAt != nil {
+        start = *access.event.OriginalStartsAt
+    }
+
+    return eventResponse{change.view(access, start)}, nil
+}
+
+// removeSeries deletes the occurrences of a series in scope. Deleting the following occurrences ends the series
+// before them.
+func (h EventsHandler) removeSeries (reqCtx context.Context, ctx *models.AppContext, access eventAccess, scope string) (interface{}, *models.APIError) {
+    change, apiErr := loadSeriesChange(reqCtx, ctx, access, scope)
+    if apiErr != nil {
+        return nil, apiErr
+    }
+
+    err := ctx.Transaction(reqCtx, func (tx *models.AppContext) error {
+        for _, instance := range change.instances {
+            if err := tx.Events.Delete(reqCtx, instance.ID); err != nil {
+                return err
+            }
+        }
+
+        if change.truncated != nil {
+            return tx.Events.Update(reqCtx, change.truncated)
+        }
+
+        return tx.Events.Delete(reqCtx, change.series.ID)
+    })
+    if err != nil {
+        return nil, internalError(reqCtx, models.ErrSavingEvent, "deleting series", err)
+    }
+
+    now := time.Now()
+    access.event.DeletedAt = &now
+
+    return eventResponse{*access.event}, nil
+}
+
+// removeOccurrence deletes a single occurrence by excluding it from its series.
+func (h EventsHandler) removeOccurrence (reqCtx context.Context, ctx *models.AppContext, access eventAccess) (interface{}, *models.APIError) {
+    series := *access.series
+    series.ExDates = append(append(db.TimeList{}, series.ExDates...), *access.event.OriginalStartsAt)
+
+    err := ctx.Transaction(reqCtx, func (tx *models.AppContext) error {
+        if err := tx.Events.Update(reqCtx, &series); err != nil {
+            return err
+        } else if access.unsaved() {
+            return nil
+        }
+
+        return tx.Events.Delete(reqCtx, access.event.ID)
+    })
+    if err != nil {
+        return nil, internalError(reqCtx, models.ErrSavingEvent, "deleting occurrence", err)
+    }
+
+    now := time.Now()
+    access.event.DeletedAt = &now
+
+    return eventResponse{*access.event}, nil
+}
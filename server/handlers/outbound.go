@@ -0,0 +1,24 @@
+package handlers
+
+import (
+    "context"
+    "net/http"
+
+    "github.com/Noah-Huppert/squad-up/server/models"
+)
+
+// httpGet makes a GET request which is cancelled along with the request context. Uses Config.HTTPClient, or
+// http.DefaultClient if one is not configured.
+func httpGet (reqCtx context.Context, ctx *models.AppContext, url string) (*http.Response, error) {
+    req, err := http.NewRequest(http.MethodGet, url, nil)
+    if err != nil {
+        return nil, err
+    }
+
+    client := ctx.Config.HTTPClient
+    if client == nil {
+        client = http.DefaultClient
+    }
+
+    return client.Do(req.WithContext(reqCtx))
+}
@@ -0,0 +1,580 @@
+package handlers
+
+import (
+    "context"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/Noah-Huppert/squad-up/server/models"
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+    "github.com/Noah-Huppert/squad-up/server/voting"
+)
+
+// Path poll endpoints are registered under
+const pollsPath = "/api/v1/polls"
+
+// Limits of polls
+const (
+    minPollOptions = 2
+    maxPollOptions = 20
+    maxPollQuestionLength = 200
+    maxPollOptionLength = 100
+    // Highest max score of score polls, and the max score they get by default
+    maxPollScore = 10
+    defaultPollScore = 5
+)
+
+// PollsHandler serves polls, which let a squad or the people invited to an event vote between options. Polls are
+// counted with one of the voting.Method methods, see the voting package for how ties are broken.
+//
+//     GET    /api/v1/polls?squad_id={id}      Squad's polls, newest first
+//     GET    /api/v1/polls?event_id={id}      Event's polls, newest first
+//     POST   /api/v1/polls                    Create poll, see pollRequest
+//     GET    /api/v1/polls/{id}               View poll, its results and the viewer's ballot
+//     DELETE /api/v1/polls/{id}               Delete poll
+//     PUT    /api/v1/polls/{id}/ballots/me    Cast or replace the viewer's ballot, see ballotRequest
+//     POST   /api/v1/polls/{id}/close         Close poll before its deadline
+//
+// Squad polls can be seen and voted in by members whose role has the models.PermRSVP permission. They are created by
+// members with the models.PermCreateEvents permission, and managed by their creator while they can create events, or
+// by members with the models.PermManageEvents permission. Event polls can be seen and voted in by anyone who can see
+// the event, and are created and managed by the users who can edit it.
+//
+// Polls close on their own once their closes_at deadline passes. Ballots of anonymous polls are counted, but who cast
+// them is never returned.
+type PollsHandler struct {}
+
+type pollsResponse struct {
+    Polls []db.Poll `json:"polls"`
+}
+
+// pollBallot is a ballot cast in a poll.
+type pollBallot struct {
+    // Voter, omitted for the viewer's own ballot
+    UserID int `json:"user_id,omitempty"`
+    // Options picked, ranked polls list them from most to least preferred
+    Choices []int `json:"choices"`
+    // Score given to each option by option id, for score polls
+    Scores map[string]int `json:"scores,omitempty"`
+}
+
+type pollResponse struct {
+    Poll db.Poll `json:"poll"`
+    // Closed reports if the poll no longer accepts ballots, either because it was closed or its deadline passed
+    Closed bool `json:"closed"`
+    Results voting.Result `json:"results"`
+    // Viewer's ballot, with no choices if they did not vote
+    Ballot pollBallot `json:"ballot"`
+    // Every ballot cast, omitted for anonymous polls
+    Ballots []pollBallot `json:"ballots,omitempty"`
+}
+
+// votingPollAccess is a poll loaded for a request and what it is attached to.
+type votingPollAccess struct {
+    poll *db.Poll
+    // Viewer's membership in the poll's squad, for squad polls
+    squad squadAccess
+    // Event of event polls, nil for squad polls
+    event *eventAccess
+}
+
+// canManage reports if the viewer can close or delete the poll.
+func (a votingPollAccess) canManage (policy models.Policy, viewerId int) bool {
+    if a.event != nil {
+        return a.event.canEdit(policy, viewerId)
+    }
+
+    role := a.squad.role()
+
+    return policy.Allows(role, models.PermManageEvents) ||
+        (a.poll.CreatorID == viewerId && policy.Allows(role, models.PermCreateEvents))
+}
+
+// checkWritable returns an error if what the poll is attached to can no longer change.
+func (a votingPollAccess) checkWritable () *models.APIError {
+    if a.event != nil {
+        return checkPollEvent(*a.event)
+    } else if a.squad.squad.Archived() {
+        return models.ErrSquadArchived.New()
+    }
+
+    return nil
+}
+
+// checkManageable returns an error if the viewer can not close or delete the poll.
+func (a votingPollAccess) checkManageable (ctx *models.AppContext, viewerId int) *models.APIError {
+    if a.canManage(squadPolicy(ctx), viewerId) == false {
+        return models.ErrPermissionDenied.New(string(models.PermManageEvents))
+    }
+
+    return a.checkWritable()
+}
+
+// checkPollEvent returns an error if polls of an event can not be created or voted in.
+func checkPollEvent (access eventAccess) *models.APIError {
+    if access.event.Cancelled() {
+        return models.ErrEventCancelled.New()
+    } else if access.squad != nil && access.squad.Archived() {
+        return models.ErrSquadArchived.New()
+    }
+
+    return nil
+}
+
+func (h PollsHandler) Serve (reqCtx context.Context, ctx *models.AppContext, r *http.Request) (interface{}, *models.APIError) {
+    viewer, apiErr := currentUser(reqCtx, ctx, r)
+    if apiErr != nil {
+        return nil, apiErr
+    }
+
+    parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, pollsPath), "/"), "/")
+
+    // Collection
+    if parts[0] == "" {
+        return methodHandlers{
+            http.MethodGet: func () (interface{}, *models.APIError) {
+                return h.list(reqCtx, ctx, r, viewer)
+            },
+            http.MethodPost: func () (interface{}, *models.APIError) {
+                return h.create(reqCtx, ctx, r, viewer)
+            },
+        }.serveMethod(r)
+    }
+
+    access, apiErr := loadVotingPoll(reqCtx, ctx, parts[0], viewer.ID)
+    if apiErr != nil {
+        return nil, apiErr
+    }
+
+    switch {
+    case len(parts) == 1:
+        return methodHandlers{
+            http.MethodGet: func () (interface{}, *models.APIError) {
+                return h.view(reqCtx, ctx, access, viewer)
+            },
+            http.MethodDelete: func () (interface{}, *models.APIError) {
+                return h.remove(reqCtx, ctx, access, viewer)
+            },
+        }.serveMethod(r)
+    case len(parts) == 3 && parts[1] == "ballots" && parts[2] == "me":
+        return methodHandlers{
+            http.MethodPut: func () (interface{}, *models.APIError) {
+                return h.vote(reqCtx, ctx, r, access, viewer)
+            },
+        }.serveMethod(r)
+    case len(parts) == 2 && parts[1] == "close":
+        return methodHandlers{
+            http.MethodPost: func () (interface{}, *models.APIError) {
+                return h.close(reqCtx, ctx, access, viewer)
+            },
+        }.serveMethod(r)
+    }
+
+    return nil, models.ErrEndpointNotFound.New(r.URL.Path)
+}
+
+// loadVotingPoll loads the poll with the provided id and what it is attached to. Users who can not vote in the poll
+// get the same models.ErrPollNotFound error as if it did not exist.
+func loadVotingPoll (reqCtx context.Context, ctx *models.AppContext, id string, viewerId int) (votingPollAccess, *models.APIError) {
+    var access votingPollAccess
+
+    pollId, err := strconv.Atoi(id)
+    if err != nil {
+        return access, models.ErrPollNotFound.New(id)
+    }
+
+    access.poll, err = ctx.Polls.FindById(reqCtx, pollId)
+    if err == models.ErrNotFound {
+        return access, models.ErrPollNotFound.New(id)
+    } else if err != nil {
+        return access, internalError(reqCtx, models.ErrFindingPoll, "finding poll", err)
+    }
+
+    if access.poll.EventID != nil {
+        event, apiErr := loadEvent(reqCtx, ctx, strconv.Itoa(*access.poll.EventID), viewerId)
+        if apiErr != nil && apiErr.Id == models.ErrEventNotFound.Id {
+            return access, models.ErrPollNotFound.New(id)
+        } else if apiErr != nil {
+            return access, apiErr
+        }
+
+        access.event = &event
+
+        return access, nil
+    }
+
+    access.squad, err = loadPollSquad(reqCtx, ctx, *access.poll.SquadID, viewerId)
+    if err != nil {
+        return access, internalError(reqCtx, models.ErrFindingPoll, "finding poll squad", err)
+    }
+
+    if squadPolicy(ctx).Allows(access.squad.role(), models.PermRSVP) == false {
+        return access, models.ErrPollNotFound.New(id)
+    }
+
+    return access, nil
+}
+
+// loadPollSquad loads a squad which is known to exist and the viewer's membership in it.
+func loadPollSquad (reqCtx context.Context, ctx *models.AppContext, squadId, viewerId int) (squadAccess, error) {
+    var access squadAccess
+    var err error
+
+    if access.squad, err = ctx.Squads.FindById(reqCtx, squadId); err != nil {
+        return access, err
+    }
+
+    access.membership, err = ctx.Squads.FindMembership(reqCtx, squadId, viewerId)
+    if err == models.ErrNotFound {
+        return access, nil
+    }
+
+    return access, err
+}
+
+// list returns the polls of a squad or an event.
+func (h PollsHandler) list (reqCtx context.Context, ctx *models.AppContext, r *http.Request, viewer *db.User) (interface{}, *models.APIError) {
+    query := r.URL.Query()
+
+    var filter models.PollFilter
+    switch {
+    case query.Get("event_id") != "":
+        access, apiErr := loadEvent(reqCtx, ctx, query.Get("event_id"), viewer.ID)
+        if apiErr != nil {
+            return nil, apiErr
+        }
+
+        filter.EventID = access.event.ID
+    case query.Get("squad_id") != "":
+        access, apiErr := loadSquad(reqCtx, ctx, query.Get("squad_id"), viewer.ID)
+        if apiErr != nil {
+            return nil, apiErr
+        } else if apiErr := squadPolicy(ctx).Check(access.role(), models.PermRSVP); apiErr != nil {
+            return nil, apiErr
+        }
+
+        filter.SquadID = access.squad.ID
+    default:
+        return nil, models.ErrPollTarget.New()
+    }
+
+    polls, err := ctx.Polls.Find(reqCtx, filter)
+    if err != nil {
+        return nil, internalError(reqCtx, models.ErrFindingPoll, "listing polls", err)
+    }
+
+    if polls == nil {
+        polls = []db.Poll{}
+    }
+
+    return pollsResponse{polls}, nil
+}
+
+// Body of a request to create a poll
+type pollRequest struct {
+    // Exactly one of SquadID and EventID must be provided
+    SquadID int `json:"squad_id"`
+    EventID int `json:"event_id"`
+    Question *string `json:"question"`
+    Description *string `json:"description"`
+    // One of the voting.Method constants
+    Method string `json:"method"`
+    // Highest score of score polls, defaults to defaultPollScore
+    MaxScore int `json:"max_score"`
+    Anonymous bool `json:"anonymous"`
+    // RFC 3339 time the poll closes at, optional
+    ClosesAt string `json:"closes_at"`
+    // Labels of the options in order
+    Options []string `json:"options"`
+}
+
+// create saves a new poll created by the viewer.
+func (h PollsHandler) create (reqCtx context.Context, ctx *models.AppContext, r *http.Request, viewer *db.User) (interface{}, *models.APIError) {
+    var req pollRequest
+    if apiErr := decodeJSONBody(r, &req); apiErr != nil {
+        return nil, apiErr
+    }
+
+    poll := db.Poll{CreatorID: viewer.ID}
+
+    switch {
+    case (req.SquadID == 0) == (req.EventID == 0):
+        return nil, models.ErrPollTarget.New()
+    case req.EventID != 0:
+        access, apiErr := loadEvent(reqCtx, ctx, strconv.Itoa(req.EventID), viewer.ID)
+        if apiErr != nil {
+            return nil, apiErr
+        } else if apiErr := checkEditable(ctx, access, viewer.ID); apiErr != nil {
+            return nil, apiErr
+        } else if apiErr := checkPollEvent(access); apiErr != nil {
+            return nil, apiErr
+        }
+
+        poll.EventID = &access.event.ID
+    default:
+        access, apiErr := loadSquad(reqCtx, ctx, strconv.Itoa(req.SquadID), viewer.ID)
+        if apiErr != nil {
+            return nil, apiErr
+        } else if apiErr := squadPolicy(ctx).Check(access.role(), models.PermCreateEvents); apiErr != nil {
+            return nil, apiErr
+        } else if access.squad.Archived() {
+            return nil, models.ErrSquadArchived.New()
+        }
+
+        poll.SquadID = &access.squad.ID
+    }
+
+    apiErr := applyTextFields([]textField{
+        {"question", req.Question, maxPollQuestionLength, &poll.Question},
+        {"description", req.Description, maxEventDescriptionLength, &poll.Description},
+    })
+    if apiErr != nil {
+        return nil, apiErr
+    } else if poll.Question == "" {
+        return nil, models.ErrMissingField.New("question")
+    }
+
+    poll.Method = strings.TrimSpace(req.Method)
+    if poll.Method == "" {
+        poll.Method = string(voting.Single)
+    } else if validMethod(voting.Method(poll.Method)) == false {
+        valid := make([]string, len(voting.Methods))
+        for i, method := range voting.Methods {
+            valid[i] = string(method)
+        }
+
+        return nil, models.ErrInvalidChoice.New("method", poll.Method, strings.Join(valid, ", "))
+    }
+
+    if poll.Method == string(voting.Score) {
+        poll.MaxScore = req.MaxScore
+        if poll.MaxScore == 0 {
+            poll.MaxScore = defaultPollScore
+        } else if poll.MaxScore < 1 || poll.MaxScore > maxPollScore {
+            return nil, models.ErrFieldOutOfRange.New("max_score", "1", strconv.Itoa(maxPollScore))
+        }
+    }
+
+    poll.Anonymous = req.Anonymous
+
+    if req.ClosesAt != "" {
+        closesAt, apiErr := parseTime("closes_at", req.ClosesAt)
+        if apiErr != nil {
+            return nil, apiErr
+        } else if closesAt.After(time.Now()) == false {
+            return nil, models.ErrInvalidTimeRange.New("now", "closes_at")
+        }
+
+        poll.ClosesAt = &closesAt
+    }
+
+    if len(req.Options) < minPollOptions || len(req.Options) > maxPollOptions {
+        return nil, models.ErrFieldOutOfRange.New("options", strconv.Itoa(minPollOptions), strconv.Itoa(maxPollOptions))
+    }
+
+    for i, label := range req.Options {
+        option := db.PollOption{Position: i}
+
+        label := label
+        if apiErr := applyTextFields([]textField{{"options", &label, maxPollOptionLength, &option.Label}}); apiErr != nil {
+            return nil, apiErr
+        } else if option.Label == "" {
+            return nil, models.ErrMissingField.New("options")
+        }
+
+        poll.Options = append(poll.Options, option)
+    }
+
+    if err := ctx.Polls.Create(reqCtx, &poll); err != nil {
+        return nil, internalError(reqCtx, models.ErrSavingPoll, "creating poll", err)
+    }
+
+    return pollResponse{
+        Poll: poll,
+        Results: countPoll(poll, nil),
+        Ballot: pollBallot{Choices: []int{}},
+    }, nil
+}
+
+// validMethod reports if a voting method is supported.
+func validMethod (method voting.Method) bool {
+    for _, valid := range voting.Methods {
+        if method == valid {
+            return true
+        }
+    }
+
+    return false
+}
+
+// countPoll counts a poll's votes. The method was checked when the poll was created so counting can not fail.
+func countPoll (poll db.Poll, votes []db.PollVote) voting.Result {
+    result, _ := models.CountPoll(poll, votes)
+    if result.Standings == nil {
+        result.Standings = []voting.Tally{}
+    }
+
+    return result
+}
+
+// view returns a poll, its results and its ballots.
+func (h PollsHandler) view (reqCtx context.Context, ctx *models.AppContext, access votingPollAccess, viewer *db.User) (interface{}, *models.APIError) {
+    votes, err := ctx.Polls.FindVotes(reqCtx, access.poll.ID)
+    if err != nil {
+        return nil, internalError(reqCtx, models.ErrFindingPoll, "listing poll votes", err)
+    }
+
+    poll := *access.poll
+    resp := pollResponse{
+        Poll: poll,
+        Closed: poll.Closed(time.Now()),
+        Results: countPoll(poll, votes),
+        Ballot: pollBallot{Choices: []int{}},
+    }
+
+    // Votes are sorted by user then rank
+    for i, vote := range votes {
+        if i == 0 || vote.UserID != votes[i - 1].UserID {
+            resp.Ballots = append(resp.Ballots, pollBallot{UserID: vote.UserID})
+        }
+
+        ballot := &resp.Ballots[len(resp.Ballots) - 1]
+        ballot.Choices = append(ballot.Choices, vote.OptionID)
+        if poll.Method == string(voting.Score) {
+            if ballot.Scores == nil {
+                ballot.Scores = make(map[string]int)
+            }
+
+            ballot.Scores[strconv.Itoa(vote.OptionID)] = vote.Score
+        }
+    }
+
+    for _, ballot := range resp.Ballots {
+        if ballot.UserID == viewer.ID {
+            resp.Ballot = ballot
+            resp.Ballot.UserID = 0
+        }
+    }
+
+    if poll.Anonymous {
+        resp.Ballots = nil
+    }
+
+    return resp, nil
+}
+
+// Body of a request to vote in a poll. An empty ballot withdraws the viewer's vote.
+type ballotRequest struct {
+    // Options picked by id, for single, approval and ranked polls. Ranked polls list them from most to least preferred.
+    Choices []int `json:"choices"`
+    // Score of each option by option id, for score polls. Options which are not included are not scored.
+    Scores map[string]int `json:"scores"`
+}
+
+// vote replaces the viewer's ballot in a poll.
+func (h PollsHandler) vote (reqCtx context.Context, ctx *models.AppContext, r *http.Request, access votingPollAccess, viewer *db.User) (interface{}, *models.APIError) {
+    if access.poll.Closed(time.Now()) {
+        return nil, models.ErrPollClosed.New()
+    } else if apiErr := access.checkWritable(); apiErr != nil {
+        return nil, apiErr
+    }
+
+    var req ballotRequest
+    if apiErr := decodeJSONBody(r, &req); apiErr != nil {
+        return nil, apiErr
+    }
+
+    votes, apiErr := ballotVotes(*access.poll, req)
+    if apiErr != nil {
+        return nil, apiErr
+    }
+
+    err := ctx.Polls.Vote(reqCtx, access.poll.ID, viewer.ID, votes)
+    if err == models.ErrVotingClosed {
+        return nil, models.ErrPollClosed.New()
+    } else if err != nil {
+        return nil, internalError(reqCtx, models.ErrSavingPoll, "saving ballot", err)
+    }
+
+    return h.view(reqCtx, ctx, access, viewer)
+}
+
+// ballotVotes checks a ballot is valid for a poll's method and returns its votes.
+func ballotVotes (poll db.Poll, req ballotRequest) ([]db.PollVote, *models.APIError) {
+    positions := make(map[int]int)
+    for _, option := range poll.Options {
+        positions[option.ID] = option.Position
+    }
+
+    var votes []db.PollVote
+
+    if poll.Method == string(voting.Score) {
+        for id, score := range req.Scores {
+            optionId, err := strconv.Atoi(id)
+            if _, ok := positions[optionId]; err != nil || ok == false {
+                return nil, models.ErrOptionNotFound.New(id)
+            } else if score < 0 || score > poll.MaxScore {
+                return nil, models.ErrFieldOutOfRange.New("scores", "0", strconv.Itoa(poll.MaxScore))
+            }
+
+            // Scored options are kept in the poll's order
+            votes = append(votes, db.PollVote{OptionID: optionId, Rank: positions[optionId] + 1, Score: score})
+        }
+
+        return votes, nil
+    }
+
+    if poll.Method == string(voting.Single) && len(req.Choices) > 1 {
+        return nil, models.ErrFieldOutOfRange.New("choices", "0", "1")
+    }
+
+    picked := make(map[int]bool)
+    for i, optionId := range req.Choices {
+        if _, ok := positions[optionId]; ok == false {
+            return nil, models.ErrOptionNotFound.New(strconv.Itoa(optionId))
+        } else if picked[optionId] {
+            return nil, models.ErrDuplicateChoice.New(strconv.Itoa(optionId))
+        }
+
+        picked[optionId] = true
+        votes = append(votes, db.PollVote{OptionID: optionId, Rank: i + 1})
+    }
+
+    return votes, nil
+}
+
+// close closes a poll before its deadline, its results no longer change.
+func (h PollsHandler) close (reqCtx context.Context, ctx *models.AppContext, access votingPollAccess, viewer *db.User) (interface{}, *models.APIError) {
+    now := time.Now()
+
+    if apiErr := access.checkManageable(ctx, viewer.ID); apiErr != nil {
+        return nil, apiErr
+    } else if access.poll.Closed(now) {
+        return nil, models.ErrPollClosed.New()
+    }
+
+    access.poll.ClosedAt = &now
+    if err := ctx.Polls.Update(reqCtx, access.poll); err != nil {
+        return nil, internalError(reqCtx, models.ErrSavingPoll, "closing poll", err)
+    }
+
+    return h.view(reqCtx, ctx, access, viewer)
+}
+
+// remove deletes a poll.
+func (h PollsHandler) remove (reqCtx context.Context, ctx *models.AppContext, access votingPollAccess, viewer *db.User) (interface{}, *models.APIError) {
+    if apiErr := access.checkManageable(ctx, viewer.ID); apiErr != nil {
+        return nil, apiErr
+    }
+
+    if err := ctx.Polls.Delete(reqCtx, access.poll.ID); err != nil {
+        return nil, internalError(reqCtx, models.ErrSavingPoll, "deleting poll", err)
+    }
+
+    now := time.Now()
+    access.poll.DeletedAt = &now
+
+    return pollResponse{Poll: *access.poll, Closed: true, Results: countPoll(*access.poll, nil), Ballot: pollBallot{Choices: []int{}}}, nil
+}
@@ -0,0 +1,118 @@
+package handlers_test
+
+import (
+    "context"
+    "net/http"
+    "strconv"
+    "testing"
+    "time"
+
+    "github.com/Noah-Huppert/squad-up/server/apitest"
+    "github.com/Noah-Huppert/squad-up/server/models"
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+    "github.com/stretchr/testify/assert"
+)
+
+func TestPollsHandler(t *testing.T) {
+    a := assert.New(t)
+    h := apitest.New(t)
+    defer h.Close()
+
+    _, ownerToken := h.SeedUser(db.User{FirstName: "Jane", Email: "jane@example.com"})
+    member, memberToken := h.SeedUser(db.User{FirstName: "John", Email: "john@example.com"})
+    other, otherToken := h.SeedUser(db.User{FirstName: "Jack", Email: "jack@example.com"})
+    _, strangerToken := h.SeedUser(db.User{FirstName: "Eve"})
+
+    squadId := createSquad(h, ownerToken, map[string]string{"name": "Hikers"})
+    for _, user := range []*db.User{member, other} {
+        a.Nil(h.Ctx.Squads.AddMember(context.Background(), &db.SquadMembership{SquadID: squadId, UserID: user.ID, Role: db.SquadRoleMember}))
+    }
+
+    body := map[string]interface{}{
+        "squad_id": squadId,
+        "question": "Dinner?",
+        "method": "ranked",
+        "options": []string{"Pizza", "Tacos", "Sushi"},
+    }
+
+    h.DoJSON(http.MethodPost, "/api/v1/polls", memberToken, body).AssertError(http.StatusForbidden, models.ErrPermissionDenied.Id)
+    h.DoJSON(http.MethodPost, "/api/v1/polls", ownerToken, map[string]interface{}{"question": "Dinner?"}).AssertError(http.StatusUnprocessableEntity, models.ErrPollTarget.Id)
+    h.DoJSON(http.MethodPost, "/api/v1/polls", ownerToken, map[string]interface{}{"squad_id": squadId, "question": "Dinner?", "method": "borda", "options": []string{"A", "B"}}).AssertError(http.StatusUnprocessableEntity, models.ErrInvalidChoice.Id)
+    h.DoJSON(http.MethodPost, "/api/v1/polls", ownerToken, map[string]interface{}{"squad_id": squadId, "question": "Dinner?", "options": []string{"A"}}).AssertError(http.StatusUnprocessableEntity, models.ErrFieldOutOfRange.Id)
+
+    var poll db.Poll
+    res := h.DoJSON(http.MethodPost, "/api/v1/polls", ownerToken, body)
+    res.AssertOK()
+    res.Decode("poll", &poll)
+    a.Len(poll.Options, 3)
+
+    path := "/api/v1/polls/" + strconv.Itoa(poll.ID)
+    pizza, tacos, sushi := poll.Options[0].ID, poll.Options[1].ID, poll.Options[2].ID
+
+    h.Get(path, strangerToken).AssertError(http.StatusNotFound, models.ErrPollNotFound.Id)
+    a.Len(h.Get("/api/v1/polls?squad_id=" + strconv.Itoa(squadId), memberToken).AssertOK()["polls"], 1)
+
+    // Vote
+    h.DoJSON(http.MethodPut, path + "/ballots/me", memberToken, map[string]interface{}{"choices": []int{0}}).AssertError(http.StatusUnprocessableEntity, models.ErrOptionNotFound.Id)
+    h.DoJSON(http.MethodPut, path + "/ballots/me", memberToken, map[string]interface{}{"choices": []int{tacos, tacos}}).AssertError(http.StatusUnprocessableEntity, models.ErrDuplicateChoice.Id)
+
+    h.DoJSON(http.MethodPut, path + "/ballots/me", ownerToken, map[string]interface{}{"choices": []int{pizza, sushi}}).AssertOK()
+    h.DoJSON(http.MethodPut, path + "/ballots/me", memberToken, map[string]interface{}{"choices": []int{tacos, sushi}}).AssertOK()
+    env := h.DoJSON(http.MethodPut, path + "/ballots/me", otherToken, map[string]interface{}{"choices": []int{sushi, pizza}}).AssertOK()
+    a.Equal([]interface{}{float64(sushi), float64(pizza)}, env["ballot"].(map[string]interface{})["choices"])
+    a.Len(env["ballots"], 3)
+
+    // Every option gets one first choice, the tie eliminates the option listed last and its ballot goes to pizza
+    results := env["results"].(map[string]interface{})
+    rounds := results["rounds"].([]interface{})
+    a.Equal(float64(pizza), results["winner"])
+    a.Len(rounds, 2)
+    a.Equal(float64(sushi), rounds[0].(map[string]interface{})["eliminated"])
+
+    // Close
+    h.DoJSON(http.MethodPost, path + "/close", memberToken, nil).AssertError(http.StatusForbidden, models.ErrPermissionDenied.Id)
+    a.Equal(true, h.DoJSON(http.MethodPost, path + "/close", ownerToken, nil).AssertOK()["closed"])
+    h.DoJSON(http.MethodPut, path + "/ballots/me", memberToken, map[string]interface{}{"choices": []int{pizza}}).AssertError(http.StatusConflict, models.ErrPollClosed.Id)
+
+    // Anonymous score poll of a public event, which closes on its own
+    eventId := createEvent(h, ownerToken, map[string]interface{}{
+        "title": "Picnic",
+        "starts_at": "2030-06-01T12:00:00Z",
+        "ends_at": "2030-06-01T15:00:00Z",
+        "visibility": "public",
+    })
+
+    h.DoJSON(http.MethodPost, "/api/v1/polls", strangerToken, map[string]interface{}{"event_id": eventId, "question": "Where?", "options": []string{"Park", "Beach"}}).AssertError(http.StatusForbidden, models.ErrPermissionDenied.Id)
+
+    res = h.DoJSON(http.MethodPost, "/api/v1/polls", ownerToken, map[string]interface{}{
+        "event_id": eventId,
+        "question": "Where?",
+        "method": "score",
+        "anonymous": true,
+        "closes_at": time.Now().Add(time.Hour).Format(time.RFC3339),
+        "options": []string{"Park", "Beach"},
+    })
+    res.AssertOK()
+    res.Decode("poll", &poll)
+    a.Equal(5, poll.MaxScore)
+
+    path = "/api/v1/polls/" + strconv.Itoa(poll.ID)
+    park, beach := strconv.Itoa(poll.Options[0].ID), strconv.Itoa(poll.Options[1].ID)
+
+    h.DoJSON(http.MethodPut, path + "/ballots/me", strangerToken, map[string]interface{}{"scores": map[string]int{park: 6}}).AssertError(http.StatusUnprocessableEntity, models.ErrFieldOutOfRange.Id)
+    h.DoJSON(http.MethodPut, path + "/ballots/me", strangerToken, map[string]interface{}{"scores": map[string]int{park: 2, beach: 4}}).AssertOK()
+    env = h.DoJSON(http.MethodPut, path + "/ballots/me", ownerToken, map[string]interface{}{"scores": map[string]int{park: 5, beach: 1}}).AssertOK()
+    a.Nil(env["ballots"])
+    a.Equal(map[string]interface{}{park: float64(5), beach: float64(1)}, env["ballot"].(map[string]interface{})["scores"])
+
+    results = env["results"].(map[string]interface{})
+    a.Equal(float64(poll.Options[0].ID), results["winner"])
+    a.Equal(float64(7), results["standings"].([]interface{})[0].(map[string]interface{})["votes"])
+    a.Len(h.Get("/api/v1/polls?event_id=" + strconv.Itoa(eventId), strangerToken).AssertOK()["polls"], 1)
+
+    // Deadline passes
+    closesAt := time.Now().Add(-time.Minute)
+    poll.ClosesAt = &closesAt
+    a.Nil(h.Ctx.Polls.Update(context.Background(), &poll))
+    h.DoJSON(http.MethodPut, path + "/ballots/me", strangerToken, map[string]interface{}{"scores": map[string]int{park: 0}}).AssertError(http.StatusConflict, models.ErrPollClosed.Id)
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+    "context"
+    "testing"
+    "time"
+
+    "github.com/Noah-Huppert/squad-up/server/mail"
+    "github.com/Noah-Huppert/squad-up/server/models"
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+    "github.com/Noah-Huppert/squad-up/server/voting"
+    "github.com/stretchr/testify/assert"
+)
+
+func TestPurgeDeletedUsers(t *testing.T) {
+    a := assert.New(t)
+    c := context.Background()
+    ctx := models.NewMemoryAppContext(models.Config{})
+
+    user := &db.User{GoogleID: "1001", FirstName: "Jane", Email: "jane@example.com", AvatarVersion: "v1"}
+    a.Nil(ctx.Users.Create(c, user))
+    a.Nil(ctx.Blobs.Put(c, avatarKey(userAvatarPrefix(user.ID), "v1", 64), "image/png", []byte("png")))
+    a.Nil(ctx.Invites.Create(c, &db.SquadInvite{SquadID: 1, CreatedByID: user.ID, Email: "john@example.com"}))
+
+    // User has the only seat of an event, another user is waitlisted
+    bob := &db.User{FirstName: "Bob", Email: "bob@example.com"}
+    a.Nil(ctx.Users.Create(c, bob))
+    event := &db.Event{CreatorID: bob.ID, Title: "Dinner", StartsAt: time.Now().Add(time.Hour), EndsAt: time.Now().Add(2 * time.Hour), Capacity: 1}
+    a.Nil(ctx.Events.Create(c, event))
+    _, err := ctx.RSVPs.Respond(c, &db.RSVP{EventID: event.ID, UserID: user.ID, Response: db.RSVPYes, Note: "Vegetarian"})
+    a.Nil(err)
+    _, err = ctx.RSVPs.Respond(c, &db.RSVP{EventID: event.ID, UserID: bob.ID, Response: db.RSVPYes})
+    a.Nil(err)
+
+    poll := &db.AvailabilityPoll{Title: "Climb", Status: db.AvailabilityPollOpen, Slots: []db.AvailabilitySlot{{StartsAt: time.Now(), EndsAt: time.Now().Add(time.Hour)}}}
+    a.Nil(ctx.Availability.Create(c, poll))
+    a.Nil(ctx.Availability.Vote(c, poll.ID, user.ID, []db.AvailabilityVote{{SlotID: poll.Slots[0].ID, Answer: db.AvailabilityYes}}))
+
+    ballot := &db.Poll{Question: "Where?", Method: string(voting.Single), Options: []db.PollOption{{Label: "Crag"}}}
+    a.Nil(ctx.Polls.Create(c, ballot))
+    a.Nil(ctx.Polls.Vote(c, ballot.ID, user.ID, []db.PollVote{{OptionID: ballot.Options[0].ID, Rank: 1}}))
+
+    a.Nil(ctx.Busy.ReplaceImported(c, user.ID, []db.BusyBlock{{StartsAt: time.Now(), EndsAt: time.Now().Add(time.Hour)}}))
+
+    a.Nil(ctx.Feeds.Create(c, &db.CalendarFeed{UserID: user.ID, Nonce: "old"}))
+    a.Nil(ctx.Feeds.Create(c, &db.CalendarFeed{UserID: user.ID, Nonce: "new"}))
+
+    personal := &db.Event{CreatorID: user.ID, Title: "Dentist", StartsAt: time.Now(), EndsAt: time.Now().Add(time.Hour)}
+    a.Nil(ctx.Events.Create(c, personal))
+
+    // Owned squad with another member, owned squad without, and another user's squad
+    shared := &db.Squad{Name: "Hikers", OwnerID: user.ID}
+    a.Nil(ctx.Squads.Create(c, shared))
+    a.Nil(ctx.Squads.AddMember(c, &db.SquadMembership{SquadID: shared.ID, UserID: bob.ID, Role: db.SquadRoleAdmin}))
+
+    solo := &db.Squad{Name: "Journal", OwnerID: user.ID, AvatarVersion: "v1"}
+    a.Nil(ctx.Squads.Create(c, solo))
+    a.Nil(ctx.Blobs.Put(c, avatarKey(squadAvatarPrefix(solo.ID), "v1", 64), "image/png", []byte("png")))
+    soloEvent := &db.Event{CreatorID: user.ID, SquadID: &solo.ID, Title: "Notes", StartsAt: time.Now(), EndsAt: time.Now().Add(time.Hour)}
+    a.Nil(ctx.Events.Create(c, soloEvent))
+
+    joined := &db.Squad{Name: "Climbers", OwnerID: bob.ID}
+    a.Nil(ctx.Squads.Create(c, joined))
+    a.Nil(ctx.Squads.AddMember(c, &db.SquadMembership{SquadID: joined.ID, UserID: user.ID, Role: db.SquadRoleMember}))
+
+    a.Nil(ctx.Users.SoftDelete(c, user.ID))
+
+    // Users still in grace period are kept
+    purgeDeletedUsers(ctx, time.Now().Add(-time.Hour))
+
+    _, err = ctx.Users.FindDeletedByIdentity(c, "1001")
+    a.Nil(err)
+
+    purgeDeletedUsers(ctx, time.Now().Add(time.Hour))
+
+    _, err = ctx.Users.FindDeletedByIdentity(c, "1001")
+    a.Equal(models.ErrNotFound, err)
+
+    _, err = ctx.Blobs.Get(c, avatarKey(userAvatarPrefix(user.ID), "v1", 64))
+    a.Equal(models.ErrNotFound, err)
+
+    invites, err := ctx.Invites.FindByCreator(c, user.ID)
+    a.Nil(err)
+    a.Empty(invites)
+
+    // The seat goes to the waitlisted user, who is emailed
+    rsvps, err := ctx.RSVPs.FindByEvent(c, event.ID)
+    a.Nil(err)
+    if a.Len(rsvps, 1) {
+        a.True(rsvps[0].Going())
+    }
+    a.Len(ctx.Mailer.(*mail.MemoryMailer).Sent(), 1)
+
+    availabilityVotes, err := ctx.Availability.FindVotesByUser(c, user.ID)
+    a.Nil(err)
+    a.Empty(availabilityVotes)
+
+    pollVotes, err := ctx.Polls.FindVotesByUser(c, user.ID)
+    a.Nil(err)
+    a.Empty(pollVotes)
+
+    busy, err := ctx.Busy.FindByUser(c, user.ID)
+    a.Nil(err)
+    a.Empty(busy)
+
+    feeds, err := ctx.Feeds.FindByUser(c, user.ID)
+    a.Nil(err)
+    a.Empty(feeds)
+
+    _, err = ctx.Events.FindById(c, personal.ID)
+    a.Equal(models.ErrNotFound, err)
+
+    // Owned squads go to the remaining admin, or are deleted if no one else is a member
+    memberships, err := ctx.Squads.FindMembershipsByUser(c, user.ID)
+    a.Nil(err)
+    a.Empty(memberships)
+
+    shared, err = ctx.Squads.FindById(c, shared.ID)
+    a.Nil(err)
+    a.Equal(bob.ID, shared.OwnerID)
+    membership, err := ctx.Squads.FindMembership(c, shared.ID, bob.ID)
+    a.Nil(err)
+    a.Equal(db.SquadRoleOwner, membership.Role)
+
+    _, err = ctx.Squads.FindById(c, solo.ID)
+    a.Equal(models.ErrNotFound, err)
+    _, err = ctx.Events.FindById(c, soloEvent.ID)
+    a.Equal(models.ErrNotFound, err)
+    _, err = ctx.Blobs.Get(c, avatarKey(squadAvatarPrefix(solo.ID), "v1", 64))
+    a.Equal(models.ErrNotFound, err)
+
+    members, err := ctx.Squads.FindMemberships(c, joined.ID)
+    a.Nil(err)
+    a.Len(members, 1)
+
+    users, err := ctx.Users.FindDeletedBefore(c, time.Now().Add(time.Hour))
+    a.Nil(err)
+    a.Empty(users)
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+    "context"
+    "net/http"
+    "sort"
+    "strings"
+
+    "github.com/Noah-Huppert/squad-up/server/models"
+    "github.com/Noah-Huppert/squad-up/server/models/utils"
+)
+
+// ExpandingEndpointHandler is implemented by endpoint handlers whose results have relations which clients can ask to
+// be included with the "expand" query parameter, ex: ?expand=owner,attendees
+//
+// Relations which are not expanded are left empty, so they should be pointers or slices tagged with "omitempty".
+type ExpandingEndpointHandler interface {
+    EndpointHandler
+
+    // Expansions maps the names clients use in the "expand" query parameter to the relations stores must load to
+    // include them, see the models Expand constants.
+    Expansions () map[string]string
+}
+
+// Key used to store the relations to expand in a request's context.
+type expansionsKey struct {}
+
+// parseExpansions validates the "expand" query parameter against the relations an endpoint handler declares. Returns
+// a request whose context holds the relations which should be expanded.
+func parseExpansions (r *http.Request, eHdlr EndpointHandler) (*http.Request, *models.APIError) {
+    list := r.URL.Query().Get("expand")
+    if list == "" {
+        return r, nil
+    }
+
+    var allowed map[string]string
+    if expanding, ok := eHdlr.(ExpandingEndpointHandler); ok {
+        allowed = expanding.Expansions()
+    }
+
+    var preloads []string
+
+    for _, name := range strings.Split(list, ",") {
+        name = strings.TrimSpace(name)
+        if name == "" {
+            continue
+        }
+
+        assoc, ok := allowed[name]
+        if ok == false {
+            names := make([]string, 0, len(allowed))
+            for allowedName := range allowed {
+                names = append(names, allowedName)
+            }
+            sort.Strings(names)
+
+            valid := strings.Join(names, ", ")
+            if valid == "" {
+                valid = "none"
+            }
+
+            return r, models.ErrInvalidExpand.New(name, valid)
+        }
+
+        preloads = append(preloads, assoc)
+    }
+
+    return r.WithContext(context.WithValue(r.Context(), expansionsKey{}, preloads)), nil
+}
+
+// expansions returns the relations the client asked to expand, to pass to store methods.
+func expansions (r *http.Request) []string {
+    preloads, _ := r.Context().Value(expansionsKey{}).([]string)
+    return preloads
+}
+
+// pruneFields removes fields the client did not ask for with the "fields" query parameter, ex: ?fields=id,first_name
+//
+// Fields are pruned from each resource in the response, the values of the top level keys. Top level values which are
+// not objects or arrays of objects, like access tokens, are never pruned.
+func pruneFields (r *http.Request, resMap map[string]interface{}) {
+    fs := utils.ParseFieldSet(r.URL.Query().Get("fields"))
+    if fs == nil {
+        return
+    }
+
+    for key, value := range resMap {
+        resMap[key] = utils.Prune(value, fs)
+    }
+}
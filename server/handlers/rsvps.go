@@ -0,0 +1,227 @@
+package handlers
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/Noah-Huppert/squad-up/server/mail"
+    "github.com/Noah-Huppert/squad-up/server/models"
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+)
+
+// Max number of guests a user can bring to an event
+const maxPlusOnes = 10
+
+// Max length of an RSVP note, in characters
+const maxRSVPNoteLength = 280
+
+// Max capacity of an event
+const maxEventCapacity = 10000
+
+// Valid values of db.RSVP.Response
+var rsvpResponses = []string{db.RSVPYes, db.RSVPMaybe, db.RSVPNo}
+
+type rsvpResponse struct {
+    RSVP db.RSVP `json:"rsvp"`
+}
+
+// rsvpsResponse shows who is coming to an event.
+type rsvpsResponse struct {
+    // Users who responded yes and have a seat
+    Going []db.RSVP `json:"going"`
+    Maybe []db.RSVP `json:"maybe"`
+    NotGoing []db.RSVP `json:"not_going"`
+    // Users who responded yes but are waiting for a seat, in the order seats are given out
+    Waitlist []db.RSVP `json:"waitlist"`
+    // Seats taken by users who are going and their plus-ones
+    Seats int `json:"seats"`
+    // Max number of seats, 0 if unlimited
+    Capacity int `json:"capacity"`
+}
+
+// canRSVP returns an error if the viewer can not respond to the event. Squad events require the models.PermRSVP
+// permission, anyone who can see a personal event can respond to it.
+func canRSVP (ctx *models.AppContext, access eventAccess) *models.APIError {
+    if access.event.SquadID != nil {
+        if apiErr := squadPolicy(ctx).Check(access.role, models.PermRSVP); apiErr != nil {
+            return apiErr
+        }
+    }
+
+    switch {
+    case access.event.Cancelled():
+        return models.ErrEventCancelled.New()
+    case access.event.Status != db.EventStatusScheduled:
+        return models.ErrEventNotScheduled.New()
+    case access.event.EndsAt.Before(time.Now()):
+        return models.ErrEventEnded.New()
+    }
+
+    return nil
+}
+
+// rsvps lists the responses to an event. Occurrences which are not saved have no responses.
+func (h EventsHandler) rsvps (reqCtx context.Context, ctx *models.AppContext, access eventAccess) (interface{}, *models.APIError) {
+    var rsvps []db.RSVP
+    if access.unsaved() == false {
+        var err error
+        if rsvps, err = ctx.RSVPs.FindByEvent(reqCtx, access.event.ID, models.ExpandRSVPUser); err != nil {
+            return nil, internalError(reqCtx, models.ErrFindingEvent, "listing rsvps", err)
+        }
+    }
+
+    resp := rsvpsResponse{
+        Going: []db.RSVP{},
+        Maybe: []db.RSVP{},
+        NotGoing: []db.RSVP{},
+        Waitlist: []db.RSVP{},
+        Capacity: access.event.Capacity,
+    }
+
+    for _, rsvp := range rsvps {
+        switch {
+        case rsvp.Going():
+            resp.Going = append(resp.Going, rsvp)
+            resp.Seats += rsvp.Seats()
+        case rsvp.Waitlisted():
+            resp.Waitlist = append(resp.Waitlist, rsvp)
+        case rsvp.Response == db.RSVPMaybe:
+            resp.Maybe = append(resp.Maybe, rsvp)
+        default:
+            resp.NotGoing = append(resp.NotGoing, rsvp)
+        }
+    }
+
+    return resp, nil
+}
+
+// Body of a request to respond to an event
+type rsvpRequest struct {
+    Response string `json:"response"`
+    PlusOnes int `json:"plus_ones"`
+    Note *string `json:"note"`
+}
+
+// respond saves the viewer's response to an event. Users who respond yes when the event is full are waitlisted.
+// Occurrences are saved with the first response, since RSVPs are made to each occurrence separately.
+func (h EventsHandler) respond (reqCtx context.Context, ctx *models.AppContext, r *http.Request, access eventAccess, viewer *db.User) (interface{}, *models.APIError) {
+    if apiErr := canRSVP(ctx, access); apiErr != nil {
+        return nil, apiErr
+    }
+
+    var req rsvpRequest
+    if apiErr := decodeJSONBody(r, &req); apiErr != nil {
+        return nil, apiErr
+    }
+
+    rsvp := db.RSVP{EventID: access.event.ID, UserID: viewer.ID, Response: strings.TrimSpace(req.Response)}
+
+    if rsvp.Response != db.RSVPYes && rsvp.Response != db.RSVPMaybe && rsvp.Response != db.RSVPNo {
+        return nil, models.ErrInvalidChoice.New("response", rsvp.Response, strings.Join(rsvpResponses, ", "))
+    }
+
+    if req.PlusOnes < 0 || req.PlusOnes > maxPlusOnes {
+        return nil, models.ErrFieldOutOfRange.New("plus_ones", "0", strconv.Itoa(maxPlusOnes))
+    }
+    rsvp.PlusOnes = req.PlusOnes
+
+    if apiErr := applyTextFields([]textField{{"note", req.Note, maxRSVPNoteLength, &rsvp.Note}}); apiErr != nil {
+        return nil, apiErr
+    }
+
+    if access.unsaved() {
+        if err := saveEvent(reqCtx, ctx, access, access.event); err != nil {
+            return nil, internalError(reqCtx, models.ErrSavingRSVP, "saving occurrence", err)
+        }
+
+        rsvp.EventID = access.event.ID
+    }
+
+    promoted, err := ctx.RSVPs.Respond(reqCtx, &rsvp)
+    if err == models.ErrNoCapacity {
+        return nil, h.notEnoughSeats(reqCtx, ctx, access.event, viewer.ID)
+    } else if err != nil {
+        return nil, internalError(reqCtx, models.ErrSavingRSVP, "saving rsvp", err)
+    }
+
+    notifyPromoted(ctx, *access.event, promoted)
+
+    return rsvpResponse{rsvp}, nil
+}
+
+// notEnoughSeats returns a models.ErrNotEnoughSeats error with the number of plus-ones a user can bring.
+func (h EventsHandler) notEnoughSeats (reqCtx context.Context, ctx *models.AppContext, event *db.Event, userId int) *models.APIError {
+    rsvps, err := ctx.RSVPs.FindByEvent(reqCtx, event.ID)
+    if err != nil {
+        return internalError(reqCtx, models.ErrSavingRSVP, "counting seats", err)
+    }
+
+    free := event.Capacity
+    for _, rsvp := range rsvps {
+        if rsvp.Going() && rsvp.UserID != userId {
+            free -= rsvp.Seats()
+        }
+    }
+
+    if free < 1 {
+        free = 1
+    }
+
+    return models.ErrNotEnoughSeats.New(strconv.Itoa(free - 1))
+}
+
+// unrespond removes the viewer's response to an event, giving their seat to the next user on the waitlist.
+func (h EventsHandler) unrespond (reqCtx context.Context, ctx *models.AppContext, access eventAccess, viewer *db.User) (interface{}, *models.APIError) {
+    if access.unsaved() {
+        return h.rsvps(reqCtx, ctx, access)
+    }
+
+    promoted, err := ctx.RSVPs.Remove(reqCtx, access.event.ID, viewer.ID)
+    if err != nil {
+        return nil, internalError(reqCtx, models.ErrSavingRSVP, "removing rsvp", err)
+    }
+
+    if access.event.Cancelled() == false {
+        notifyPromoted(ctx, *access.event, promoted)
+    }
+
+    return h.rsvps(reqCtx, ctx, access)
+}
+
+// notifyPromoted emails users who were given a seat at an event after being waitlisted. Not cancelled with the
+// request since the seats were already given. Failures are only logged.
+func notifyPromoted (ctx *models.AppContext, event db.Event, promoted []db.RSVP) {
+    for _, rsvp := range promoted {
+        user, err := ctx.Users.FindById(context.Background(), rsvp.UserID)
+        if err != nil {
+            fmt.Printf("Error finding waitlisted user to notify: %s\n", err)
+            continue
+        }
+
+        msg := mail.Message{
+            To: user.Email,
+            Subject: "You're going to " + event.Title,
+            Body: "A seat opened up for " + event.Title + ", you are off the waitlist and going.\n\n" +
+                "The event starts on " + eventStartText(event) + ". If you can no longer make it, update your " +
+                "RSVP so someone else can have your seat.\n",
+        }
+
+        if err := ctx.Mailer.Send(context.Background(), msg); err != nil {
+            fmt.Printf("Error notifying promoted user: %s\n", err)
+        }
+    }
+}
+
+// eventStartText formats an event's start time for emails, in the time zone it was planned in.
+func eventStartText (event db.Event) string {
+    start := event.StartsAt
+    if loc, err := time.LoadLocation(event.Timezone); err == nil {
+        start = start.In(loc)
+    }
+
+    return start.Format("Monday, January 2 at 3:04 PM MST")
+}
@@ -0,0 +1,66 @@
+package handlers_test
+
+import (
+    "net/http"
+    "strconv"
+    "testing"
+
+    "github.com/Noah-Huppert/squad-up/server/apitest"
+    "github.com/Noah-Huppert/squad-up/server/mail"
+    "github.com/Noah-Huppert/squad-up/server/models"
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+    "github.com/stretchr/testify/assert"
+)
+
+func TestEventsHandler_RSVPs(t *testing.T) {
+    a := assert.New(t)
+    h := apitest.New(t)
+    defer h.Close()
+
+    _, janeToken := h.SeedUser(db.User{FirstName: "Jane", Email: "jane@example.com"})
+    _, johnToken := h.SeedUser(db.User{FirstName: "John", Email: "john@example.com"})
+    _, bobToken := h.SeedUser(db.User{FirstName: "Bob", Email: "bob@example.com"})
+
+    id := createEvent(h, janeToken, map[string]interface{}{
+        "title": "Dinner",
+        "starts_at": "2030-06-01T23:00:00Z",
+        "ends_at": "2030-06-02T01:00:00Z",
+        "visibility": "public",
+        "capacity": 3,
+    })
+    path := "/api/v1/events/" + strconv.Itoa(id) + "/rsvps"
+
+    h.DoJSON(http.MethodPut, path + "/me", janeToken, map[string]interface{}{"response": "sure"}).AssertError(http.StatusUnprocessableEntity, models.ErrInvalidChoice.Id)
+
+    // Fill the event, the next user is waitlisted
+    rsvp := h.DoJSON(http.MethodPut, path + "/me", janeToken, map[string]interface{}{"response": "yes", "plus_ones": 1}).AssertOK()["rsvp"].(map[string]interface{})
+    a.Nil(rsvp["waitlisted_at"])
+    h.DoJSON(http.MethodPut, path + "/me", johnToken, map[string]interface{}{"response": "yes", "note": "Bringing wine"}).AssertOK()
+
+    rsvp = h.DoJSON(http.MethodPut, path + "/me", bobToken, map[string]interface{}{"response": "yes"}).AssertOK()["rsvp"].(map[string]interface{})
+    a.NotNil(rsvp["waitlisted_at"])
+
+    env := h.Get(path, bobToken).AssertOK()
+    a.Len(env["going"], 2)
+    a.Len(env["waitlist"], 1)
+    a.Equal(float64(3), env["seats"])
+
+    // Users with a seat can not add plus-ones which do not fit
+    h.DoJSON(http.MethodPut, path + "/me", janeToken, map[string]interface{}{"response": "yes", "plus_ones": 2}).AssertError(http.StatusConflict, models.ErrNotEnoughSeats.Id)
+
+    // Dropping out promotes the next user, who is emailed
+    h.DoJSON(http.MethodPut, path + "/me", johnToken, map[string]interface{}{"response": "no"}).AssertOK()
+    env = h.Get(path, bobToken).AssertOK()
+    a.Len(env["going"], 2)
+    a.Len(env["waitlist"], 0)
+    a.Len(env["not_going"], 1)
+
+    sent := h.Ctx.Mailer.(*mail.MemoryMailer).Sent()
+    if a.Len(sent, 1) {
+        a.Equal("bob@example.com", sent[0].To)
+    }
+
+    // Cancelled events can not be responded to
+    h.DoJSON(http.MethodPost, "/api/v1/events/" + strconv.Itoa(id) + "/cancel", janeToken, nil).AssertOK()
+    h.DoJSON(http.MethodPut, path + "/me", johnToken, map[string]interface{}{"response": "yes"}).AssertError(http.StatusConflict, models.ErrEventCancelled.Id)
+}
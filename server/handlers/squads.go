@@ -0,0 +1,533 @@
+package handlers
+
+import (
+    "context"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/Noah-Huppert/squad-up/server/models"
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+)
+
+// Path squad endpoints are registered under
+const squadsPath = "/api/v1/squads"
+
+// Max lengths of squad fields, in characters
+const (
+    maxSquadNameLength = 64
+    maxSquadDescriptionLength = 500
+)
+
+// Valid values of db.Squad.Visibility
+var squadVisibilities = []string{db.SquadVisibilityPrivate, db.SquadVisibilityPublic}
+
+// SquadsHandler serves squads and their memberships.
+//
+//     GET    /api/v1/squads                        Squads the user is a member of, ?archived=true includes archived
+//     POST   /api/v1/squads                        Create squad, the user becomes its owner
+//     GET    /api/v1/squads/{id}                   View squad, private squads can only be viewed by members
+//     PATCH  /api/v1/squads/{id}                   Edit squad
+//     POST   /api/v1/squads/{id}/archive           Archive squad
+//     POST   /api/v1/squads/{id}/unarchive         Unarchive squad
+//     POST   /api/v1/squads/{id}/avatar            Upload avatar as the "picture" file of a multipart form
+//     DELETE /api/v1/squads/{id}/avatar            Remove avatar
+//     GET    /api/v1/squads/{id}/members           List members
+//     PATCH  /api/v1/squads/{id}/members/{userId}  Change member's role
+//     DELETE /api/v1/squads/{id}/members/{userId}  Remove member, "me" leaves the squad
+//     POST   /api/v1/squads/{id}/owner             Transfer ownership to the member with the "user_id"
+//     GET    /api/v1/squads/{id}/invites           List invites which can still be accepted
+//     POST   /api/v1/squads/{id}/invites           Create invite link, or email an invite, see inviteRequest
+//     DELETE /api/v1/squads/{id}/invites/{id}      Revoke invite
+//
+// Which endpoints members can use depends on the permissions of their role, see routes.
+type SquadsHandler struct {}
+
+// Expansions implements ExpandingEndpointHandler.
+func (h SquadsHandler) Expansions () map[string]string {
+    return map[string]string{
+        "owner": models.ExpandSquadOwner,
+        "members": models.ExpandSquadMemberUsers,
+    }
+}
+
+type squadResponse struct {
+    Squad db.Squad `json:"squad"`
+    // Viewer's role in the squad, empty if they are not a member
+    Role string `json:"role,omitempty"`
+}
+
+// ETag implements ETagger so PATCH requests can be made conditional on the version of the squad a client has. The role
+// and expansions are covered by the hash of the body resultETag adds.
+func (r squadResponse) ETag () string {
+    return r.Squad.ETag()
+}
+
+type squadsResponse struct {
+    Squads []db.Squad `json:"squads"`
+}
+
+type membersResponse struct {
+    Members []db.SquadMembership `json:"members"`
+}
+
+type membershipResponse struct {
+    Member db.SquadMembership `json:"member"`
+}
+
+// squadAccess is a squad loaded for a request and the viewer's membership in it.
+type squadAccess struct {
+    squad *db.Squad
+    // Viewer's membership, nil if they are not a member
+    membership *db.SquadMembership
+}
+
+// role returns the viewer's role in the squad, empty if they are not a member.
+func (a squadAccess) role () string {
+    if a.membership == nil {
+        return ""
+    }
+
+    return a.membership.Role
+}
+
+func (h SquadsHandler) Serve (reqCtx context.Context, ctx *models.AppContext, r *http.Request) (interface{}, *models.APIError) {
+    viewer, apiErr := currentUser(reqCtx, ctx, r)
+    if apiErr != nil {
+        return nil, apiErr
+    }
+
+    parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, squadsPath), "/"), "/")
+
+    // Collection
+    if parts[0] == "" {
+        return methodHandlers{
+            http.MethodGet: func () (interface{}, *models.APIError) {
+                return h.list(reqCtx, ctx, r, viewer)
+            },
+            http.MethodPost: func () (interface{}, *models.APIError) {
+                return h.create(reqCtx, ctx, r, viewer)
+            },
+        }.serveMethod(r)
+    }
+
+    access, apiErr := loadSquad(reqCtx, ctx, parts[0], viewer.ID, expansions(r)...)
+    if apiErr != nil {
+        return nil, apiErr
+    }
+
+    req := squadRequest{reqCtx: reqCtx, ctx: ctx, r: r, viewer: viewer, access: access}
+    return serveSquadRoute(h.routes(), req, parts[1:])
+}
+
+// routes declares the endpoints of a squad, and the permissions needed to use them.
+func (h SquadsHandler) routes () []squadRoute {
+    return []squadRoute{
+        {http.MethodGet, "", "", false, func (q squadRequest) (interface{}, *models.APIError) {
+            return squadResponse{*q.access.squad, q.access.role()}, nil
+        }},
+        {http.MethodPatch, "", models.PermEditSquad, false, h.update},
+        {http.MethodPost, "archive", models.PermArchiveSquad, true, func (q squadRequest) (interface{}, *models.APIError) {
+            return h.archive(q, true)
+        }},
+        {http.MethodPost, "unarchive", models.PermArchiveSquad, true, func (q squadRequest) (interface{}, *models.APIError) {
+            return h.archive(q, false)
+        }},
+        {http.MethodPost, "avatar", models.PermEditSquad, false, h.uploadAvatar},
+        {http.MethodDelete, "avatar", models.PermEditSquad, false, h.removeAvatar},
+        {http.MethodGet, "members", models.PermViewMembers, false, h.members},
+        {http.MethodPatch, "members/*", models.PermManageRoles, false, h.changeRole},
+        {http.MethodDelete, "members/*", "", true, h.removeMember},
+        {http.MethodPost, "owner", models.PermTransferOwnership, false, h.transferOwnership},
+        {http.MethodGet, "invites", models.PermInviteMembers, false, h.listInvites},
+        {http.MethodPost, "invites", models.PermInviteMembers, false, h.createInvite},
+        {http.MethodDelete, "invites/*", models.PermInviteMembers, false, h.revokeInvite},
+    }
+}
+
+// loadSquad loads the squad with the provided id and the viewer's membership in it. Private squads are only returned to
+// their members, other users get the same models.ErrSquadNotFound error as if it did not exist. Members are only
+// expanded if the viewer's role can view them, see withoutMembers.
+func loadSquad (reqCtx context.Context, ctx *models.AppContext, id string, viewerId int, expand ...string) (squadAccess, *models.APIError) {
+    var access squadAccess
+
+    squadId, err := strconv.Atoi(id)
+    if err != nil {
+        return access, models.ErrSquadNotFound.New(id)
+    }
+
+    access.membership, err = ctx.Squads.FindMembership(reqCtx, squadId, viewerId)
+    if err == models.ErrNotFound {
+        access.membership = nil
+    } else if err != nil {
+        return access, internalError(reqCtx, models.ErrFindingSquad, "finding squad membership", err)
+    }
+
+    if squadPolicy(ctx).Allows(access.role(), models.PermViewMembers) == false {
+        expand = withoutMembers(expand)
+    }
+
+    access.squad, err = ctx.Squads.FindById(reqCtx, squadId, expand...)
+    if err == models.ErrNotFound {
+        return access, models.ErrSquadNotFound.New(id)
+    } else if err != nil {
+        return access, internalError(reqCtx, models.ErrFindingSquad, "finding squad", err)
+    }
+
+    if access.membership == nil && access.squad.Visibility != db.SquadVisibilityPublic {
+        return access, models.ErrSquadNotFound.New(id)
+    }
+
+    return access, nil
+}
+
+// withoutMembers removes the expansions of a squad's members, for viewers whose role does not have
+// models.PermViewMembers. The members endpoint checks the same permission.
+func withoutMembers (expand []string) []string {
+    var kept []string
+    for _, assoc := range expand {
+        if assoc != models.ExpandSquadMembers && assoc != models.ExpandSquadMemberUsers {
+            kept = append(kept, assoc)
+        }
+    }
+
+    return kept
+}
+
+// list returns the squads the viewer is a member of. Members are only expanded in squads where the viewer's role can
+// view them.
+func (h SquadsHandler) list (reqCtx context.Context, ctx *models.AppContext, r *http.Request, viewer *db.User) (interface{}, *models.APIError) {
+    includeArchived := r.URL.Query().Get("archived") == "true"
+    expand := expansions(r)
+
+    // Squads whose members the viewer can not view, nil if members were not expanded
+    var hidden map[int]bool
+    if len(withoutMembers(expand)) < len(expand) {
+        memberships, err := ctx.Squads.FindMembershipsByUser(reqCtx, viewer.ID)
+        if err != nil {
+            return nil, internalError(reqCtx, models.ErrFindingSquad, "listing squad memberships", err)
+        }
+
+        hidden = make(map[int]bool)
+        for _, membership := range memberships {
+            if squadPolicy(ctx).Allows(membership.Role, models.PermViewMembers) == false {
+                hidden[membership.SquadID] = true
+            }
+        }
+
+        if len(hidden) == len(memberships) {
+            expand = withoutMembers(expand)
+        }
+    }
+
+    squads, err := ctx.Squads.FindByMember(reqCtx, viewer.ID, includeArchived, expand...)
+    if err != nil {
+        return nil, internalError(reqCtx, models.ErrFindingSquad, "listing squads", err)
+    }
+
+    for i := range squads {
+        if hidden[squads[i].ID] {
+            squads[i].Memberships = nil
+        }
+    }
+
+    if squads == nil {
+        squads = []db.Squad{}
+    }
+
+    return squadsResponse{squads}, nil
+}
+
+// Fields of a squad which can be set by its managers. Fields which are not included in a request are left as is.
+type squadPatch struct {
+    Name *string `json:"name"`
+    Description *string `json:"description"`
+    Visibility *string `json:"visibility"`
+}
+
+// apply validates a squadPatch and copies its values to a squad.
+func (p squadPatch) apply (squad *db.Squad) *models.APIError {
+    apiErr := applyTextFields([]textField{
+        {"name", p.Name, maxSquadNameLength, &squad.Name},
+        {"description", p.Description, maxSquadDescriptionLength, &squad.Description},
+    })
+    if apiErr != nil {
+        return apiErr
+    }
+
+    if squad.Name == "" {
+        return models.ErrMissingField.New("name")
+    }
+
+    if p.Visibility != nil {
+        visibility := strings.TrimSpace(*p.Visibility)
+        if visibility != db.SquadVisibilityPrivate && visibility != db.SquadVisibilityPublic {
+            return models.ErrInvalidSquadVisibility.New(visibility, strings.Join(squadVisibilities, ", "))
+        }
+
+        squad.Visibility = visibility
+    }
+
+    return nil
+}
+
+// create saves a new squad owned by the viewer.
+func (h SquadsHandler) create (reqCtx context.Context, ctx *models.AppContext, r *http.Request, viewer *db.User) (interface{}, *models.APIError) {
+    var patch squadPatch
+    if apiErr := decodeJSONBody(r, &patch); apiErr != nil {
+        return nil, apiErr
+    }
+
+    squad := db.Squad{OwnerID: viewer.ID, Visibility: db.SquadVisibilityPrivate}
+    if apiErr := patch.apply(&squad); apiErr != nil {
+        return nil, apiErr
+    }
+
+    if err := ctx.Squads.Create(reqCtx, &squad); err != nil {
+        return nil, internalError(reqCtx, models.ErrSavingSquad, "creating squad", err)
+    }
+
+    return squadResponse{squad, db.SquadRoleOwner}, nil
+}
+
+// update edits a squad's details.
+func (h SquadsHandler) update (q squadRequest) (interface{}, *models.APIError) {
+    reqCtx, ctx, access := q.reqCtx, q.ctx, q.access
+
+    if apiErr := checkIfMatch(q.r, access.squad); apiErr != nil {
+        return nil, apiErr
+    }
+
+    var patch squadPatch
+    if apiErr := decodeJSONBody(q.r, &patch); apiErr != nil {
+        return nil, apiErr
+    }
+
+    if apiErr := patch.apply(access.squad); apiErr != nil {
+        return nil, apiErr
+    }
+
+    save := ctx.Squads.Update
+    if hasIfMatch(q.r) {
+        save = ctx.Squads.UpdateIfUnmodified
+    }
+
+    if err := save(reqCtx, access.squad); err == models.ErrModified {
+        return nil, models.ErrPreconditionFailed.New()
+    } else if err != nil {
+        return nil, internalError(reqCtx, models.ErrSavingSquad, "saving squad", err)
+    }
+
+    return squadResponse{*access.squad, access.role()}, nil
+}
+
+// archive archives or unarchives a squad.
+func (h SquadsHandler) archive (q squadRequest, archive bool) (interface{}, *models.APIError) {
+    reqCtx, ctx, access := q.reqCtx, q.ctx, q.access
+
+    if archive && access.squad.Archived() == false {
+        now := time.Now()
+        access.squad.ArchivedAt = &now
+    } else if archive == false {
+        access.squad.ArchivedAt = nil
+    }
+
+    if err := ctx.Squads.Update(reqCtx, access.squad); err != nil {
+        return nil, internalError(reqCtx, models.ErrSavingSquad, "archiving squad", err)
+    }
+
+    return squadResponse{*access.squad, access.role()}, nil
+}
+
+// uploadAvatar sets the squad's avatar to the uploaded picture.
+func (h SquadsHandler) uploadAvatar (q squadRequest) (interface{}, *models.APIError) {
+    reqCtx, ctx, access := q.reqCtx, q.ctx, q.access
+
+    squad := access.squad
+    prefix := squadAvatarPrefix(squad.ID)
+
+    version, _, apiErr := saveAvatarUpload(reqCtx, ctx, q.r, prefix)
+    if apiErr != nil {
+        return nil, apiErr
+    }
+
+    oldVersion := squad.AvatarVersion
+    squad.AvatarVersion = version
+    squad.AvatarUrl = largestThumbnail(prefix, version)
+
+    if err := ctx.Squads.Update(reqCtx, squad); err != nil {
+        deleteAvatar(ctx, prefix, version)
+        return nil, avatarSaveError(reqCtx, err)
+    }
+
+    deleteAvatar(ctx, prefix, oldVersion)
+
+    return squadResponse{*squad, access.role()}, nil
+}
+
+// removeAvatar deletes the squad's avatar.
+func (h SquadsHandler) removeAvatar (q squadRequest) (interface{}, *models.APIError) {
+    reqCtx, ctx, access := q.reqCtx, q.ctx, q.access
+
+    squad := access.squad
+    oldVersion := squad.AvatarVersion
+    if oldVersion == "" {
+        return squadResponse{*squad, access.role()}, nil
+    }
+
+    squad.AvatarVersion = ""
+    squad.AvatarUrl = ""
+
+    if err := ctx.Squads.Update(reqCtx, squad); err != nil {
+        return nil, avatarSaveError(reqCtx, err)
+    }
+
+    deleteAvatar(ctx, squadAvatarPrefix(squad.ID), oldVersion)
+
+    return squadResponse{*squad, access.role()}, nil
+}
+
+// members lists the squad's members.
+func (h SquadsHandler) members (q squadRequest) (interface{}, *models.APIError) {
+    memberships, err := q.ctx.Squads.FindMemberships(q.reqCtx, q.access.squad.ID, models.ExpandMembershipUser)
+    if err != nil {
+        return nil, internalError(q.reqCtx, models.ErrFindingSquad, "listing squad members", err)
+    }
+
+    return membersResponse{memberships}, nil
+}
+
+// findMember returns the membership of the member identified by the request's path, "me" being the viewer.
+func findMember (q squadRequest) (*db.SquadMembership, *models.APIError) {
+    id := q.params[0]
+
+    userId := q.viewer.ID
+    if id != "me" {
+        var err error
+        if userId, err = strconv.Atoi(id); err != nil {
+            return nil, models.ErrMemberNotFound.New(id)
+        }
+    }
+
+    membership, err := q.ctx.Squads.FindMembership(q.reqCtx, q.access.squad.ID, userId)
+    if err == models.ErrNotFound {
+        return nil, models.ErrMemberNotFound.New(id)
+    } else if err != nil {
+        return nil, internalError(q.reqCtx, models.ErrFindingSquad, "finding squad member", err)
+    }
+
+    return membership, nil
+}
+
+// Body of a request to change a member's role
+type roleRequest struct {
+    Role string `json:"role"`
+}
+
+// changeRole gives a member a new role. Members can only change the roles of less privileged members, to roles less
+// privileged than their own.
+func (h SquadsHandler) changeRole (q squadRequest) (interface{}, *models.APIError) {
+    var req roleRequest
+    if apiErr := decodeJSONBody(q.r, &req); apiErr != nil {
+        return nil, apiErr
+    }
+
+    if req.Role != db.SquadRoleOwner && models.ValidRole(req.Role) == false {
+        return nil, models.ErrInvalidSquadRole.New(req.Role, strings.Join(models.Roles[1:], ", "))
+    }
+
+    membership, apiErr := findMember(q)
+    if apiErr != nil {
+        return nil, apiErr
+    }
+
+    policy := squadPolicy(q.ctx)
+    role := q.access.role()
+    if policy.CanAssignRole(role, membership.Role) == false || policy.CanAssignRole(role, req.Role) == false {
+        return nil, models.ErrPermissionDenied.New(string(models.PermManageRoles))
+    }
+
+    membership.Role = req.Role
+    if err := q.ctx.Squads.UpdateMembership(q.reqCtx, membership); err != nil {
+        return nil, internalError(q.reqCtx, models.ErrSavingSquad, "changing member role", err)
+    }
+
+    return membershipResponse{*membership}, nil
+}
+
+// removeMember removes a user from the squad. Members can remove themselves, members with the
+// models.PermRemoveMembers permission can remove less privileged members. The owner can not leave.
+func (h SquadsHandler) removeMember (q squadRequest) (interface{}, *models.APIError) {
+    membership, apiErr := findMember(q)
+    if apiErr != nil {
+        return nil, apiErr
+    }
+
+    if membership.Role == db.SquadRoleOwner {
+        return nil, models.ErrOwnerCannotLeave.New()
+    }
+
+    if membership.UserID != q.viewer.ID {
+        role := q.access.role()
+        if apiErr := squadPolicy(q.ctx).Check(role, models.PermRemoveMembers); apiErr != nil {
+            return nil, apiErr
+        } else if models.RoleRank(membership.Role) >= models.RoleRank(role) {
+            return nil, models.ErrPermissionDenied.New(string(models.PermRemoveMembers))
+        }
+    }
+
+    if err := q.ctx.Squads.RemoveMember(q.reqCtx, q.access.squad.ID, membership.UserID); err != nil {
+        return nil, internalError(q.reqCtx, models.ErrSavingSquad, "removing squad member", err)
+    }
+
+    return h.members(q)
+}
+
+// Body of a request to transfer ownership of a squad
+type ownerRequest struct {
+    UserID int `json:"user_id"`
+}
+
+// transferOwnership makes another member the owner of the squad. The previous owner becomes an admin.
+func (h SquadsHandler) transferOwnership (q squadRequest) (interface{}, *models.APIError) {
+    var req ownerRequest
+    if apiErr := decodeJSONBody(q.r, &req); apiErr != nil {
+        return nil, apiErr
+    } else if req.UserID == 0 {
+        return nil, models.ErrMissingField.New("user_id")
+    }
+
+    squad := q.access.squad
+    if req.UserID == squad.OwnerID {
+        return squadResponse{*squad, q.access.role()}, nil
+    }
+
+    membership, err := q.ctx.Squads.FindMembership(q.reqCtx, squad.ID, req.UserID)
+    if err == models.ErrNotFound {
+        return nil, models.ErrMemberNotFound.New(strconv.Itoa(req.UserID))
+    } else if err != nil {
+        return nil, internalError(q.reqCtx, models.ErrFindingSquad, "finding squad member", err)
+    }
+
+    previous := *q.access.membership
+
+    err = q.ctx.Transaction(q.reqCtx, func (tx *models.AppContext) error {
+        membership.Role = db.SquadRoleOwner
+        previous.Role = db.SquadRoleAdmin
+        squad.OwnerID = req.UserID
+
+        if err := tx.Squads.UpdateMembership(q.reqCtx, membership); err != nil {
+            return err
+        } else if err := tx.Squads.UpdateMembership(q.reqCtx, &previous); err != nil {
+            return err
+        }
+
+        return tx.Squads.Update(q.reqCtx, squad)
+    })
+    if err != nil {
+        return nil, internalError(q.reqCtx, models.ErrSavingSquad, "transferring squad ownership", err)
+    }
+
+    return squadResponse{*squad, previous.Role}, nil
+}
@@ -0,0 +1,170 @@
+package handlers_test
+
+import (
+    "context"
+    "net/http"
+    "strconv"
+    "testing"
+
+    "github.com/Noah-Huppert/squad-up/server/apitest"
+    "github.com/Noah-Huppert/squad-up/server/models"
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+    "github.com/stretchr/testify/assert"
+)
+
+// Creates a squad through the API and returns its id
+func createSquad (h *apitest.Harness, token string, body map[string]string) int {
+    res := h.DoJSON(http.MethodPost, "/api/v1/squads", token, body)
+
+    var squad db.Squad
+    res.AssertOK()
+    res.Decode("squad", &squad)
+
+    return squad.ID
+}
+
+func TestSquadsHandler(t *testing.T) {
+    a := assert.New(t)
+    h := apitest.New(t)
+    defer h.Close()
+
+    owner, token := h.SeedUser(db.User{FirstName: "Jane", Email: "jane@example.com"})
+
+    id := createSquad(h, token, map[string]string{"name": " Hikers ", "description": "Weekend hikes"})
+    path := "/api/v1/squads/" + strconv.Itoa(id)
+
+    // View with owner expanded
+    env := h.Get(path + "?expand=owner,members", token).AssertOK()
+    a.Equal("owner", env["role"])
+
+    squad := env["squad"].(map[string]interface{})
+    a.Equal("Hikers", squad["name"])
+    a.Equal("private", squad["visibility"])
+    a.Equal("Jane", squad["owner"].(map[string]interface{})["first_name"])
+    a.Len(squad["members"], 1)
+
+    // Edit
+    res := h.DoJSON(http.MethodPatch, path, token, map[string]string{"visibility": "public"})
+    a.Equal("public", res.AssertOK()["squad"].(map[string]interface{})["visibility"])
+
+    h.DoJSON(http.MethodPatch, path, token, map[string]string{"visibility": "secret"}).AssertError(http.StatusUnprocessableEntity, models.ErrInvalidSquadVisibility.Id)
+    h.DoJSON(http.MethodPatch, path, token, map[string]string{"name": ""}).AssertError(http.StatusUnprocessableEntity, models.ErrMissingField.Id)
+
+    // List
+    a.Len(h.Get("/api/v1/squads", token).AssertOK()["squads"], 1)
+
+    // Archive
+    h.DoJSON(http.MethodPost, path + "/archive", token, nil).AssertOK()
+    h.DoJSON(http.MethodPatch, path, token, map[string]string{"name": "Climbers"}).AssertError(http.StatusConflict, models.ErrSquadArchived.Id)
+    a.Len(h.Get("/api/v1/squads", token).AssertOK()["squads"], 0)
+    a.Len(h.Get("/api/v1/squads?archived=true", token).AssertOK()["squads"], 1)
+
+    // Owner can not leave
+    h.DoJSON(http.MethodDelete, path + "/members/" + strconv.Itoa(owner.ID), token, nil).AssertError(http.StatusConflict, models.ErrOwnerCannotLeave.Id)
+}
+
+func TestSquadsHandler_Access(t *testing.T) {
+    a := assert.New(t)
+    h := apitest.New(t)
+    defer h.Close()
+
+    _, ownerToken := h.SeedUser(db.User{FirstName: "Jane", Email: "jane@example.com"})
+    member, memberToken := h.SeedUser(db.User{FirstName: "John", Email: "john@example.com"})
+    _, strangerToken := h.SeedUser(db.User{FirstName: "Eve"})
+
+    id := createSquad(h, ownerToken, map[string]string{"name": "Hikers"})
+    path := "/api/v1/squads/" + strconv.Itoa(id)
+
+    a.Nil(h.Ctx.Squads.AddMember(context.Background(), &db.SquadMembership{SquadID: id, UserID: member.ID, Role: db.SquadRoleMember}))
+
+    // Private squads are hidden from non-members
+    h.Get(path, strangerToken).AssertError(http.StatusNotFound, models.ErrSquadNotFound.Id)
+
+    // Members see each other's member level fields
+    members := h.Get(path + "/members", memberToken).AssertOK()["members"].([]interface{})
+    a.Len(members, 2)
+    a.Equal("jane@example.com", members[0].(map[string]interface{})["user"].(map[string]interface{})["email"])
+
+    // Responses with another role or expansions are not revalidated with each other's tags
+    ownerTag := h.Get(path, ownerToken).Header().Get("ETag")
+    a.NotEqual(ownerTag, h.Get(path + "?expand=members", ownerToken).Header().Get("ETag"))
+
+    r := h.NewRequest(http.MethodGet, path, memberToken, nil)
+    r.Header.Set("If-None-Match", ownerTag)
+    a.Equal("member", h.Do(r).AssertOK()["role"])
+
+    // Only managers can edit
+    h.DoJSON(http.MethodPatch, path, memberToken, map[string]string{"name": "Mine"}).AssertError(http.StatusForbidden, models.ErrPermissionDenied.Id)
+
+    // Members can leave
+    h.DoJSON(http.MethodDelete, path + "/members/me", memberToken, nil).AssertOK()
+    h.Get(path, memberToken).AssertError(http.StatusNotFound, models.ErrSquadNotFound.Id)
+
+    // Public squads can be viewed by anyone, but not their members
+    h.DoJSON(http.MethodPatch, path, ownerToken, map[string]string{"visibility": "public"}).AssertOK()
+    h.Get(path, strangerToken).AssertOK()
+    h.Get(path + "/members", strangerToken).AssertError(http.StatusForbidden, models.ErrPermissionDenied.Id)
+    a.Nil(h.Get(path + "?expand=members", strangerToken).AssertOK()["squad"].(map[string]interface{})["members"])
+    a.Len(h.Get(path + "?expand=members", ownerToken).AssertOK()["squad"].(map[string]interface{})["members"], 1)
+
+    h.Get(path + "/nope", ownerToken).AssertError(http.StatusNotFound, models.ErrEndpointNotFound.Id)
+}
+
+func TestSquadsHandler_Roles(t *testing.T) {
+    a := assert.New(t)
+    h := apitest.New(t)
+    defer h.Close()
+
+    owner, ownerToken := h.SeedUser(db.User{FirstName: "Jane", Email: "jane@example.com"})
+    admin, adminToken := h.SeedUser(db.User{FirstName: "John", Email: "john@example.com"})
+    guest, guestToken := h.SeedUser(db.User{FirstName: "Eve", Email: "eve@example.com"})
+
+    id := createSquad(h, ownerToken, map[string]string{"name": "Hikers"})
+    path := "/api/v1/squads/" + strconv.Itoa(id)
+
+    a.Nil(h.Ctx.Squads.AddMember(context.Background(), &db.SquadMembership{SquadID: id, UserID: admin.ID, Role: db.SquadRoleMember}))
+    a.Nil(h.Ctx.Squads.AddMember(context.Background(), &db.SquadMembership{SquadID: id, UserID: guest.ID, Role: db.SquadRoleGuest}))
+
+    adminPath := path + "/members/" + strconv.Itoa(admin.ID)
+    guestPath := path + "/members/" + strconv.Itoa(guest.ID)
+
+    // Owner promotes a member
+    res := h.DoJSON(http.MethodPatch, adminPath, ownerToken, map[string]string{"role": "admin"})
+    a.Equal("admin", res.AssertOK()["member"].(map[string]interface{})["role"])
+    h.DoJSON(http.MethodPatch, adminPath, ownerToken, map[string]string{"role": "boss"}).AssertError(http.StatusUnprocessableEntity, models.ErrInvalidSquadRole.Id)
+
+    // Admins can only give less privileged roles
+    h.DoJSON(http.MethodPatch, guestPath, adminToken, map[string]string{"role": "admin"}).AssertError(http.StatusForbidden, models.ErrPermissionDenied.Id)
+    h.DoJSON(http.MethodPatch, guestPath, adminToken, map[string]string{"role": "organizer"}).AssertOK()
+    h.DoJSON(http.MethodPatch, guestPath, adminToken, map[string]string{"role": "guest"}).AssertOK()
+
+    // Guests can not see who is in the squad
+    h.Get(path + "/members", guestToken).AssertError(http.StatusForbidden, models.ErrPermissionDenied.Id)
+    a.Nil(h.Get(path + "?expand=members", guestToken).AssertOK()["squad"].(map[string]interface{})["members"])
+
+    // Nor through the squads they are listed
+    otherId := createSquad(h, guestToken, map[string]string{"name": "Climbers"})
+    squads := h.Get("/api/v1/squads?expand=members", guestToken).AssertOK()["squads"].([]interface{})
+    a.Len(squads, 2)
+    for _, squad := range squads {
+        squad := squad.(map[string]interface{})
+        if squad["id"] == float64(otherId) {
+            a.Len(squad["members"], 1)
+        } else {
+            a.Nil(squad["members"])
+        }
+    }
+
+    // Admins can not remove the owner's role or transfer ownership
+    h.DoJSON(http.MethodPatch, path + "/members/" + strconv.Itoa(owner.ID), adminToken, map[string]string{"role": "member"}).AssertError(http.StatusForbidden, models.ErrPermissionDenied.Id)
+    h.DoJSON(http.MethodPost, path + "/owner", adminToken, map[string]int{"user_id": admin.ID}).AssertError(http.StatusForbidden, models.ErrPermissionDenied.Id)
+
+    // Transfer ownership, previous owner becomes an admin
+    env := h.DoJSON(http.MethodPost, path + "/owner", ownerToken, map[string]int{"user_id": admin.ID}).AssertOK()
+    a.Equal("admin", env["role"])
+    a.Equal(float64(admin.ID), env["squad"].(map[string]interface{})["owner_id"])
+    a.Equal("owner", h.Get(path, adminToken).AssertOK()["role"])
+
+    // New owner can remove the previous one
+    h.DoJSON(http.MethodDelete, path + "/members/" + strconv.Itoa(owner.ID), adminToken, nil).AssertOK()
+}
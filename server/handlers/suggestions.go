@@ -0,0 +1,180 @@
+package handlers
+
+import (
+    "context"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/Noah-Huppert/squad-up/server/models"
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+    "github.com/Noah-Huppert/squad-up/server/suggest"
+)
+
+// Path of the meeting time suggestions endpoint
+const suggestionsPath = "/api/v1/suggestions"
+
+// Limits of suggestions
+const (
+    defaultSuggestions = 5
+    maxSuggestions = 20
+    defaultSuggestionStepMinutes = 30
+    // Max length of the window suggestions are made in
+    maxSuggestionDays = 31
+)
+
+// SuggestionsHandler suggests times for a squad to meet.
+//
+//     GET /api/v1/suggestions?squad_id={id}&duration_minutes={n}&from={time}&to={time}&count={n}&step_minutes={n}
+//                            &required={user id},{user id}
+//
+// Members whose role has the models.PermRSVP permission are invited, those listed in required count more than the
+// others. Slots are scored by which members are free, see loadBusy, and how well the slot fits their preferred and
+// sleep hours in their time zone. See the suggest package for how slots are ranked.
+//
+// The window defaults to the next 31 days like events, see eventRange, and can be at most maxSuggestionDays long. Slots
+// start every step_minutes, 30 by default. count suggestions are returned, 5 by default.
+type SuggestionsHandler struct {}
+
+type suggestionsResponse struct {
+    Suggestions []suggest.Suggestion `json:"suggestions"`
+}
+
+func (h SuggestionsHandler) Serve (reqCtx context.Context, ctx *models.AppContext, r *http.Request) (interface{}, *models.APIError) {
+    viewer, apiErr := currentUser(reqCtx, ctx, r)
+    if apiErr != nil {
+        return nil, apiErr
+    }
+
+    return methodHandlers{
+        http.MethodGet: func () (interface{}, *models.APIError) {
+            return h.suggest(reqCtx, ctx, r, viewer)
+        },
+    }.serveMethod(r)
+}
+
+// intParam parses an optional integer query parameter. Returns a models.ErrFieldOutOfRange error if it is not between
+// min and max.
+func intParam (r *http.Request, name string, def, min, max int) (int, *models.APIError) {
+    value := r.URL.Query().Get(name)
+    if value == "" {
+        return def, nil
+    }
+
+    n, err := strconv.Atoi(value)
+    if err != nil || n < min || n > max {
+        return 0, models.ErrFieldOutOfRange.New(name, strconv.Itoa(min), strconv.Itoa(max))
+    }
+
+    return n, nil
+}
+
+// suggest returns the best times for a squad to meet.
+func (h SuggestionsHandler) suggest (reqCtx context.Context, ctx *models.AppContext, r *http.Request, viewer *db.User) (interface{}, *models.APIError) {
+    query := r.URL.Query()
+
+    if query.Get("squad_id") == "" {
+        return nil, models.ErrMissingField.New("squad_id")
+    } else if query.Get("duration_minutes") == "" {
+        return nil, models.ErrMissingField.New("duration_minutes")
+    }
+
+    access, apiErr := loadSquad(reqCtx, ctx, query.Get("squad_id"), viewer.ID)
+    if apiErr != nil {
+        return nil, apiErr
+    } else if apiErr := squadPolicy(ctx).Check(access.role(), models.PermRSVP); apiErr != nil {
+        return nil, apiErr
+    }
+
+    req := suggest.Request{}
+
+    durationMinutes, apiErr := intParam(r, "duration_minutes", 0, minSlotMinutes, maxSlotMinutes)
+    if apiErr != nil {
+        return nil, apiErr
+    }
+    stepMinutes, apiErr := intParam(r, "step_minutes", defaultSuggestionStepMinutes, minSlotMinutes, maxSlotMinutes)
+    if apiErr != nil {
+        return nil, apiErr
+    }
+    if req.Count, apiErr = intParam(r, "count", defaultSuggestions, 1, maxSuggestions); apiErr != nil {
+        return nil, apiErr
+    }
+
+    req.Duration = time.Duration(durationMinutes) * time.Minute
+    req.Step = time.Duration(stepMinutes) * time.Minute
+
+    if req.From, req.To, apiErr = eventRange(r); apiErr != nil {
+        return nil, apiErr
+    } else if req.To.Sub(req.From) > maxSuggestionDays * 24 * time.Hour {
+        return nil, models.ErrTimeRangeTooLong.New(strconv.Itoa(maxSuggestionDays))
+    } else if req.To.Sub(req.From) < req.Duration {
+        return nil, models.ErrFieldOutOfRange.New("duration_minutes", strconv.Itoa(minSlotMinutes), strconv.Itoa(int(req.To.Sub(req.From) / time.Minute)))
+    }
+
+    memberships, err := ctx.Squads.FindMemberships(reqCtx, access.squad.ID, models.ExpandMembershipUser)
+    if err != nil {
+        return nil, internalError(reqCtx, models.ErrFindingBusy, "listing squad members", err)
+    }
+
+    // Members who can RSVP are invited
+    policy := squadPolicy(ctx)
+    var userIds []int
+    for _, membership := range memberships {
+        if policy.Allows(membership.Role, models.PermRSVP) && membership.User != nil {
+            userIds = append(userIds, membership.UserID)
+            req.Attendees = append(req.Attendees, newAttendee(*membership.User))
+        }
+    }
+
+    if value := query.Get("required"); value != "" {
+        for _, id := range strings.Split(value, ",") {
+            userId, _ := strconv.Atoi(strings.TrimSpace(id))
+
+            found := false
+            for i := range req.Attendees {
+                if req.Attendees[i].ID == userId {
+                    req.Attendees[i].Required, found = true, true
+                }
+            }
+
+            if found == false {
+                return nil, models.ErrMemberNotFound.New(strings.TrimSpace(id))
+            }
+        }
+    }
+
+    busy, apiErr := loadBusy(reqCtx, ctx, userIds, req.From, req.To)
+    if apiErr != nil {
+        return nil, apiErr
+    }
+
+    for i := range req.Attendees {
+        req.Attendees[i].Busy = busy[req.Attendees[i].ID]
+    }
+
+    return suggestionsResponse{suggest.Suggest(req)}, nil
+}
+
+// newAttendee returns a user's time zone and hours as a suggest.Attendee. Hours which are not set, or not valid, are
+// the defaults.
+func newAttendee (user db.User) suggest.Attendee {
+    attendee := suggest.Attendee{
+        ID: user.ID,
+        Location: time.UTC,
+        Preferred: suggest.DefaultPreferred,
+        Sleep: suggest.DefaultSleep,
+    }
+
+    if loc, err := time.LoadLocation(user.Timezone); err == nil && user.Timezone != "" {
+        attendee.Location = loc
+    }
+    if hours, err := suggest.ParseHours(user.PreferredHours); err == nil {
+        attendee.Preferred = hours
+    }
+    if hours, err := suggest.ParseHours(user.SleepHours); err == nil {
+        attendee.Sleep = hours
+    }
+
+    return attendee
+}
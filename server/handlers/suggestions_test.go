@@ -0,0 +1,69 @@
+package handlers_test
+
+import (
+    "context"
+    "net/http"
+    "strconv"
+    "testing"
+    "time"
+
+    "github.com/Noah-Huppert/squad-up/server/apitest"
+    "github.com/Noah-Huppert/squad-up/server/models"
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+    "github.com/stretchr/testify/assert"
+)
+
+func TestSuggestionsHandler(t *testing.T) {
+    a := assert.New(t)
+    h := apitest.New(t)
+    defer h.Close()
+
+    _, ownerToken := h.SeedUser(db.User{FirstName: "Jane", Email: "jane@example.com", Timezone: "UTC"})
+    member, memberToken := h.SeedUser(db.User{FirstName: "John", Email: "john@example.com", Timezone: "UTC", PreferredHours: "12:00-20:00"})
+    _, strangerToken := h.SeedUser(db.User{FirstName: "Eve"})
+
+    squadId := createSquad(h, ownerToken, map[string]string{"name": "Hikers"})
+    a.Nil(h.Ctx.Squads.AddMember(context.Background(), &db.SquadMembership{SquadID: squadId, UserID: member.ID, Role: db.SquadRoleMember}))
+
+    // A day in the future, starting at midnight UTC
+    day := time.Now().UTC().Truncate(24 * time.Hour).Add(48 * time.Hour)
+    at := func (hours float64) string {
+        return day.Add(time.Duration(hours * float64(time.Hour))).Format(time.RFC3339)
+    }
+
+    h.DoJSON(http.MethodPost, "/api/v1/busy", memberToken, map[string]string{"starts_at": at(12), "ends_at": at(14)}).AssertOK()
+
+    url := "/api/v1/suggestions?squad_id=" + strconv.Itoa(squadId) + "&from=" + at(0) + "&to=" + at(24)
+
+    // Both members' hours overlap from noon to 5 PM, when the member is free from 2 PM
+    var suggestions []map[string]interface{}
+    res := h.Get(url + "&duration_minutes=60&step_minutes=60&count=3", ownerToken)
+    res.AssertOK()
+    res.Decode("suggestions", &suggestions)
+
+    a.Len(suggestions, 3)
+    for i, hours := range []float64{14, 15, 16} {
+        a.Equal(at(hours), suggestions[i]["starts_at"])
+        a.Equal(at(hours + 1), suggestions[i]["ends_at"])
+        a.Len(suggestions[i]["available"], 2)
+        a.Equal(float64(1), suggestions[i]["score"])
+    }
+
+    // Slots the required member is busy for rank last
+    res = h.Get(url + "&duration_minutes=120&step_minutes=120&count=12&required=" + strconv.Itoa(member.ID), ownerToken)
+    res.AssertOK()
+    res.Decode("suggestions", &suggestions)
+
+    a.Len(suggestions, 12)
+    a.Equal(at(12), suggestions[11]["starts_at"])
+    a.Equal(float64(1), suggestions[11]["missing_required"])
+    a.Equal(float64(0), suggestions[10]["missing_required"])
+
+    h.Get(url + "&duration_minutes=60&required=" + strconv.Itoa(member.ID + 100), ownerToken).AssertError(http.StatusNotFound, models.ErrMemberNotFound.Id)
+    h.Get(url, ownerToken).AssertError(http.StatusUnprocessableEntity, models.ErrMissingField.Id)
+    h.Get(url + "&duration_minutes=2", ownerToken).AssertError(http.StatusUnprocessableEntity, models.ErrFieldOutOfRange.Id)
+    h.Get(url + "&duration_minutes=60&count=50", ownerToken).AssertError(http.StatusUnprocessableEntity, models.ErrFieldOutOfRange.Id)
+    h.Get("/api/v1/suggestions?squad_id=" + strconv.Itoa(squadId) + "&from=" + at(0) + "&to=" + at(0.5) + "&duration_minutes=60", ownerToken).AssertError(http.StatusUnprocessableEntity, models.ErrFieldOutOfRange.Id)
+    h.Get("/api/v1/suggestions?squad_id=" + strconv.Itoa(squadId) + "&from=" + at(0) + "&to=" + at(24 * 40) + "&duration_minutes=60", ownerToken).AssertError(http.StatusUnprocessableEntity, models.ErrTimeRangeTooLong.Id)
+    h.Get(url + "&duration_minutes=60", strangerToken).AssertError(http.StatusNotFound, models.ErrSquadNotFound.Id)
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+    "strconv"
+    "strings"
+
+    "github.com/Noah-Huppert/squad-up/server/models"
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+    "github.com/Noah-Huppert/squad-up/server/suggest"
+)
+
+// Path users endpoints are registered under
+const usersPath = "/api/v1/users/"
+
+// Max lengths of profile fields, in characters
+const (
+    maxNameLength = 64
+    maxBioLength = 500
+    maxPronounsLength = 32
+)
+
+// UsersHandler serves user profiles.
+//
+// GET /api/v1/users/me and GET /api/v1/users/{id} return a user, which fields are included depends on the viewer's
+// visibility level. PATCH /api/v1/users/me edits the authenticated user's profile. DELETE /api/v1/users/me deletes the
+// authenticated user's account, see deleteAccount.
+type UsersHandler struct {}
+
+type userResponse struct {
+    User db.User `json:"user"`
+}
+
+// ETag implements ETagger so PATCH requests can be made conditional on the version of the profile a client has.
+func (r userResponse) ETag () string {
+    return r.User.ETag()
+}
+
+func (h UsersHandler) Serve (reqCtx context.Context, ctx *models.AppContext, r *http.Request) (interface{}, *models.APIError) {
+    viewer, apiErr := currentUser(reqCtx, ctx, r)
+    if apiErr != nil {
+        return nil, apiErr
+    }
+
+    id := strings.TrimPrefix(r.URL.Path, usersPath)
+
+    if id == "me" {
+        return methodHandlers{
+            http.MethodGet: func () (interface{}, *models.APIError) {
+                return userResponse{*viewer}, nil
+            },
+            http.MethodPatch: func () (interface{}, *models.APIError) {
+                return h.update(reqCtx, ctx, r, viewer)
+            },
+            http.MethodDelete: func () (interface{}, *models.APIError) {
+                return deleteAccount(reqCtx, ctx, viewer)
+            },
+        }.serveMethod(r)
+    }
+
+    return methodHandlers{
+        http.MethodGet: func () (interface{}, *models.APIError) {
+            return h.get(reqCtx, ctx, id)
+        },
+    }.serveMethod(r)
+}
+
+// get returns the user with the provided id.
+func (h UsersHandler) get (reqCtx context.Context, ctx *models.AppContext, id string) (interface{}, *models.APIError) {
+    userId, err := strconv.Atoi(id)
+    if err != nil {
+        return nil, models.ErrUserNotFound.New(id)
+    }
+
+    user, err := ctx.Users.FindById(reqCtx, userId)
+    if err == models.ErrNotFound {
+        return nil, models.ErrUserNotFound.New(id)
+    } else if err != nil {
+        if ctxErr := models.ContextError(reqCtx); ctxErr != nil {
+            return nil, ctxErr
+        }
+
+        fmt.Printf("Error finding user: %s\n", err)
+        return nil, models.ErrFindingUser.New()
+    }
+
+    return userResponse{*user}, nil
+}
+
+// Fields of a user's profile they can edit. Fields which are not included in a request are left as is.
+type profilePatch struct {
+    FirstName *string `json:"first_name"`
+    LastName *string `json:"last_name"`
+    DisplayName *string `json:"display_name"`
+    Bio *string `json:"bio"`
+    Pronouns *string `json:"pronouns"`
+    Timezone *string `json:"timezone"`
+    Locale *string `json:"locale"`
+    PreferredHours *string `json:"preferred_hours"`
+    SleepHours *string `json:"sleep_hours"`
+}
+
+// update applies a profilePatch from the request body to the user's profile.
+func (h UsersHandler) update (reqCtx context.Context, ctx *models.AppContext, r *http.Request, user *db.User) (interface{}, *models.APIError) {
+    if apiErr := checkIfMatch(r, user); apiErr != nil {
+        return nil, apiErr
+    }
+
+    var patch profilePatch
+    if apiErr := decodeJSONBody(r, &patch); apiErr != nil {
+        return nil, apiErr
+    }
+
+    // Text fields
+    apiErr := applyTextFields([]textField{
+        {"first_name", patch.FirstName, maxNameLength, &user.FirstName},
+        {"last_name", patch.LastName, maxNameLength, &user.LastName},
+        {"display_name", patch.DisplayName, maxNameLength, &user.DisplayName},
+        {"bio", patch.Bio, maxBioLength, &user.Bio},
+        {"pronouns", patch.Pronouns, maxPronounsLength, &user.Pronouns},
+    })
+    if apiErr != nil {
+        return nil, apiErr
+    }
+
+    // Time zone, an empty value clears it
+    if patch.Timezone != nil {
+        timezone := ""
+        if strings.TrimSpace(*patch.Timezone) != "" {
+            if timezone, apiErr = parseTimezone(*patch.Timezone); apiErr != nil {
+                return nil, apiErr
+            }
+        }
+
+        user.Timezone = timezone
+    }
+
+    // Locale, stored as the supported locale which best matches
+    if patch.Locale != nil {
+        locale, ok := models.SupportedLocale(*patch.Locale)
+        if ok == false {
+            return nil, models.ErrUnsupportedLocale.New(*patch.Locale, strings.Join(models.SupportedLocales(), ", "))
+        }
+
+        user.Locale = locale
+    }
+
+    // Hours, an empty value restores the default
+    hours := []struct {
+        field string
+        value *string
+        dest *string
+    }{
+        {"preferred_hours", patch.PreferredHours, &user.PreferredHours},
+        {"sleep_hours", patch.SleepHours, &user.SleepHours},
+    }
+    for _, h := range hours {
+        if h.value == nil {
+            continue
+        }
+
+        *h.dest = ""
+        if value := strings.TrimSpace(*h.value); value != "" {
+            parsed, err := suggest.ParseHours(value)
+            if err != nil {
+                return nil, models.ErrInvalidHours.New(h.field)
+            }
+
+            *h.dest = parsed.String()
+        }
+    }
+
+    save := ctx.Users.Update
+    if hasIfMatch(r) {
+        save = ctx.Users.UpdateIfUnmodified
+    }
+
+    if err := save(reqCtx, user); err == models.ErrModified {
+        return nil, models.ErrPreconditionFailed.New()
+    } else if err != nil {
+        if ctxErr := models.ContextError(reqCtx); ctxErr != nil {
+            return nil, ctxErr
+        }
+
+        fmt.Printf("Error saving user: %s\n", err)
+        return nil, models.ErrSavingUser.New()
+    }
+
+    return userResponse{*user}, nil
+}
@@ -0,0 +1,101 @@
+package handlers_test
+
+import (
+    "net/http"
+    "strconv"
+    "strings"
+    "testing"
+
+    "github.com/Noah-Huppert/squad-up/server/apitest"
+    "github.com/Noah-Huppert/squad-up/server/models"
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+    "github.com/stretchr/testify/assert"
+)
+
+func TestUsersHandler_Me(t *testing.T) {
+    a := assert.New(t)
+    h := apitest.New(t)
+    defer h.Close()
+
+    _, token := h.SeedUser(db.User{FirstName: "Jane", Email: "jane@example.com", Locale: "fr"})
+
+    res := h.Get("/api/v1/users/me", token)
+    user := res.AssertOK()["user"].(map[string]interface{})
+    a.Equal("Jane", user["first_name"])
+    a.Equal("fr", user["locale"])
+
+    // Edit profile
+    res = h.DoJSON(http.MethodPatch, "/api/v1/users/me", token, map[string]string{
+        "display_name": "  JD ",
+        "timezone": "America/New_York",
+        "locale": "es-MX",
+        "sleep_hours": "00:30-08:00",
+    })
+
+    var updated db.User
+    res.AssertOK()
+    res.Decode("user", &updated)
+    a.Equal("JD", updated.DisplayName)
+    a.Equal("Jane", updated.FirstName)
+    a.Equal("America/New_York", updated.Timezone)
+    a.Equal("es", updated.Locale)
+    a.Equal("00:30-08:00", updated.SleepHours)
+
+    // If-Match compares the version of the profile a tag was received for
+    etag := h.Get("/api/v1/users/me", token).Header().Get("ETag")
+    r := h.NewRequest(http.MethodPatch, "/api/v1/users/me", token, strings.NewReader(`{"bio": "Hiker"}`))
+    r.Header.Set("If-Match", etag)
+    h.Do(r).AssertOK()
+
+    r = h.NewRequest(http.MethodPatch, "/api/v1/users/me", token, strings.NewReader(`{"bio": "Climber"}`))
+    r.Header.Set("If-Match", etag)
+    h.Do(r).AssertError(http.StatusPreconditionFailed, models.ErrPreconditionFailed.Id)
+
+    // Stale If-Match
+    r = h.NewRequest(http.MethodPatch, "/api/v1/users/me", token, nil)
+    r.Header.Set("If-Match", "\"stale\"")
+    h.Do(r).AssertError(http.StatusPreconditionFailed, models.ErrPreconditionFailed.Id)
+
+    h.Get("/api/v1/users/me", "").AssertError(http.StatusUnauthorized, models.ErrMissingAccessToken.Id)
+}
+
+func TestUsersHandler_Me_Invalid(t *testing.T) {
+    h := apitest.New(t)
+    defer h.Close()
+
+    _, token := h.SeedUser(db.User{FirstName: "Jane"})
+
+    matrix := map[string]map[string]string{
+        models.ErrInvalidTimezone.Id: {"timezone": "Mars/Olympus_Mons"},
+        models.ErrUnsupportedLocale.Id: {"locale": "xx"},
+        models.ErrInvalidHours.Id: {"preferred_hours": "9 to 5"},
+        models.ErrFieldTooLong.Id: {"pronouns": "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"},
+    }
+
+    for id, patch := range matrix {
+        h.DoJSON(http.MethodPatch, "/api/v1/users/me", token, patch).AssertError(http.StatusUnprocessableEntity, id)
+    }
+
+    r := h.NewRequest(http.MethodPatch, "/api/v1/users/me", token, nil)
+    h.Do(r).AssertError(http.StatusBadRequest, models.ErrInvalidJSONBody.Id)
+}
+
+func TestUsersHandler_Get(t *testing.T) {
+    a := assert.New(t)
+    h := apitest.New(t)
+    defer h.Close()
+
+    jane, _ := h.SeedUser(db.User{FirstName: "Jane", Email: "jane@example.com", Locale: "fr", Timezone: "UTC"})
+    _, token := h.SeedUser(db.User{FirstName: "John"})
+
+    // Other users only see public fields
+    user := h.Get("/api/v1/users/" + strconv.Itoa(jane.ID), token).AssertOK()["user"].(map[string]interface{})
+    a.Equal("Jane", user["first_name"])
+    a.NotContains(user, "email")
+    a.NotContains(user, "timezone")
+    a.NotContains(user, "locale")
+
+    h.Get("/api/v1/users/404", token).AssertError(http.StatusNotFound, models.ErrUserNotFound.Id)
+    h.Get("/api/v1/users/abc", token).AssertError(http.StatusNotFound, models.ErrUserNotFound.Id)
+    h.DoJSON(http.MethodPatch, "/api/v1/users/" + strconv.Itoa(jane.ID), token, nil).AssertError(http.StatusMethodNotAllowed, models.ErrMethodNotAllowed.Id)
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+
+    "github.com/Noah-Huppert/squad-up/server/models"
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+    "github.com/Noah-Huppert/squad-up/server/models/utils"
+)
+
+// Key used to store a *viewerState in a request's context.
+type viewerKey struct {}
+
+// viewerState records the user an endpoint handler authenticated, if any.
+type viewerState struct {
+    userId int
+}
+
+// withViewerState returns a request whose context can record the user an endpoint handler authenticated.
+func withViewerState (r *http.Request) *http.Request {
+    return r.WithContext(context.WithValue(r.Context(), viewerKey{}, &viewerState{}))
+}
+
+// setViewer is used by endpoint handlers which authenticate a user without an access token, like
+// ExchangeTokenHandler, so the response is serialized for that user.
+func setViewer (r *http.Request, userId int) {
+    if state, ok := r.Context().Value(viewerKey{}).(*viewerState); ok {
+        state.userId = userId
+    }
+}
+
+// viewer is the utils.Viewer responses are serialized for. Determines a viewer's visibility level for db.Owned models.
+type viewer struct {
+    ctx *models.AppContext
+    // Context of the request being served
+    reqCtx context.Context
+    // Id of user viewing response, 0 if anonymous
+    userId int
+    // Ids of users who share a squad with the viewer, loaded the first time it is needed
+    coMembers map[int]bool
+}
+
+// requestViewer returns the viewer a response should be serialized for. This is the user set by the endpoint handler
+// with setViewer, or else the user the request's access token belongs to. Requests without a valid access token are
+// anonymous.
+func requestViewer (ctx *models.AppContext, r *http.Request) *viewer {
+    v := &viewer{ctx: ctx, reqCtx: r.Context()}
+
+    if state, ok := r.Context().Value(viewerKey{}).(*viewerState); ok && state.userId != 0 {
+        v.userId = state.userId
+    } else if userId, err := authenticate(ctx, r); err == nil {
+        v.userId = userId
+    }
+
+    return v
+}
+
+// Level implements utils.Viewer.
+func (v *viewer) Level (val interface{}) (utils.Visibility, bool) {
+    owned, ok := val.(db.Owned)
+    if ok == false {
+        return utils.VisibilityPublic, false
+    }
+
+    if v.userId == 0 {
+        return utils.VisibilityPublic, true
+    }
+
+    ownerId := owned.OwnerID()
+
+    if ownerId == v.userId {
+        return utils.VisibilitySelf, true
+    }
+
+    if v.coMembers == nil {
+        v.coMembers = coMemberIds(v.reqCtx, v.ctx, v.userId)
+    }
+
+    if v.coMembers[ownerId] {
+        return utils.VisibilityMembers, true
+    }
+
+    return utils.VisibilityPublic, true
+}
+
+// coMemberIds returns the ids of users who share a squad with a user.
+func coMemberIds (reqCtx context.Context, ctx *models.AppContext, userId int) map[int]bool {
+    coMembers := make(map[int]bool)
+    if ctx.Squads == nil {
+        return coMembers
+    }
+
+    ids, err := ctx.Squads.FindCoMemberIds(reqCtx, userId)
+    if err != nil {
+        fmt.Printf("Error finding squad co-members: %s\n", err)
+        return coMembers
+    }
+
+    for _, id := range ids {
+        coMembers[id] = true
+    }
+
+    return coMembers
+}
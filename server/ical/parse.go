@@ -0,0 +1,340 @@
+// Package ical reads and writes iCalendar (RFC 5545) data, the format of .ics files.
+//
+// Files are parsed into a tree of components and their properties. Values are left as text, helpers parse the time
+// and duration values needed to find when events take place. Trees built the same way are written with Write.
+package ical
+
+import (
+    "bufio"
+    "errors"
+    "fmt"
+    "io"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// ErrInvalid is returned by Parse when data is not valid iCalendar. Errors for specific lines wrap it in a ParseError.
+var ErrInvalid = errors.New("invalid iCalendar data")
+
+// ParseError describes which line of iCalendar data is not valid.
+type ParseError struct {
+    // Number of the line, after unfolding
+    Line int
+    Reason string
+}
+
+func (e ParseError) Error () string {
+    return fmt.Sprintf("%s: line %d: %s", ErrInvalid, e.Line, e.Reason)
+}
+
+// Max length of an unfolded line, bounds the memory used by malformed files
+const maxLineLength = 64 * 1024
+
+// Property is a content line, ex: DTSTART;TZID=America/New_York:20300601T090000.
+type Property struct {
+    // Name in upper case, ex: DTSTART
+    Name string
+    // Parameter values by upper case name, quotes removed
+    Params map[string]string
+    // Raw value, text values are not unescaped
+    Value string
+}
+
+// Component is a BEGIN / END block, ex: a VEVENT.
+type Component struct {
+    // Name in upper case, ex: VEVENT
+    Name string
+    Props []Property
+    Components []Component
+}
+
+// Prop returns the first property with the provided name, nil if there is none.
+func (c Component) Prop (name string) *Property {
+    for i := range c.Props {
+        if c.Props[i].Name == name {
+            return &c.Props[i]
+        }
+    }
+
+    return nil
+}
+
+// AllProps returns the properties with the provided name.
+func (c Component) AllProps (name string) []Property {
+    var props []Property
+    for _, prop := range c.Props {
+        if prop.Name == name {
+            props = append(props, prop)
+        }
+    }
+
+    return props
+}
+
+// Value returns the value of the first property with the provided name, empty if there is none.
+func (c Component) Value (name string) string {
+    if prop := c.Prop(name); prop != nil {
+        return prop.Value
+    }
+
+    return ""
+}
+
+// Children returns the direct child components with the provided name.
+func (c Component) Children (name string) []Component {
+    var children []Component
+    for _, child := range c.Components {
+        if child.Name == name {
+            children = append(children, child)
+        }
+    }
+
+    return children
+}
+
+// Parse reads iCalendar data and returns its first VCALENDAR component. Lines may end with CRLF or LF, folded lines
+// are joined.
+func Parse (r io.Reader) (Component, error) {
+    lines, err := unfold(r)
+    if err != nil {
+        return Component{}, err
+    }
+
+    // Components being parsed, innermost last
+    var stack []Component
+
+    for i, line := range lines {
+        if strings.TrimSpace(line) == "" {
+            continue
+        }
+
+        prop, err := parseLine(line)
+        if err != nil {
+            return Component{}, ParseError{i + 1, err.Error()}
+        }
+
+        switch prop.Name {
+        case "BEGIN":
+            stack = append(stack, Component{Name: strings.ToUpper(prop.Value)})
+        case "END":
+            last := len(stack) - 1
+            if last < 0 || stack[last].Name != strings.ToUpper(prop.Value) {
+                return Component{}, ParseError{i + 1, "unexpected END:" + prop.Value}
+            }
+
+            done := stack[last]
+            stack = stack[:last]
+            if last == 0 {
+                if done.Name != "VCALENDAR" {
+                    return Component{}, ParseError{i + 1, "expected a VCALENDAR"}
+                }
+
+                return done, nil
+            }
+
+            stack[last - 1].Components = append(stack[last - 1].Components, done)
+        default:
+            if len(stack) == 0 {
+                return Component{}, ParseError{i + 1, "property outside of a component"}
+            }
+
+            stack[len(stack) - 1].Props = append(stack[len(stack) - 1].Props, prop)
+        }
+    }
+
+    return Component{}, ParseError{len(lines), "missing END:VCALENDAR"}
+}
+
+// unfold reads content lines, joining lines which start with a space or tab to the previous one.
+func unfold (r io.Reader) ([]string, error) {
+    scanner := bufio.NewScanner(r)
+    scanner.Buffer(make([]byte, 4096), maxLineLength)
+
+    var lines []string
+    for scanner.Scan() {
+        line := strings.TrimSuffix(scanner.Text(), "\r")
+        if len(lines) > 0 && line != "" && (line[0] == ' ' || line[0] == '\t') {
+            last := len(lines) - 1
+            if len(lines[last]) + len(line) > maxLineLength {
+                return nil, ParseError{len(lines), "line too long"}
+            }
+
+            lines[last] += line[1:]
+            continue
+        }
+
+        lines = append(lines, line)
+    }
+
+    if err := scanner.Err(); err == bufio.ErrTooLong {
+        return nil, ParseError{len(lines) + 1, "line too long"}
+    } else if err != nil {
+        return nil, err
+    }
+
+    return lines, nil
+}
+
+// parseLine parses an unfolded content line. Colons and semicolons in quoted parameter values do not end the value.
+func parseLine (line string) (Property, error) {
+    prop := Property{Params: make(map[string]string)}
+
+    end := strings.IndexAny(line, ";:")
+    if end <= 0 {
+        return prop, errors.New("missing property name")
+    }
+    prop.Name = strings.ToUpper(line[:end])
+
+    for line[end] == ';' {
+        rest := line[end + 1:]
+        eq := strings.IndexByte(rest, '=')
+        if eq <= 0 {
+            return prop, errors.New("invalid parameter of " + prop.Name)
+        }
+
+        name := strings.ToUpper(rest[:eq])
+        rest = rest[eq + 1:]
+
+        var value string
+        if strings.HasPrefix(rest, "\"") {
+            closing := strings.IndexByte(rest[1:], '"')
+            if closing < 0 {
+                return prop, errors.New("unterminated quote in " + prop.Name)
+            }
+
+            value = rest[1:closing + 1]
+            rest = rest[closing + 2:]
+        } else {
+            stop := strings.IndexAny(rest, ";:")
+            if stop < 0 {
+                return prop, errors.New("missing value of " + prop.Name)
+            }
+
+            value = rest[:stop]
+            rest = rest[stop:]
+        }
+
+        prop.Params[name] = value
+        end = len(line) - len(rest)
+        if end >= len(line) {
+            return prop, errors.New("missing value of " + prop.Name)
+        }
+    }
+
+    if line[end] != ':' {
+        return prop, errors.New("missing value of " + prop.Name)
+    }
+
+    prop.Value = line[end + 1:]
+
+    return prop, nil
+}
+
+// Formats of DATE and DATE-TIME values
+const (
+    dateFormat = "20060102"
+    dateTimeFormat = "20060102T150405"
+    utcDateTimeFormat = dateTimeFormat + "Z"
+)
+
+// Time parses a DATE or DATE-TIME value. UTC times end with Z, others are in the time zone named by the TZID parameter.
+// Floating times, and times whose TZID is not an IANA time zone name, are in loc. allDay is true for DATE values,
+// which are midnight in loc.
+func (p Property) Time (loc *time.Location) (t time.Time, allDay bool, err error) {
+    return parseTime(p.Value, p.Params, loc)
+}
+
+// Times parses a property with a comma separated list of DATE or DATE-TIME values, like EXDATE.
+func (p Property) Times (loc *time.Location) ([]time.Time, error) {
+    var times []time.Time
+    for _, value := range strings.Split(p.Value, ",") {
+        t, _, err := parseTime(value, p.Params, loc)
+        if err != nil {
+            return nil, err
+        }
+
+        times = append(times, t)
+    }
+
+    return times, nil
+}
+
+// parseTime parses a DATE or DATE-TIME value, see Property.Time.
+func parseTime (value string, params map[string]string, loc *time.Location) (time.Time, bool, error) {
+    value = strings.TrimSpace(value)
+
+    if params["VALUE"] == "DATE" || len(value) == len(dateFormat) {
+        t, err := time.ParseInLocation(dateFormat, value, loc)
+        return t, true, err
+    }
+
+    if strings.HasSuffix(value, "Z") {
+        t, err := time.Parse(dateTimeFormat, strings.TrimSuffix(value, "Z"))
+        return t, false, err
+    }
+
+    if tzid := strings.TrimPrefix(params["TZID"], "/"); tzid != "" {
+        if tz, err := time.LoadLocation(tzid); err == nil && strings.EqualFold(tzid, "Local") == false {
+            loc = tz
+        }
+    }
+
+    t, err := time.ParseInLocation(dateTimeFormat, value, loc)
+
+    return t, false, err
+}
+
+// ParseDuration parses a DURATION value, ex: PT1H30M or -P1D. Days and weeks are 24 hours and 7 days long.
+func ParseDuration (value string) (time.Duration, error) {
+    invalid := errors.New("invalid duration \"" + value + "\"")
+
+    s := strings.TrimSpace(value)
+    sign := time.Duration(1)
+    if strings.HasPrefix(s, "-") {
+        sign = -1
+        s = s[1:]
+    } else {
+        s = strings.TrimPrefix(s, "+")
+    }
+
+    if strings.HasPrefix(s, "P") == false || len(s) < 3 {
+        return 0, invalid
+    }
+    s = s[1:]
+
+    units := map[byte]time.Duration{'W': 7 * 24 * time.Hour, 'D': 24 * time.Hour}
+    timeUnits := map[byte]time.Duration{'H': time.Hour, 'M': time.Minute, 'S': time.Second}
+
+    var total time.Duration
+    number := ""
+    inTime := false
+    for i := 0; i < len(s); i++ {
+        c := s[i]
+        switch {
+        case c >= '0' && c <= '9':
+            number += string(c)
+        case c == 'T' && inTime == false && number == "":
+            inTime = true
+        default:
+            unit, ok := units[c]
+            if inTime {
+                unit, ok = timeUnits[c]
+            }
+
+            n, err := strconv.Atoi(number)
+            if ok == false || err != nil {
+                return 0, invalid
+            }
+
+            total += time.Duration(n) * unit
+            number = ""
+        }
+    }
+
+    if number != "" {
+        return 0, invalid
+    }
+
+    return sign * total, nil
+}
@@ -0,0 +1,97 @@
+package ical
+
+import (
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+    a := assert.New(t)
+
+    cal, err := Parse(strings.NewReader("BEGIN:VCALENDAR\r\n" +
+        "VERSION:2.0\r\n" +
+        "BEGIN:VEVENT\r\n" +
+        "UID:1@example.com\r\n" +
+        "DTSTART;TZID=America/New_York:20300601T090000\r\n" +
+        "ATTENDEE;CN=\"Doe; Jane\";ROLE=REQ-PARTICIPANT:mailto:jane@\r\n" +
+        " example.com\r\n" +
+        "END:VEVENT\r\n" +
+        "END:VCALENDAR\r\n"))
+    a.Nil(err)
+    a.Equal("VCALENDAR", cal.Name)
+    a.Equal("2.0", cal.Value("VERSION"))
+
+    events := cal.Children("VEVENT")
+    a.Len(events, 1)
+
+    // Quoted parameters can contain separators, folded lines are joined
+    attendee := events[0].Prop("ATTENDEE")
+    a.Equal("Doe; Jane", attendee.Params["CN"])
+    a.Equal("REQ-PARTICIPANT", attendee.Params["ROLE"])
+    a.Equal("mailto:jane@example.com", attendee.Value)
+    a.Nil(events[0].Prop("DTEND"))
+
+    for _, data := range []string{
+        "",
+        "BEGIN:VEVENT\nEND:VEVENT\n",
+        "BEGIN:VCALENDAR\nBEGIN:VEVENT\nEND:VCALENDAR\n",
+        "BEGIN:VCALENDAR\nVERSION\nEND:VCALENDAR\n",
+        "BEGIN:VCALENDAR\nX-A;B=\"c:d\nEND:VCALENDAR\n",
+        "VERSION:2.0\n",
+    } {
+        _, err := Parse(strings.NewReader(data))
+        a.NotNil(err, data)
+    }
+}
+
+func TestProperty_Time(t *testing.T) {
+    a := assert.New(t)
+    ny, _ := time.LoadLocation("America/New_York")
+    paris, _ := time.LoadLocation("Europe/Paris")
+
+    tm, allDay, err := Property{Value: "20300601T090000", Params: map[string]string{"TZID": "America/New_York"}}.Time(paris)
+    a.Nil(err)
+    a.False(allDay)
+    a.Equal(time.Date(2030, 6, 1, 13, 0, 0, 0, time.UTC), tm.UTC())
+
+    // UTC, floating and unknown time zones
+    tm, _, _ = Property{Value: "20300601T090000Z"}.Time(ny)
+    a.Equal(time.Date(2030, 6, 1, 9, 0, 0, 0, time.UTC), tm.UTC())
+    tm, _, _ = Property{Value: "20300601T090000", Params: map[string]string{"TZID": "Eastern Standard Time"}}.Time(paris)
+    a.Equal(time.Date(2030, 6, 1, 7, 0, 0, 0, time.UTC), tm.UTC())
+
+    tm, allDay, _ = Property{Value: "20300601", Params: map[string]string{"VALUE": "DATE"}}.Time(ny)
+    a.True(allDay)
+    a.Equal(time.Date(2030, 6, 1, 0, 0, 0, 0, ny), tm)
+
+    times, err := Property{Value: "20300601T090000Z,20300608T090000Z"}.Times(ny)
+    a.Nil(err)
+    a.Len(times, 2)
+
+    _, _, err = Property{Value: "2030-06-01"}.Time(ny)
+    a.NotNil(err)
+}
+
+func TestParseDuration(t *testing.T) {
+    a := assert.New(t)
+
+    for value, expected := range map[string]time.Duration{
+        "PT1H30M": 90 * time.Minute,
+        "P1D": 24 * time.Hour,
+        "P2W": 14 * 24 * time.Hour,
+        "-PT15M": -15 * time.Minute,
+        "P1DT12H": 36 * time.Hour,
+    } {
+        d, err := ParseDuration(value)
+        a.Nil(err, value)
+        a.Equal(expected, d, value)
+    }
+
+    for _, value := range []string{"", "P", "PT", "1H", "PT1", "P1H", "PT1D"} {
+        _, err := ParseDuration(value)
+        a.NotNil(err, value)
+    }
+}
@@ -0,0 +1,187 @@
+package ical
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "sort"
+    "strings"
+    "time"
+    "unicode/utf8"
+)
+
+// Max length of a content line in octets, excluding the line break. Longer lines are folded.
+const maxLineOctets = 75
+
+// Write writes a component and its children as iCalendar data. Lines end with CRLF and are folded after
+// maxLineOctets octets. Values are written as is, text values must be escaped with EscapeText.
+func Write (w io.Writer, c Component) error {
+    bw := bufio.NewWriter(w)
+    writeComponent(bw, c)
+
+    return bw.Flush()
+}
+
+// writeComponent writes a component, errors are returned by the writer's Flush.
+func writeComponent (w *bufio.Writer, c Component) {
+    writeLine(w, "BEGIN:" + c.Name)
+    for _, prop := range c.Props {
+        writeLine(w, prop.String())
+    }
+    for _, child := range c.Components {
+        writeComponent(w, child)
+    }
+    writeLine(w, "END:" + c.Name)
+}
+
+// writeLine writes a content line, folded so no line is longer than maxLineOctets. Lines are only folded between
+// characters, so UTF-8 sequences are not split.
+func writeLine (w *bufio.Writer, line string) {
+    limit := maxLineOctets
+    for len(line) > limit {
+        cut := limit
+        for cut > 0 && utf8.RuneStart(line[cut]) == false {
+            cut--
+        }
+
+        w.WriteString(line[:cut])
+        w.WriteString("\r\n ")
+        line = line[cut:]
+
+        // Continuation lines start with a space
+        limit = maxLineOctets - 1
+    }
+
+    w.WriteString(line)
+    w.WriteString("\r\n")
+}
+
+// String formats the property as a content line. Parameters are sorted by name, values which contain separators are
+// quoted.
+func (p Property) String () string {
+    names := make([]string, 0, len(p.Params))
+    for name := range p.Params {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+
+    line := p.Name
+    for _, name := range names {
+        // Parameter values can not contain quotes, even quoted
+        value := strings.Replace(p.Params[name], "\"", "", -1)
+        if strings.ContainsAny(value, ":;,") {
+            value = "\"" + value + "\""
+        }
+
+        line += ";" + name + "=" + value
+    }
+
+    return line + ":" + p.Value
+}
+
+// textEscaper escapes the characters which have a meaning in TEXT values.
+var textEscaper = strings.NewReplacer("\\", "\\\\", ";", "\\;", ",", "\\,", "\r\n", "\\n", "\n", "\\n", "\r", "\\n")
+
+// EscapeText escapes a string for use as a TEXT value, ex: a SUMMARY.
+func EscapeText (value string) string {
+    return textEscaper.Replace(value)
+}
+
+// FormatUTC formats a time as a UTC date-time value, ex: 20300601T130000Z.
+func FormatUTC (t time.Time) string {
+    return t.UTC().Format(utcDateTimeFormat)
+}
+
+// TimeProperty returns a date-time property of a time in the loc time zone, ex: DTSTART;TZID=America/New_York. Times
+// in UTC are written with a Z instead, calendars which include other time zones must define them with Timezone.
+func TimeProperty (name string, t time.Time, loc *time.Location) Property {
+    if loc == nil || loc == time.UTC {
+        return Property{Name: name, Value: FormatUTC(t)}
+    }
+
+    return Property{Name: name, Params: map[string]string{"TZID": loc.String()}, Value: t.In(loc).Format(dateTimeFormat)}
+}
+
+// TimesProperty returns a property listing date-times in the loc time zone, like TimeProperty, ex: an EXDATE.
+func TimesProperty (name string, times []time.Time, loc *time.Location) Property {
+    prop := TimeProperty(name, time.Time{}, loc)
+
+    values := make([]string, len(times))
+    for i, t := range times {
+        values[i] = TimeProperty(name, t, loc).Value
+    }
+    prop.Value = strings.Join(values, ",")
+
+    return prop
+}
+
+// Step between the times Timezone compares offsets at. Time zones do not change offsets more than once a day.
+const transitionStep = 24 * time.Hour
+
+// Timezone returns the VTIMEZONE component defining a time zone between from and to. It lists the offset in effect at
+// from and every change of offset until to, daylight saving time changes are found in the time zone database rather
+// than written as rules.
+func Timezone (loc *time.Location, from, to time.Time) Component {
+    tz := Component{Name: "VTIMEZONE", Props: []Property{{Name: "TZID", Value: loc.String()}}}
+
+    name, offset := from.In(loc).Zone()
+    tz.Components = append(tz.Components, observance(loc, from, name, offset, offset))
+
+    for t := from; t.Before(to); {
+        next := t.Add(transitionStep)
+        if nextName, nextOffset := next.In(loc).Zone(); nextName != name || nextOffset != offset {
+            // Find the second the offset changes at
+            change := sort.Search(int(transitionStep / time.Second), func (i int) bool {
+                changeName, changeOffset := t.Add(time.Duration(i + 1) * time.Second).In(loc).Zone()
+                return changeName != name || changeOffset != offset
+            })
+
+            at := t.Add(time.Duration(change + 1) * time.Second)
+            tz.Components = append(tz.Components, observance(loc, at, nextName, offset, nextOffset))
+            name, offset = nextName, nextOffset
+        }
+
+        t = next
+    }
+
+    return tz
+}
+
+// observance returns the STANDARD or DAYLIGHT component of a time zone's offset starting at a time. Offsets ahead of
+// the lowest offset of the year are daylight saving time.
+func observance (loc *time.Location, at time.Time, name string, offsetFrom, offsetTo int) Component {
+    year := at.In(loc).Year()
+    _, january := time.Date(year, time.January, 1, 0, 0, 0, 0, loc).Zone()
+    _, july := time.Date(year, time.July, 1, 0, 0, 0, 0, loc).Zone()
+
+    kind := "STANDARD"
+    if offsetTo > january || offsetTo > july {
+        kind = "DAYLIGHT"
+    }
+
+    return Component{
+        Name: kind,
+        Props: []Property{
+            // Onsets are local times before the change
+            {Name: "DTSTART", Value: at.UTC().Add(time.Duration(offsetFrom) * time.Second).Format(dateTimeFormat)},
+            {Name: "TZOFFSETFROM", Value: formatOffset(offsetFrom)},
+            {Name: "TZOFFSETTO", Value: formatOffset(offsetTo)},
+            {Name: "TZNAME", Value: EscapeText(name)},
+        },
+    }
+}
+
+// formatOffset formats a UTC offset in seconds, ex: -0500. Seconds are only included if not 0.
+func formatOffset (offset int) string {
+    sign := "+"
+    if offset < 0 {
+        sign, offset = "-", -offset
+    }
+
+    value := fmt.Sprintf("%s%02d%02d", sign, offset / 3600, offset / 60 % 60)
+    if offset % 60 != 0 {
+        value += fmt.Sprintf("%02d", offset % 60)
+    }
+
+    return value
+}
@@ -0,0 +1,95 @@
+package ical
+
+import (
+    "bytes"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/stretchr/testify/assert"
+)
+
+func TestWrite(t *testing.T) {
+    a := assert.New(t)
+    ny, _ := time.LoadLocation("America/New_York")
+    start := time.Date(2030, 6, 1, 13, 0, 0, 0, time.UTC)
+
+    description := strings.Repeat("Bring water, snacks; and sunscreen.\n", 3) + "Café ☕"
+    cal := Component{
+        Name: "VCALENDAR",
+        Props: []Property{{Name: "VERSION", Value: "2.0"}},
+        Components: []Component{{
+            Name: "VEVENT",
+            Props: []Property{
+                {Name: "UID", Value: "event-1@example.com"},
+                TimeProperty("DTSTART", start, ny),
+                TimeProperty("DTSTAMP", start, time.UTC),
+                TimesProperty("EXDATE", []time.Time{start.AddDate(0, 0, 7), start.AddDate(0, 0, 14)}, ny),
+                {Name: "DESCRIPTION", Value: EscapeText(description)},
+                {Name: "ORGANIZER", Params: map[string]string{"CN": "Doe; \"Jane\""}, Value: "mailto:jane@example.com"},
+            },
+        }},
+    }
+
+    var buf bytes.Buffer
+    a.Nil(Write(&buf, cal))
+
+    // Lines are folded without splitting characters
+    for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n") {
+        a.True(len(line) <= maxLineOctets, line)
+        a.True(strings.ContainsRune(line, '�') == false, line)
+    }
+    a.Contains(buf.String(), "DTSTART;TZID=America/New_York:20300601T090000\r\n")
+    a.Contains(buf.String(), "EXDATE;TZID=America/New_York:20300608T090000,20300615T090000\r\n")
+    a.Contains(buf.String(), "DTSTAMP:20300601T130000Z\r\n")
+    a.Contains(buf.String(), "ORGANIZER;CN=\"Doe; Jane\":mailto:jane@example.com\r\n")
+
+    // Written data can be parsed back
+    parsed, err := Parse(&buf)
+    a.Nil(err)
+
+    event := parsed.Children("VEVENT")[0]
+    a.Equal(EscapeText(description), event.Value("DESCRIPTION"))
+    a.Equal("Doe; Jane", event.Prop("ORGANIZER").Params["CN"])
+
+    parsedStart, _, err := event.Prop("DTSTART").Time(time.UTC)
+    a.Nil(err)
+    a.True(start.Equal(parsedStart))
+}
+
+func TestEscapeText(t *testing.T) {
+    a := assert.New(t)
+
+    a.Equal("a\\, b\\; c\\\\d\\ne\\nf", EscapeText("a, b; c\\d\r\ne\nf"))
+}
+
+func TestTimezone(t *testing.T) {
+    a := assert.New(t)
+    ny, _ := time.LoadLocation("America/New_York")
+
+    tz := Timezone(ny, time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2031, 1, 1, 0, 0, 0, 0, time.UTC))
+    a.Equal("America/New_York", tz.Value("TZID"))
+    a.Len(tz.Components, 3)
+
+    // Offset at the start, then daylight saving time from March 10 to November 3
+    expected := [][]string{
+        {"STANDARD", "20291231T190000", "-0500", "-0500", "EST"},
+        {"DAYLIGHT", "20300310T020000", "-0500", "-0400", "EDT"},
+        {"STANDARD", "20301103T020000", "-0400", "-0500", "EST"},
+    }
+    for i, observance := range tz.Components {
+        a.Equal(expected[i], []string{
+            observance.Name,
+            observance.Value("DTSTART"),
+            observance.Value("TZOFFSETFROM"),
+            observance.Value("TZOFFSETTO"),
+            observance.Value("TZNAME"),
+        })
+    }
+
+    // Time zones without daylight saving time have a single offset
+    a.Len(Timezone(time.UTC, time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2031, 1, 1, 0, 0, 0, 0, time.UTC)).Components, 1)
+
+    a.Equal("+0530", formatOffset(5 * 3600 + 30 * 60))
+    a.Equal("-001915", formatOffset(-(19 * 60 + 15)))
+}
@@ -0,0 +1,139 @@
+package imaging
+
+import (
+    "encoding/binary"
+    "image"
+)
+
+// EXIF orientation values, see the TIFF 6.0 Orientation tag. Values describe how the stored pixels must be transformed
+// to display the image upright.
+const (
+    orientationNormal = 1
+    orientationFlipH = 2
+    orientationRotate180 = 3
+    orientationFlipV = 4
+    orientationTranspose = 5
+    orientationRotate90 = 6
+    orientationTransverse = 7
+    orientationRotate270 = 8
+)
+
+// Id of the EXIF orientation tag
+const exifOrientationTag = 0x0112
+
+// jpegOrientation returns the EXIF orientation of a JPEG. Returns orientationNormal if the JPEG does not have one, or
+// its EXIF data can not be read.
+func jpegOrientation (data []byte) int {
+    // Skip start of image marker
+    if len(data) < 2 || data[0] != 0xFF || data[1] != 0xD8 {
+        return orientationNormal
+    }
+    i := 2
+
+    // Walk segments until image data starts
+    for i + 4 <= len(data) && data[i] == 0xFF {
+        marker := data[i + 1]
+        length := int(binary.BigEndian.Uint16(data[i + 2:]))
+
+        // Start of scan, no metadata follows
+        if marker == 0xDA || length < 2 || i + 2 + length > len(data) {
+            break
+        }
+
+        segment := data[i + 4:i + 2 + length]
+
+        // APP1 segment with EXIF data
+        if marker == 0xE1 && len(segment) >= 6 && string(segment[:6]) == "Exif\x00\x00" {
+            return tiffOrientation(segment[6:])
+        }
+
+        i += 2 + length
+    }
+
+    return orientationNormal
+}
+
+// tiffOrientation returns the orientation tag of the first IFD in the TIFF structure EXIF data is stored in.
+func tiffOrientation (tiff []byte) int {
+    if len(tiff) < 8 {
+        return orientationNormal
+    }
+
+    var order binary.ByteOrder
+    switch string(tiff[:2]) {
+    case "II":
+        order = binary.LittleEndian
+    case "MM":
+        order = binary.BigEndian
+    default:
+        return orientationNormal
+    }
+
+    ifd := int(order.Uint32(tiff[4:]))
+    if ifd < 8 || ifd + 2 > len(tiff) {
+        return orientationNormal
+    }
+
+    entries := int(order.Uint16(tiff[ifd:]))
+    for e := 0; e < entries; e++ {
+        entry := ifd + 2 + e * 12
+        if entry + 12 > len(tiff) {
+            break
+        }
+
+        if order.Uint16(tiff[entry:]) == exifOrientationTag {
+            value := int(order.Uint16(tiff[entry + 8:]))
+            if value < orientationNormal || value > orientationRotate270 {
+                return orientationNormal
+            }
+
+            return value
+        }
+    }
+
+    return orientationNormal
+}
+
+// orient transforms an image so it displays upright given its EXIF orientation.
+func orient (src *image.NRGBA, orientation int) *image.NRGBA {
+    if orientation == orientationNormal {
+        return src
+    }
+
+    w, h := src.Bounds().Dx(), src.Bounds().Dy()
+
+    // Orientations which rotate by 90 degrees swap width and height
+    dw, dh := w, h
+    if orientation >= orientationTranspose {
+        dw, dh = h, w
+    }
+
+    dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+
+    for y := 0; y < dh; y++ {
+        for x := 0; x < dw; x++ {
+            // Find the source pixel displayed at (x, y)
+            var sx, sy int
+            switch orientation {
+            case orientationFlipH:
+                sx, sy = w - 1 - x, y
+            case orientationRotate180:
+                sx, sy = w - 1 - x, h - 1 - y
+            case orientationFlipV:
+                sx, sy = x, h - 1 - y
+            case orientationTranspose:
+                sx, sy = y, x
+            case orientationRotate90:
+                sx, sy = y, h - 1 - x
+            case orientationTransverse:
+                sx, sy = w - 1 - y, h - 1 - x
+            case orientationRotate270:
+                sx, sy = w - 1 - y, x
+            }
+
+            copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y) + 4], src.Pix[src.PixOffset(sx, sy):src.PixOffset(sx, sy) + 4])
+        }
+    }
+
+    return dst
+}
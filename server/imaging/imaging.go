@@ -0,0 +1,145 @@
+// Package imaging decodes uploaded images and generates thumbnails from them.
+//
+// Images are re-encoded from their decoded pixels, so metadata in the original file (EXIF, comments, color profiles)
+// is never served back. The EXIF orientation of JPEGs is applied to the pixels before the metadata is discarded so
+// photos taken with a rotated camera still display upright.
+package imaging
+
+import (
+    "bytes"
+    "errors"
+    "image"
+    "image/draw"
+    "image/png"
+
+    // Register decoders for supported formats
+    _ "image/gif"
+    _ "image/jpeg"
+)
+
+// Formats which Decode accepts, as returned by image.Decode
+var Formats = []string{"gif", "jpeg", "png"}
+
+var (
+    // ErrUnsupportedFormat is returned by Decode when the data is not an image in one of the Formats.
+    ErrUnsupportedFormat = errors.New("unsupported image format")
+    // ErrTooManyPixels is returned by Decode when an image's dimensions exceed the provided limit.
+    ErrTooManyPixels = errors.New("image has too many pixels")
+)
+
+// Decode decodes an image in one of the Formats, applying its EXIF orientation if it has one. Images with more than
+// maxPixels pixels are rejected before they are decoded, so small files which decompress into huge images can not
+// exhaust memory.
+func Decode (data []byte, maxPixels int) (image.Image, error) {
+    config, format, err := image.DecodeConfig(bytes.NewReader(data))
+    if err != nil || supported(format) == false {
+        return nil, ErrUnsupportedFormat
+    }
+
+    if config.Width <= 0 || config.Height <= 0 || config.Width * config.Height > maxPixels {
+        return nil, ErrTooManyPixels
+    }
+
+    img, _, err := image.Decode(bytes.NewReader(data))
+    if err != nil {
+        return nil, err
+    }
+
+    if format == "jpeg" {
+        return orient(toNRGBA(img), jpegOrientation(data)), nil
+    }
+
+    return img, nil
+}
+
+// supported reports if format is one of the Formats.
+func supported (format string) bool {
+    for _, f := range Formats {
+        if f == format {
+            return true
+        }
+    }
+
+    return false
+}
+
+// Thumbnail crops the center square out of an image and scales it to size x size pixels. Each thumbnail pixel is the
+// average of the image pixels it covers.
+func Thumbnail (img image.Image, size int) *image.NRGBA {
+    b := img.Bounds()
+
+    side := b.Dx()
+    if b.Dy() < side {
+        side = b.Dy()
+    }
+
+    src := image.NewNRGBA(image.Rect(0, 0, side, side))
+    draw.Draw(src, src.Bounds(), img, image.Pt(b.Min.X + (b.Dx() - side) / 2, b.Min.Y + (b.Dy() - side) / 2), draw.Src)
+
+    dst := image.NewNRGBA(image.Rect(0, 0, size, size))
+
+    for y := 0; y < size; y++ {
+        y0, y1 := span(y, side, size)
+
+        for x := 0; x < size; x++ {
+            x0, x1 := span(x, side, size)
+
+            // Average with colors weighted by alpha so transparent pixels don't darken edges
+            var r, g, bl, a, n uint64
+            for sy := y0; sy < y1; sy++ {
+                for sx := x0; sx < x1; sx++ {
+                    p := src.Pix[src.PixOffset(sx, sy):]
+                    pa := uint64(p[3])
+
+                    r += uint64(p[0]) * pa
+                    g += uint64(p[1]) * pa
+                    bl += uint64(p[2]) * pa
+                    a += pa
+                    n++
+                }
+            }
+
+            d := dst.Pix[dst.PixOffset(x, y):]
+            if a > 0 {
+                d[0] = uint8(r / a)
+                d[1] = uint8(g / a)
+                d[2] = uint8(bl / a)
+            }
+            d[3] = uint8(a / n)
+        }
+    }
+
+    return dst
+}
+
+// span returns the range of source pixels [start, end) which destination pixel i covers when scaling srcSize pixels
+// to dstSize pixels. Always covers at least one pixel, so images can be scaled up.
+func span (i, srcSize, dstSize int) (int, int) {
+    start := i * srcSize / dstSize
+    end := (i + 1) * srcSize / dstSize
+
+    if end <= start {
+        end = start + 1
+    }
+
+    return start, end
+}
+
+// EncodePNG encodes an image as a PNG.
+func EncodePNG (img image.Image) ([]byte, error) {
+    var buf bytes.Buffer
+    if err := png.Encode(&buf, img); err != nil {
+        return nil, err
+    }
+
+    return buf.Bytes(), nil
+}
+
+// toNRGBA converts an image to an *image.NRGBA whose bounds start at (0, 0).
+func toNRGBA (img image.Image) *image.NRGBA {
+    b := img.Bounds()
+    dst := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+    draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+
+    return dst
+}
@@ -0,0 +1,79 @@
+package imaging
+
+import (
+    "bytes"
+    "image"
+    "image/color"
+    "image/jpeg"
+    "testing"
+
+    "github.com/stretchr/testify/assert"
+)
+
+// Creates a w x h image, left half red and right half blue
+func halves (w, h int) *image.NRGBA {
+    img := image.NewNRGBA(image.Rect(0, 0, w, h))
+    for y := 0; y < h; y++ {
+        for x := 0; x < w; x++ {
+            c := color.NRGBA{255, 0, 0, 255}
+            if x >= w / 2 {
+                c = color.NRGBA{0, 0, 255, 255}
+            }
+            img.SetNRGBA(x, y, c)
+        }
+    }
+
+    return img
+}
+
+// Inserts an EXIF segment with the provided orientation after a JPEG's start of image marker
+func withOrientation (jpg []byte, orientation byte) []byte {
+    exif := []byte("Exif\x00\x00MM\x00\x2a\x00\x00\x00\x08" +
+        "\x00\x01" +// 1 entry
+        "\x01\x12\x00\x03\x00\x00\x00\x01\x00" + string(orientation) + "\x00\x00" +
+        "\x00\x00\x00\x00")// No next IFD
+
+    segment := []byte{0xFF, 0xE1, 0, byte(len(exif) + 2)}
+    segment = append(segment, exif...)
+
+    return append(append(append([]byte{}, jpg[:2]...), segment...), jpg[2:]...)
+}
+
+func TestThumbnail(t *testing.T) {
+    a := assert.New(t)
+
+    // Center square of a wide image is cropped
+    thumb := Thumbnail(halves(40, 20), 10)
+    a.Equal(image.Rect(0, 0, 10, 10), thumb.Bounds())
+    a.Equal(color.NRGBA{255, 0, 0, 255}, thumb.NRGBAAt(0, 5))
+    a.Equal(color.NRGBA{0, 0, 255, 255}, thumb.NRGBAAt(9, 5))
+
+    // Small images are scaled up
+    a.Equal(image.Rect(0, 0, 64, 64), Thumbnail(halves(2, 2), 64).Bounds())
+}
+
+func TestDecode(t *testing.T) {
+    a := assert.New(t)
+
+    var buf bytes.Buffer
+    a.Nil(jpeg.Encode(&buf, halves(40, 20), nil))
+    plain := buf.Bytes()
+
+    img, err := Decode(plain, 1000)
+    a.Nil(err)
+    a.Equal(image.Rect(0, 0, 40, 20), img.Bounds())
+
+    // Rotated 90 degrees so red half ends up on top
+    img, err = Decode(withOrientation(plain, orientationRotate90), 1000)
+    a.Nil(err)
+    a.Equal(image.Rect(0, 0, 20, 40), img.Bounds())
+
+    r, _, b, _ := img.At(10, 5).RGBA()
+    a.True(r > b, "expected red at top")
+
+    _, err = Decode(plain, 100)
+    a.Equal(ErrTooManyPixels, err)
+
+    _, err = Decode([]byte("not an image"), 1000)
+    a.Equal(ErrUnsupportedFormat, err)
+}
@@ -0,0 +1,92 @@
+// Package mail sends emails to users, like squad invites.
+package mail
+
+import (
+    "context"
+    "fmt"
+    "net/smtp"
+    "strings"
+    "sync"
+)
+
+// Message is a plain text email.
+type Message struct {
+    To string
+    Subject string
+    Body string
+}
+
+// Mailer sends emails.
+type Mailer interface {
+    // Send delivers a message. Implementations may not stop sending when the context is cancelled.
+    Send (c context.Context, msg Message) error
+}
+
+// SMTPMailer sends emails through an SMTP server.
+type SMTPMailer struct {
+    // Host and port of SMTP server, ex: "smtp.example.com:587"
+    Addr string
+    // Credentials for PLAIN authentication, no authentication is used if Username is empty
+    Username string
+    Password string
+    // Address emails are sent from
+    From string
+}
+
+func (m SMTPMailer) Send (c context.Context, msg Message) error {
+    if err := c.Err(); err != nil {
+        return err
+    }
+
+    var auth smtp.Auth
+    if m.Username != "" {
+        auth = smtp.PlainAuth("", m.Username, m.Password, strings.Split(m.Addr, ":")[0])
+    }
+
+    return smtp.SendMail(m.Addr, auth, m.From, []string{msg.To}, []byte(format(m.From, msg)))
+}
+
+// format encodes a message in the Internet Message Format.
+func format (from string, msg Message) string {
+    // Header values can not contain line breaks, they would allow injecting headers
+    clean := strings.NewReplacer("\r", "", "\n", "")
+
+    return "From: " + clean.Replace(from) + "\r\n" +
+        "To: " + clean.Replace(msg.To) + "\r\n" +
+        "Subject: " + clean.Replace(msg.Subject) + "\r\n" +
+        "MIME-Version: 1.0\r\n" +
+        "Content-Type: text/plain; charset=UTF-8\r\n" +
+        "\r\n" +
+        strings.Replace(msg.Body, "\n", "\r\n", -1)
+}
+
+// LogMailer prints emails instead of sending them. Used in development when no SMTP server is configured.
+type LogMailer struct {}
+
+func (m LogMailer) Send (c context.Context, msg Message) error {
+    fmt.Printf("Email to %s: %s\n%s\n", msg.To, msg.Subject, msg.Body)
+    return nil
+}
+
+// MemoryMailer records emails instead of sending them. Used by tests.
+type MemoryMailer struct {
+    mu sync.Mutex
+    sent []Message
+}
+
+func (m *MemoryMailer) Send (c context.Context, msg Message) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    m.sent = append(m.sent, msg)
+
+    return nil
+}
+
+// Sent returns the messages which were sent, in order.
+func (m *MemoryMailer) Sent () []Message {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    return append([]Message(nil), m.sent...)
+}
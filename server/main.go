@@ -5,10 +5,12 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/jinzhu/gorm"
     _ "github.com/jinzhu/gorm/dialects/postgres"
 
+    "github.com/Noah-Huppert/squad-up/server/mail"
     "github.com/Noah-Huppert/squad-up/server/models"
     tables "github.com/Noah-Huppert/squad-up/server/models/db"
 	"github.com/Noah-Huppert/squad-up/server/handlers"
@@ -27,24 +29,63 @@ func main() {
     }
 
     // Setup DB
-    db.AutoMigrate(&tables.User{})
+    db.AutoMigrate(&tables.User{}, &tables.IdempotencyRecord{}, &tables.Squad{}, &tables.SquadMembership{},
+        &tables.SquadInvite{}, &tables.Event{}, &tables.RSVP{}, &tables.AvailabilityPoll{}, &tables.AvailabilitySlot{},
+        &tables.AvailabilityVote{}, &tables.Poll{}, &tables.PollOption{}, &tables.PollVote{},
+        &tables.BusyBlock{}, &tables.CalendarFeed{})
 
     // Create App Context
     config := models.Config{
         GAPIClientId: "432144215744-2n6fha955i4f2en9jubvelfhmdsh1jcv.apps.googleusercontent.com",
         JWTServerURI: "squad-up@server/api/v1",
         JWTHMACKey: "abcdefghijklmnopqrstuvwxyz1234567890abcdefghijklmnopqrstuvwxyz1234567890abcdefghijklmnopqrstuvwxyz1234567890abcdefghijklmnopqrst",
+        RequestTimeout: 10 * time.Second,
+        HTTPClient: &http.Client{Timeout: 15 * time.Second},
+        IdempotencyRetention: 24 * time.Hour,
+        AccountDeletionGracePeriod: 30 * 24 * time.Hour,
+        BlobDir: "data/blobs",
+        PublicURL: "http://localhost:5000",
+        MailFrom: "Squad Up <noreply@squad-up.local>",
+        MetricsAddr: "127.0.0.1:9090",
     }
 
-    ctx := models.AppContext{config, db}
+    // Send emails through SMTP if configured, otherwise print them
+    var mailer mail.Mailer = mail.LogMailer{}
+    if config.SMTPAddr != "" {
+        mailer = mail.SMTPMailer{
+            Addr: config.SMTPAddr,
+            Username: config.SMTPUsername,
+            Password: config.SMTPPassword,
+            From: config.MailFrom,
+        }
+    }
+
+    ctx := models.NewGormAppContext(config, db, mailer)
 
 	// New HTTP router.
 	mux := http.NewServeMux()
 
 	// Attach handlers
-    handlerLoader := handlers.NewLoader(mux, &ctx)
+    handlerLoader := handlers.NewLoader(mux, ctx)
     handlerLoader.Load()
 
+    // Periodically remove expired idempotency records
+    go handlers.PurgeIdempotencyRecords(ctx, time.Hour)
+
+    // Periodically remove the personal data of accounts deleted longer than the grace period ago
+    go handlers.PurgeDeletedUsers(ctx, time.Hour)
+
+    // Serve metrics on their own listener so they are not public
+    if config.MetricsAddr != "" {
+        go func () {
+            fmt.Println("Serving metrics on " + config.MetricsAddr)
+
+            if err := http.ListenAndServe(config.MetricsAddr, handlers.MetricsHandler()); err != nil {
+                fmt.Println("Error starting metrics HTTP server on " + config.MetricsAddr + ": " + err.Error())
+            }
+        }()
+    }
+
 	// Start listening on any host, port 5000.
 	fmt.Println("Listening on :5000")
 
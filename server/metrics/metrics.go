@@ -0,0 +1,305 @@
+// Package metrics records application metrics and exposes them in the Prometheus text exposition format.
+package metrics
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "math"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+)
+
+// Collector is a metric which can write itself in the Prometheus text format.
+type Collector interface {
+    // Collect writes the metric's HELP, TYPE and sample lines
+    Collect (w io.Writer)
+}
+
+// Registry holds the collectors which are exposed by Handler.
+type Registry struct {
+    mu sync.Mutex
+    collectors []Collector
+}
+
+// DefaultRegistry is the registry metrics created by the New* functions in this package are added to.
+var DefaultRegistry = &Registry{}
+
+// Register adds a collector to the registry.
+func (r *Registry) Register (c Collector) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    r.collectors = append(r.collectors, c)
+}
+
+// Gather writes all registered metrics in the Prometheus text format.
+func (r *Registry) Gather (w io.Writer) {
+    r.mu.Lock()
+    collectors := append([]Collector{}, r.collectors...)
+    r.mu.Unlock()
+
+    for _, c := range collectors {
+        c.Collect(w)
+    }
+}
+
+// Handler serves the metrics in a registry to Prometheus.
+func Handler (r *Registry) http.Handler {
+    return http.HandlerFunc(func (w http.ResponseWriter, req *http.Request) {
+        w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+        buf := bufio.NewWriter(w)
+        r.Gather(buf)
+        buf.Flush()
+    })
+}
+
+// Default histogram buckets, in seconds. Suitable for request latencies.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// writeHeader writes the HELP and TYPE lines of a metric.
+func writeHeader (w io.Writer, name, help, metricType string) {
+    help = strings.Replace(help, "\\", "\\\\", -1)
+    help = strings.Replace(help, "\n", "\\n", -1)
+
+    fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+// labelString formats label names and values, ex: {route="/",status="200"}. Extra label pairs are appended after.
+func labelString (names, values []string, extra ...string) string {
+    if len(names) == 0 && len(extra) == 0 {
+        return ""
+    }
+
+    pairs := make([]string, 0, len(names) + len(extra) / 2)
+    for i, name := range names {
+        pairs = append(pairs, name + "=\"" + escapeLabelValue(values[i]) + "\"")
+    }
+    for i := 0; i + 1 < len(extra); i += 2 {
+        pairs = append(pairs, extra[i] + "=\"" + escapeLabelValue(extra[i + 1]) + "\"")
+    }
+
+    return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// escapeLabelValue escapes backslashes, double quotes and newlines in a label value.
+func escapeLabelValue (v string) string {
+    v = strings.Replace(v, "\\", "\\\\", -1)
+    v = strings.Replace(v, "\"", "\\\"", -1)
+    return strings.Replace(v, "\n", "\\n", -1)
+}
+
+// formatFloat formats a sample value.
+func formatFloat (v float64) string {
+    switch {
+    case math.IsInf(v, 1):
+        return "+Inf"
+    case math.IsInf(v, -1):
+        return "-Inf"
+    case math.IsNaN(v):
+        return "NaN"
+    }
+
+    return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Separates label values in map keys, can not appear in valid UTF-8
+const labelSep = "\xff"
+
+// labelVec keeps label values for each child of a vector metric.
+type labelVec struct {
+    names []string
+}
+
+// key returns the map key for a set of label values. Panics if the wrong number of values is given, as this is a
+// programming error.
+func (l labelVec) key (values []string) string {
+    if len(values) != len(l.names) {
+        panic(fmt.Sprintf("expected %d label values, got %d", len(l.names), len(values)))
+    }
+
+    return strings.Join(values, labelSep)
+}
+
+// sortedKeys returns the keys of a children map in a stable order.
+func sortedKeys (keys []string) []string {
+    sort.Strings(keys)
+    return keys
+}
+
+// splitKey converts a map key back into label values.
+func (l labelVec) splitKey (key string) []string {
+    if len(l.names) == 0 {
+        return nil
+    }
+
+    return strings.Split(key, labelSep)
+}
+
+// CounterVec is a counter partitioned by labels.
+type CounterVec struct {
+    name, help string
+    labels labelVec
+
+    mu sync.Mutex
+    values map[string]float64
+}
+
+// NewCounterVec creates a counter and registers it with the DefaultRegistry.
+func NewCounterVec (name, help string, labelNames ...string) *CounterVec {
+    c := &CounterVec{name: name, help: help, labels: labelVec{labelNames}, values: make(map[string]float64)}
+    DefaultRegistry.Register(c)
+
+    return c
+}
+
+// Inc increments the counter with the provided label values by 1.
+func (c *CounterVec) Inc (labelValues ...string) {
+    c.Add(1, labelValues...)
+}
+
+// Add increases the counter with the provided label values. Counters can only go up, so negative values panic.
+func (c *CounterVec) Add (v float64, labelValues ...string) {
+    if v < 0 {
+        panic("counter can not decrease")
+    }
+
+    key := c.labels.key(labelValues)
+
+    c.mu.Lock()
+    c.values[key] += v
+    c.mu.Unlock()
+}
+
+// Collect implements Collector.
+func (c *CounterVec) Collect (w io.Writer) {
+    writeHeader(w, c.name, c.help, "counter")
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    keys := make([]string, 0, len(c.values))
+    for key := range c.values {
+        keys = append(keys, key)
+    }
+
+    for _, key := range sortedKeys(keys) {
+        fmt.Fprintf(w, "%s%s %s\n", c.name, labelString(c.labels.names, c.labels.splitKey(key)), formatFloat(c.values[key]))
+    }
+}
+
+// histogram holds the observations of one child of a HistogramVec.
+type histogram struct {
+    // Count of observations less than or equal to each bucket's upper bound
+    counts []uint64
+    sum float64
+    count uint64
+}
+
+// HistogramVec is a histogram partitioned by labels.
+type HistogramVec struct {
+    name, help string
+    labels labelVec
+    // Bucket upper bounds, sorted
+    buckets []float64
+
+    mu sync.Mutex
+    values map[string]*histogram
+}
+
+// NewHistogramVec creates a histogram and registers it with the DefaultRegistry. Uses DefBuckets if buckets is nil.
+func NewHistogramVec (name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+    if buckets == nil {
+        buckets = DefBuckets
+    }
+
+    sorted := append([]float64{}, buckets...)
+    sort.Float64s(sorted)
+
+    h := &HistogramVec{name: name, help: help, labels: labelVec{labelNames}, buckets: sorted, values: make(map[string]*histogram)}
+    DefaultRegistry.Register(h)
+
+    return h
+}
+
+// Observe records a value in the histogram with the provided label values.
+func (h *HistogramVec) Observe (v float64, labelValues ...string) {
+    key := h.labels.key(labelValues)
+
+    h.mu.Lock()
+    defer h.mu.Unlock()
+
+    hist, ok := h.values[key]
+    if ok == false {
+        hist = &histogram{counts: make([]uint64, len(h.buckets))}
+        h.values[key] = hist
+    }
+
+    for i, bound := range h.buckets {
+        if v <= bound {
+            hist.counts[i]++
+        }
+    }
+
+    hist.sum += v
+    hist.count++
+}
+
+// Collect implements Collector.
+func (h *HistogramVec) Collect (w io.Writer) {
+    writeHeader(w, h.name, h.help, "histogram")
+
+    h.mu.Lock()
+    defer h.mu.Unlock()
+
+    keys := make([]string, 0, len(h.values))
+    for key := range h.values {
+        keys = append(keys, key)
+    }
+
+    for _, key := range sortedKeys(keys) {
+        hist := h.values[key]
+        values := h.labels.splitKey(key)
+
+        for i, bound := range h.buckets {
+            fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelString(h.labels.names, values, "le", formatFloat(bound)), hist.counts[i])
+        }
+
+        fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelString(h.labels.names, values, "le", "+Inf"), hist.count)
+        fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labelString(h.labels.names, values), formatFloat(hist.sum))
+        fmt.Fprintf(w, "%s_count%s %d\n", h.name, labelString(h.labels.names, values), hist.count)
+    }
+}
+
+// GaugeFunc is a gauge whose value is read when metrics are collected.
+type GaugeFunc struct {
+    name, help, metricType string
+    fn func () float64
+}
+
+// NewGaugeFunc creates a gauge whose value is computed by fn and registers it with the DefaultRegistry.
+func NewGaugeFunc (name, help string, fn func () float64) *GaugeFunc {
+    g := &GaugeFunc{name, help, "gauge", fn}
+    DefaultRegistry.Register(g)
+
+    return g
+}
+
+// NewCounterFunc creates a counter whose value is read from fn, for totals which are tracked elsewhere. Registers it
+// with the DefaultRegistry.
+func NewCounterFunc (name, help string, fn func () float64) *GaugeFunc {
+    g := &GaugeFunc{name, help, "counter", fn}
+    DefaultRegistry.Register(g)
+
+    return g
+}
+
+// Collect implements Collector.
+func (g *GaugeFunc) Collect (w io.Writer) {
+    writeHeader(w, g.name, g.help, g.metricType)
+    fmt.Fprintf(w, "%s %s\n", g.name, formatFloat(g.fn()))
+}
@@ -0,0 +1,55 @@
+package metrics
+
+import (
+    "bytes"
+    "testing"
+
+    "github.com/stretchr/testify/assert"
+)
+
+func TestCounterVec_Collect(t *testing.T) {
+    c := &CounterVec{name: "requests_total", help: "Requests.", labels: labelVec{[]string{"route", "status"}}, values: make(map[string]float64)}
+    c.Inc("/b", "200")
+    c.Inc("/a", "500")
+    c.Add(2, "/a", "500")
+    c.Inc("/q\"uote", "200")
+
+    var buf bytes.Buffer
+    c.Collect(&buf)
+
+    assert.Equal(t, "# HELP requests_total Requests.\n" +
+        "# TYPE requests_total counter\n" +
+        "requests_total{route=\"/a\",status=\"500\"} 3\n" +
+        "requests_total{route=\"/b\",status=\"200\"} 1\n" +
+        "requests_total{route=\"/q\\\"uote\",status=\"200\"} 1\n", buf.String())
+
+    assert.Panics(t, func () { c.Inc("/a") })
+    assert.Panics(t, func () { c.Add(-1, "/a", "200") })
+}
+
+func TestHistogramVec_Collect(t *testing.T) {
+    h := &HistogramVec{name: "latency_seconds", help: "Latency.", labels: labelVec{}, buckets: []float64{0.1, 1}, values: make(map[string]*histogram)}
+    h.Observe(0.05)
+    h.Observe(0.5)
+    h.Observe(5)
+
+    var buf bytes.Buffer
+    h.Collect(&buf)
+
+    assert.Equal(t, "# HELP latency_seconds Latency.\n" +
+        "# TYPE latency_seconds histogram\n" +
+        "latency_seconds_bucket{le=\"0.1\"} 1\n" +
+        "latency_seconds_bucket{le=\"1\"} 2\n" +
+        "latency_seconds_bucket{le=\"+Inf\"} 3\n" +
+        "latency_seconds_sum 5.55\n" +
+        "latency_seconds_count 3\n", buf.String())
+}
+
+func TestGaugeFunc_Collect(t *testing.T) {
+    g := &GaugeFunc{"connections", "Connections.", "gauge", func () float64 { return 4 }}
+
+    var buf bytes.Buffer
+    g.Collect(&buf)
+
+    assert.Equal(t, "# HELP connections Connections.\n# TYPE connections gauge\nconnections 4\n", buf.String())
+}
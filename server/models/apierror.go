@@ -4,6 +4,9 @@ import "fmt"
 
 // APIError provides detail about an error that occurred while handling an endpoint
 //
+// APIErrors should be created from an ErrorDef in the error catalog (errors.go) so that their ids are stable and
+// their messages can be localized.
+//
 // IMPORTANT:
 // Update the manual fields below (APIErrorErrorMarshallingHTTPResponse and APIErrorManualMarshalledErrorMarshallingHTTPResponse)
 // if any changes are made to the field
@@ -12,25 +15,45 @@ type APIError struct {
 	Id       string `json:"id"`
 	Message  string `json:"message"`
 	HTTPCode int    `json:"http_code"`
+    // Link to documentation about error
+    DocsURL string `json:"docs_url,omitempty"`
+
+    // Values of message template parameters, used to render message in other locales
+    params map[string]string
 }
 
 // Error served when there is an error encoding the provided data into json for a response.
-var APIErrorErrorMarshallingHTTPResponse = &APIError{"error_marshalling_http_response", "An internal error occured while generating the response", 500}
+var APIErrorErrorMarshallingHTTPResponse = ErrMarshallingHTTPResponse.New()
 
 // String representing APIErrorErrorMarshallingHTTPResponse in JSON form
 //
 // This field is here for use when an error occurs marshalling an HTTPResponse object to send to a client.
 // It was put in this file (Although used elsewhere) so that is is kept up to date with any field changes of APIError.
-var APIErrorManualMarshalledErrorMarshallingHTTPResponse = "" +
-                "{" +
-				    "\"error\":" +
-					"{" +
-					    "\"id\":\"" + APIErrorErrorMarshallingHTTPResponse.Id + "\"," +
-					    "\"message\":\"" + APIErrorErrorMarshallingHTTPResponse.Message + "\"," +
-					    "\"http_code\": " + string(APIErrorErrorMarshallingHTTPResponse.HTTPCode) +
-					"}" +
-				"}"
+//
+// Only strings and numbers are encoded, which can not fail, so it is always valid JSON.
+var APIErrorManualMarshalledErrorMarshallingHTTPResponse = mustMarshal(map[string]interface{}{
+    "error": map[string]interface{}{
+        "id": APIErrorErrorMarshallingHTTPResponse.Id,
+        "message": APIErrorErrorMarshallingHTTPResponse.Message,
+        "http_code": APIErrorErrorMarshallingHTTPResponse.HTTPCode,
+        "docs_url": APIErrorErrorMarshallingHTTPResponse.DocsURL,
+    },
+})
 
 func (e APIError) Error() string {
 	return fmt.Sprintf("%v (%v: %v)", e.Message, e.Id, e.HTTPCode)
 }
+
+// Localize returns a copy of the error with its message rendered in the provided locale. Errors which are not in the
+// catalog are returned as is.
+func (e *APIError) Localize (locale string) *APIError {
+    def := LookupErrorDef(e.Id)
+    if def == nil {
+        return e
+    }
+
+    localized := *e
+    localized.Message = renderMessage(def.Template(locale), e.params)
+
+    return &localized
+}
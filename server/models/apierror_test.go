@@ -1,11 +1,87 @@
 package models
 
 import (
+	"context"
+	"time"
+	"encoding/json"
 	"github.com/stretchr/testify/assert"
 	"testing"
 )
 
 func TestAPIError_Error(t *testing.T) {
-	err := APIError{"errorId", "errorMsg", 123}
+	err := APIError{Id: "errorId", Message: "errorMsg", HTTPCode: 123}
 	assert.Equal(t, err.Error(), "errorMsg (errorId: 123)")
 }
+
+func TestErrorDef_New(t *testing.T) {
+	a := assert.New(t)
+
+	err := ErrMissingParam.New("id_token")
+	a.Equal("missing_param", err.Id)
+	a.Equal(422, err.HTTPCode)
+	a.Equal("`id_token` must be provided as a post parameter", err.Message)
+	a.Equal(ErrorDocsURL + "#missing_param", err.DocsURL)
+
+	// Values are not rendered again
+	err = ErrFieldOutOfRange.New("{max}", "{field}", "10")
+	a.Equal("`{max}` must be between {field} and 10", err.Message)
+
+	a.Panics(func() { ErrMissingParam.New() })
+	a.Panics(func() { DefineError("missing_param", 400, "Duplicate") })
+}
+
+func TestAPIError_Localize(t *testing.T) {
+	a := assert.New(t)
+
+	err := ErrMissingParam.New("id_token")
+	a.Equal("`id_token` doit être fourni comme paramètre post", err.Localize("fr").Message)
+	a.Equal(err.Message, err.Localize("de").Message)
+
+	// Errors not in catalog are not changed
+	custom := &APIError{Id: "custom", Message: "Custom", HTTPCode: 400}
+	a.Equal(custom, custom.Localize("fr"))
+}
+
+func TestNegotiateLocale(t *testing.T) {
+	a := assert.New(t)
+
+	locale, ok := NegotiateLocale("de-DE, fr-CA;q=0.8, en;q=0.9")
+	a.True(ok)
+	a.Equal("en", locale)
+
+	locale, ok = NegotiateLocale("es-MX")
+	a.True(ok)
+	a.Equal("es", locale)
+
+	_, ok = NegotiateLocale("de, ja;q=0.5")
+	a.False(ok)
+
+	_, ok = NegotiateLocale("")
+	a.False(ok)
+}
+
+func TestManualMarshalledResponses(t *testing.T) {
+	a := assert.New(t)
+
+	var envelope map[string]map[string]interface{}
+	a.Nil(json.Unmarshal([]byte(APIErrorManualMarshalledErrorMarshallingHTTPResponse), &envelope))
+	a.Equal(float64(500), envelope["error"]["http_code"])
+
+	var problem map[string]interface{}
+	a.Nil(json.Unmarshal([]byte(ProblemManualMarshalledErrorMarshallingHTTPResponse), &problem))
+	a.Equal(float64(500), problem["status"])
+}
+
+func TestContextError(t *testing.T) {
+	a := assert.New(t)
+
+	a.Nil(ContextError(context.Background()))
+
+	c, cancel := context.WithCancel(context.Background())
+	cancel()
+	a.Equal(ErrRequestCanceled.Id, ContextError(c).Id)
+
+	c, cancel = context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	a.Equal(ErrRequestTimeout.Id, ContextError(c).Id)
+}
@@ -1,6 +1,10 @@
 package models
 
 import (
+    "context"
+
+    "github.com/Noah-Huppert/squad-up/server/mail"
+
     "github.com/jinzhu/gorm"
 )
 
@@ -8,8 +12,96 @@ import (
 type AppContext struct {
     // App config
     Config Config
-    // Gorm Database
+    // Gorm Database, endpoint handlers should use the stores below instead
     Db *gorm.DB
+
+    // Stores
+    Users UserStore
+    Idempotency IdempotencyStore
+    Blobs BlobStore
+    Squads SquadStore
+    Invites InviteStore
+    Events EventStore
+    RSVPs RSVPStore
+    Availability AvailabilityStore
+    Polls PollStore
+    Busy BusyStore
+    Feeds FeedStore
+
+    // Sends emails
+    Mailer mail.Mailer
+}
+
+// NewGormAppContext creates an AppContext whose stores use a gorm database. Blobs are saved in Config.BlobDir.
+func NewGormAppContext (config Config, db *gorm.DB, mailer mail.Mailer) *AppContext {
+    ctx := &AppContext{
+        Config: config,
+        Blobs: NewFileBlobStore(config.BlobDir),
+        Mailer: mailer,
+    }
+    ctx.useDb(db)
+
+    return ctx
+}
+
+// useDb sets the context's database and points its stores at it.
+func (ctx *AppContext) useDb (db *gorm.DB) {
+    ctx.Db = db
+    ctx.Users = NewGormUserStore(db)
+    ctx.Idempotency = NewGormIdempotencyStore(db)
+    ctx.Squads = NewGormSquadStore(db)
+    ctx.Invites = NewGormInviteStore(db)
+    ctx.Events = NewGormEventStore(db)
+    ctx.RSVPs = NewGormRSVPStore(db)
+    ctx.Availability = NewGormAvailabilityStore(db)
+    ctx.Polls = NewGormPollStore(db)
+    ctx.Busy = NewGormBusyStore(db)
+    ctx.Feeds = NewGormFeedStore(db)
+}
+
+// NewMemoryAppContext creates an AppContext whose stores keep data in memory. Used by tests.
+func NewMemoryAppContext (config Config) *AppContext {
+    users := NewMemoryUserStore()
+    squads := NewMemorySquadStore(users)
+    events := NewMemoryEventStore(users, squads)
+
+    return &AppContext{
+        Config: config,
+        Users: users,
+        Idempotency: NewMemoryIdempotencyStore(),
+        Blobs: NewMemoryBlobStore(),
+        Squads: squads,
+        Invites: NewMemoryInviteStore(squads, users),
+        Events: events,
+        RSVPs: NewMemoryRSVPStore(users, events),
+        Availability: NewMemoryAvailabilityStore(),
+        Polls: NewMemoryPollStore(),
+        Busy: NewMemoryBusyStore(),
+        Feeds: NewMemoryFeedStore(),
+        Mailer: &mail.MemoryMailer{},
+    }
+}
+
+// Transaction calls fn with a copy of the context whose stores run their queries in a database transaction. The
+// transaction is committed if fn returns nil and rolled back otherwise, fn's error is returned.
+//
+// Contexts without a database, like the memory contexts used by tests, can not roll back. fn is called with the
+// context as is.
+func (ctx *AppContext) Transaction (c context.Context, fn func (tx *AppContext) error) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    if ctx.Db == nil {
+        return fn(ctx)
+    }
+
+    return inTransaction(ctx.Db, func (tx *gorm.DB) error {
+        txCtx := *ctx
+        txCtx.useDb(tx)
+
+        return fn(&txCtx)
+    })
 }
 
 type AppContextProvider interface {
@@ -0,0 +1,574 @@
+package models
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "sort"
+    "sync"
+    "time"
+
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+
+    "github.com/jinzhu/gorm"
+)
+
+// ErrPollFinalized is returned by AvailabilityStore methods which change a poll after a slot was picked.
+var ErrPollFinalized = errors.New("poll is finalized")
+
+// Weights of availability answers in the score of a slot
+const (
+    AvailabilityYesWeight = 1.0
+    AvailabilityIfNeedBeWeight = 0.5
+)
+
+// SlotRanking is how well a slot of an availability poll works for a squad.
+type SlotRanking struct {
+    Slot db.AvailabilitySlot `json:"slot"`
+    // Sum of the weights of members' answers
+    Score float64 `json:"score"`
+    // Ids of the members who gave each answer
+    Yes []int `json:"yes"`
+    IfNeedBe []int `json:"if_need_be"`
+    No []int `json:"no"`
+    // Ids of the members who did not answer
+    Missing []int `json:"missing"`
+}
+
+// slotRankings sorts rankings from best to worst: by score, then number of yes answers, then start time.
+type slotRankings []SlotRanking
+
+func (l slotRankings) Len () int { return len(l) }
+func (l slotRankings) Swap (i, j int) { l[i], l[j] = l[j], l[i] }
+func (l slotRankings) Less (i, j int) bool {
+    a, b := l[i], l[j]
+    switch {
+    case a.Score != b.Score:
+        return a.Score > b.Score
+    case len(a.Yes) != len(b.Yes):
+        return len(a.Yes) > len(b.Yes)
+    case a.Slot.StartsAt.Equal(b.Slot.StartsAt) == false:
+        return a.Slot.StartsAt.Before(b.Slot.StartsAt)
+    }
+
+    return a.Slot.ID < b.Slot.ID
+}
+
+// RankSlots ranks the slots of an availability poll from best to worst. Only the answers of the provided members are
+// counted, so people who left the squad do not sway the result.
+func RankSlots (slots []db.AvailabilitySlot, votes []db.AvailabilityVote, members []int) []SlotRanking {
+    answers := make(map[int]map[int]string)
+    for _, vote := range votes {
+        if answers[vote.SlotID] == nil {
+            answers[vote.SlotID] = make(map[int]string)
+        }
+        answers[vote.SlotID][vote.UserID] = vote.Answer
+    }
+
+    rankings := make([]SlotRanking, len(slots))
+    for i, slot := range slots {
+        ranking := SlotRanking{Slot: slot, Yes: []int{}, IfNeedBe: []int{}, No: []int{}, Missing: []int{}}
+
+        for _, userId := range members {
+            switch answers[slot.ID][userId] {
+            case db.AvailabilityYes:
+                ranking.Yes = append(ranking.Yes, userId)
+                ranking.Score += AvailabilityYesWeight
+            case db.AvailabilityIfNeedBe:
+                ranking.IfNeedBe = append(ranking.IfNeedBe, userId)
+                ranking.Score += AvailabilityIfNeedBeWeight
+            case db.AvailabilityNo:
+                ranking.No = append(ranking.No, userId)
+            default:
+                ranking.Missing = append(ranking.Missing, userId)
+            }
+        }
+
+        rankings[i] = ranking
+    }
+
+    sort.Sort(slotRankings(rankings))
+
+    return rankings
+}
+
+// AvailabilityStore loads and saves availability polls and their votes.
+type AvailabilityStore interface {
+    // Create saves a new poll and its slots, setting their IDs
+    Create (c context.Context, poll *db.AvailabilityPoll) error
+    // FindById returns the poll with the provided id and its slots. Returns ErrNotFound if no such poll exists.
+    FindById (c context.Context, id int) (*db.AvailabilityPoll, error)
+    // FindBySquad returns a squad's polls and their slots, newest first
+    FindBySquad (c context.Context, squadId int) ([]db.AvailabilityPoll, error)
+    // Update saves changes to a poll, but not its slots
+    Update (c context.Context, poll *db.AvailabilityPoll) error
+    // Finalize marks a poll as finalized, recording the event created for it. Returns ErrPollFinalized if the poll
+    // was already finalized.
+    Finalize (c context.Context, pollId, eventId int) error
+    // Delete soft deletes a poll
+    Delete (c context.Context, id int) error
+    // FindVotes returns the votes of a poll
+    FindVotes (c context.Context, pollId int) ([]db.AvailabilityVote, error)
+    // Vote replaces a user's votes in a poll. Returns ErrPollFinalized if the poll was finalized.
+    Vote (c context.Context, pollId, userId int, votes []db.AvailabilityVote) error
+    // FindVotesByUser returns a user's votes in all polls
+    FindVotesByUser (c context.Context, userId int) ([]db.AvailabilityVote, error)
+    // DeleteVotesByUser permanently deletes a user's votes in all polls, including finalized and deleted ones
+    DeleteVotesByUser (c context.Context, userId int) error
+}
+
+// slotsByStart sorts slots by start time.
+type slotsByStart []db.AvailabilitySlot
+
+func (l slotsByStart) Len () int { return len(l) }
+func (l slotsByStart) Swap (i, j int) { l[i], l[j] = l[j], l[i] }
+func (l slotsByStart) Less (i, j int) bool {
+    if l[i].StartsAt.Equal(l[j].StartsAt) {
+        return l[i].ID < l[j].ID
+    }
+
+    return l[i].StartsAt.Before(l[j].StartsAt)
+}
+
+// GormAvailabilityStore is an AvailabilityStore which uses a gorm database. Votes lock their poll's row so they can
+// not be saved after the poll is finalized.
+type GormAvailabilityStore struct {
+    db *gorm.DB
+}
+
+// NewGormAvailabilityStore creates a GormAvailabilityStore.
+func NewGormAvailabilityStore (db *gorm.DB) *GormAvailabilityStore {
+    return &GormAvailabilityStore{db}
+}
+
+func (s *GormAvailabilityStore) Create (c context.Context, poll *db.AvailabilityPoll) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    return inTransaction(s.db, func (tx *gorm.DB) error {
+        if err := tx.Set("gorm:save_associations", false).Create(poll).Error; err != nil {
+            return err
+        }
+
+        for i := range poll.Slots {
+            poll.Slots[i].PollID = poll.ID
+            if err := tx.Create(&poll.Slots[i]).Error; err != nil {
+                return err
+            }
+        }
+
+        sort.Sort(slotsByStart(poll.Slots))
+
+        return nil
+    })
+}
+
+// loadSlots loads the slots of polls.
+func (s *GormAvailabilityStore) loadSlots (polls []db.AvailabilityPoll) error {
+    if len(polls) == 0 {
+        return nil
+    }
+
+    index := make(map[int]int)
+    var ids []int
+    for i, poll := range polls {
+        index[poll.ID] = i
+        ids = append(ids, poll.ID)
+        polls[i].Slots = []db.AvailabilitySlot{}
+    }
+
+    var slots []db.AvailabilitySlot
+    if err := s.db.Where("poll_id IN (?)", ids).Order("starts_at, id").Find(&slots).Error; err != nil {
+        return err
+    }
+
+    for _, slot := range slots {
+        poll := &polls[index[slot.PollID]]
+        poll.Slots = append(poll.Slots, slot)
+    }
+
+    return nil
+}
+
+func (s *GormAvailabilityStore) FindById (c context.Context, id int) (*db.AvailabilityPoll, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    var poll db.AvailabilityPoll
+    q := s.db.Where("id = ?", id).First(&poll)
+    if q.RecordNotFound() {
+        return nil, ErrNotFound
+    } else if q.Error != nil {
+        return nil, q.Error
+    }
+
+    polls := []db.AvailabilityPoll{poll}
+    if err := s.loadSlots(polls); err != nil {
+        return nil, err
+    }
+
+    return &polls[0], nil
+}
+
+func (s *GormAvailabilityStore) FindBySquad (c context.Context, squadId int) ([]db.AvailabilityPoll, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    var polls []db.AvailabilityPoll
+    if err := s.db.Where("squad_id = ?", squadId).Order("created_at DESC, id DESC").Find(&polls).Error; err != nil {
+        return nil, err
+    }
+
+    return polls, s.loadSlots(polls)
+}
+
+func (s *GormAvailabilityStore) Update (c context.Context, poll *db.AvailabilityPoll) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    return s.db.Set("gorm:save_associations", false).Save(poll).Error
+}
+
+func (s *GormAvailabilityStore) Finalize (c context.Context, pollId, eventId int) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    q := s.db.Model(&db.AvailabilityPoll{}).Where("id = ? AND status = ?", pollId, db.AvailabilityPollOpen).
+        Updates(map[string]interface{}{"status": db.AvailabilityPollFinalized, "event_id": eventId})
+    if q.Error != nil {
+        return q.Error
+    } else if q.RowsAffected == 0 {
+        return ErrPollFinalized
+    }
+
+    return nil
+}
+
+func (s *GormAvailabilityStore) Delete (c context.Context, id int) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    return s.db.Where("id = ?", id).Delete(&db.AvailabilityPoll{}).Error
+}
+
+func (s *GormAvailabilityStore) FindVotes (c context.Context, pollId int) ([]db.AvailabilityVote, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    var votes []db.AvailabilityVote
+    err := s.db.Where("poll_id = ?", pollId).Order("id").Find(&votes).Error
+
+    return votes, err
+}
+
+func (s *GormAvailabilityStore) Vote (c context.Context, pollId, userId int, votes []db.AvailabilityVote) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    return inTransaction(s.db, func (tx *gorm.DB) error {
+        var status string
+        row := tx.Raw("SELECT status FROM availability_polls WHERE id = ? AND deleted_at IS NULL FOR UPDATE", pollId).Row()
+        if err := row.Scan(&status); err == sql.ErrNoRows {
+            return ErrNotFound
+        } else if err != nil {
+            return err
+        } else if status != db.AvailabilityPollOpen {
+            return ErrPollFinalized
+        }
+
+        // Votes are replaced, not soft deleted, so the unique index allows new ones
+        err := tx.Unscoped().Where("poll_id = ? AND user_id = ?", pollId, userId).Delete(&db.AvailabilityVote{}).Error
+        if err != nil {
+            return err
+        }
+
+        for i := range votes {
+            votes[i].PollID, votes[i].UserID = pollId, userId
+            if err := tx.Create(&votes[i]).Error; err != nil {
+                return err
+            }
+        }
+
+        return nil
+    })
+}
+
+func (s *GormAvailabilityStore) FindVotesByUser (c context.Context, userId int) ([]db.AvailabilityVote, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    var votes []db.AvailabilityVote
+    err := s.db.Where("user_id = ?", userId).Order("id").Find(&votes).Error
+
+    return votes, err
+}
+
+func (s *GormAvailabilityStore) DeleteVotesByUser (c context.Context, userId int) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    return s.db.Unscoped().Where("user_id = ?", userId).Delete(&db.AvailabilityVote{}).Error
+}
+
+// MemoryAvailabilityStore is an AvailabilityStore which keeps polls in memory. Used by tests.
+type MemoryAvailabilityStore struct {
+    mu sync.Mutex
+    polls map[int]db.AvailabilityPoll
+    votes []db.AvailabilityVote
+    nextId int
+}
+
+// NewMemoryAvailabilityStore creates an empty MemoryAvailabilityStore.
+func NewMemoryAvailabilityStore () *MemoryAvailabilityStore {
+    return &MemoryAvailabilityStore{polls: make(map[int]db.AvailabilityPoll), nextId: 1}
+}
+
+// pollsByNewest sorts polls like GormAvailabilityStore.FindBySquad.
+type pollsByNewest []db.AvailabilityPoll
+
+func (l pollsByNewest) Len () int { return len(l) }
+func (l pollsByNewest) Swap (i, j int) { l[i], l[j] = l[j], l[i] }
+func (l pollsByNewest) Less (i, j int) bool {
+    if l[i].CreatedAt.Equal(l[j].CreatedAt) {
+        return l[i].ID > l[j].ID
+    }
+
+    return l[i].CreatedAt.After(l[j].CreatedAt)
+}
+
+// copyPoll returns a copy of a poll which does not share its slots.
+func copyPoll (poll db.AvailabilityPoll) db.AvailabilityPoll {
+    poll.Slots = append([]db.AvailabilitySlot{}, poll.Slots...)
+
+    return poll
+}
+
+func (s *MemoryAvailabilityStore) Create (c context.Context, poll *db.AvailabilityPoll) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    now := time.Now()
+    poll.ID = s.nextId
+    poll.CreatedAt = now
+    poll.UpdatedAt = now
+    s.nextId++
+
+    for i := range poll.Slots {
+        poll.Slots[i].ID = s.nextId
+        poll.Slots[i].PollID = poll.ID
+        s.nextId++
+    }
+
+    sort.Sort(slotsByStart(poll.Slots))
+    s.polls[poll.ID] = copyPoll(*poll)
+
+    return nil
+}
+
+func (s *MemoryAvailabilityStore) FindById (c context.Context, id int) (*db.AvailabilityPoll, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    poll, ok := s.polls[id]
+    if ok == false || poll.DeletedAt != nil {
+        return nil, ErrNotFound
+    }
+
+    poll = copyPoll(poll)
+
+    return &poll, nil
+}
+
+func (s *MemoryAvailabilityStore) FindBySquad (c context.Context, squadId int) ([]db.AvailabilityPoll, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    var polls []db.AvailabilityPoll
+    for _, poll := range s.polls {
+        if poll.SquadID == squadId && poll.DeletedAt == nil {
+            polls = append(polls, copyPoll(poll))
+        }
+    }
+
+    sort.Sort(pollsByNewest(polls))
+
+    return polls, nil
+}
+
+func (s *MemoryAvailabilityStore) Update (c context.Context, poll *db.AvailabilityPoll) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    saved, ok := s.polls[poll.ID]
+    if ok == false || saved.DeletedAt != nil {
+        return ErrNotFound
+    }
+
+    updated := copyPoll(*poll)
+    updated.Slots = saved.Slots
+    updated.UpdatedAt = time.Now()
+    poll.UpdatedAt = updated.UpdatedAt
+    s.polls[poll.ID] = updated
+
+    return nil
+}
+
+func (s *MemoryAvailabilityStore) Finalize (c context.Context, pollId, eventId int) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    poll, ok := s.polls[pollId]
+    if ok == false || poll.DeletedAt != nil {
+        return ErrNotFound
+    } else if poll.Finalized() {
+        return ErrPollFinalized
+    }
+
+    poll.Status = db.AvailabilityPollFinalized
+    poll.EventID = &eventId
+    poll.UpdatedAt = time.Now()
+    s.polls[pollId] = poll
+
+    return nil
+}
+
+func (s *MemoryAvailabilityStore) Delete (c context.Context, id int) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    poll, ok := s.polls[id]
+    if ok == false || poll.DeletedAt != nil {
+        return ErrNotFound
+    }
+
+    now := time.Now()
+    poll.DeletedAt = &now
+    s.polls[id] = poll
+
+    return nil
+}
+
+func (s *MemoryAvailabilityStore) FindVotes (c context.Context, pollId int) ([]db.AvailabilityVote, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    var votes []db.AvailabilityVote
+    for _, vote := range s.votes {
+        if vote.PollID == pollId {
+            votes = append(votes, vote)
+        }
+    }
+
+    return votes, nil
+}
+
+func (s *MemoryAvailabilityStore) Vote (c context.Context, pollId, userId int, votes []db.AvailabilityVote) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    poll, ok := s.polls[pollId]
+    if ok == false || poll.DeletedAt != nil {
+        return ErrNotFound
+    } else if poll.Finalized() {
+        return ErrPollFinalized
+    }
+
+    kept := s.votes[:0]
+    for _, vote := range s.votes {
+        if vote.PollID != pollId || vote.UserID != userId {
+            kept = append(kept, vote)
+        }
+    }
+    s.votes = kept
+
+    now := time.Now()
+    for i := range votes {
+        votes[i].ID = s.nextId
+        votes[i].PollID, votes[i].UserID = pollId, userId
+        votes[i].CreatedAt, votes[i].UpdatedAt = now, now
+        s.nextId++
+
+        s.votes = append(s.votes, votes[i])
+    }
+
+    return nil
+}
+
+func (s *MemoryAvailabilityStore) FindVotesByUser (c context.Context, userId int) ([]db.AvailabilityVote, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    var votes []db.AvailabilityVote
+    for _, vote := range s.votes {
+        if vote.UserID == userId {
+            votes = append(votes, vote)
+        }
+    }
+
+    return votes, nil
+}
+
+func (s *MemoryAvailabilityStore) DeleteVotesByUser (c context.Context, userId int) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    kept := s.votes[:0]
+    for _, vote := range s.votes {
+        if vote.UserID != userId {
+            kept = append(kept, vote)
+        }
+    }
+    s.votes = kept
+
+    return nil
+}
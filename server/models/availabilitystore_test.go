@@ -0,0 +1,43 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Noah-Huppert/squad-up/server/models/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRankSlots(t *testing.T) {
+	a := assert.New(t)
+	start := time.Date(2030, 6, 1, 18, 0, 0, 0, time.UTC)
+
+	slots := []db.AvailabilitySlot{
+		{ID: 1, StartsAt: start},
+		{ID: 2, StartsAt: start.Add(24 * time.Hour)},
+		{ID: 3, StartsAt: start.Add(48 * time.Hour)},
+	}
+	votes := []db.AvailabilityVote{
+		{SlotID: 1, UserID: 10, Answer: db.AvailabilityIfNeedBe},
+		{SlotID: 1, UserID: 11, Answer: db.AvailabilityIfNeedBe},
+		{SlotID: 2, UserID: 10, Answer: db.AvailabilityYes},
+		{SlotID: 2, UserID: 11, Answer: db.AvailabilityNo},
+		{SlotID: 3, UserID: 10, Answer: db.AvailabilityYes},
+		// Former member
+		{SlotID: 3, UserID: 99, Answer: db.AvailabilityYes},
+	}
+
+	rankings := RankSlots(slots, votes, []int{10, 11, 12})
+	a.Len(rankings, 3)
+
+	// Ties on score go to the slot with more yes answers, then the earliest
+	a.Equal(2, rankings[0].Slot.ID)
+	a.Equal(3, rankings[1].Slot.ID)
+	a.Equal(1, rankings[2].Slot.ID)
+	a.Equal(1.0, rankings[2].Score)
+
+	a.Equal([]int{10}, rankings[0].Yes)
+	a.Equal([]int{11}, rankings[0].No)
+	a.Equal([]int{12}, rankings[0].Missing)
+	a.Equal([]int{11, 12}, rankings[1].Missing)
+}
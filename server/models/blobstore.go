@@ -0,0 +1,204 @@
+package models
+
+import (
+    "context"
+    "errors"
+    "io/ioutil"
+    "mime"
+    "os"
+    "path"
+    "path/filepath"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Blob is a file saved in a BlobStore.
+type Blob struct {
+    ContentType string
+    Data []byte
+    // Time blob was last saved
+    ModTime time.Time
+}
+
+// BlobStore saves files, like uploaded images, by key. Keys are slash separated paths, ex: "avatars/1/abc/64.png".
+type BlobStore interface {
+    // Put saves a blob, replacing any blob with the same key
+    Put (c context.Context, key, contentType string, data []byte) error
+    // Get returns the blob with the provided key. Returns ErrNotFound if no such blob exists.
+    Get (c context.Context, key string) (*Blob, error)
+    // Delete removes the blob with the provided key. Deleting a blob which does not exist is not an error.
+    Delete (c context.Context, key string) error
+}
+
+// ErrInvalidBlobKey is returned by blob stores when a key is empty or tries to escape the store, ex: "../config".
+var ErrInvalidBlobKey = errors.New("invalid blob key")
+
+// cleanBlobKey validates a blob key and returns it in canonical form.
+func cleanBlobKey (key string) (string, error) {
+    cleaned := path.Clean("/" + key)[1:]
+    if cleaned == "" || cleaned != key || strings.Contains(key, "\\") {
+        return "", ErrInvalidBlobKey
+    }
+
+    return cleaned, nil
+}
+
+// FileBlobStore is a BlobStore which saves blobs as files in a directory on the local filesystem. A blob's content
+// type is determined from its key's file extension.
+type FileBlobStore struct {
+    dir string
+}
+
+// NewFileBlobStore creates a FileBlobStore which saves blobs under dir.
+func NewFileBlobStore (dir string) *FileBlobStore {
+    return &FileBlobStore{dir}
+}
+
+// file returns the path of the file a blob is saved in.
+func (s *FileBlobStore) file (key string) (string, error) {
+    key, err := cleanBlobKey(key)
+    if err != nil {
+        return "", err
+    }
+
+    return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
+
+func (s *FileBlobStore) Put (c context.Context, key, contentType string, data []byte) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    file, err := s.file(key)
+    if err != nil {
+        return err
+    }
+
+    if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+        return err
+    }
+
+    // Write to a temporary file first so readers never see a partial blob
+    tmp, err := ioutil.TempFile(filepath.Dir(file), ".tmp-")
+    if err != nil {
+        return err
+    }
+
+    _, err = tmp.Write(data)
+    if closeErr := tmp.Close(); err == nil {
+        err = closeErr
+    }
+    if err == nil {
+        err = os.Rename(tmp.Name(), file)
+    }
+    if err != nil {
+        os.Remove(tmp.Name())
+    }
+
+    return err
+}
+
+func (s *FileBlobStore) Get (c context.Context, key string) (*Blob, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    file, err := s.file(key)
+    if err != nil {
+        return nil, err
+    }
+
+    info, err := os.Stat(file)
+    if os.IsNotExist(err) || (err == nil && info.IsDir()) {
+        return nil, ErrNotFound
+    } else if err != nil {
+        return nil, err
+    }
+
+    data, err := ioutil.ReadFile(file)
+    if err != nil {
+        return nil, err
+    }
+
+    return &Blob{
+        ContentType: mime.TypeByExtension(path.Ext(key)),
+        Data: data,
+        ModTime: info.ModTime(),
+    }, nil
+}
+
+func (s *FileBlobStore) Delete (c context.Context, key string) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    file, err := s.file(key)
+    if err != nil {
+        return err
+    }
+
+    if err := os.Remove(file); err != nil && os.IsNotExist(err) == false {
+        return err
+    }
+
+    return nil
+}
+
+// MemoryBlobStore is a BlobStore which keeps blobs in memory. Used by tests.
+type MemoryBlobStore struct {
+    mu sync.Mutex
+    blobs map[string]Blob
+}
+
+// NewMemoryBlobStore creates an empty MemoryBlobStore.
+func NewMemoryBlobStore () *MemoryBlobStore {
+    return &MemoryBlobStore{blobs: make(map[string]Blob)}
+}
+
+func (s *MemoryBlobStore) Put (c context.Context, key, contentType string, data []byte) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    key, err := cleanBlobKey(key)
+    if err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    s.blobs[key] = Blob{contentType, append([]byte(nil), data...), time.Now()}
+
+    return nil
+}
+
+func (s *MemoryBlobStore) Get (c context.Context, key string) (*Blob, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    blob, ok := s.blobs[key]
+    if ok == false {
+        return nil, ErrNotFound
+    }
+
+    return &blob, nil
+}
+
+func (s *MemoryBlobStore) Delete (c context.Context, key string) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    delete(s.blobs, key)
+
+    return nil
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+    "context"
+    "io/ioutil"
+    "os"
+    "testing"
+
+    "github.com/stretchr/testify/assert"
+)
+
+func TestFileBlobStore(t *testing.T) {
+    a := assert.New(t)
+    c := context.Background()
+
+    dir, err := ioutil.TempDir("", "blobs")
+    a.Nil(err)
+    defer os.RemoveAll(dir)
+
+    store := NewFileBlobStore(dir)
+
+    a.Nil(store.Put(c, "avatars/1/v1/64.png", "image/png", []byte("png")))
+
+    blob, err := store.Get(c, "avatars/1/v1/64.png")
+    a.Nil(err)
+    a.Equal([]byte("png"), blob.Data)
+    a.Equal("image/png", blob.ContentType)
+
+    a.Nil(store.Delete(c, "avatars/1/v1/64.png"))
+    a.Nil(store.Delete(c, "avatars/1/v1/64.png"))
+
+    _, err = store.Get(c, "avatars/1/v1/64.png")
+    a.Equal(ErrNotFound, err)
+
+    // Keys can not escape directory
+    for _, key := range []string{"", "../secret", "avatars/../../secret", "/etc/passwd", "avatars//1"} {
+        a.Equal(ErrInvalidBlobKey, store.Put(c, key, "", nil), key)
+    }
+}
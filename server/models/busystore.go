@@ -0,0 +1,447 @@
+package models
+
+import (
+    "context"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/Noah-Huppert/squad-up/server/freebusy"
+    "github.com/Noah-Huppert/squad-up/server/ical"
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+    "github.com/Noah-Huppert/squad-up/server/recur"
+
+    "github.com/jinzhu/gorm"
+)
+
+// BusyStore loads and saves the busy blocks of users.
+type BusyStore interface {
+    // Create saves a new busy block, setting its ID
+    Create (c context.Context, block *db.BusyBlock) error
+    // FindById returns the busy block with the provided id. Returns ErrNotFound if no such block exists.
+    FindById (c context.Context, id int) (*db.BusyBlock, error)
+    // Find returns the busy blocks of users which end after from and start before to, ordered by start time
+    Find (c context.Context, userIds []int, from, to time.Time) ([]db.BusyBlock, error)
+    // Delete soft deletes a busy block
+    Delete (c context.Context, id int) error
+    // ReplaceImported replaces a user's imported busy blocks, setting the IDs of the new blocks
+    ReplaceImported (c context.Context, userId int, blocks []db.BusyBlock) error
+    // FindByUser returns all of a user's busy blocks, ordered by start time
+    FindByUser (c context.Context, userId int) ([]db.BusyBlock, error)
+    // DeleteByUser permanently deletes all of a user's busy blocks, including soft deleted ones
+    DeleteByUser (c context.Context, userId int) error
+}
+
+// BusyFromCalendar returns when the events of an iCalendar file take place between from and to, at most max
+// intervals. Floating and all-day times are in loc. Recurring events are expanded, skipping their EXDATEs and the
+// occurrences which were moved. Transparent and cancelled events do not make users busy, and events which can not be
+// read are skipped. The free/busy periods of VFREEBUSY components are included too.
+func BusyFromCalendar (cal ical.Component, loc *time.Location, from, to time.Time, max int) []freebusy.Interval {
+    var busy []freebusy.Interval
+    add := func (start, end time.Time) bool {
+        if start.Before(to) && end.After(from) {
+            busy = append(busy, freebusy.Interval{Start: start.UTC(), End: end.UTC()})
+        }
+
+        return len(busy) < max
+    }
+
+    events := cal.Children("VEVENT")
+
+    // Start times of occurrences which were moved, by the UID of their series
+    moved := make(map[string][]time.Time)
+    for _, event := range events {
+        if prop := event.Prop("RECURRENCE-ID"); prop != nil {
+            if t, _, err := prop.Time(loc); err == nil {
+                uid := event.Value("UID")
+                moved[uid] = append(moved[uid], t)
+            }
+        }
+    }
+
+    for _, event := range events {
+        status, transp := strings.ToUpper(event.Value("STATUS")), strings.ToUpper(event.Value("TRANSP"))
+        if status == "CANCELLED" || transp == "TRANSPARENT" || event.Prop("DTSTART") == nil {
+            continue
+        }
+
+        start, end, ok := eventTimes(event, loc)
+        if ok == false {
+            continue
+        }
+
+        rule, err := recur.Parse(event.Value("RRULE"))
+        if event.Prop("RRULE") == nil || event.Prop("RECURRENCE-ID") != nil || err != nil {
+            // Rules which are not supported are imported as their first occurrence
+            if add(start, end) == false {
+                return busy
+            }
+
+            continue
+        }
+
+        skipped := append([]time.Time{}, moved[event.Value("UID")]...)
+        for _, prop := range event.AllProps("EXDATE") {
+            if times, err := prop.Times(loc); err == nil {
+                skipped = append(skipped, times...)
+            }
+        }
+
+        length := end.Sub(start)
+        for _, t := range rule.Between(start, start.Location(), from.Add(-length), to, max) {
+            if containsTime(skipped, t) {
+                continue
+            }
+
+            if add(t, t.Add(length)) == false {
+                return busy
+            }
+        }
+    }
+
+    for _, freeBusy := range cal.Children("VFREEBUSY") {
+        for _, prop := range freeBusy.AllProps("FREEBUSY") {
+            if fbType := strings.ToUpper(prop.Params["FBTYPE"]); fbType == "FREE" {
+                continue
+            }
+
+            for _, period := range strings.Split(prop.Value, ",") {
+                start, end, ok := parsePeriod(period)
+                if ok && add(start, end) == false {
+                    return busy
+                }
+            }
+        }
+    }
+
+    return busy
+}
+
+// eventTimes returns when a VEVENT starts and ends. Events without an end last for their DURATION, or all day if they
+// start on a date. Returns false if the times can not be read or the event is empty.
+func eventTimes (event ical.Component, loc *time.Location) (time.Time, time.Time, bool) {
+    start, allDay, err := event.Prop("DTSTART").Time(loc)
+    if err != nil {
+        return start, start, false
+    }
+
+    end := start
+    if prop := event.Prop("DTEND"); prop != nil {
+        if end, _, err = prop.Time(loc); err != nil {
+            return start, end, false
+        }
+    } else if value := event.Value("DURATION"); value != "" {
+        length, err := ical.ParseDuration(value)
+        if err != nil {
+            return start, end, false
+        }
+
+        end = start.Add(length)
+    } else if allDay {
+        end = start.AddDate(0, 0, 1)
+    }
+
+    return start, end, end.After(start)
+}
+
+// parsePeriod parses a UTC PERIOD value, either start/end or start/duration.
+func parsePeriod (period string) (time.Time, time.Time, bool) {
+    parts := strings.SplitN(strings.TrimSpace(period), "/", 2)
+    if len(parts) != 2 {
+        return time.Time{}, time.Time{}, false
+    }
+
+    start, _, err := ical.Property{Value: parts[0]}.Time(time.UTC)
+    if err != nil {
+        return start, start, false
+    }
+
+    if strings.HasPrefix(parts[1], "P") {
+        length, err := ical.ParseDuration(parts[1])
+        return start, start.Add(length), err == nil && length > 0
+    }
+
+    end, _, err := ical.Property{Value: parts[1]}.Time(time.UTC)
+
+    return start, end, err == nil && end.After(start)
+}
+
+// containsTime reports if a list includes a time.
+func containsTime (times []time.Time, t time.Time) bool {
+    for _, other := range times {
+        if other.Equal(t) {
+            return true
+        }
+    }
+
+    return false
+}
+
+// GormBusyStore is a BusyStore which uses a gorm database.
+type GormBusyStore struct {
+    db *gorm.DB
+}
+
+// NewGormBusyStore creates a GormBusyStore.
+func NewGormBusyStore (db *gorm.DB) *GormBusyStore {
+    return &GormBusyStore{db}
+}
+
+func (s *GormBusyStore) Create (c context.Context, block *db.BusyBlock) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    return s.db.Create(block).Error
+}
+
+func (s *GormBusyStore) FindById (c context.Context, id int) (*db.BusyBlock, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    var block db.BusyBlock
+    q := s.db.Where("id = ?", id).First(&block)
+    if q.RecordNotFound() {
+        return nil, ErrNotFound
+    } else if q.Error != nil {
+        return nil, q.Error
+    }
+
+    return &block, nil
+}
+
+func (s *GormBusyStore) Find (c context.Context, userIds []int, from, to time.Time) ([]db.BusyBlock, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    } else if len(userIds) == 0 {
+        return nil, nil
+    }
+
+    var blocks []db.BusyBlock
+    err := s.db.Where("user_id IN (?) AND ends_at > ? AND starts_at < ?", userIds, from, to).
+        Order("starts_at, id").Find(&blocks).Error
+
+    return blocks, err
+}
+
+func (s *GormBusyStore) Delete (c context.Context, id int) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    return s.db.Where("id = ?", id).Delete(&db.BusyBlock{}).Error
+}
+
+func (s *GormBusyStore) ReplaceImported (c context.Context, userId int, blocks []db.BusyBlock) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    return inTransaction(s.db, func (tx *gorm.DB) error {
+        // Imports can be large and frequent, replaced blocks are not kept
+        err := tx.Unscoped().Where("user_id = ? AND source = ?", userId, db.BusySourceImport).Delete(&db.BusyBlock{}).Error
+        if err != nil {
+            return err
+        }
+
+        for i := range blocks {
+            blocks[i].UserID, blocks[i].Source = userId, db.BusySourceImport
+            if err := tx.Create(&blocks[i]).Error; err != nil {
+                return err
+            }
+        }
+
+        return nil
+    })
+}
+
+func (s *GormBusyStore) FindByUser (c context.Context, userId int) ([]db.BusyBlock, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    var blocks []db.BusyBlock
+    err := s.db.Where("user_id = ?", userId).Order("starts_at, id").Find(&blocks).Error
+
+    return blocks, err
+}
+
+func (s *GormBusyStore) DeleteByUser (c context.Context, userId int) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    return s.db.Unscoped().Where("user_id = ?", userId).Delete(&db.BusyBlock{}).Error
+}
+
+// MemoryBusyStore is a BusyStore which keeps busy blocks in memory. Used by tests.
+type MemoryBusyStore struct {
+    mu sync.Mutex
+    blocks map[int]db.BusyBlock
+    nextId int
+}
+
+// NewMemoryBusyStore creates an empty MemoryBusyStore.
+func NewMemoryBusyStore () *MemoryBusyStore {
+    return &MemoryBusyStore{blocks: make(map[int]db.BusyBlock), nextId: 1}
+}
+
+// blocksByStart sorts busy blocks like GormBusyStore.Find.
+type blocksByStart []db.BusyBlock
+
+func (l blocksByStart) Len () int { return len(l) }
+func (l blocksByStart) Swap (i, j int) { l[i], l[j] = l[j], l[i] }
+func (l blocksByStart) Less (i, j int) bool {
+    if l[i].StartsAt.Equal(l[j].StartsAt) {
+        return l[i].ID < l[j].ID
+    }
+
+    return l[i].StartsAt.Before(l[j].StartsAt)
+}
+
+// create saves a new busy block. Must be called with the lock held.
+func (s *MemoryBusyStore) create (block *db.BusyBlock) {
+    now := time.Now()
+    block.ID = s.nextId
+    block.CreatedAt = now
+    block.UpdatedAt = now
+    s.nextId++
+
+    s.blocks[block.ID] = *block
+}
+
+func (s *MemoryBusyStore) Create (c context.Context, block *db.BusyBlock) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    s.create(block)
+
+    return nil
+}
+
+func (s *MemoryBusyStore) FindById (c context.Context, id int) (*db.BusyBlock, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    block, ok := s.blocks[id]
+    if ok == false || block.DeletedAt != nil {
+        return nil, ErrNotFound
+    }
+
+    return &block, nil
+}
+
+func (s *MemoryBusyStore) Find (c context.Context, userIds []int, from, to time.Time) ([]db.BusyBlock, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    var blocks []db.BusyBlock
+    for _, block := range s.blocks {
+        if block.DeletedAt != nil || block.EndsAt.After(from) == false || block.StartsAt.Before(to) == false {
+            continue
+        }
+
+        for _, id := range userIds {
+            if block.UserID == id {
+                blocks = append(blocks, block)
+            }
+        }
+    }
+
+    sort.Sort(blocksByStart(blocks))
+
+    return blocks, nil
+}
+
+func (s *MemoryBusyStore) Delete (c context.Context, id int) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    block, ok := s.blocks[id]
+    if ok == false || block.DeletedAt != nil {
+        return ErrNotFound
+    }
+
+    now := time.Now()
+    block.DeletedAt = &now
+    s.blocks[id] = block
+
+    return nil
+}
+
+func (s *MemoryBusyStore) ReplaceImported (c context.Context, userId int, blocks []db.BusyBlock) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    for id, block := range s.blocks {
+        if block.UserID == userId && block.Source == db.BusySourceImport {
+            delete(s.blocks, id)
+        }
+    }
+
+    for i := range blocks {
+        blocks[i].UserID, blocks[i].Source = userId, db.BusySourceImport
+        s.create(&blocks[i])
+    }
+
+    return nil
+}
+
+func (s *MemoryBusyStore) FindByUser (c context.Context, userId int) ([]db.BusyBlock, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    var blocks []db.BusyBlock
+    for _, block := range s.blocks {
+        if block.UserID == userId && block.DeletedAt == nil {
+            blocks = append(blocks, block)
+        }
+    }
+
+    sort.Sort(blocksByStart(blocks))
+
+    return blocks, nil
+}
+
+func (s *MemoryBusyStore) DeleteByUser (c context.Context, userId int) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    for id, block := range s.blocks {
+        if block.UserID == userId {
+            delete(s.blocks, id)
+        }
+    }
+
+    return nil
+}
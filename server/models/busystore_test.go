@@ -0,0 +1,74 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Noah-Huppert/squad-up/server/freebusy"
+	"github.com/Noah-Huppert/squad-up/server/ical"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBusyFromCalendar(t *testing.T) {
+	a := assert.New(t)
+	ny, _ := time.LoadLocation("America/New_York")
+
+	cal, err := ical.Parse(strings.NewReader(strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		// Daily series, its first occurrence was moved and its third deleted
+		"BEGIN:VEVENT",
+		"UID:standup",
+		"DTSTART;TZID=America/New_York:20300603T090000",
+		"DTEND;TZID=America/New_York:20300603T100000",
+		"RRULE:FREQ=DAILY;COUNT=3",
+		"EXDATE;TZID=America/New_York:20300605T090000",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:standup",
+		"RECURRENCE-ID;TZID=America/New_York:20300603T090000",
+		"DTSTART;TZID=America/New_York:20300603T110000",
+		"DURATION:PT1H",
+		"END:VEVENT",
+		// All day, in the user's time zone
+		"BEGIN:VEVENT",
+		"DTSTART;VALUE=DATE:20300607",
+		"END:VEVENT",
+		// Do not make the user busy
+		"BEGIN:VEVENT",
+		"DTSTART;VALUE=DATE:20300608",
+		"TRANSP:TRANSPARENT",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"DTSTART:20300609T100000Z",
+		"DTEND:20300609T110000Z",
+		"STATUS:CANCELLED",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"DTSTART:20200609T100000Z",
+		"DTEND:20200609T110000Z",
+		"END:VEVENT",
+		"BEGIN:VFREEBUSY",
+		"FREEBUSY;FBTYPE=BUSY:20300602T100000Z/PT2H",
+		"FREEBUSY;FBTYPE=FREE:20300602T140000Z/20300602T150000Z",
+		"END:VFREEBUSY",
+		"END:VCALENDAR",
+	}, "\n")))
+	a.Nil(err)
+
+	from, to := time.Date(2030, 6, 1, 0, 0, 0, 0, time.UTC), time.Date(2030, 6, 15, 0, 0, 0, 0, time.UTC)
+	interval := func (start, end string) freebusy.Interval {
+		s, _ := time.Parse(time.RFC3339, start)
+		e, _ := time.Parse(time.RFC3339, end)
+		return freebusy.Interval{Start: s, End: e}
+	}
+
+	a.Equal([]freebusy.Interval{
+		interval("2030-06-04T13:00:00Z", "2030-06-04T14:00:00Z"),
+		interval("2030-06-03T15:00:00Z", "2030-06-03T16:00:00Z"),
+		interval("2030-06-07T04:00:00Z", "2030-06-08T04:00:00Z"),
+		interval("2030-06-02T10:00:00Z", "2030-06-02T12:00:00Z"),
+	}, BusyFromCalendar(cal, ny, from, to, 100))
+
+	a.Len(BusyFromCalendar(cal, ny, from, to, 2), 2)
+}
@@ -1,11 +1,44 @@
 package models
 
+import (
+    "net/http"
+    "time"
+)
+
+// Google endpoint which verifies id tokens and returns the profile information they contain
+const GoogleTokenInfoURL = "https://www.googleapis.com/oauth2/v3/tokeninfo"
+
 // Config holds application configuration values
 type Config struct {
     // Google API Client Id
     GAPIClientId string
+    // URL of Google's id token info endpoint, used to verify id tokens. Defaults to GoogleTokenInfoURL if empty
+    GoogleTokenInfoURL string
     // URI used in JWTs to identify server
     JWTServerURI string
     // Key used to sign JWSs with HS512
     JWTHMACKey string
+    // Default max time an API request can take before it is cancelled
+    RequestTimeout time.Duration
+    // Client used to make outbound HTTP requests, ex: to Google
+    HTTPClient *http.Client
+    // How long deleted accounts can be restored by logging in again before their personal data is purged
+    AccountDeletionGracePeriod time.Duration
+    // Directory uploaded files are saved in
+    BlobDir string
+    // How long responses to requests made with an Idempotency-Key header are kept for replay
+    IdempotencyRetention time.Duration
+    // Base URL of the web app, used to build links sent to users, ex: squad invite links
+    PublicURL string
+    // Host and port of the SMTP server emails are sent through, emails are only logged if empty
+    SMTPAddr string
+    // Credentials for the SMTP server, no authentication is used if SMTPUsername is empty
+    SMTPUsername string
+    SMTPPassword string
+    // Address emails are sent from
+    MailFrom string
+    // Permissions of squad roles, DefaultPolicy is used if nil
+    Policy Policy
+    // Host and port metrics are served on, should not be reachable from the internet. Metrics are not served if empty
+    MetricsAddr string
 }
@@ -0,0 +1,22 @@
+package models
+
+import "context"
+
+// Status code served when a client disconnects before its request is handled. Not standard, popularized by nginx,
+// the client will never see it but it shows up in logs and metrics.
+const StatusClientClosedRequest = 499
+
+// ContextError returns an APIError if a request's context was cancelled or its deadline passed, otherwise nil.
+//
+// Gorm does not accept contexts, so handlers should call this before starting database work to stop early for
+// requests which were abandoned.
+func ContextError (c context.Context) *APIError {
+    switch c.Err() {
+    case context.DeadlineExceeded:
+        return ErrRequestTimeout.New()
+    case context.Canceled:
+        return ErrRequestCanceled.New()
+    }
+
+    return nil
+}
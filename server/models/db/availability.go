@@ -0,0 +1,65 @@
+package db
+
+import "time"
+
+// Availability poll statuses
+const (
+    // Members can still mark when they are available
+    AvailabilityPollOpen = "open"
+    // A slot was picked and turned into an event, votes can no longer change
+    AvailabilityPollFinalized = "finalized"
+)
+
+// Availability answers
+const (
+    AvailabilityYes = "yes"
+    // Available, but would rather not
+    AvailabilityIfNeedBe = "if_need_be"
+    AvailabilityNo = "no"
+)
+
+// AvailabilityPoll asks a squad's members which of a few proposed times work for them, to plan an event.
+type AvailabilityPoll struct {
+    TableMetadata
+    ID int `gorm:"serial primary key" json:"id"`
+    SquadID int `gorm:"index" json:"squad_id"`
+    // User who created the poll
+    CreatorID int `json:"creator_id"`
+    // Title and description of the event the poll is for
+    Title string `json:"title"`
+    Description string `json:"description"`
+    // IANA time zone the slots were proposed in, used for the event
+    Timezone string `json:"timezone"`
+    // One of the AvailabilityPoll status constants
+    Status string `json:"status"`
+    // Event created from the picked slot once finalized
+    EventID *int `json:"event_id"`
+
+    // Proposed times, ordered by start time
+    Slots []AvailabilitySlot `gorm:"ForeignKey:PollID" json:"slots"`
+}
+
+// Finalized reports if a slot was picked.
+func (p AvailabilityPoll) Finalized () bool {
+    return p.Status == AvailabilityPollFinalized
+}
+
+// AvailabilitySlot is a time proposed by an availability poll.
+type AvailabilitySlot struct {
+    ID int `gorm:"serial primary key" json:"id"`
+    PollID int `gorm:"index" json:"poll_id"`
+    // Times are stored in UTC
+    StartsAt time.Time `json:"starts_at"`
+    EndsAt time.Time `json:"ends_at"`
+}
+
+// AvailabilityVote is a user's answer for one slot of an availability poll.
+type AvailabilityVote struct {
+    TableMetadata
+    ID int `gorm:"serial primary key" json:"id"`
+    PollID int `gorm:"index" json:"poll_id"`
+    SlotID int `gorm:"unique_index:idx_availability_votes_voter" json:"slot_id"`
+    UserID int `gorm:"unique_index:idx_availability_votes_voter" json:"user_id"`
+    // One of the Availability answer constants
+    Answer string `json:"answer"`
+}
@@ -0,0 +1,24 @@
+package db
+
+import "time"
+
+// Sources of busy blocks
+const (
+    // Entered by the user
+    BusySourceManual = "manual"
+    // Imported from an iCalendar file, replaced by the next import
+    BusySourceImport = "import"
+)
+
+// BusyBlock is a time a user is not available, ex: work or an event of a calendar they imported. Only the times are
+// stored, other users never see what a user is busy with.
+type BusyBlock struct {
+    TableMetadata
+    ID int `gorm:"serial primary key" json:"id"`
+    UserID int `gorm:"index" json:"user_id"`
+    // Times are stored in UTC
+    StartsAt time.Time `gorm:"index" json:"starts_at"`
+    EndsAt time.Time `gorm:"index" json:"ends_at"`
+    // One of the BusySource constants
+    Source string `json:"source"`
+}
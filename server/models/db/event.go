@@ -0,0 +1,91 @@
+package db
+
+import "time"
+
+// Event visibilities
+const (
+    // Only the creator can see personal events, only members can see squad events
+    EventVisibilityPrivate = "private"
+    // Any user can see the event
+    EventVisibilityPublic = "public"
+)
+
+// Event statuses
+const (
+    // Event is being planned, only the users who can edit it can see it
+    EventStatusDraft = "draft"
+    EventStatusScheduled = "scheduled"
+    // Event will not take place, cancelled events can not be changed
+    EventStatusCancelled = "cancelled"
+)
+
+// Event is something users plan to do together. Events are personal, or belong to a squad.
+type Event struct {
+    TableMetadata
+    ID int `gorm:"serial primary key" json:"id"`
+    Title string `json:"title"`
+    Description string `json:"description"`
+
+    // Times are stored in UTC
+    StartsAt time.Time `gorm:"index" json:"starts_at"`
+    EndsAt time.Time `gorm:"index" json:"ends_at"`
+    // IANA time zone the event was planned in, ex: America/New_York. Recurring events repeat in this time zone.
+    Timezone string `json:"timezone"`
+
+    // RFC 5545 recurrence rule of a series, ex: FREQ=WEEKLY;BYDAY=TU. Empty if the event does not repeat.
+    RRule string `gorm:"column:rrule" json:"rrule"`
+    // Start times of occurrences of the series which were deleted
+    ExDates TimeList `gorm:"type:text" json:"exdates"`
+    // Time the last occurrence of the series ends, nil if it repeats forever. Lets series be found by date range.
+    RecursUntil *time.Time `gorm:"index" json:"-"`
+
+    // Series this event is an occurrence of. Occurrences are only saved once they are changed or someone RSVPs.
+    ParentID *int `gorm:"unique_index:idx_events_occurrence" json:"parent_id"`
+    // Time the occurrence starts at according to its series' rule, even if it was moved
+    OriginalStartsAt *time.Time `gorm:"unique_index:idx_events_occurrence" json:"original_starts_at"`
+
+    // Free text description of where the event takes place, ex: an address
+    Location string `json:"location"`
+    // Coordinates of the location, both are nil if unknown
+    Latitude *float64 `json:"latitude"`
+    Longitude *float64 `json:"longitude"`
+
+    // Max number of attendees, including plus-ones, 0 if unlimited. Attendees who do not fit are waitlisted.
+    Capacity int `json:"capacity"`
+
+    // One of the EventVisibility constants
+    Visibility string `json:"visibility"`
+    // One of the EventStatus constants
+    Status string `json:"status"`
+    CancelledAt *time.Time `json:"cancelled_at"`
+    // Number of times the event was changed since it was created, calendar feeds publish it as the event's SEQUENCE
+    // so subscribed calendars pick up changes
+    Sequence int `json:"sequence"`
+
+    // User who created the event
+    CreatorID int `gorm:"index" json:"creator_id"`
+    Creator *User `json:"creator,omitempty"`
+    // Squad the event belongs to, nil for personal events
+    SquadID *int `gorm:"index" json:"squad_id"`
+    Squad *Squad `json:"squad,omitempty"`
+}
+
+// Cancelled reports if the event was cancelled.
+func (e Event) Cancelled () bool {
+    return e.Status == EventStatusCancelled
+}
+
+// InSquad reports if the event belongs to the squad with the provided id.
+func (e Event) InSquad (squadId int) bool {
+    return e.SquadID != nil && *e.SquadID == squadId
+}
+
+// Recurring reports if the event is a series which repeats.
+func (e Event) Recurring () bool {
+    return e.RRule != ""
+}
+
+// Occurrence reports if the event is an occurrence of a series.
+func (e Event) Occurrence () bool {
+    return e.OriginalStartsAt != nil
+}
@@ -0,0 +1,15 @@
+package db
+
+// CalendarFeed is a secret link to an iCalendar feed of a user's events, which calendar apps subscribe to. Feeds
+// cover the user's personal events and those of their squads, or the events of a single squad. Deleting a feed
+// revokes its link.
+type CalendarFeed struct {
+    TableMetadata
+    ID int `gorm:"serial primary key" json:"id"`
+    UserID int `gorm:"index" json:"user_id"`
+    // Squad whose events the feed covers, nil for the user's own feed
+    SquadID *int `gorm:"index" json:"squad_id"`
+    // Random value signed to create the feed's token, see handlers.feedToken
+    Nonce string `json:"-"`
+}
+
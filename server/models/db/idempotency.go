@@ -0,0 +1,35 @@
+package db
+
+import "time"
+
+// IdempotencyRecord stores the response to a mutating API request which was made with an Idempotency-Key header. If
+// the client retries the request with the same key the stored response is replayed instead of running the request
+// again.
+//
+// Records are hard deleted once their retention window passes, which is why TableMetadata (And its soft delete
+// DeletedAt field) is not embedded.
+type IdempotencyRecord struct {
+    ID int `gorm:"serial primary key"`
+    // Time request was first received
+    CreatedAt time.Time `gorm:"index"`
+
+    // User who made request
+    UserID int `gorm:"unique_index:idx_idempotency_records_key"`
+    // Value of Idempotency-Key header
+    Key string `gorm:"unique_index:idx_idempotency_records_key"`
+    // HTTP method and path of request
+    Route string `gorm:"unique_index:idx_idempotency_records_key"`
+    // Hash of request body, used to detect keys being reused for different requests
+    RequestHash string
+
+    // False while the first request with this key is still being handled
+    Completed bool
+    // Response status code
+    StatusCode int
+    // Response Content-Type header
+    ContentType string
+    // Response ETag header
+    ETag string
+    // Response body
+    Body []byte
+}
@@ -0,0 +1,33 @@
+package db
+
+import "time"
+
+// SquadInvite lets people join a squad. Invites are shared as a link, or emailed to a specific address in which case
+// only the user with that email can accept them.
+type SquadInvite struct {
+    TableMetadata
+    ID int `gorm:"serial primary key" json:"id"`
+    SquadID int `gorm:"index" json:"squad_id"`
+    // User who created the invite
+    CreatedByID int `json:"created_by_id"`
+    // Address invite was emailed to, empty for invite links
+    Email string `json:"email,omitempty"`
+    // Role users who accept the invite get, one of the SquadRole constants
+    Role string `json:"role"`
+    ExpiresAt time.Time `json:"expires_at"`
+    // Number of times invite can be accepted, 0 if unlimited
+    MaxUses int `json:"max_uses"`
+    // Number of times invite was accepted
+    Uses int `json:"uses"`
+    RevokedAt *time.Time `json:"revoked_at"`
+    // Random value signed to create the invite's token, see handlers.inviteToken
+    Nonce string `json:"-"`
+
+    Squad *Squad `json:"squad,omitempty"`
+    CreatedBy *User `json:"created_by,omitempty"`
+}
+
+// Usable reports if the invite can still be accepted.
+func (i SquadInvite) Usable (now time.Time) bool {
+    return i.RevokedAt == nil && now.Before(i.ExpiresAt) && (i.MaxUses == 0 || i.Uses < i.MaxUses)
+}
@@ -1,6 +1,9 @@
 package db
 
-import "time"
+import (
+    "strconv"
+    "time"
+)
 
 // Basic lifecycle metadata fields provided by gorm.Model but without the ID field. This allows for customizations of
 // the ID field such as autoincrement.
@@ -10,6 +13,15 @@ type TableMetadata struct {
     // Last time row was updated
 	UpdatedAt time.Time `json:"updated_at"`
     // If using soft delete, time the item was deleted
-	DeletedAt *time.Time `json:"deleted_at"`
+	DeletedAt *time.Time `json:"deleted_at" visibility:"self"`
 }
 
+// ETag returns an entity tag which identifies the current version of a row. Derived from UpdatedAt, truncated to
+// microseconds since that is the precision Postgres stores timestamps with.
+func (m TableMetadata) ETag() string {
+    if m.UpdatedAt.IsZero() {
+        return ""
+    }
+
+    return "\"" + strconv.FormatInt(m.UpdatedAt.UnixNano() / int64(time.Microsecond), 36) + "\""
+}
@@ -0,0 +1,8 @@
+package db
+
+// Owned is implemented by models which belong to a user. The response serializer uses the owner to decide which of a
+// model's fields a viewer may see. Fields are marked with the "visibility" struct tag, see utils.Visibility.
+type Owned interface {
+    // OwnerID returns the id of the user who owns the model
+    OwnerID () int
+}
@@ -0,0 +1,57 @@
+package db
+
+import "time"
+
+// Poll asks a squad, or the people invited to an event, to vote between options. See the voting package for how
+// ballots are counted.
+type Poll struct {
+    TableMetadata
+    ID int `gorm:"serial primary key" json:"id"`
+    // Squad or event the poll is attached to, exactly one is set
+    SquadID *int `gorm:"index" json:"squad_id"`
+    EventID *int `gorm:"index" json:"event_id"`
+    // User who created the poll
+    CreatorID int `json:"creator_id"`
+    Question string `json:"question"`
+    Description string `json:"description"`
+    // One of the voting.Method constants
+    Method string `json:"method"`
+    // Highest score an option can be given, for score polls
+    MaxScore int `json:"max_score,omitempty"`
+    // If true, who cast which ballot is hidden
+    Anonymous bool `json:"anonymous"`
+    // Time the poll closes at on its own, nil if it stays open until closed
+    ClosesAt *time.Time `json:"closes_at"`
+    // Time the poll was closed by its creator
+    ClosedAt *time.Time `json:"closed_at"`
+
+    // Options in the order they are listed
+    Options []PollOption `gorm:"ForeignKey:PollID" json:"options"`
+}
+
+// Closed reports if the poll no longer accepts ballots.
+func (p Poll) Closed (now time.Time) bool {
+    return p.ClosedAt != nil || (p.ClosesAt != nil && now.Before(*p.ClosesAt) == false)
+}
+
+// PollOption is something a poll lets users vote for.
+type PollOption struct {
+    ID int `gorm:"serial primary key" json:"id"`
+    PollID int `gorm:"index" json:"poll_id"`
+    // Index of the option in the poll's list
+    Position int `json:"position"`
+    Label string `json:"label"`
+}
+
+// PollVote is part of a user's ballot: one option they picked, ranked or scored.
+type PollVote struct {
+    TableMetadata
+    ID int `gorm:"serial primary key" json:"id"`
+    PollID int `gorm:"unique_index:idx_poll_votes_voter" json:"poll_id"`
+    UserID int `gorm:"unique_index:idx_poll_votes_voter" json:"user_id"`
+    OptionID int `gorm:"unique_index:idx_poll_votes_voter" json:"option_id"`
+    // Position of the option on the ballot, 1 being the most preferred for ranked polls
+    Rank int `json:"rank"`
+    // Score given to the option, for score polls
+    Score int `json:"score"`
+}
@@ -0,0 +1,44 @@
+package db
+
+import "time"
+
+// RSVP responses
+const (
+    RSVPYes = "yes"
+    RSVPNo = "no"
+    RSVPMaybe = "maybe"
+)
+
+// RSVP is a user's response to an event. Stored in the rsvps table.
+type RSVP struct {
+    TableMetadata
+    ID int `gorm:"serial primary key" json:"id"`
+    EventID int `gorm:"unique_index:idx_rsvps_attendee" json:"event_id"`
+    UserID int `gorm:"unique_index:idx_rsvps_attendee;index" json:"user_id"`
+    // One of the RSVP response constants
+    Response string `json:"response"`
+    // Number of guests the user is bringing
+    PlusOnes int `json:"plus_ones"`
+    Note string `json:"note"`
+    // Time a yes RSVP was put on the waitlist because the event was full, nil if it has a seat. Waitlisted RSVPs are
+    // given seats in the order they were waitlisted.
+    WaitlistedAt *time.Time `json:"waitlisted_at"`
+
+    Event *Event `json:"event,omitempty"`
+    User *User `json:"user,omitempty"`
+}
+
+// Seats returns the number of seats the RSVP takes if the user is going.
+func (r RSVP) Seats () int {
+    return 1 + r.PlusOnes
+}
+
+// Going reports if the user responded yes and has a seat.
+func (r RSVP) Going () bool {
+    return r.Response == RSVPYes && r.WaitlistedAt == nil
+}
+
+// Waitlisted reports if the user responded yes but is waiting for a seat.
+func (r RSVP) Waitlisted () bool {
+    return r.Response == RSVPYes && r.WaitlistedAt != nil
+}
@@ -0,0 +1,64 @@
+package db
+
+import "time"
+
+// Squad visibilities
+const (
+    // Only members can see the squad
+    SquadVisibilityPrivate = "private"
+    // Any user can see the squad's name, description and avatar
+    SquadVisibilityPublic = "public"
+)
+
+// Squad is a group of users who plan events together.
+type Squad struct {
+    TableMetadata
+    ID int `gorm:"serial primary key" json:"id"`
+    Name string `json:"name"`
+    Description string `json:"description"`
+    // URL of the squad's avatar, the largest thumbnail of an uploaded picture
+    AvatarUrl string `json:"avatar_url"`
+    // Identifies the uploaded avatar's thumbnails in the BlobStore, empty if no avatar was uploaded
+    AvatarVersion string `json:"-"`
+    // One of the SquadVisibility constants
+    Visibility string `json:"visibility"`
+    // Time the squad was archived, archived squads can be viewed but not changed
+    ArchivedAt *time.Time `json:"archived_at"`
+
+    // User who created the squad
+    OwnerID int `gorm:"index" json:"owner_id"`
+    Owner *User `json:"owner,omitempty"`
+
+    Memberships []SquadMembership `json:"members,omitempty"`
+}
+
+// Archived reports if the squad was archived.
+func (s Squad) Archived () bool {
+    return s.ArchivedAt != nil
+}
+
+// Squad membership roles
+const (
+    // User who created the squad, there is exactly one owner
+    SquadRoleOwner = "owner"
+    // User who helps the owner manage the squad
+    SquadRoleAdmin = "admin"
+    // Member who can plan events
+    SquadRoleOrganizer = "organizer"
+    SquadRoleMember = "member"
+    // User who can see the squad and respond to events, but not who else is in it
+    SquadRoleGuest = "guest"
+)
+
+// SquadMembership records that a user belongs to a squad. Stored in the squad_memberships table.
+type SquadMembership struct {
+    TableMetadata
+    ID int `gorm:"serial primary key" json:"-"`
+    SquadID int `gorm:"unique_index:idx_squad_memberships_member" json:"squad_id"`
+    UserID int `gorm:"unique_index:idx_squad_memberships_member;index" json:"user_id"`
+    // One of the SquadRole constants
+    Role string `json:"role"`
+
+    Squad *Squad `json:"squad,omitempty"`
+    User *User `json:"user,omitempty"`
+}
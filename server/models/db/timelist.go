@@ -0,0 +1,54 @@
+package db
+
+import (
+    "database/sql/driver"
+    "encoding/json"
+    "errors"
+    "time"
+)
+
+// TimeList is a list of times stored in a single text column, as JSON.
+type TimeList []time.Time
+
+// Contains reports if the list has a time equal to t.
+func (l TimeList) Contains (t time.Time) bool {
+    for _, item := range l {
+        if item.Equal(t) {
+            return true
+        }
+    }
+
+    return false
+}
+
+// Value implements driver.Valuer.
+func (l TimeList) Value () (driver.Value, error) {
+    if len(l) == 0 {
+        return "", nil
+    }
+
+    b, err := json.Marshal([]time.Time(l))
+
+    return string(b), err
+}
+
+// Scan implements sql.Scanner.
+func (l *TimeList) Scan (src interface{}) error {
+    var b []byte
+    switch v := src.(type) {
+    case nil:
+    case string:
+        b = []byte(v)
+    case []byte:
+        b = v
+    default:
+        return errors.New("TimeList can only be scanned from text")
+    }
+
+    *l = nil
+    if len(b) == 0 {
+        return nil
+    }
+
+    return json.Unmarshal(b, (*[]time.Time)(l))
+}
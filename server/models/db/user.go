@@ -1,11 +1,70 @@
 package db
 
+import (
+    "strings"
+    "time"
+)
+
+// User is a person who uses Squad Up. Users are created the first time they login with Google.
 type User struct {
     TableMetadata
     ID int `gorm:"serial primary key" json:"id"`
+    // Google account id, the "sub" claim of their id token
+    GoogleID string `gorm:"index" json:"-"`
     FirstName string  `json:"first_name"`
     LastName string `json:"last_name"`
-    Email string `json:"email"`
+    // Name user chose to be shown as, overrides their first and last name if set
+    DisplayName string `json:"display_name"`
+    Email string `json:"email" visibility:"members"`
+    // URL of profile picture, either a Google CDN URL or the largest thumbnail of an uploaded picture
     ProfilePictureUrl string `json:"profile_picture_url"`
+    // Identifies the uploaded profile picture's thumbnails in the BlobStore, empty if user has not uploaded one
+    AvatarVersion string `json:"-"`
+    Bio string `json:"bio"`
+    Pronouns string `json:"pronouns"`
+    // IANA time zone name, ex: "America/New_York"
+    Timezone string `json:"timezone" visibility:"members"`
+    // Language tag of user's preferred locale, ex: "en" or "fr-CA". Used to localize messages
+    Locale string `json:"locale" visibility:"self"`
+    // Times of day the user prefers to meet, ex: their working hours, and is usually asleep, in their time zone. Formatted
+    // as HH:MM-HH:MM, empty to use the defaults of the suggest package.
+    PreferredHours string `json:"preferred_hours" visibility:"members"`
+    SleepHours string `json:"sleep_hours" visibility:"members"`
+
+    // Access tokens issued before this time are not accepted, set when the user deletes their account
+    TokensRevokedAt *time.Time `json:"-"`
+    // Time the personal data of a deleted user was removed, nil if user has not been purged
+    PurgedAt *time.Time `json:"-"`
+}
+
+// Name returns the name a user should be shown as.
+func (u User) Name () string {
+    if u.DisplayName != "" {
+        return u.DisplayName
+    }
+
+    return strings.TrimSpace(u.FirstName + " " + u.LastName)
+}
+
+// OwnerID implements Owned, users own themselves.
+func (u User) OwnerID () int {
+    return u.ID
 }
 
+// Anonymize removes all personal data from a user. Used to purge deleted users, their row is kept so records which
+// reference them, like events they created, stay valid.
+func (u *User) Anonymize () {
+    u.GoogleID = ""
+    u.FirstName = ""
+    u.LastName = ""
+    u.DisplayName = ""
+    u.Email = ""
+    u.ProfilePictureUrl = ""
+    u.AvatarVersion = ""
+    u.Bio = ""
+    u.Pronouns = ""
+    u.Timezone = ""
+    u.Locale = ""
+    u.PreferredHours = ""
+    u.SleepHours = ""
+}
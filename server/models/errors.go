@@ -0,0 +1,243 @@
+package models
+
+import (
+    "fmt"
+    "net/http"
+    "sort"
+    "strings"
+)
+
+// Base URL of error documentation. Each error is documented under an anchor with the name of its id.
+const ErrorDocsURL = "https://github.com/Noah-Huppert/squad-up/wiki/API-Errors"
+
+// ErrorDef defines an error the API can return. All errors are registered in a catalog with DefineError so that
+// clients can rely on their ids never changing.
+type ErrorDef struct {
+    // Stable identifier clients can switch on
+    Id string
+    // HTTP status code error is served with
+    HTTPCode int
+    // English message template, parameters are referenced by name in curly braces, ex: "{param} is required"
+    Message string
+    // Names of parameters the message template takes, in the order ErrorDef.New takes them
+    Params []string
+}
+
+// Catalog of all error definitions by id.
+var errorDefs = make(map[string]*ErrorDef)
+
+// DefineError registers an error definition in the catalog. Panics if an error with the same id was already defined,
+// as this is a programming error.
+func DefineError (id string, code int, message string, params ...string) *ErrorDef {
+    if _, exists := errorDefs[id]; exists {
+        panic("error with id \"" + id + "\" defined more than once")
+    }
+
+    def := &ErrorDef{id, code, message, params}
+    errorDefs[id] = def
+
+    return def
+}
+
+// ErrorDefs returns all registered error definitions sorted by id.
+func ErrorDefs () []*ErrorDef {
+    defs := make([]*ErrorDef, 0, len(errorDefs))
+    for _, def := range errorDefs {
+        defs = append(defs, def)
+    }
+
+    sort.Sort(errorDefsById(defs))
+
+    return defs
+}
+
+// Sorts error definitions by id
+type errorDefsById []*ErrorDef
+
+func (d errorDefsById) Len () int { return len(d) }
+func (d errorDefsById) Swap (i, j int) { d[i], d[j] = d[j], d[i] }
+func (d errorDefsById) Less (i, j int) bool { return d[i].Id < d[j].Id }
+
+// LookupErrorDef returns the definition of the error with the provided id, or nil if no such error is defined.
+func LookupErrorDef (id string) *ErrorDef {
+    return errorDefs[id]
+}
+
+// DocsURL returns the URL of the error's documentation.
+func (d *ErrorDef) DocsURL () string {
+    return ErrorDocsURL + "#" + d.Id
+}
+
+// Template returns the error's message template in the provided locale. Falls back to English if the message has not
+// been translated.
+func (d *ErrorDef) Template (locale string) string {
+    if translated, ok := errorTranslations[locale][d.Id]; ok {
+        return translated
+    }
+
+    return d.Message
+}
+
+// New creates an APIError from the definition. Takes a value for each parameter listed in ErrorDef.Params, in order.
+func (d *ErrorDef) New (values ...string) *APIError {
+    if len(values) != len(d.Params) {
+        panic(fmt.Sprintf("error \"%s\" takes %d parameters, got %d", d.Id, len(d.Params), len(values)))
+    }
+
+    params := make(map[string]string, len(values))
+    for i, name := range d.Params {
+        params[name] = values[i]
+    }
+
+    return &APIError{
+        Id: d.Id,
+        Message: renderMessage(d.Message, params),
+        HTTPCode: d.HTTPCode,
+        DocsURL: d.DocsURL(),
+        params: params,
+    }
+}
+
+// renderMessage replaces the parameter references in a message template with their values. References are replaced in
+// a single pass, so values which look like references are left as is.
+func renderMessage (template string, params map[string]string) string {
+    pairs := make([]string, 0, 2 * len(params))
+    for name, value := range params {
+        pairs = append(pairs, "{" + name + "}", value)
+    }
+
+    return strings.NewReplacer(pairs...).Replace(template)
+}
+
+// Authentication errors
+var (
+    ErrMissingParam = DefineError("missing_param", http.StatusUnprocessableEntity, "`{param}` must be provided as a post parameter", "param")
+    ErrHTTPVerifyingIdToken = DefineError("http_err_verifying_id_token", http.StatusInternalServerError, "An error occurred while contacting Google servers to verify your identity")
+    ErrBodyReadVerifyingIdToken = DefineError("body_read_err_verifying_id_token", http.StatusInternalServerError, "We couldn't read the Google server's response while verifying your identity")
+    ErrJSONParseVerifyingIdToken = DefineError("json_parse_err_verifying_id_token", http.StatusInternalServerError, "We couldn't understand the response the Google servers gave us while verifying your identity")
+    ErrInvalidIdToken = DefineError("invalid_id_token", http.StatusUnauthorized, "Google login not valid")
+    ErrEmailNotVerified = DefineError("email_not_verified", http.StatusUnauthorized, "Your email is not verified with Google")
+    ErrEmailLinked = DefineError("email_linked", http.StatusConflict, "Your email is used by an account which logs in with another Google account")
+    ErrFindingUser = DefineError("err_finding_user", http.StatusInternalServerError, "An internal error occurred while loading your account")
+    ErrGeneratingAccessToken = DefineError("err_generating_access_token", http.StatusInternalServerError, "An internal error occurred while generating the access token")
+    ErrMissingAccessToken = DefineError("missing_access_token", http.StatusUnauthorized, "An access token must be provided in the Authorization header")
+    ErrInvalidAccessToken = DefineError("invalid_access_token", http.StatusUnauthorized, "The provided access token is not valid")
+)
+
+// Request handling errors
+var (
+    ErrEndpointHandlerInvalidResultType = DefineError("endpoint_handler_invalid_result_type", http.StatusInternalServerError, "The handler for this endpoint returned a result with an invalid type")
+    ErrConvertingEndpointHandlerResult = DefineError("err_converting_endpoint_handler_result", http.StatusInternalServerError, "An internal error occurred in an intermediary json conversion step")
+    ErrMarshallingHTTPResponse = DefineError("error_marshalling_http_response", http.StatusInternalServerError, "An internal error occurred while generating the response")
+    ErrReadingRequestBody = DefineError("err_reading_request_body", http.StatusInternalServerError, "An internal error occurred while reading your request")
+    ErrPreconditionFailed = DefineError("precondition_failed", http.StatusPreconditionFailed, "The resource has been modified since you last retrieved it")
+    ErrRequestTimeout = DefineError("request_timeout", http.StatusServiceUnavailable, "Your request took too long to process, please try again")
+    ErrRequestCanceled = DefineError("request_canceled", StatusClientClosedRequest, "The request was canceled before it finished")
+    ErrInvalidExpand = DefineError("invalid_expand", http.StatusBadRequest, "The \"{relation}\" relation can not be expanded, valid relations are: {valid}", "relation", "valid")
+    ErrMethodNotAllowed = DefineError("method_not_allowed", http.StatusMethodNotAllowed, "{method} requests are not allowed, allowed methods are: {allowed}", "method", "allowed")
+    ErrInvalidJSONBody = DefineError("invalid_json_body", http.StatusBadRequest, "The request body must be a JSON object")
+    ErrMissingField = DefineError("missing_field", http.StatusUnprocessableEntity, "`{field}` is required", "field")
+    ErrEndpointNotFound = DefineError("endpoint_not_found", http.StatusNotFound, "No API endpoint exists at {path}", "path")
+    ErrForbidden = DefineError("forbidden", http.StatusForbidden, "You do not have permission to do this")
+    ErrPermissionDenied = DefineError("permission_denied", http.StatusForbidden, "Your role in this squad does not have the \"{permission}\" permission", "permission")
+)
+
+// Idempotency key errors
+var (
+    ErrInvalidIdempotencyKey = DefineError("invalid_idempotency_key", http.StatusBadRequest, "The Idempotency-Key header must be {max} characters or less", "max")
+    ErrSavingIdempotencyKey = DefineError("err_saving_idempotency_key", http.StatusInternalServerError, "An internal error occurred while saving your idempotency key")
+    ErrIdempotencyKeyReused = DefineError("idempotency_key_reused", http.StatusUnprocessableEntity, "This idempotency key was already used for a different request")
+    ErrIdempotencyKeyInProgress = DefineError("idempotency_key_in_progress", http.StatusConflict, "A request with this idempotency key is still being processed")
+)
+
+// User profile errors
+var (
+    ErrUserNotFound = DefineError("user_not_found", http.StatusNotFound, "No user with the id \"{id}\" exists", "id")
+    ErrSavingUser = DefineError("err_saving_user", http.StatusInternalServerError, "An internal error occurred while saving your profile")
+    ErrDeletingUser = DefineError("err_deleting_user", http.StatusInternalServerError, "An internal error occurred while deleting your account")
+    ErrFieldTooLong = DefineError("field_too_long", http.StatusUnprocessableEntity, "`{field}` must be {max} characters or less", "field", "max")
+    ErrInvalidTimezone = DefineError("invalid_timezone", http.StatusUnprocessableEntity, "\"{timezone}\" is not a valid time zone, ex: America/New_York", "timezone")
+    ErrInvalidHours = DefineError("invalid_hours", http.StatusUnprocessableEntity, "`{field}` must be a range of times of day, ex: 09:00-17:00", "field")
+    ErrUnsupportedLocale = DefineError("unsupported_locale", http.StatusUnprocessableEntity, "The \"{locale}\" locale is not supported, supported locales are: {supported}", "locale", "supported")
+)
+
+// Picture upload errors
+var (
+    ErrInvalidMultipartBody = DefineError("invalid_multipart_body", http.StatusBadRequest, "The request body must be multipart/form-data")
+    ErrAvatarTooLarge = DefineError("avatar_too_large", http.StatusRequestEntityTooLarge, "Pictures must be {max} or smaller", "max")
+    ErrUnsupportedImageType = DefineError("unsupported_image_type", http.StatusUnsupportedMediaType, "Pictures must be one of these image types: {supported}", "supported")
+    ErrImageTooManyPixels = DefineError("image_too_many_pixels", http.StatusUnprocessableEntity, "Pictures must be {max} megapixels or smaller", "max")
+    ErrSavingAvatar = DefineError("err_saving_avatar", http.StatusInternalServerError, "An internal error occurred while saving the picture")
+)
+
+// Squad errors
+var (
+    ErrSquadNotFound = DefineError("squad_not_found", http.StatusNotFound, "No squad with the id \"{id}\" exists", "id")
+    ErrFindingSquad = DefineError("err_finding_squad", http.StatusInternalServerError, "An internal error occurred while loading the squad")
+    ErrSavingSquad = DefineError("err_saving_squad", http.StatusInternalServerError, "An internal error occurred while saving the squad")
+    ErrInvalidSquadVisibility = DefineError("invalid_squad_visibility", http.StatusUnprocessableEntity, "\"{visibility}\" is not a valid squad visibility, valid visibilities are: {valid}", "visibility", "valid")
+    ErrSquadArchived = DefineError("squad_archived", http.StatusConflict, "This squad is archived and can not be changed")
+    ErrMemberNotFound = DefineError("member_not_found", http.StatusNotFound, "User \"{id}\" is not a member of this squad", "id")
+    ErrOwnerCannotLeave = DefineError("owner_cannot_leave", http.StatusConflict, "The owner of a squad can not leave it")
+)
+
+// Event errors
+var (
+    ErrEventNotFound = DefineError("event_not_found", http.StatusNotFound, "No event with the id \"{id}\" exists", "id")
+    ErrFindingEvent = DefineError("err_finding_event", http.StatusInternalServerError, "An internal error occurred while loading events")
+    ErrSavingEvent = DefineError("err_saving_event", http.StatusInternalServerError, "An internal error occurred while saving the event")
+    ErrEventCancelled = DefineError("event_cancelled", http.StatusConflict, "This event is cancelled and can not be changed")
+    ErrInvalidTime = DefineError("invalid_time", http.StatusUnprocessableEntity, "`{field}` must be a time in RFC 3339 format, ex: 2017-06-01T18:00:00-04:00", "field")
+    ErrInvalidTimeRange = DefineError("invalid_time_range", http.StatusUnprocessableEntity, "`{end}` must be after `{start}`", "start", "end")
+    ErrTimeRangeTooLong = DefineError("time_range_too_long", http.StatusUnprocessableEntity, "Time ranges can be at most {max} days long", "max")
+    ErrEventNotScheduled = DefineError("event_not_scheduled", http.StatusConflict, "RSVPs open once the event is scheduled")
+    ErrEventEnded = DefineError("event_ended", http.StatusConflict, "This event has already ended")
+    ErrNotEnoughSeats = DefineError("not_enough_seats", http.StatusConflict, "There are not enough seats left, you can bring at most {max} plus-ones", "max")
+    ErrSavingRSVP = DefineError("err_saving_rsvp", http.StatusInternalServerError, "An internal error occurred while saving your RSVP")
+    ErrInvalidChoice = DefineError("invalid_choice", http.StatusUnprocessableEntity, "\"{value}\" is not a valid `{field}`, valid values are: {valid}", "field", "value", "valid")
+    ErrInvalidRRule = DefineError("invalid_rrule", http.StatusUnprocessableEntity, "\"{rrule}\" is not a supported recurrence rule, only series can repeat", "rrule")
+    ErrOccurrenceRequired = DefineError("occurrence_required", http.StatusUnprocessableEntity, "This is a recurring event, `occurrence` must be the start time of one of its occurrences")
+    ErrOccurrenceNotFound = DefineError("occurrence_not_found", http.StatusNotFound, "This event does not take place at \"{occurrence}\"", "occurrence")
+)
+
+// Poll errors
+var (
+    ErrPollNotFound = DefineError("poll_not_found", http.StatusNotFound, "No poll with the id \"{id}\" exists", "id")
+    ErrFindingPoll = DefineError("err_finding_poll", http.StatusInternalServerError, "An internal error occurred while loading the poll")
+    ErrSavingPoll = DefineError("err_saving_poll", http.StatusInternalServerError, "An internal error occurred while saving the poll")
+    ErrPollClosed = DefineError("poll_closed", http.StatusConflict, "This poll is closed and its votes can no longer change")
+    ErrSlotNotFound = DefineError("slot_not_found", http.StatusUnprocessableEntity, "This poll has no time slot with the id \"{id}\"", "id")
+    ErrOptionNotFound = DefineError("option_not_found", http.StatusUnprocessableEntity, "This poll has no option with the id \"{id}\"", "id")
+    ErrPollTarget = DefineError("poll_target", http.StatusUnprocessableEntity, "Polls must be attached to either a `squad_id` or an `event_id`")
+    ErrDuplicateChoice = DefineError("duplicate_choice", http.StatusUnprocessableEntity, "The option with the id \"{id}\" is picked more than once", "id")
+)
+
+// Free/busy errors
+var (
+    ErrBusyBlockNotFound = DefineError("busy_block_not_found", http.StatusNotFound, "No busy block with the id \"{id}\" exists", "id")
+    ErrFindingBusy = DefineError("err_finding_busy", http.StatusInternalServerError, "An internal error occurred while loading busy times")
+    ErrSavingBusy = DefineError("err_saving_busy", http.StatusInternalServerError, "An internal error occurred while saving busy times")
+    ErrInvalidCalendar = DefineError("invalid_calendar", http.StatusUnprocessableEntity, "The request body must be an iCalendar (.ics) file")
+    ErrCalendarTooLarge = DefineError("calendar_too_large", http.StatusRequestEntityTooLarge, "Calendar files must be {max} or smaller", "max")
+)
+
+// Calendar feed errors
+var (
+    ErrFeedNotFound = DefineError("feed_not_found", http.StatusNotFound, "No calendar feed with the id \"{id}\" exists", "id")
+    ErrFindingFeed = DefineError("err_finding_feed", http.StatusInternalServerError, "An internal error occurred while loading the calendar feed")
+    ErrSavingFeed = DefineError("err_saving_feed", http.StatusInternalServerError, "An internal error occurred while saving the calendar feed")
+)
+
+// Squad invite errors
+var (
+    ErrInviteNotFound = DefineError("invite_not_found", http.StatusNotFound, "This invite does not exist, check the link you were sent")
+    ErrInviteExpired = DefineError("invite_expired", http.StatusGone, "This invite has expired, ask for a new one")
+    ErrInviteRevoked = DefineError("invite_revoked", http.StatusGone, "This invite was revoked")
+    ErrInviteUsedUp = DefineError("invite_used_up", http.StatusGone, "This invite has already been used, ask for a new one")
+    ErrInviteEmailMismatch = DefineError("invite_email_mismatch", http.StatusForbidden, "This invite was sent to a different email address")
+    ErrSavingInvite = DefineError("err_saving_invite", http.StatusInternalServerError, "An internal error occurred while saving the invite")
+    ErrInvalidSquadRole = DefineError("invalid_squad_role", http.StatusUnprocessableEntity, "\"{role}\" is not a valid role, valid roles are: {valid}", "role", "valid")
+    ErrSendingInviteEmail = DefineError("err_sending_invite_email", http.StatusBadGateway, "The invite was created but the email could not be sent")
+    ErrFieldOutOfRange = DefineError("field_out_of_range", http.StatusUnprocessableEntity, "`{field}` must be between {min} and {max}", "field", "min", "max")
+    ErrInvalidEmail = DefineError("invalid_email", http.StatusUnprocessableEntity, "\"{email}\" is not a valid email address", "email")
+)
@@ -0,0 +1,281 @@
+package models
+
+import (
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// Locale used when a client's locale is not supported.
+const DefaultLocale = "en"
+
+// Translated error message templates by locale, then error id. Errors which have not been translated fall back to the
+// English message in their ErrorDef.
+var errorTranslations = map[string]map[string]string{
+    "es": {
+        "missing_param": "Debes proporcionar `{param}` como parámetro post",
+        "http_err_verifying_id_token": "Ocurrió un error al contactar a los servidores de Google para verificar tu identidad",
+        "body_read_err_verifying_id_token": "No pudimos leer la respuesta del servidor de Google al verificar tu identidad",
+        "json_parse_err_verifying_id_token": "No pudimos entender la respuesta de los servidores de Google al verificar tu identidad",
+        "invalid_id_token": "El inicio de sesión de Google no es válido",
+        "email_not_verified": "Tu correo electrónico no está verificado con Google",
+        "err_finding_user": "Ocurrió un error interno al cargar tu cuenta",
+        "err_generating_access_token": "Ocurrió un error interno al generar el token de acceso",
+        "missing_access_token": "Debes proporcionar un token de acceso en el encabezado Authorization",
+        "invalid_access_token": "El token de acceso proporcionado no es válido",
+        "endpoint_handler_invalid_result_type": "El controlador de este endpoint devolvió un resultado de tipo no válido",
+        "err_converting_endpoint_handler_result": "Ocurrió un error interno en un paso intermedio de conversión a json",
+        "error_marshalling_http_response": "Ocurrió un error interno al generar la respuesta",
+        "err_reading_request_body": "Ocurrió un error interno al leer tu solicitud",
+        "precondition_failed": "El recurso ha sido modificado desde la última vez que lo obtuviste",
+        "request_timeout": "Tu solicitud tardó demasiado en procesarse, inténtalo de nuevo",
+        "request_canceled": "La solicitud fue cancelada antes de terminar",
+        "invalid_expand": "La relación \"{relation}\" no se puede expandir, las relaciones válidas son: {valid}",
+        "invalid_idempotency_key": "El encabezado Idempotency-Key debe tener {max} caracteres o menos",
+        "err_saving_idempotency_key": "Ocurrió un error interno al guardar tu clave de idempotencia",
+        "idempotency_key_reused": "Esta clave de idempotencia ya se usó para una solicitud diferente",
+        "idempotency_key_in_progress": "Una solicitud con esta clave de idempotencia todavía se está procesando",
+        "method_not_allowed": "No se permiten solicitudes {method}, los métodos permitidos son: {allowed}",
+        "invalid_json_body": "El cuerpo de la solicitud debe ser un objeto JSON",
+        "missing_field": "`{field}` es obligatorio",
+        "endpoint_not_found": "No existe ningún endpoint de la API en {path}",
+        "forbidden": "No tienes permiso para hacer esto",
+        "permission_denied": "Tu rol en este escuadrón no tiene el permiso \"{permission}\"",
+        "user_not_found": "No existe ningún usuario con el id \"{id}\"",
+        "err_saving_user": "Ocurrió un error interno al guardar tu perfil",
+        "err_deleting_user": "Ocurrió un error interno al eliminar tu cuenta",
+        "field_too_long": "`{field}` debe tener {max} caracteres o menos",
+        "invalid_timezone": "\"{timezone}\" no es una zona horaria válida, ej: America/New_York",
+        "invalid_hours": "`{field}` debe ser un rango de horas del día, ej: 09:00-17:00",
+        "unsupported_locale": "La configuración regional \"{locale}\" no es compatible, las compatibles son: {supported}",
+        "invalid_multipart_body": "El cuerpo de la solicitud debe ser multipart/form-data",
+        "avatar_too_large": "Las imágenes deben pesar {max} o menos",
+        "unsupported_image_type": "Las imágenes deben ser de uno de estos tipos: {supported}",
+        "image_too_many_pixels": "Las imágenes deben tener {max} megapíxeles o menos",
+        "err_saving_avatar": "Ocurrió un error interno al guardar la imagen",
+        "squad_not_found": "No existe ningún escuadrón con el id \"{id}\"",
+        "err_finding_squad": "Ocurrió un error interno al cargar el escuadrón",
+        "err_saving_squad": "Ocurrió un error interno al guardar el escuadrón",
+        "invalid_squad_visibility": "\"{visibility}\" no es una visibilidad de escuadrón válida, las válidas son: {valid}",
+        "squad_archived": "Este escuadrón está archivado y no se puede modificar",
+        "member_not_found": "El usuario \"{id}\" no es miembro de este escuadrón",
+        "owner_cannot_leave": "El propietario de un escuadrón no puede abandonarlo",
+        "event_not_found": "No existe ningún evento con el id \"{id}\"",
+        "err_finding_event": "Se produjo un error interno al cargar los eventos",
+        "err_saving_event": "Se produjo un error interno al guardar el evento",
+        "event_cancelled": "Este evento está cancelado y no se puede modificar",
+        "invalid_time": "`{field}` debe ser una hora en formato RFC 3339, ej: 2017-06-01T18:00:00-04:00",
+        "invalid_time_range": "`{end}` debe ser posterior a `{start}`",
+        "time_range_too_long": "Los intervalos de tiempo pueden durar como máximo {max} días",
+        "event_not_scheduled": "Las respuestas se abren cuando el evento esté programado",
+        "event_ended": "Este evento ya ha terminado",
+        "not_enough_seats": "No quedan suficientes plazas, puedes traer como máximo {max} acompañantes",
+        "err_saving_rsvp": "Se produjo un error interno al guardar tu respuesta",
+        "invalid_choice": "\"{value}\" no es un valor válido de `{field}`, los valores válidos son: {valid}",
+        "invalid_rrule": "\"{rrule}\" no es una regla de repetición admitida, solo las series pueden repetirse",
+        "occurrence_required": "Este es un evento periódico, `occurrence` debe ser la hora de inicio de una de sus repeticiones",
+        "occurrence_not_found": "Este evento no tiene lugar el \"{occurrence}\"",
+        "poll_not_found": "No existe ninguna encuesta con el id \"{id}\"",
+        "err_finding_poll": "Se produjo un error interno al cargar la encuesta",
+        "err_saving_poll": "Se produjo un error interno al guardar la encuesta",
+        "poll_closed": "Esta encuesta está cerrada y sus votos ya no pueden cambiar",
+        "slot_not_found": "Esta encuesta no tiene ninguna franja horaria con el id \"{id}\"",
+        "option_not_found": "Esta encuesta no tiene ninguna opción con el id \"{id}\"",
+        "poll_target": "Las encuestas deben estar vinculadas a un `squad_id` o a un `event_id`",
+        "duplicate_choice": "La opción con el id \"{id}\" está elegida más de una vez",
+        "busy_block_not_found": "No existe ningún bloque ocupado con el id \"{id}\"",
+        "err_finding_busy": "Se produjo un error interno al cargar los horarios ocupados",
+        "err_saving_busy": "Se produjo un error interno al guardar los horarios ocupados",
+        "invalid_calendar": "El cuerpo de la solicitud debe ser un archivo iCalendar (.ics)",
+        "calendar_too_large": "Los archivos de calendario deben pesar {max} o menos",
+        "feed_not_found": "No existe ningún calendario suscrito con el id \"{id}\"",
+        "err_finding_feed": "Se produjo un error interno al cargar el calendario suscrito",
+        "err_saving_feed": "Se produjo un error interno al guardar el calendario suscrito",
+        "invite_not_found": "Esta invitación no existe, revisa el enlace que te enviaron",
+        "invite_expired": "Esta invitación ha caducado, pide una nueva",
+        "invite_revoked": "Esta invitación fue revocada",
+        "invite_used_up": "Esta invitación ya se ha usado, pide una nueva",
+        "invite_email_mismatch": "Esta invitación se envió a otra dirección de correo electrónico",
+        "err_saving_invite": "Se produjo un error interno al guardar la invitación",
+        "invalid_squad_role": "\"{role}\" no es un rol válido, los roles válidos son: {valid}",
+        "err_sending_invite_email": "La invitación se creó pero no se pudo enviar el correo electrónico",
+        "field_out_of_range": "`{field}` debe estar entre {min} y {max}",
+        "invalid_email": "\"{email}\" no es una dirección de correo electrónico válida",
+    },
+    "fr": {
+        "missing_param": "`{param}` doit être fourni comme paramètre post",
+        "http_err_verifying_id_token": "Une erreur est survenue en contactant les serveurs de Google pour vérifier votre identité",
+        "body_read_err_verifying_id_token": "Nous n'avons pas pu lire la réponse du serveur de Google en vérifiant votre identité",
+        "json_parse_err_verifying_id_token": "Nous n'avons pas compris la réponse des serveurs de Google en vérifiant votre identité",
+        "invalid_id_token": "La connexion Google n'est pas valide",
+        "email_not_verified": "Votre adresse e-mail n'est pas vérifiée auprès de Google",
+        "err_finding_user": "Une erreur interne est survenue lors du chargement de votre compte",
+        "err_generating_access_token": "Une erreur interne est survenue lors de la génération du jeton d'accès",
+        "missing_access_token": "Un jeton d'accès doit être fourni dans l'en-tête Authorization",
+        "invalid_access_token": "Le jeton d'accès fourni n'est pas valide",
+        "endpoint_handler_invalid_result_type": "Le gestionnaire de ce point d'accès a renvoyé un résultat de type invalide",
+        "err_converting_endpoint_handler_result": "Une erreur interne est survenue lors d'une étape intermédiaire de conversion json",
+        "error_marshalling_http_response": "Une erreur interne est survenue lors de la génération de la réponse",
+        "err_reading_request_body": "Une erreur interne est survenue lors de la lecture de votre requête",
+        "precondition_failed": "La ressource a été modifiée depuis que vous l'avez récupérée",
+        "request_timeout": "Votre requête a pris trop de temps à traiter, veuillez réessayer",
+        "request_canceled": "La requête a été annulée avant d'être terminée",
+        "invalid_expand": "La relation \"{relation}\" ne peut pas être développée, les relations valides sont : {valid}",
+        "invalid_idempotency_key": "L'en-tête Idempotency-Key doit contenir {max} caractères au maximum",
+        "err_saving_idempotency_key": "Une erreur interne est survenue lors de l'enregistrement de votre clé d'idempotence",
+        "idempotency_key_reused": "Cette clé d'idempotence a déjà été utilisée pour une requête différente",
+        "idempotency_key_in_progress": "Une requête avec cette clé d'idempotence est toujours en cours de traitement",
+        "method_not_allowed": "Les requêtes {method} ne sont pas autorisées, les méthodes autorisées sont : {allowed}",
+        "invalid_json_body": "Le corps de la requête doit être un objet JSON",
+        "missing_field": "`{field}` est obligatoire",
+        "endpoint_not_found": "Aucun point d'accès de l'API n'existe à {path}",
+        "forbidden": "Vous n'avez pas la permission de faire ceci",
+        "permission_denied": "Votre rôle dans cette escouade n'a pas la permission \"{permission}\"",
+        "user_not_found": "Aucun utilisateur avec l'identifiant \"{id}\" n'existe",
+        "err_saving_user": "Une erreur interne est survenue lors de l'enregistrement de votre profil",
+        "err_deleting_user": "Une erreur interne est survenue lors de la suppression de votre compte",
+        "field_too_long": "`{field}` doit contenir {max} caractères au maximum",
+        "invalid_timezone": "\"{timezone}\" n'est pas un fuseau horaire valide, ex : America/New_York",
+        "invalid_hours": "`{field}` doit être une plage d'heures de la journée, ex : 09:00-17:00",
+        "unsupported_locale": "La langue \"{locale}\" n'est pas prise en charge, les langues prises en charge sont : {supported}",
+        "invalid_multipart_body": "Le corps de la requête doit être au format multipart/form-data",
+        "avatar_too_large": "Les images doivent faire {max} ou moins",
+        "unsupported_image_type": "Les images doivent être de l'un de ces types : {supported}",
+        "image_too_many_pixels": "Les images doivent faire {max} mégapixels ou moins",
+        "err_saving_avatar": "Une erreur interne est survenue lors de l'enregistrement de l'image",
+        "squad_not_found": "Aucune escouade avec l'identifiant \"{id}\" n'existe",
+        "err_finding_squad": "Une erreur interne est survenue lors du chargement de l'escouade",
+        "err_saving_squad": "Une erreur interne est survenue lors de l'enregistrement de l'escouade",
+        "invalid_squad_visibility": "\"{visibility}\" n'est pas une visibilité d'escouade valide, les visibilités valides sont : {valid}",
+        "squad_archived": "Cette escouade est archivée et ne peut pas être modifiée",
+        "member_not_found": "L'utilisateur \"{id}\" n'est pas membre de cette escouade",
+        "owner_cannot_leave": "Le propriétaire d'une escouade ne peut pas la quitter",
+        "event_not_found": "Aucun événement avec l'identifiant \"{id}\" n'existe",
+        "err_finding_event": "Une erreur interne s'est produite lors du chargement des événements",
+        "err_saving_event": "Une erreur interne s'est produite lors de l'enregistrement de l'événement",
+        "event_cancelled": "Cet événement est annulé et ne peut pas être modifié",
+        "invalid_time": "`{field}` doit être une heure au format RFC 3339, ex : 2017-06-01T18:00:00-04:00",
+        "invalid_time_range": "`{end}` doit être postérieur à `{start}`",
+        "time_range_too_long": "Les plages horaires peuvent durer au maximum {max} jours",
+        "event_not_scheduled": "Les réponses ouvrent une fois l'événement programmé",
+        "event_ended": "Cet événement est déjà terminé",
+        "not_enough_seats": "Il ne reste pas assez de places, vous pouvez venir avec au maximum {max} invités",
+        "err_saving_rsvp": "Une erreur interne s'est produite lors de l'enregistrement de votre réponse",
+        "invalid_choice": "\"{value}\" n'est pas une valeur valide pour `{field}`, les valeurs valides sont : {valid}",
+        "invalid_rrule": "\"{rrule}\" n'est pas une règle de récurrence prise en charge, seules les séries peuvent se répéter",
+        "occurrence_required": "Cet événement est récurrent, `occurrence` doit être l'heure de début de l'une de ses occurrences",
+        "occurrence_not_found": "Cet événement n'a pas lieu le \"{occurrence}\"",
+        "poll_not_found": "Aucun sondage avec l'id \"{id}\" n'existe",
+        "err_finding_poll": "Une erreur interne s'est produite lors du chargement du sondage",
+        "err_saving_poll": "Une erreur interne s'est produite lors de l'enregistrement du sondage",
+        "poll_closed": "Ce sondage est clos et ses votes ne peuvent plus changer",
+        "slot_not_found": "Ce sondage n'a aucun créneau avec l'id \"{id}\"",
+        "option_not_found": "Ce sondage n'a aucune option avec l'id \"{id}\"",
+        "poll_target": "Les sondages doivent être rattachés à un `squad_id` ou à un `event_id`",
+        "duplicate_choice": "L'option avec l'id \"{id}\" est choisie plus d'une fois",
+        "busy_block_not_found": "Aucun créneau occupé avec l'id \"{id}\" n'existe",
+        "err_finding_busy": "Une erreur interne s'est produite lors du chargement des créneaux occupés",
+        "err_saving_busy": "Une erreur interne s'est produite lors de l'enregistrement des créneaux occupés",
+        "invalid_calendar": "Le corps de la requête doit être un fichier iCalendar (.ics)",
+        "calendar_too_large": "Les fichiers de calendrier doivent faire {max} ou moins",
+        "feed_not_found": "Aucun flux de calendrier avec l'id \"{id}\" n'existe",
+        "err_finding_feed": "Une erreur interne s'est produite lors du chargement du flux de calendrier",
+        "err_saving_feed": "Une erreur interne s'est produite lors de l'enregistrement du flux de calendrier",
+        "invite_not_found": "Cette invitation n'existe pas, vérifiez le lien que vous avez reçu",
+        "invite_expired": "Cette invitation a expiré, demandez-en une nouvelle",
+        "invite_revoked": "Cette invitation a été révoquée",
+        "invite_used_up": "Cette invitation a déjà été utilisée, demandez-en une nouvelle",
+        "invite_email_mismatch": "Cette invitation a été envoyée à une autre adresse e-mail",
+        "err_saving_invite": "Une erreur interne s'est produite lors de l'enregistrement de l'invitation",
+        "invalid_squad_role": "\"{role}\" n'est pas un rôle valide, les rôles valides sont : {valid}",
+        "err_sending_invite_email": "L'invitation a été créée mais l'e-mail n'a pas pu être envoyé",
+        "field_out_of_range": "`{field}` doit être compris entre {min} et {max}",
+        "invalid_email": "\"{email}\" n'est pas une adresse e-mail valide",
+    },
+}
+
+// SupportedLocales returns all locales messages can be rendered in, sorted.
+func SupportedLocales () []string {
+    locales := []string{DefaultLocale}
+    for locale := range errorTranslations {
+        locales = append(locales, locale)
+    }
+
+    sort.Strings(locales)
+
+    return locales
+}
+
+// SupportedLocale returns the supported locale which best matches a locale tag, ex: "fr-CA" matches "fr". Returns
+// false if no supported locale matches.
+func SupportedLocale (tag string) (string, bool) {
+    tag = strings.ToLower(strings.Replace(strings.TrimSpace(tag), "_", "-", -1))
+    if tag == "" {
+        return "", false
+    }
+
+    for {
+        if tag == DefaultLocale {
+            return tag, true
+        }
+
+        if _, ok := errorTranslations[tag]; ok {
+            return tag, true
+        }
+
+        // Try less specific tag
+        i := strings.LastIndex(tag, "-")
+        if i == -1 {
+            return "", false
+        }
+
+        tag = tag[:i]
+    }
+}
+
+// A language range from an Accept-Language header and its quality value
+type weightedLocale struct {
+    tag string
+    q float64
+}
+
+// Sorts weighted locales by descending quality
+type byQuality []weightedLocale
+
+func (l byQuality) Len () int { return len(l) }
+func (l byQuality) Swap (i, j int) { l[i], l[j] = l[j], l[i] }
+func (l byQuality) Less (i, j int) bool { return l[i].q > l[j].q }
+
+// NegotiateLocale returns the supported locale which best matches the value of an Accept-Language header. Returns
+// false if the header does not list any supported locales.
+func NegotiateLocale (acceptLanguage string) (string, bool) {
+    var ranges []weightedLocale
+
+    for _, part := range strings.Split(acceptLanguage, ",") {
+        fields := strings.Split(part, ";")
+        wl := weightedLocale{strings.TrimSpace(fields[0]), 1}
+
+        for _, param := range fields[1:] {
+            param = strings.TrimSpace(param)
+            if strings.HasPrefix(param, "q=") {
+                if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+                    wl.q = q
+                }
+            }
+        }
+
+        if wl.tag != "" && wl.q > 0 {
+            ranges = append(ranges, wl)
+        }
+    }
+
+    sort.Stable(byQuality(ranges))
+
+    for _, wl := range ranges {
+        if locale, ok := SupportedLocale(wl.tag); ok {
+            return locale, true
+        }
+    }
+
+    return "", false
+}
@@ -0,0 +1,466 @@
+package models
+
+import (
+    "context"
+    "sort"
+    "sync"
+    "time"
+
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+
+    "github.com/jinzhu/gorm"
+)
+
+// Relations of events which EventStore methods can load, by their gorm association name
+const (
+    // db.Event.Creator
+    ExpandEventCreator = "Creator"
+    // db.Event.Squad
+    ExpandEventSquad = "Squad"
+)
+
+// EventFilter selects events. Events matching either the PersonalOf or SquadIDs fields are selected.
+type EventFilter struct {
+    // Only select events which end after From and start before To. Not limited if zero. Recurring events are selected
+    // if any of their occurrences could be in the range.
+    From time.Time
+    To time.Time
+    // Select personal events created by the user with this id, if not 0
+    PersonalOf int
+    // Select events of these squads
+    SquadIDs []int
+}
+
+// matches reports if an event is selected by the filter.
+func (f EventFilter) matches (event db.Event) bool {
+    end := &event.EndsAt
+    if event.Recurring() {
+        end = event.RecursUntil
+    }
+
+    if (f.From.IsZero() == false && end != nil && end.After(f.From) == false) ||
+        (f.To.IsZero() == false && event.StartsAt.Before(f.To) == false) {
+        return false
+    }
+
+    if event.SquadID == nil {
+        return f.PersonalOf != 0 && event.CreatorID == f.PersonalOf
+    }
+
+    for _, id := range f.SquadIDs {
+        if *event.SquadID == id {
+            return true
+        }
+    }
+
+    return false
+}
+
+// EventStore loads and saves events.
+type EventStore interface {
+    // Create saves a new event, setting its ID
+    Create (c context.Context, event *db.Event) error
+    // FindById returns the event with the provided id. Returns ErrNotFound if no such event exists.
+    FindById (c context.Context, id int, expand ...string) (*db.Event, error)
+    // Find returns the events selected by a filter, ordered by start time
+    Find (c context.Context, filter EventFilter, expand ...string) ([]db.Event, error)
+    // FindOccurrences returns the saved occurrences of recurring events, ordered by their original start time
+    FindOccurrences (c context.Context, seriesIds []int) ([]db.Event, error)
+    // Update saves changes to an existing event, incrementing its Sequence
+    Update (c context.Context, event *db.Event) error
+    // UpdateIfUnmodified saves changes to an existing event like Update if it was not changed since it was loaded.
+    // Returns ErrModified otherwise.
+    UpdateIfUnmodified (c context.Context, event *db.Event) error
+    // Delete soft deletes an event
+    Delete (c context.Context, id int) error
+    // FindByCreator returns the events a user created, in squads or personal, ordered by start time
+    FindByCreator (c context.Context, userId int) ([]db.Event, error)
+    // DeletePersonal permanently deletes the personal events a user created and their saved occurrences, including
+    // deleted ones
+    DeletePersonal (c context.Context, userId int) error
+    // DeleteBySquad permanently deletes the events of a squad, including deleted ones
+    DeleteBySquad (c context.Context, squadId int) error
+}
+
+// GormEventStore is an EventStore which uses a gorm database.
+type GormEventStore struct {
+    db *gorm.DB
+}
+
+// NewGormEventStore creates a GormEventStore.
+func NewGormEventStore (db *gorm.DB) *GormEventStore {
+    return &GormEventStore{db}
+}
+
+func (s *GormEventStore) Create (c context.Context, event *db.Event) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    return s.db.Set("gorm:save_associations", false).Create(event).Error
+}
+
+func (s *GormEventStore) FindById (c context.Context, id int, expand ...string) (*db.Event, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    var event db.Event
+    q := preloadAll(s.db, expand).Where("id = ?", id).First(&event)
+    if q.RecordNotFound() {
+        return nil, ErrNotFound
+    } else if q.Error != nil {
+        return nil, q.Error
+    }
+
+    return &event, nil
+}
+
+func (s *GormEventStore) Find (c context.Context, filter EventFilter, expand ...string) ([]db.Event, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    q := preloadAll(s.db, expand)
+    if filter.From.IsZero() == false {
+        q = q.Where("(rrule = '' AND ends_at > ?) OR (rrule <> '' AND (recurs_until IS NULL OR recurs_until > ?))",
+            filter.From, filter.From)
+    }
+    if filter.To.IsZero() == false {
+        q = q.Where("starts_at < ?", filter.To)
+    }
+
+    // Gorm can not build an IN condition for an empty list
+    switch {
+    case filter.PersonalOf != 0 && len(filter.SquadIDs) > 0:
+        q = q.Where("(squad_id IS NULL AND creator_id = ?) OR squad_id IN (?)", filter.PersonalOf, filter.SquadIDs)
+    case filter.PersonalOf != 0:
+        q = q.Where("squad_id IS NULL AND creator_id = ?", filter.PersonalOf)
+    case len(filter.SquadIDs) > 0:
+        q = q.Where("squad_id IN (?)", filter.SquadIDs)
+    default:
+        return nil, nil
+    }
+
+    var events []db.Event
+    err := q.Order("starts_at, id").Find(&events).Error
+
+    return events, err
+}
+
+func (s *GormEventStore) FindOccurrences (c context.Context, seriesIds []int) ([]db.Event, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    } else if len(seriesIds) == 0 {
+        return nil, nil
+    }
+
+    var events []db.Event
+    err := s.db.Where("parent_id IN (?)", seriesIds).Order("original_starts_at, id").Find(&events).Error
+
+    return events, err
+}
+
+func (s *GormEventStore) Update (c context.Context, event *db.Event) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    event.Sequence++
+
+    return s.db.Set("gorm:save_associations", false).Save(event).Error
+}
+
+func (s *GormEventStore) UpdateIfUnmodified (c context.Context, event *db.Event) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    event.Sequence++
+
+    err := updateIfUnmodified(s.db, event, event.UpdatedAt)
+    if err != nil {
+        event.Sequence--
+    }
+
+    return err
+}
+
+func (s *GormEventStore) Delete (c context.Context, id int) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    return s.db.Where("id = ?", id).Delete(&db.Event{}).Error
+}
+
+func (s *GormEventStore) FindByCreator (c context.Context, userId int) ([]db.Event, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    var events []db.Event
+    err := s.db.Where("creator_id = ?", userId).Order("starts_at, id").Find(&events).Error
+
+    return events, err
+}
+
+func (s *GormEventStore) DeletePersonal (c context.Context, userId int) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    // Occurrences are copies of their series, so they have the same creator and no squad
+    return s.db.Unscoped().Where("creator_id = ? AND squad_id IS NULL", userId).Delete(&db.Event{}).Error
+}
+
+func (s *GormEventStore) DeleteBySquad (c context.Context, squadId int) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    return s.db.Unscoped().Where("squad_id = ?", squadId).Delete(&db.Event{}).Error
+}
+
+// MemoryEventStore is an EventStore which keeps events in memory. Used by tests.
+type MemoryEventStore struct {
+    mu sync.Mutex
+    // Used to load the Creator and Squad relations
+    users UserStore
+    squads SquadStore
+    events map[int]db.Event
+    nextId int
+}
+
+// NewMemoryEventStore creates an empty MemoryEventStore which loads relations from the provided stores.
+func NewMemoryEventStore (users UserStore, squads SquadStore) *MemoryEventStore {
+    return &MemoryEventStore{users: users, squads: squads, events: make(map[int]db.Event), nextId: 1}
+}
+
+// expand loads an event's requested relations.
+func (s *MemoryEventStore) expand (event db.Event, expand []string) db.Event {
+    if hasExpand(expand, ExpandEventCreator) {
+        event.Creator, _ = s.users.FindById(context.Background(), event.CreatorID)
+    }
+
+    if hasExpand(expand, ExpandEventSquad) && event.SquadID != nil {
+        event.Squad, _ = s.squads.FindById(context.Background(), *event.SquadID)
+    }
+
+    return event
+}
+
+// eventsByStart sorts events like GormEventStore.Find.
+type eventsByStart []db.Event
+
+func (l eventsByStart) Len () int { return len(l) }
+func (l eventsByStart) Swap (i, j int) { l[i], l[j] = l[j], l[i] }
+func (l eventsByStart) Less (i, j int) bool {
+    if l[i].StartsAt.Equal(l[j].StartsAt) {
+        return l[i].ID < l[j].ID
+    }
+
+    return l[i].StartsAt.Before(l[j].StartsAt)
+}
+
+func (s *MemoryEventStore) Create (c context.Context, event *db.Event) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    now := time.Now()
+    event.ID = s.nextId
+    event.CreatedAt = now
+    event.UpdatedAt = now
+    s.nextId++
+
+    s.save(*event)
+
+    return nil
+}
+
+// save stores a copy of an event without its relations. Must be called with the lock held.
+func (s *MemoryEventStore) save (event db.Event) {
+    event.Creator = nil
+    event.Squad = nil
+    s.events[event.ID] = event
+}
+
+func (s *MemoryEventStore) FindById (c context.Context, id int, expand ...string) (*db.Event, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    s.mu.Lock()
+    event, ok := s.events[id]
+    s.mu.Unlock()
+
+    if ok == false || event.DeletedAt != nil {
+        return nil, ErrNotFound
+    }
+
+    event = s.expand(event, expand)
+
+    return &event, nil
+}
+
+func (s *MemoryEventStore) Find (c context.Context, filter EventFilter, expand ...string) ([]db.Event, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    s.mu.Lock()
+    var events []db.Event
+    for _, event := range s.events {
+        if event.DeletedAt == nil && filter.matches(event) {
+            events = append(events, event)
+        }
+    }
+    s.mu.Unlock()
+
+    sort.Sort(eventsByStart(events))
+
+    for i := range events {
+        events[i] = s.expand(events[i], expand)
+    }
+
+    return events, nil
+}
+
+// occurrencesByStart sorts events like GormEventStore.FindOccurrences.
+type occurrencesByStart []db.Event
+
+func (l occurrencesByStart) Len () int { return len(l) }
+func (l occurrencesByStart) Swap (i, j int) { l[i], l[j] = l[j], l[i] }
+func (l occurrencesByStart) Less (i, j int) bool {
+    if l[i].OriginalStartsAt.Equal(*l[j].OriginalStartsAt) {
+        return l[i].ID < l[j].ID
+    }
+
+    return l[i].OriginalStartsAt.Before(*l[j].OriginalStartsAt)
+}
+
+func (s *MemoryEventStore) FindOccurrences (c context.Context, seriesIds []int) ([]db.Event, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    s.mu.Lock()
+    var events []db.Event
+    for _, event := range s.events {
+        if event.DeletedAt != nil || event.ParentID == nil {
+            continue
+        }
+
+        for _, id := range seriesIds {
+            if *event.ParentID == id {
+                events = append(events, event)
+            }
+        }
+    }
+    s.mu.Unlock()
+
+    sort.Sort(occurrencesByStart(events))
+
+    return events, nil
+}
+
+func (s *MemoryEventStore) Update (c context.Context, event *db.Event) error {
+    return s.update(c, event, false)
+}
+
+func (s *MemoryEventStore) UpdateIfUnmodified (c context.Context, event *db.Event) error {
+    return s.update(c, event, true)
+}
+
+// update saves changes to an event, only if it was not changed since it was loaded if unmodified is true.
+func (s *MemoryEventStore) update (c context.Context, event *db.Event, unmodified bool) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    saved, ok := s.events[event.ID]
+    if ok == false || saved.DeletedAt != nil {
+        return ErrNotFound
+    } else if unmodified && saved.UpdatedAt.Equal(event.UpdatedAt) == false {
+        return ErrModified
+    }
+
+    event.UpdatedAt = time.Now()
+    event.Sequence++
+    s.save(*event)
+
+    return nil
+}
+
+func (s *MemoryEventStore) Delete (c context.Context, id int) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    event, ok := s.events[id]
+    if ok == false || event.DeletedAt != nil {
+        return ErrNotFound
+    }
+
+    now := time.Now()
+    event.DeletedAt = &now
+    s.events[id] = event
+
+    return nil
+}
+
+func (s *MemoryEventStore) FindByCreator (c context.Context, userId int) ([]db.Event, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    var events []db.Event
+    for _, event := range s.events {
+        if event.DeletedAt == nil && event.CreatorID == userId {
+            events = append(events, event)
+        }
+    }
+
+    sort.Sort(eventsByStart(events))
+
+    return events, nil
+}
+
+// deleteWhere permanently deletes the events which match.
+func (s *MemoryEventStore) deleteWhere (c context.Context, match func (db.Event) bool) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    for id, event := range s.events {
+        if match(event) {
+            delete(s.events, id)
+        }
+    }
+
+    return nil
+}
+
+func (s *MemoryEventStore) DeletePersonal (c context.Context, userId int) error {
+    return s.deleteWhere(c, func (event db.Event) bool { return event.SquadID == nil && event.CreatorID == userId })
+}
+
+func (s *MemoryEventStore) DeleteBySquad (c context.Context, squadId int) error {
+    return s.deleteWhere(c, func (event db.Event) bool { return event.SquadID != nil && *event.SquadID == squadId })
+}
@@ -0,0 +1,228 @@
+package models
+
+import (
+    "context"
+    "sort"
+    "sync"
+    "time"
+
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+
+    "github.com/jinzhu/gorm"
+)
+
+// FeedStore loads and saves calendar feeds.
+type FeedStore interface {
+    // Create saves a new feed, setting its ID. The user's previous feed of the same squad, or their own feed if the
+    // new one has no squad, is deleted so its link stops working.
+    Create (c context.Context, feed *db.CalendarFeed) error
+    // FindById returns the feed with the provided id. Returns ErrNotFound if no such feed exists.
+    FindById (c context.Context, id int) (*db.CalendarFeed, error)
+    // FindByUser returns a user's feeds, in the order they were created
+    FindByUser (c context.Context, userId int) ([]db.CalendarFeed, error)
+    // Delete soft deletes a feed
+    Delete (c context.Context, id int) error
+    // DeleteByUser permanently deletes all of a user's feeds, including ones which were replaced or deleted
+    DeleteByUser (c context.Context, userId int) error
+}
+
+// GormFeedStore is a FeedStore which uses a gorm database.
+type GormFeedStore struct {
+    db *gorm.DB
+}
+
+// NewGormFeedStore creates a GormFeedStore.
+func NewGormFeedStore (db *gorm.DB) *GormFeedStore {
+    return &GormFeedStore{db}
+}
+
+func (s *GormFeedStore) Create (c context.Context, feed *db.CalendarFeed) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    return inTransaction(s.db, func (tx *gorm.DB) error {
+        q := tx.Where("user_id = ?", feed.UserID)
+        if feed.SquadID == nil {
+            q = q.Where("squad_id IS NULL")
+        } else {
+            q = q.Where("squad_id = ?", *feed.SquadID)
+        }
+
+        if err := q.Delete(&db.CalendarFeed{}).Error; err != nil {
+            return err
+        }
+
+        return tx.Create(feed).Error
+    })
+}
+
+func (s *GormFeedStore) FindById (c context.Context, id int) (*db.CalendarFeed, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    var feed db.CalendarFeed
+    q := s.db.Where("id = ?", id).First(&feed)
+    if q.RecordNotFound() {
+        return nil, ErrNotFound
+    } else if q.Error != nil {
+        return nil, q.Error
+    }
+
+    return &feed, nil
+}
+
+func (s *GormFeedStore) FindByUser (c context.Context, userId int) ([]db.CalendarFeed, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    var feeds []db.CalendarFeed
+    err := s.db.Where("user_id = ?", userId).Order("id").Find(&feeds).Error
+
+    return feeds, err
+}
+
+func (s *GormFeedStore) Delete (c context.Context, id int) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    return s.db.Where("id = ?", id).Delete(&db.CalendarFeed{}).Error
+}
+
+func (s *GormFeedStore) DeleteByUser (c context.Context, userId int) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    return s.db.Unscoped().Where("user_id = ?", userId).Delete(&db.CalendarFeed{}).Error
+}
+
+// MemoryFeedStore is a FeedStore which keeps feeds in memory. Used by tests.
+type MemoryFeedStore struct {
+    mu sync.Mutex
+    feeds map[int]db.CalendarFeed
+    nextId int
+}
+
+// NewMemoryFeedStore creates an empty MemoryFeedStore.
+func NewMemoryFeedStore () *MemoryFeedStore {
+    return &MemoryFeedStore{feeds: make(map[int]db.CalendarFeed), nextId: 1}
+}
+
+// feedsById sorts feeds like GormFeedStore.FindByUser.
+type feedsById []db.CalendarFeed
+
+func (l feedsById) Len () int { return len(l) }
+func (l feedsById) Swap (i, j int) { l[i], l[j] = l[j], l[i] }
+func (l feedsById) Less (i, j int) bool { return l[i].ID < l[j].ID }
+
+// sameSquad reports if two feeds cover the same squad, or both cover their user's own events.
+func sameSquad (a, b db.CalendarFeed) bool {
+    if a.SquadID == nil || b.SquadID == nil {
+        return a.SquadID == nil && b.SquadID == nil
+    }
+
+    return *a.SquadID == *b.SquadID
+}
+
+func (s *MemoryFeedStore) Create (c context.Context, feed *db.CalendarFeed) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    now := time.Now()
+    for id, other := range s.feeds {
+        if other.DeletedAt == nil && other.UserID == feed.UserID && sameSquad(other, *feed) {
+            other.DeletedAt = &now
+            s.feeds[id] = other
+        }
+    }
+
+    feed.ID = s.nextId
+    feed.CreatedAt = now
+    feed.UpdatedAt = now
+    s.nextId++
+
+    s.feeds[feed.ID] = *feed
+
+    return nil
+}
+
+func (s *MemoryFeedStore) FindById (c context.Context, id int) (*db.CalendarFeed, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    feed, ok := s.feeds[id]
+    if ok == false || feed.DeletedAt != nil {
+        return nil, ErrNotFound
+    }
+
+    return &feed, nil
+}
+
+func (s *MemoryFeedStore) FindByUser (c context.Context, userId int) ([]db.CalendarFeed, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    var feeds []db.CalendarFeed
+    for _, feed := range s.feeds {
+        if feed.DeletedAt == nil && feed.UserID == userId {
+            feeds = append(feeds, feed)
+        }
+    }
+
+    sort.Sort(feedsById(feeds))
+
+    return feeds, nil
+}
+
+func (s *MemoryFeedStore) Delete (c context.Context, id int) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    feed, ok := s.feeds[id]
+    if ok == false || feed.DeletedAt != nil {
+        return ErrNotFound
+    }
+
+    now := time.Now()
+    feed.DeletedAt = &now
+    s.feeds[id] = feed
+
+    return nil
+}
+
+func (s *MemoryFeedStore) DeleteByUser (c context.Context, userId int) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    for id, feed := range s.feeds {
+        if feed.UserID == userId {
+            delete(s.feeds, id)
+        }
+    }
+
+    return nil
+}
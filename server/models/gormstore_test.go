@@ -0,0 +1,81 @@
+package models
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Noah-Huppert/squad-up/server/models/db"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/stretchr/testify/assert"
+)
+
+// openTestDB opens an empty in-memory sqlite database with the provided tables.
+func openTestDB(t *testing.T, tables ...interface{}) *gorm.DB {
+	gdb, err := gorm.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("error opening test database: %s", err)
+	}
+
+	if err := gdb.AutoMigrate(tables...).Error; err != nil {
+		t.Fatalf("error migrating test database: %s", err)
+	}
+
+	return gdb
+}
+
+func TestGormStores_UpdateIfUnmodified(t *testing.T) {
+	a := assert.New(t)
+	c := context.Background()
+	gdb := openTestDB(t, &db.User{}, &db.Squad{}, &db.SquadMembership{}, &db.Event{})
+	defer gdb.Close()
+
+	users := NewGormUserStore(gdb)
+	user := &db.User{GoogleID: "123", FirstName: "Jane"}
+	a.Nil(users.Create(c, user))
+
+	stale, err := users.FindById(c, user.ID)
+	a.Nil(err)
+	fresh := *stale
+	fresh.FirstName = "Janet"
+	a.Nil(users.UpdateIfUnmodified(c, &fresh))
+
+	// The stale copy is rejected instead of overwriting, or creating, a row
+	stale.LastName = "Doe"
+	a.Equal(ErrModified, users.UpdateIfUnmodified(c, stale))
+	a.Equal("Doe", stale.LastName)
+
+	found, err := users.FindById(c, user.ID)
+	a.Nil(err)
+	a.Equal("Janet", found.FirstName)
+	a.Empty(found.LastName)
+
+	// Zero values are saved too
+	found.FirstName = ""
+	a.Nil(users.UpdateIfUnmodified(c, found))
+	found, err = users.FindById(c, user.ID)
+	a.Nil(err)
+	a.Empty(found.FirstName)
+
+	squads := NewGormSquadStore(gdb)
+	squad := &db.Squad{Name: "Hikers", OwnerID: user.ID}
+	a.Nil(squads.Create(c, squad))
+	staleSquad := *squad
+	squad.Name = "Climbers"
+	a.Nil(squads.UpdateIfUnmodified(c, squad))
+	a.Equal(ErrModified, squads.UpdateIfUnmodified(c, &staleSquad))
+
+	events := NewGormEventStore(gdb)
+	event := &db.Event{Title: "Hike", CreatorID: user.ID}
+	a.Nil(events.Create(c, event))
+	staleEvent := *event
+	event.Title = "Climb"
+	a.Nil(events.UpdateIfUnmodified(c, event))
+	a.Equal(1, event.Sequence)
+	a.Equal(ErrModified, events.UpdateIfUnmodified(c, &staleEvent))
+	a.Equal(0, staleEvent.Sequence)
+
+	var count int
+	a.Nil(gdb.Model(&db.Event{}).Count(&count).Error)
+	a.Equal(1, count)
+}
@@ -40,6 +40,6 @@ func (r *HTTPResponse) Serve(w http.ResponseWriter) error {
 }
 
 func (r *HTTPResponse) WithError(id, message string, code int) *HTTPResponse {
-	r.Error = &APIError{id, message, code}
+	r.Error = &APIError{Id: id, Message: message, HTTPCode: code}
 	return r
 }
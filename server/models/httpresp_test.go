@@ -45,7 +45,7 @@ func TestHTTPResponse_Serve(t *testing.T) {
 	}
 
 	// Make a test error to use
-	testErr := APIError{"testerr", "msg", http.StatusInternalServerError}
+	testErr := APIError{Id: "testerr", Message: "msg", HTTPCode: http.StatusInternalServerError}
 
 	// Make test matrix
 	matrix := []MatrixItem{
@@ -0,0 +1,145 @@
+package models
+
+import (
+    "context"
+    "sync"
+    "time"
+
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+
+    "github.com/jinzhu/gorm"
+)
+
+// IdempotencyStore saves the responses to requests made with an Idempotency-Key header.
+type IdempotencyStore interface {
+    // Claim saves a new pending record for a (user, key, route), setting its ID. If a record already exists for them
+    // it is returned instead and nothing is saved. Only one concurrent caller can claim a key.
+    Claim (c context.Context, rec *db.IdempotencyRecord) (*db.IdempotencyRecord, error)
+    // Complete saves the response stored in a claimed record
+    Complete (c context.Context, rec *db.IdempotencyRecord) error
+    // Delete removes a record, freeing its key
+    Delete (c context.Context, rec *db.IdempotencyRecord) error
+    // PurgeBefore removes all records created before the provided time
+    PurgeBefore (c context.Context, cutoff time.Time) error
+}
+
+// GormIdempotencyStore is an IdempotencyStore which uses a gorm database. Relies on the unique index over
+// (user_id, key, route) to make sure only one request can claim a key.
+type GormIdempotencyStore struct {
+    db *gorm.DB
+}
+
+// NewGormIdempotencyStore creates a GormIdempotencyStore.
+func NewGormIdempotencyStore (db *gorm.DB) *GormIdempotencyStore {
+    return &GormIdempotencyStore{db}
+}
+
+func (s *GormIdempotencyStore) Claim (c context.Context, rec *db.IdempotencyRecord) (*db.IdempotencyRecord, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    err := s.db.Create(rec).Error
+    if err == nil {
+        return nil, nil
+    }
+
+    // Insert failed, most likely because a record already exists for this key
+    var existing db.IdempotencyRecord
+    if s.db.Where("user_id = ? AND key = ? AND route = ?", rec.UserID, rec.Key, rec.Route).First(&existing).RecordNotFound() {
+        return nil, err
+    }
+
+    return &existing, nil
+}
+
+func (s *GormIdempotencyStore) Complete (c context.Context, rec *db.IdempotencyRecord) error {
+    // Response was already sent, save it even if the client disconnected
+    return s.db.Save(rec).Error
+}
+
+func (s *GormIdempotencyStore) Delete (c context.Context, rec *db.IdempotencyRecord) error {
+    return s.db.Unscoped().Delete(rec).Error
+}
+
+func (s *GormIdempotencyStore) PurgeBefore (c context.Context, cutoff time.Time) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    return s.db.Unscoped().Where("created_at < ?", cutoff).Delete(&db.IdempotencyRecord{}).Error
+}
+
+// MemoryIdempotencyStore is an IdempotencyStore which keeps records in memory. Used by tests.
+type MemoryIdempotencyStore struct {
+    mu sync.Mutex
+    records map[[3]interface{}]db.IdempotencyRecord
+    nextId int
+}
+
+// NewMemoryIdempotencyStore creates an empty MemoryIdempotencyStore.
+func NewMemoryIdempotencyStore () *MemoryIdempotencyStore {
+    return &MemoryIdempotencyStore{records: make(map[[3]interface{}]db.IdempotencyRecord), nextId: 1}
+}
+
+// idempotencyKey returns the key records are unique by.
+func idempotencyKey (rec *db.IdempotencyRecord) [3]interface{} {
+    return [3]interface{}{rec.UserID, rec.Key, rec.Route}
+}
+
+func (s *MemoryIdempotencyStore) Claim (c context.Context, rec *db.IdempotencyRecord) (*db.IdempotencyRecord, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if existing, ok := s.records[idempotencyKey(rec)]; ok {
+        return &existing, nil
+    }
+
+    rec.ID = s.nextId
+    rec.CreatedAt = time.Now()
+    s.nextId++
+
+    s.records[idempotencyKey(rec)] = *rec
+
+    return nil, nil
+}
+
+func (s *MemoryIdempotencyStore) Complete (c context.Context, rec *db.IdempotencyRecord) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    s.records[idempotencyKey(rec)] = *rec
+
+    return nil
+}
+
+func (s *MemoryIdempotencyStore) Delete (c context.Context, rec *db.IdempotencyRecord) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    // Deleted by ID like GormIdempotencyStore, so a newer record claimed with the same key is kept
+    for key, saved := range s.records {
+        if saved.ID == rec.ID {
+            delete(s.records, key)
+        }
+    }
+
+    return nil
+}
+
+func (s *MemoryIdempotencyStore) PurgeBefore (c context.Context, cutoff time.Time) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    for key, rec := range s.records {
+        if rec.CreatedAt.Before(cutoff) {
+            delete(s.records, key)
+        }
+    }
+
+    return nil
+}
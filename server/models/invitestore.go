@@ -0,0 +1,291 @@
+package models
+
+import (
+    "context"
+    "sync"
+    "time"
+
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+
+    "github.com/jinzhu/gorm"
+)
+
+// Relations of invites which InviteStore methods can load, by their gorm association name
+const (
+    // db.SquadInvite.Squad
+    ExpandInviteSquad = "Squad"
+    // db.SquadInvite.CreatedBy
+    ExpandInviteCreatedBy = "CreatedBy"
+)
+
+// InviteStore loads and saves squad invites.
+type InviteStore interface {
+    // Create saves a new invite, setting its ID
+    Create (c context.Context, invite *db.SquadInvite) error
+    // FindById returns the invite with the provided id. Returns ErrNotFound if no such invite exists.
+    FindById (c context.Context, id int, expand ...string) (*db.SquadInvite, error)
+    // FindUsable returns a squad's invites which can still be accepted at the provided time, newest first
+    FindUsable (c context.Context, squadId int, now time.Time, expand ...string) ([]db.SquadInvite, error)
+    // Update saves changes to an existing invite
+    Update (c context.Context, invite *db.SquadInvite) error
+    // Use records that an invite was accepted. Returns ErrNotFound if the invite can no longer be accepted at the
+    // provided time. Only MaxUses concurrent callers can use an invite.
+    Use (c context.Context, id int, now time.Time) error
+    // FindByCreator returns the invites a user created, oldest first
+    FindByCreator (c context.Context, userId int) ([]db.SquadInvite, error)
+    // DeleteByCreator permanently deletes the invites a user created
+    DeleteByCreator (c context.Context, userId int) error
+}
+
+// GormInviteStore is an InviteStore which uses a gorm database.
+type GormInviteStore struct {
+    db *gorm.DB
+}
+
+// NewGormInviteStore creates a GormInviteStore.
+func NewGormInviteStore (db *gorm.DB) *GormInviteStore {
+    return &GormInviteStore{db}
+}
+
+func (s *GormInviteStore) Create (c context.Context, invite *db.SquadInvite) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    return s.db.Create(invite).Error
+}
+
+func (s *GormInviteStore) FindById (c context.Context, id int, expand ...string) (*db.SquadInvite, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    var invite db.SquadInvite
+    q := preloadAll(s.db, expand).Where("id = ?", id).First(&invite)
+    if q.RecordNotFound() {
+        return nil, ErrNotFound
+    } else if q.Error != nil {
+        return nil, q.Error
+    }
+
+    return &invite, nil
+}
+
+func (s *GormInviteStore) FindUsable (c context.Context, squadId int, now time.Time, expand ...string) ([]db.SquadInvite, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    var invites []db.SquadInvite
+    err := preloadAll(s.db, expand).
+        Where("squad_id = ? AND revoked_at IS NULL AND expires_at > ? AND (max_uses = 0 OR uses < max_uses)", squadId, now).
+        Order("id DESC").
+        Find(&invites).Error
+
+    return invites, err
+}
+
+func (s *GormInviteStore) Update (c context.Context, invite *db.SquadInvite) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    return s.db.Set("gorm:save_associations", false).Save(invite).Error
+}
+
+func (s *GormInviteStore) Use (c context.Context, id int, now time.Time) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    // Conditional update so concurrent accepts can not exceed max uses
+    q := s.db.Model(&db.SquadInvite{}).
+        Where("id = ? AND revoked_at IS NULL AND expires_at > ? AND (max_uses = 0 OR uses < max_uses)", id, now).
+        UpdateColumn("uses", gorm.Expr("uses + 1"))
+    if q.Error == nil && q.RowsAffected == 0 {
+        return ErrNotFound
+    }
+
+    return q.Error
+}
+
+func (s *GormInviteStore) FindByCreator (c context.Context, userId int) ([]db.SquadInvite, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    var invites []db.SquadInvite
+    err := s.db.Where("created_by_id = ?", userId).Order("id").Find(&invites).Error
+
+    return invites, err
+}
+
+func (s *GormInviteStore) DeleteByCreator (c context.Context, userId int) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    return s.db.Unscoped().Where("created_by_id = ?", userId).Delete(&db.SquadInvite{}).Error
+}
+
+// MemoryInviteStore is an InviteStore which keeps invites in memory. Used by tests.
+type MemoryInviteStore struct {
+    mu sync.Mutex
+    // Used to load the Squad and CreatedBy relations
+    squads SquadStore
+    users UserStore
+    invites map[int]db.SquadInvite
+    nextId int
+}
+
+// NewMemoryInviteStore creates an empty MemoryInviteStore which loads relations from the provided stores.
+func NewMemoryInviteStore (squads SquadStore, users UserStore) *MemoryInviteStore {
+    return &MemoryInviteStore{squads: squads, users: users, invites: make(map[int]db.SquadInvite), nextId: 1}
+}
+
+// expand loads an invite's requested relations.
+func (s *MemoryInviteStore) expand (invite db.SquadInvite, expand []string) db.SquadInvite {
+    if hasExpand(expand, ExpandInviteSquad) {
+        invite.Squad, _ = s.squads.FindById(context.Background(), invite.SquadID)
+    }
+
+    if hasExpand(expand, ExpandInviteCreatedBy) {
+        invite.CreatedBy, _ = s.users.FindById(context.Background(), invite.CreatedByID)
+    }
+
+    return invite
+}
+
+func (s *MemoryInviteStore) Create (c context.Context, invite *db.SquadInvite) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    now := time.Now()
+    invite.ID = s.nextId
+    invite.CreatedAt = now
+    invite.UpdatedAt = now
+    s.nextId++
+
+    s.invites[invite.ID] = *invite
+
+    return nil
+}
+
+func (s *MemoryInviteStore) FindById (c context.Context, id int, expand ...string) (*db.SquadInvite, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    s.mu.Lock()
+    invite, ok := s.invites[id]
+    s.mu.Unlock()
+
+    if ok == false {
+        return nil, ErrNotFound
+    }
+
+    invite = s.expand(invite, expand)
+
+    return &invite, nil
+}
+
+func (s *MemoryInviteStore) FindUsable (c context.Context, squadId int, now time.Time, expand ...string) ([]db.SquadInvite, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    s.mu.Lock()
+    var invites []db.SquadInvite
+    for id := s.nextId - 1; id > 0; id-- {
+        if invite, ok := s.invites[id]; ok && invite.SquadID == squadId && invite.Usable(now) {
+            invites = append(invites, invite)
+        }
+    }
+    s.mu.Unlock()
+
+    for i := range invites {
+        invites[i] = s.expand(invites[i], expand)
+    }
+
+    return invites, nil
+}
+
+func (s *MemoryInviteStore) Update (c context.Context, invite *db.SquadInvite) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if _, ok := s.invites[invite.ID]; ok == false {
+        return ErrNotFound
+    }
+
+    invite.UpdatedAt = time.Now()
+
+    saved := *invite
+    saved.Squad = nil
+    saved.CreatedBy = nil
+    s.invites[invite.ID] = saved
+
+    return nil
+}
+
+func (s *MemoryInviteStore) Use (c context.Context, id int, now time.Time) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    invite, ok := s.invites[id]
+    if ok == false || invite.Usable(now) == false {
+        return ErrNotFound
+    }
+
+    invite.Uses++
+    s.invites[id] = invite
+
+    return nil
+}
+
+func (s *MemoryInviteStore) FindByCreator (c context.Context, userId int) ([]db.SquadInvite, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    var invites []db.SquadInvite
+    for id := 1; id < s.nextId; id++ {
+        if invite, ok := s.invites[id]; ok && invite.CreatedByID == userId {
+            invites = append(invites, invite)
+        }
+    }
+
+    return invites, nil
+}
+
+func (s *MemoryInviteStore) DeleteByCreator (c context.Context, userId int) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    for id, invite := range s.invites {
+        if invite.CreatedByID == userId {
+            delete(s.invites, id)
+        }
+    }
+
+    return nil
+}
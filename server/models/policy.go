@@ -0,0 +1,103 @@
+package models
+
+import "github.com/Noah-Huppert/squad-up/server/models/db"
+
+// Permission is an action users may be allowed to take in a squad.
+type Permission string
+
+// Permissions which roles can be granted
+const (
+    // See the squad's members
+    PermViewMembers Permission = "view_members"
+    // Edit the squad's details and avatar
+    PermEditSquad Permission = "edit_squad"
+    // Archive and unarchive the squad
+    PermArchiveSquad Permission = "archive_squad"
+    // Create, list and revoke invites
+    PermInviteMembers Permission = "invite_members"
+    // Remove other members
+    PermRemoveMembers Permission = "remove_members"
+    // Change the roles of other members
+    PermManageRoles Permission = "manage_roles"
+    // Make another member the owner
+    PermTransferOwnership Permission = "transfer_ownership"
+    // Create events, and edit events one created
+    PermCreateEvents Permission = "create_events"
+    // Edit and cancel any event
+    PermManageEvents Permission = "manage_events"
+    // Respond to events
+    PermRSVP Permission = "rsvp"
+)
+
+// Roles ordered from most to least privileged
+var Roles = []string{
+    db.SquadRoleOwner,
+    db.SquadRoleAdmin,
+    db.SquadRoleOrganizer,
+    db.SquadRoleMember,
+    db.SquadRoleGuest,
+}
+
+// Policy holds the permissions granted to each squad role. Users who are not members of a squad have no permissions
+// in it, they can only view public squads.
+type Policy map[string][]Permission
+
+// DefaultPolicy is the Policy used if Config.Policy is nil.
+var DefaultPolicy = Policy{
+    db.SquadRoleOwner: {
+        PermViewMembers, PermEditSquad, PermArchiveSquad, PermInviteMembers, PermRemoveMembers, PermManageRoles,
+        PermTransferOwnership, PermCreateEvents, PermManageEvents, PermRSVP,
+    },
+    db.SquadRoleAdmin: {
+        PermViewMembers, PermEditSquad, PermInviteMembers, PermRemoveMembers, PermManageRoles, PermCreateEvents,
+        PermManageEvents, PermRSVP,
+    },
+    db.SquadRoleOrganizer: {PermViewMembers, PermCreateEvents, PermRSVP},
+    db.SquadRoleMember: {PermViewMembers, PermRSVP},
+    db.SquadRoleGuest: {PermRSVP},
+}
+
+// Allows reports if a role has a permission.
+func (p Policy) Allows (role string, perm Permission) bool {
+    for _, granted := range p[role] {
+        if granted == perm {
+            return true
+        }
+    }
+
+    return false
+}
+
+// Check returns an ErrPermissionDenied error if a role does not have a permission.
+func (p Policy) Check (role string, perm Permission) *APIError {
+    if p.Allows(role, perm) == false {
+        return ErrPermissionDenied.New(string(perm))
+    }
+
+    return nil
+}
+
+// ValidRole reports if a role is one of the Roles.
+func ValidRole (role string) bool {
+    return RoleRank(role) >= 0
+}
+
+// RoleRank returns how privileged a role is, higher ranks are more privileged. Returns -1 for users who are not
+// members, or unknown roles.
+func RoleRank (role string) int {
+    for i, r := range Roles {
+        if r == role {
+            return len(Roles) - 1 - i
+        }
+    }
+
+    return -1
+}
+
+// CanAssignRole reports if a member with a role can give other members the assigned role, or change the role of a
+// member who has it. Members can only manage roles less privileged than their own, no one can assign the owner role
+// except by transferring ownership.
+func (p Policy) CanAssignRole (role, assigned string) bool {
+    return p.Allows(role, PermManageRoles) && assigned != db.SquadRoleOwner && ValidRole(assigned) &&
+        RoleRank(assigned) < RoleRank(role)
+}
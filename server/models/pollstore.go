@@ -0,0 +1,514 @@
+package models
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "sort"
+    "sync"
+    "time"
+
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+    "github.com/Noah-Huppert/squad-up/server/voting"
+
+    "github.com/jinzhu/gorm"
+)
+
+// ErrVotingClosed is returned by PollStore.Vote if the poll was closed, or its deadline passed.
+var ErrVotingClosed = errors.New("poll is closed")
+
+// PollFilter selects the polls attached to a squad or an event.
+type PollFilter struct {
+    // Select polls of this squad, if not 0
+    SquadID int
+    // Select polls of this event, if not 0
+    EventID int
+}
+
+// matches reports if a poll is selected by the filter.
+func (f PollFilter) matches (poll db.Poll) bool {
+    return (f.SquadID != 0 && poll.SquadID != nil && *poll.SquadID == f.SquadID) ||
+        (f.EventID != 0 && poll.EventID != nil && *poll.EventID == f.EventID)
+}
+
+// votesByBallot sorts votes by user, then by their rank on the user's ballot.
+type votesByBallot []db.PollVote
+
+func (l votesByBallot) Len () int { return len(l) }
+func (l votesByBallot) Swap (i, j int) { l[i], l[j] = l[j], l[i] }
+func (l votesByBallot) Less (i, j int) bool {
+    if l[i].UserID != l[j].UserID {
+        return l[i].UserID < l[j].UserID
+    }
+
+    return l[i].Rank < l[j].Rank
+}
+
+// CountPoll counts a poll's ballots, made of the provided votes.
+func CountPoll (poll db.Poll, votes []db.PollVote) (voting.Result, error) {
+    options := make([]int, len(poll.Options))
+    for i, option := range poll.Options {
+        options[i] = option.ID
+    }
+
+    sorted := append([]db.PollVote{}, votes...)
+    sort.Sort(votesByBallot(sorted))
+
+    var ballots []voting.Ballot
+    for i, vote := range sorted {
+        if i == 0 || vote.UserID != sorted[i - 1].UserID {
+            ballots = append(ballots, voting.Ballot{Scores: make(map[int]int)})
+        }
+
+        ballot := &ballots[len(ballots) - 1]
+        ballot.Choices = append(ballot.Choices, vote.OptionID)
+        ballot.Scores[vote.OptionID] = vote.Score
+    }
+
+    return voting.Count(voting.Method(poll.Method), options, ballots)
+}
+
+// PollStore loads and saves polls and their votes.
+type PollStore interface {
+    // Create saves a new poll and its options, setting their IDs
+    Create (c context.Context, poll *db.Poll) error
+    // FindById returns the poll with the provided id and its options. Returns ErrNotFound if no such poll exists.
+    FindById (c context.Context, id int) (*db.Poll, error)
+    // Find returns the polls selected by a filter and their options, newest first
+    Find (c context.Context, filter PollFilter) ([]db.Poll, error)
+    // Update saves changes to a poll, but not its options
+    Update (c context.Context, poll *db.Poll) error
+    // Delete soft deletes a poll
+    Delete (c context.Context, id int) error
+    // FindVotes returns the votes of a poll
+    FindVotes (c context.Context, pollId int) ([]db.PollVote, error)
+    // Vote replaces a user's ballot in a poll. Returns ErrVotingClosed if the poll is closed.
+    Vote (c context.Context, pollId, userId int, votes []db.PollVote) error
+    // FindVotesByUser returns a user's votes in all polls
+    FindVotesByUser (c context.Context, userId int) ([]db.PollVote, error)
+    // DeleteVotesByUser permanently deletes a user's votes in all polls, including closed and deleted ones
+    DeleteVotesByUser (c context.Context, userId int) error
+}
+
+// optionsByPosition sorts options in the order they are listed.
+type optionsByPosition []db.PollOption
+
+func (l optionsByPosition) Len () int { return len(l) }
+func (l optionsByPosition) Swap (i, j int) { l[i], l[j] = l[j], l[i] }
+func (l optionsByPosition) Less (i, j int) bool { return l[i].Position < l[j].Position }
+
+// GormPollStore is a PollStore which uses a gorm database. Votes lock their poll's row so they can not be saved after
+// the poll is closed.
+type GormPollStore struct {
+    db *gorm.DB
+}
+
+// NewGormPollStore creates a GormPollStore.
+func NewGormPollStore (db *gorm.DB) *GormPollStore {
+    return &GormPollStore{db}
+}
+
+func (s *GormPollStore) Create (c context.Context, poll *db.Poll) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    return inTransaction(s.db, func (tx *gorm.DB) error {
+        if err := tx.Set("gorm:save_associations", false).Create(poll).Error; err != nil {
+            return err
+        }
+
+        for i := range poll.Options {
+            poll.Options[i].PollID = poll.ID
+            if err := tx.Create(&poll.Options[i]).Error; err != nil {
+                return err
+            }
+        }
+
+        return nil
+    })
+}
+
+// loadOptions loads the options of polls.
+func (s *GormPollStore) loadOptions (polls []db.Poll) error {
+    if len(polls) == 0 {
+        return nil
+    }
+
+    index := make(map[int]int)
+    var ids []int
+    for i, poll := range polls {
+        index[poll.ID] = i
+        ids = append(ids, poll.ID)
+        polls[i].Options = []db.PollOption{}
+    }
+
+    var options []db.PollOption
+    if err := s.db.Where("poll_id IN (?)", ids).Order("position").Find(&options).Error; err != nil {
+        return err
+    }
+
+    for _, option := range options {
+        poll := &polls[index[option.PollID]]
+        poll.Options = append(poll.Options, option)
+    }
+
+    return nil
+}
+
+func (s *GormPollStore) FindById (c context.Context, id int) (*db.Poll, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    var poll db.Poll
+    q := s.db.Where("id = ?", id).First(&poll)
+    if q.RecordNotFound() {
+        return nil, ErrNotFound
+    } else if q.Error != nil {
+        return nil, q.Error
+    }
+
+    polls := []db.Poll{poll}
+    if err := s.loadOptions(polls); err != nil {
+        return nil, err
+    }
+
+    return &polls[0], nil
+}
+
+func (s *GormPollStore) Find (c context.Context, filter PollFilter) ([]db.Poll, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    q := s.db
+    switch {
+    case filter.SquadID != 0 && filter.EventID != 0:
+        q = q.Where("squad_id = ? OR event_id = ?", filter.SquadID, filter.EventID)
+    case filter.SquadID != 0:
+        q = q.Where("squad_id = ?", filter.SquadID)
+    case filter.EventID != 0:
+        q = q.Where("event_id = ?", filter.EventID)
+    default:
+        return nil, nil
+    }
+
+    var polls []db.Poll
+    if err := q.Order("created_at DESC, id DESC").Find(&polls).Error; err != nil {
+        return nil, err
+    }
+
+    return polls, s.loadOptions(polls)
+}
+
+func (s *GormPollStore) Update (c context.Context, poll *db.Poll) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    return s.db.Set("gorm:save_associations", false).Save(poll).Error
+}
+
+func (s *GormPollStore) Delete (c context.Context, id int) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    return s.db.Where("id = ?", id).Delete(&db.Poll{}).Error
+}
+
+func (s *GormPollStore) FindVotes (c context.Context, pollId int) ([]db.PollVote, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    var votes []db.PollVote
+    err := s.db.Where("poll_id = ?", pollId).Order("user_id, rank").Find(&votes).Error
+
+    return votes, err
+}
+
+func (s *GormPollStore) Vote (c context.Context, pollId, userId int, votes []db.PollVote) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    return inTransaction(s.db, func (tx *gorm.DB) error {
+        var poll db.Poll
+        row := tx.Raw("SELECT closes_at, closed_at FROM polls WHERE id = ? AND deleted_at IS NULL FOR UPDATE", pollId).Row()
+        if err := row.Scan(&poll.ClosesAt, &poll.ClosedAt); err == sql.ErrNoRows {
+            return ErrNotFound
+        } else if err != nil {
+            return err
+        } else if poll.Closed(time.Now()) {
+            return ErrVotingClosed
+        }
+
+        // Votes are replaced, not soft deleted, so the unique index allows new ones
+        err := tx.Unscoped().Where("poll_id = ? AND user_id = ?", pollId, userId).Delete(&db.PollVote{}).Error
+        if err != nil {
+            return err
+        }
+
+        for i := range votes {
+            votes[i].PollID, votes[i].UserID = pollId, userId
+            if err := tx.Create(&votes[i]).Error; err != nil {
+                return err
+            }
+        }
+
+        return nil
+    })
+}
+
+func (s *GormPollStore) FindVotesByUser (c context.Context, userId int) ([]db.PollVote, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    var votes []db.PollVote
+    err := s.db.Where("user_id = ?", userId).Order("poll_id, rank").Find(&votes).Error
+
+    return votes, err
+}
+
+func (s *GormPollStore) DeleteVotesByUser (c context.Context, userId int) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    return s.db.Unscoped().Where("user_id = ?", userId).Delete(&db.PollVote{}).Error
+}
+
+// MemoryPollStore is a PollStore which keeps polls in memory. Used by tests.
+type MemoryPollStore struct {
+    mu sync.Mutex
+    polls map[int]db.Poll
+    votes []db.PollVote
+    nextId int
+}
+
+// NewMemoryPollStore creates an empty MemoryPollStore.
+func NewMemoryPollStore () *MemoryPollStore {
+    return &MemoryPollStore{polls: make(map[int]db.Poll), nextId: 1}
+}
+
+// pollsNewestFirst sorts polls like GormPollStore.Find.
+type pollsNewestFirst []db.Poll
+
+func (l pollsNewestFirst) Len () int { return len(l) }
+func (l pollsNewestFirst) Swap (i, j int) { l[i], l[j] = l[j], l[i] }
+func (l pollsNewestFirst) Less (i, j int) bool {
+    if l[i].CreatedAt.Equal(l[j].CreatedAt) {
+        return l[i].ID > l[j].ID
+    }
+
+    return l[i].CreatedAt.After(l[j].CreatedAt)
+}
+
+// copyOptions returns a copy of a poll which does not share its options.
+func copyOptions (poll db.Poll) db.Poll {
+    poll.Options = append([]db.PollOption{}, poll.Options...)
+
+    return poll
+}
+
+func (s *MemoryPollStore) Create (c context.Context, poll *db.Poll) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    now := time.Now()
+    poll.ID = s.nextId
+    poll.CreatedAt = now
+    poll.UpdatedAt = now
+    s.nextId++
+
+    for i := range poll.Options {
+        poll.Options[i].ID = s.nextId
+        poll.Options[i].PollID = poll.ID
+        s.nextId++
+    }
+
+    sort.Sort(optionsByPosition(poll.Options))
+    s.polls[poll.ID] = copyOptions(*poll)
+
+    return nil
+}
+
+func (s *MemoryPollStore) FindById (c context.Context, id int) (*db.Poll, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    poll, ok := s.polls[id]
+    if ok == false || poll.DeletedAt != nil {
+        return nil, ErrNotFound
+    }
+
+    poll = copyOptions(poll)
+
+    return &poll, nil
+}
+
+func (s *MemoryPollStore) Find (c context.Context, filter PollFilter) ([]db.Poll, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    var polls []db.Poll
+    for _, poll := range s.polls {
+        if poll.DeletedAt == nil && filter.matches(poll) {
+            polls = append(polls, copyOptions(poll))
+        }
+    }
+
+    sort.Sort(pollsNewestFirst(polls))
+
+    return polls, nil
+}
+
+func (s *MemoryPollStore) Update (c context.Context, poll *db.Poll) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    saved, ok := s.polls[poll.ID]
+    if ok == false || saved.DeletedAt != nil {
+        return ErrNotFound
+    }
+
+    updated := copyOptions(*poll)
+    updated.Options = saved.Options
+    updated.UpdatedAt = time.Now()
+    poll.UpdatedAt = updated.UpdatedAt
+    s.polls[poll.ID] = updated
+
+    return nil
+}
+
+func (s *MemoryPollStore) Delete (c context.Context, id int) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    poll, ok := s.polls[id]
+    if ok == false || poll.DeletedAt != nil {
+        return ErrNotFound
+    }
+
+    now := time.Now()
+    poll.DeletedAt = &now
+    s.polls[id] = poll
+
+    return nil
+}
+
+func (s *MemoryPollStore) FindVotes (c context.Context, pollId int) ([]db.PollVote, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    var votes []db.PollVote
+    for _, vote := range s.votes {
+        if vote.PollID == pollId {
+            votes = append(votes, vote)
+        }
+    }
+
+    sort.Sort(votesByBallot(votes))
+
+    return votes, nil
+}
+
+func (s *MemoryPollStore) Vote (c context.Context, pollId, userId int, votes []db.PollVote) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    poll, ok := s.polls[pollId]
+    if ok == false || poll.DeletedAt != nil {
+        return ErrNotFound
+    } else if poll.Closed(time.Now()) {
+        return ErrVotingClosed
+    }
+
+    kept := s.votes[:0]
+    for _, vote := range s.votes {
+        if vote.PollID != pollId || vote.UserID != userId {
+            kept = append(kept, vote)
+        }
+    }
+    s.votes = kept
+
+    now := time.Now()
+    for i := range votes {
+        votes[i].ID = s.nextId
+        votes[i].PollID, votes[i].UserID = pollId, userId
+        votes[i].CreatedAt, votes[i].UpdatedAt = now, now
+        s.nextId++
+
+        s.votes = append(s.votes, votes[i])
+    }
+
+    return nil
+}
+
+func (s *MemoryPollStore) FindVotesByUser (c context.Context, userId int) ([]db.PollVote, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    var votes []db.PollVote
+    for _, vote := range s.votes {
+        if vote.UserID == userId {
+            votes = append(votes, vote)
+        }
+    }
+
+    return votes, nil
+}
+
+func (s *MemoryPollStore) DeleteVotesByUser (c context.Context, userId int) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    kept := s.votes[:0]
+    for _, vote := range s.votes {
+        if vote.UserID != userId {
+            kept = append(kept, vote)
+        }
+    }
+    s.votes = kept
+
+    return nil
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+    "encoding/json"
+    "net/http"
+)
+
+// Media type of RFC 7807 problem details.
+const ProblemContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details object. Served instead of the usual {"error": APIError} response to clients
+// which ask for ProblemContentType in their Accept header.
+type Problem struct {
+    // URI which identifies the problem type, the error's documentation
+    Type string `json:"type"`
+    // Short summary of problem type
+    Title string `json:"title"`
+    // HTTP status code
+    Status int `json:"status"`
+    // Explanation specific to this occurrence of the problem
+    Detail string `json:"detail"`
+    // URI of request the problem occurred in
+    Instance string `json:"instance,omitempty"`
+
+    // Extension members
+    // Stable error id, same as APIError.Id
+    Id string `json:"id"`
+}
+
+// NewProblem converts an APIError into problem details. instance is the URI of the request the error occurred in.
+func NewProblem (e *APIError, instance string) Problem {
+    problemType := e.DocsURL
+    if problemType == "" {
+        problemType = "about:blank"
+    }
+
+    title := http.StatusText(e.HTTPCode)
+    if title == "" {
+        title = e.Id
+    }
+
+    return Problem{
+        Type: problemType,
+        Title: title,
+        Status: e.HTTPCode,
+        Detail: e.Message,
+        Instance: instance,
+        Id: e.Id,
+    }
+}
+
+// Problem details form of APIErrorErrorMarshallingHTTPResponse, served by the same code path as
+// APIErrorManualMarshalledErrorMarshallingHTTPResponse.
+var ProblemManualMarshalledErrorMarshallingHTTPResponse = mustMarshal(NewProblem(APIErrorErrorMarshallingHTTPResponse, ""))
+
+// mustMarshal encodes a value made only of strings and numbers as JSON. Panics if the value can not be encoded, which
+// can only happen if a programmer passes a value with an unsupported type.
+func mustMarshal (v interface{}) string {
+    bytes, err := json.Marshal(v)
+    if err != nil {
+        panic("failed to marshal JSON: " + err.Error())
+    }
+
+    return string(bytes)
+}
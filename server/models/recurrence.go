@@ -0,0 +1,151 @@
+package models
+
+import (
+    "sort"
+    "time"
+
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+    "github.com/Noah-Huppert/squad-up/server/recur"
+)
+
+// SeriesRule parses a recurring event's rule and the time zone it repeats in.
+func SeriesRule (series db.Event) (recur.Rule, *time.Location, error) {
+    rule, err := recur.Parse(series.RRule)
+    if err != nil {
+        return rule, nil, err
+    }
+
+    loc, err := time.LoadLocation(series.Timezone)
+
+    return rule, loc, err
+}
+
+// SetRecursUntil sets the time an event's last occurrence ends. Must be called when the times or rule of a recurring
+// event change.
+func SetRecursUntil (event *db.Event) error {
+    event.RecursUntil = nil
+    if event.Recurring() == false {
+        return nil
+    }
+
+    rule, loc, err := SeriesRule(*event)
+    if err != nil {
+        return err
+    }
+
+    if last, ok := rule.Last(event.StartsAt, loc); ok {
+        until := last.Add(event.EndsAt.Sub(event.StartsAt))
+        event.RecursUntil = &until
+    }
+
+    return nil
+}
+
+// Occurrence returns the occurrence of a series which starts at start, as it is before being changed. Occurrences
+// which are not saved have the ID of their series.
+func Occurrence (series db.Event, start time.Time) db.Event {
+    occurrence := series
+    occurrence.StartsAt = start
+    occurrence.EndsAt = start.Add(series.EndsAt.Sub(series.StartsAt))
+    occurrence.RRule = ""
+    occurrence.ExDates = nil
+    occurrence.RecursUntil = nil
+    occurrence.ParentID = &series.ID
+    occurrence.OriginalStartsAt = &start
+
+    return occurrence
+}
+
+// ExpandSeries returns the occurrences of a series which end after from and start before to, at most max of them.
+// Deleted occurrences and ones which were saved, provided as instances, are skipped.
+func ExpandSeries (series db.Event, instances []db.Event, from, to time.Time, max int) ([]db.Event, error) {
+    rule, loc, err := SeriesRule(series)
+    if err != nil {
+        return nil, err
+    }
+
+    saved := make(db.TimeList, 0, len(instances))
+    for _, instance := range instances {
+        saved = append(saved, *instance.OriginalStartsAt)
+    }
+
+    // Occurrences which started before from may still be going on
+    var occurrences []db.Event
+    for _, start := range rule.Between(series.StartsAt, loc, from.Add(series.StartsAt.Sub(series.EndsAt)), to, max) {
+        if series.ExDates.Contains(start) || saved.Contains(start) {
+            continue
+        }
+
+        if occurrence := Occurrence(series, start); occurrence.EndsAt.After(from) {
+            occurrences = append(occurrences, occurrence)
+        }
+    }
+
+    return occurrences, nil
+}
+
+// SplitSeries ends a series before the occurrence which starts at at, and returns a new series made of that
+// occurrence and the ones following it. The new series is not saved.
+func SplitSeries (series *db.Event, at time.Time) (db.Event, error) {
+    rule, loc, err := SeriesRule(*series)
+    if err != nil {
+        return db.Event{}, err
+    }
+
+    following := *series
+    following.TableMetadata = db.TableMetadata{}
+    following.ID = 0
+    following.StartsAt = at
+    following.EndsAt = at.Add(series.EndsAt.Sub(series.StartsAt))
+    following.ExDates = nil
+
+    followingRule := rule
+    if rule.Count > 0 {
+        // Deleted occurrences count towards COUNT, so they are included
+        rule.Count = rule.Index(series.StartsAt, loc, at)
+        followingRule.Count -= rule.Count
+    } else {
+        rule.Until, rule.UntilFloating = at.Add(-time.Second), false
+    }
+
+    series.RRule = rule.String()
+    following.RRule = followingRule.String()
+
+    var before db.TimeList
+    for _, date := range series.ExDates {
+        if date.Before(at) {
+            before = append(before, date)
+        } else {
+            following.ExDates = append(following.ExDates, date)
+        }
+    }
+    series.ExDates = before
+
+    if err := SetRecursUntil(series); err != nil {
+        return following, err
+    }
+
+    return following, SetRecursUntil(&following)
+}
+
+// wallClock returns the local time of t in loc, as if it were a UTC time.
+func wallClock (t time.Time, loc *time.Location) time.Time {
+    l := t.In(loc)
+
+    return time.Date(l.Year(), l.Month(), l.Day(), l.Hour(), l.Minute(), l.Second(), l.Nanosecond(), time.UTC)
+}
+
+// ShiftLocal moves t by as much as an occurrence was moved from from to to, on the wall clock of loc. Moving an
+// occurrence from 7 PM to 8 PM moves the others to 8 PM, even if some are on the other side of a daylight saving
+// time change.
+func ShiftLocal (t time.Time, loc *time.Location, from, to time.Time) time.Time {
+    shifted := wallClock(t, loc).Add(wallClock(to, loc).Sub(wallClock(from, loc)))
+
+    return time.Date(shifted.Year(), shifted.Month(), shifted.Day(), shifted.Hour(), shifted.Minute(), shifted.Second(),
+        shifted.Nanosecond(), loc).UTC()
+}
+
+// SortEvents sorts events by start time, like EventStore.Find.
+func SortEvents (events []db.Event) {
+    sort.Sort(eventsByStart(events))
+}
@@ -0,0 +1,553 @@
+package models
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "sort"
+    "sync"
+    "time"
+
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+
+    "github.com/jinzhu/gorm"
+)
+
+// ErrNoCapacity is returned by RSVPStore.Respond if a user who has a seat at an event adds more plus-ones than there
+// are seats left.
+var ErrNoCapacity = errors.New("not enough seats left")
+
+// Relations of RSVPs which RSVPStore methods can load, by their gorm association name
+const (
+    // db.RSVP.User
+    ExpandRSVPUser = "User"
+    // db.RSVP.Event
+    ExpandRSVPEvent = "Event"
+)
+
+// RSVPStore loads and saves RSVPs. Methods which change RSVPs seat users at the event one at a time, so an event's
+// capacity is never exceeded, and give seats which free up to waitlisted users.
+type RSVPStore interface {
+    // Find returns a user's RSVP to an event. Returns ErrNotFound if they did not respond.
+    Find (c context.Context, eventId, userId int) (*db.RSVP, error)
+    // FindByEvent returns an event's RSVPs, waitlisted RSVPs are last in waitlist order
+    FindByEvent (c context.Context, eventId int, expand ...string) ([]db.RSVP, error)
+    // FindByUser returns a user's RSVPs to all events
+    FindByUser (c context.Context, userId int, expand ...string) ([]db.RSVP, error)
+    // Respond saves a user's RSVP, replacing their previous one. Yes RSVPs are waitlisted if they do not fit. Returns
+    // the RSVPs of other users which were given a seat.
+    Respond (c context.Context, rsvp *db.RSVP) ([]db.RSVP, error)
+    // Remove deletes a user's RSVP. Returns the RSVPs which were given their seats.
+    Remove (c context.Context, eventId, userId int) ([]db.RSVP, error)
+    // Reseat gives seats to waitlisted RSVPs after an event's capacity changed. Returns the RSVPs which were given a
+    // seat.
+    Reseat (c context.Context, eventId int) ([]db.RSVP, error)
+    // DeleteByUser permanently deletes a user's RSVPs to all events, including deleted ones. Seats they had are not
+    // given to waitlisted RSVPs, call Reseat for that.
+    DeleteByUser (c context.Context, userId int) error
+}
+
+// seatRSVP decides if a yes RSVP gets a seat. Users keep seats they have, new attendees are waitlisted if the event
+// is full or others are already waiting. Returns ErrNoCapacity if a user with a seat adds plus-ones which do not fit.
+// others are the event's RSVPs except the user's, previous is the user's RSVP before this change, nil if new.
+func seatRSVP (rsvp *db.RSVP, previous *db.RSVP, others []db.RSVP, capacity int, now time.Time) error {
+    rsvp.WaitlistedAt = nil
+    if rsvp.Response != db.RSVPYes {
+        return nil
+    }
+
+    taken, waiting := 0, false
+    for _, other := range others {
+        if other.Going() {
+            taken += other.Seats()
+        } else if other.Waitlisted() {
+            waiting = true
+        }
+    }
+
+    fits := capacity == 0 || taken + rsvp.Seats() <= capacity
+
+    switch {
+    case previous != nil && previous.Going():
+        if fits == false {
+            return ErrNoCapacity
+        }
+    case previous != nil && previous.Waitlisted():
+        // Keep place in line
+        rsvp.WaitlistedAt = previous.WaitlistedAt
+    case fits == false || waiting:
+        rsvp.WaitlistedAt = &now
+    }
+
+    return nil
+}
+
+// waitlistOrder sorts RSVPs in the order they were waitlisted.
+type waitlistOrder []*db.RSVP
+
+func (l waitlistOrder) Len () int { return len(l) }
+func (l waitlistOrder) Swap (i, j int) { l[i], l[j] = l[j], l[i] }
+func (l waitlistOrder) Less (i, j int) bool {
+    if l[i].WaitlistedAt.Equal(*l[j].WaitlistedAt) {
+        return l[i].ID < l[j].ID
+    }
+
+    return l[i].WaitlistedAt.Before(*l[j].WaitlistedAt)
+}
+
+// promoteWaitlisted gives free seats to waitlisted RSVPs in waitlist order, until the first which does not fit. RSVPs
+// are changed in place, the indexes of the ones which were given a seat are returned.
+func promoteWaitlisted (rsvps []db.RSVP, capacity int) []int {
+    taken := 0
+    var waiting []*db.RSVP
+    index := make(map[*db.RSVP]int)
+
+    for i := range rsvps {
+        if rsvps[i].Going() {
+            taken += rsvps[i].Seats()
+        } else if rsvps[i].Waitlisted() {
+            waiting = append(waiting, &rsvps[i])
+            index[&rsvps[i]] = i
+        }
+    }
+
+    sort.Sort(waitlistOrder(waiting))
+
+    var promoted []int
+    for _, rsvp := range waiting {
+        if capacity != 0 && taken + rsvp.Seats() > capacity {
+            break
+        }
+
+        rsvp.WaitlistedAt = nil
+        taken += rsvp.Seats()
+        promoted = append(promoted, index[rsvp])
+    }
+
+    return promoted
+}
+
+// promotedOthers removes the index of the RSVP being changed from the indexes returned by promoteWaitlisted.
+func promotedOthers (promoted []int, self int) []int {
+    others := promoted[:0]
+    for _, i := range promoted {
+        if i != self {
+            others = append(others, i)
+        }
+    }
+
+    return others
+}
+
+// rsvpsByEventOrder sorts RSVPs like RSVPStore.FindByEvent.
+type rsvpsByEventOrder []db.RSVP
+
+func (l rsvpsByEventOrder) Len () int { return len(l) }
+func (l rsvpsByEventOrder) Swap (i, j int) { l[i], l[j] = l[j], l[i] }
+func (l rsvpsByEventOrder) Less (i, j int) bool {
+    a, b := l[i], l[j]
+    if a.Waitlisted() != b.Waitlisted() {
+        return b.Waitlisted()
+    } else if a.Waitlisted() && a.WaitlistedAt.Equal(*b.WaitlistedAt) == false {
+        return a.WaitlistedAt.Before(*b.WaitlistedAt)
+    }
+
+    return a.ID < b.ID
+}
+
+// GormRSVPStore is an RSVPStore which uses a gorm database. Changes lock the event's row so they are applied one at a
+// time.
+type GormRSVPStore struct {
+    db *gorm.DB
+}
+
+// NewGormRSVPStore creates a GormRSVPStore.
+func NewGormRSVPStore (db *gorm.DB) *GormRSVPStore {
+    return &GormRSVPStore{db}
+}
+
+func (s *GormRSVPStore) Find (c context.Context, eventId, userId int) (*db.RSVP, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    var rsvp db.RSVP
+    q := s.db.Where("event_id = ? AND user_id = ?", eventId, userId).First(&rsvp)
+    if q.RecordNotFound() {
+        return nil, ErrNotFound
+    } else if q.Error != nil {
+        return nil, q.Error
+    }
+
+    return &rsvp, nil
+}
+
+func (s *GormRSVPStore) FindByEvent (c context.Context, eventId int, expand ...string) ([]db.RSVP, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    var rsvps []db.RSVP
+    if err := preloadAll(s.db, expand).Where("event_id = ?", eventId).Order("id").Find(&rsvps).Error; err != nil {
+        return nil, err
+    }
+
+    sort.Sort(rsvpsByEventOrder(rsvps))
+
+    return rsvps, nil
+}
+
+func (s *GormRSVPStore) FindByUser (c context.Context, userId int, expand ...string) ([]db.RSVP, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    var rsvps []db.RSVP
+    err := preloadAll(s.db, expand).Where("user_id = ?", userId).Order("id").Find(&rsvps).Error
+
+    return rsvps, err
+}
+
+// seat locks an event's row and loads its capacity and RSVPs, then calls fn with them. RSVPs changed by fn are
+// saved. Returns the RSVPs which were given a seat.
+func (s *GormRSVPStore) seat (eventId int, fn func (tx *gorm.DB, capacity int, rsvps []db.RSVP) ([]db.RSVP, []int, error)) ([]db.RSVP, error) {
+    var promoted []db.RSVP
+
+    err := inTransaction(s.db, func (tx *gorm.DB) error {
+        var capacity int
+        row := tx.Raw("SELECT capacity FROM events WHERE id = ? AND deleted_at IS NULL FOR UPDATE", eventId).Row()
+        if err := row.Scan(&capacity); err == sql.ErrNoRows {
+            return ErrNotFound
+        } else if err != nil {
+            return err
+        }
+
+        var rsvps []db.RSVP
+        if err := tx.Where("event_id = ?", eventId).Find(&rsvps).Error; err != nil {
+            return err
+        }
+
+        rsvps, changed, err := fn(tx, capacity, rsvps)
+        if err != nil {
+            return err
+        }
+
+        for _, i := range changed {
+            if err := tx.Model(&rsvps[i]).UpdateColumn("waitlisted_at", nil).Error; err != nil {
+                return err
+            }
+
+            promoted = append(promoted, rsvps[i])
+        }
+
+        return nil
+    })
+
+    return promoted, err
+}
+
+func (s *GormRSVPStore) Respond (c context.Context, rsvp *db.RSVP) ([]db.RSVP, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    return s.seat(rsvp.EventID, func (tx *gorm.DB, capacity int, rsvps []db.RSVP) ([]db.RSVP, []int, error) {
+        var previous *db.RSVP
+        others := rsvps[:0]
+        for i := range rsvps {
+            if rsvps[i].UserID == rsvp.UserID {
+                existing := rsvps[i]
+                previous = &existing
+            } else {
+                others = append(others, rsvps[i])
+            }
+        }
+
+        if previous != nil {
+            rsvp.ID = previous.ID
+            rsvp.CreatedAt = previous.CreatedAt
+        }
+
+        if err := seatRSVP(rsvp, previous, others, capacity, time.Now()); err != nil {
+            return nil, nil, err
+        }
+
+        // The user's RSVP can be seated too, if they were waitlisted and took fewer plus-ones
+        all := append(others, *rsvp)
+        changed := promotedOthers(promoteWaitlisted(all, capacity), len(all) - 1)
+        *rsvp = all[len(all) - 1]
+
+        return all, changed, tx.Set("gorm:save_associations", false).Save(rsvp).Error
+    })
+}
+
+func (s *GormRSVPStore) Remove (c context.Context, eventId, userId int) ([]db.RSVP, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    return s.seat(eventId, func (tx *gorm.DB, capacity int, rsvps []db.RSVP) ([]db.RSVP, []int, error) {
+        if err := tx.Unscoped().Where("event_id = ? AND user_id = ?", eventId, userId).Delete(&db.RSVP{}).Error; err != nil {
+            return nil, nil, err
+        }
+
+        others := rsvps[:0]
+        for _, rsvp := range rsvps {
+            if rsvp.UserID != userId {
+                others = append(others, rsvp)
+            }
+        }
+
+        return others, promoteWaitlisted(others, capacity), nil
+    })
+}
+
+func (s *GormRSVPStore) Reseat (c context.Context, eventId int) ([]db.RSVP, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    return s.seat(eventId, func (tx *gorm.DB, capacity int, rsvps []db.RSVP) ([]db.RSVP, []int, error) {
+        return rsvps, promoteWaitlisted(rsvps, capacity), nil
+    })
+}
+
+func (s *GormRSVPStore) DeleteByUser (c context.Context, userId int) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    return s.db.Unscoped().Where("user_id = ?", userId).Delete(&db.RSVP{}).Error
+}
+
+// MemoryRSVPStore is an RSVPStore which keeps RSVPs in memory. Used by tests.
+type MemoryRSVPStore struct {
+    mu sync.Mutex
+    // Used to load event capacities and the User and Event relations
+    users UserStore
+    events EventStore
+    rsvps map[int]db.RSVP
+    nextId int
+}
+
+// NewMemoryRSVPStore creates an empty MemoryRSVPStore which loads events and relations from the provided stores.
+func NewMemoryRSVPStore (users UserStore, events EventStore) *MemoryRSVPStore {
+    return &MemoryRSVPStore{users: users, events: events, rsvps: make(map[int]db.RSVP), nextId: 1}
+}
+
+// expand loads an RSVP's requested relations.
+func (s *MemoryRSVPStore) expand (rsvp db.RSVP, expand []string) db.RSVP {
+    if hasExpand(expand, ExpandRSVPUser) {
+        rsvp.User, _ = s.users.FindById(context.Background(), rsvp.UserID)
+    }
+
+    if hasExpand(expand, ExpandRSVPEvent) {
+        rsvp.Event, _ = s.events.FindById(context.Background(), rsvp.EventID)
+    }
+
+    return rsvp
+}
+
+// where returns the RSVPs which match a condition, ordered by id. Must be called with the lock held.
+func (s *MemoryRSVPStore) where (match func (rsvp db.RSVP) bool) []db.RSVP {
+    var rsvps []db.RSVP
+    for id := 1; id < s.nextId; id++ {
+        if rsvp, ok := s.rsvps[id]; ok && match(rsvp) {
+            rsvps = append(rsvps, rsvp)
+        }
+    }
+
+    return rsvps
+}
+
+func (s *MemoryRSVPStore) Find (c context.Context, eventId, userId int) (*db.RSVP, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    rsvps := s.where(func (rsvp db.RSVP) bool {
+        return rsvp.EventID == eventId && rsvp.UserID == userId
+    })
+    if len(rsvps) == 0 {
+        return nil, ErrNotFound
+    }
+
+    return &rsvps[0], nil
+}
+
+func (s *MemoryRSVPStore) FindByEvent (c context.Context, eventId int, expand ...string) ([]db.RSVP, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    s.mu.Lock()
+    rsvps := s.where(func (rsvp db.RSVP) bool {
+        return rsvp.EventID == eventId
+    })
+    s.mu.Unlock()
+
+    sort.Sort(rsvpsByEventOrder(rsvps))
+
+    for i := range rsvps {
+        rsvps[i] = s.expand(rsvps[i], expand)
+    }
+
+    return rsvps, nil
+}
+
+func (s *MemoryRSVPStore) FindByUser (c context.Context, userId int, expand ...string) ([]db.RSVP, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    s.mu.Lock()
+    rsvps := s.where(func (rsvp db.RSVP) bool {
+        return rsvp.UserID == userId
+    })
+    s.mu.Unlock()
+
+    for i := range rsvps {
+        rsvps[i] = s.expand(rsvps[i], expand)
+    }
+
+    return rsvps, nil
+}
+
+// capacity returns an event's capacity.
+func (s *MemoryRSVPStore) capacity (eventId int) (int, error) {
+    event, err := s.events.FindById(context.Background(), eventId)
+    if err != nil {
+        return 0, err
+    }
+
+    return event.Capacity, nil
+}
+
+// promote saves the RSVPs which promoteWaitlisted gave a seat. Must be called with the lock held.
+func (s *MemoryRSVPStore) promote (rsvps []db.RSVP, promoted []int) []db.RSVP {
+    var saved []db.RSVP
+    for _, i := range promoted {
+        rsvps[i].UpdatedAt = time.Now()
+        s.rsvps[rsvps[i].ID] = rsvps[i]
+        saved = append(saved, rsvps[i])
+    }
+
+    return saved
+}
+
+func (s *MemoryRSVPStore) Respond (c context.Context, rsvp *db.RSVP) ([]db.RSVP, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    capacity, err := s.capacity(rsvp.EventID)
+    if err != nil {
+        return nil, err
+    }
+
+    var previous *db.RSVP
+    others := s.where(func (other db.RSVP) bool {
+        if other.EventID == rsvp.EventID && other.UserID == rsvp.UserID {
+            previous = &other
+            return false
+        }
+
+        return other.EventID == rsvp.EventID
+    })
+
+    now := time.Now()
+    if previous != nil {
+        rsvp.ID = previous.ID
+        rsvp.CreatedAt = previous.CreatedAt
+    }
+
+    if err := seatRSVP(rsvp, previous, others, capacity, now); err != nil {
+        return nil, err
+    }
+
+    if previous == nil {
+        rsvp.ID = s.nextId
+        rsvp.CreatedAt = now
+        s.nextId++
+    }
+    rsvp.UpdatedAt = now
+
+    all := append(others, *rsvp)
+    changed := promotedOthers(promoteWaitlisted(all, capacity), len(all) - 1)
+    *rsvp = all[len(all) - 1]
+
+    saved := *rsvp
+    saved.User = nil
+    saved.Event = nil
+    s.rsvps[rsvp.ID] = saved
+
+    return s.promote(all, changed), nil
+}
+
+func (s *MemoryRSVPStore) Remove (c context.Context, eventId, userId int) ([]db.RSVP, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    capacity, err := s.capacity(eventId)
+    if err != nil {
+        return nil, err
+    }
+
+    others := s.where(func (rsvp db.RSVP) bool {
+        if rsvp.EventID == eventId && rsvp.UserID == userId {
+            delete(s.rsvps, rsvp.ID)
+            return false
+        }
+
+        return rsvp.EventID == eventId
+    })
+
+    return s.promote(others, promoteWaitlisted(others, capacity)), nil
+}
+
+func (s *MemoryRSVPStore) Reseat (c context.Context, eventId int) ([]db.RSVP, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    capacity, err := s.capacity(eventId)
+    if err != nil {
+        return nil, err
+    }
+
+    rsvps := s.where(func (rsvp db.RSVP) bool {
+        return rsvp.EventID == eventId
+    })
+
+    return s.promote(rsvps, promoteWaitlisted(rsvps, capacity)), nil
+}
+
+func (s *MemoryRSVPStore) DeleteByUser (c context.Context, userId int) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    for id, rsvp := range s.rsvps {
+        if rsvp.UserID == userId {
+            delete(s.rsvps, id)
+        }
+    }
+
+    return nil
+}
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Noah-Huppert/squad-up/server/models/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPromoteWaitlisted(t *testing.T) {
+	a := assert.New(t)
+	now := time.Now()
+	later := now.Add(time.Minute)
+
+	rsvps := []db.RSVP{
+		{ID: 1, Response: db.RSVPYes},
+		{ID: 2, Response: db.RSVPYes, PlusOnes: 2, WaitlistedAt: &later},
+		{ID: 3, Response: db.RSVPYes, PlusOnes: 1, WaitlistedAt: &now},
+		{ID: 4, Response: db.RSVPYes, WaitlistedAt: &later},
+	}
+
+	// Seats are given in waitlist order, stopping at the first RSVP which does not fit
+	a.Equal([]int{2}, promoteWaitlisted(rsvps, 4))
+	a.True(rsvps[2].Going())
+	a.True(rsvps[3].Waitlisted())
+
+	// Unlimited capacity seats everyone
+	a.Equal([]int{1, 3}, promoteWaitlisted(rsvps, 0))
+}
+
+func TestMemoryRSVPStore_Respond(t *testing.T) {
+	a := assert.New(t)
+	c := context.Background()
+	users := NewMemoryUserStore()
+	events := NewMemoryEventStore(users, NewMemorySquadStore(users))
+	store := NewMemoryRSVPStore(users, events)
+
+	event := &db.Event{Title: "Hike", Capacity: 3}
+	a.Nil(events.Create(c, event))
+
+	// Concurrent RSVPs never take more seats than the capacity
+	var wg sync.WaitGroup
+	for i := 1; i <= 10; i++ {
+		wg.Add(1)
+		go func(userId int) {
+			defer wg.Done()
+			_, err := store.Respond(c, &db.RSVP{EventID: event.ID, UserID: userId, Response: db.RSVPYes})
+			a.Nil(err)
+		}(i)
+	}
+	wg.Wait()
+
+	rsvps, err := store.FindByEvent(c, event.ID)
+	a.Nil(err)
+
+	going := 0
+	for _, rsvp := range rsvps {
+		if rsvp.Going() {
+			going++
+		}
+	}
+	a.Equal(3, going)
+
+	// Adding plus-ones which do not fit is rejected
+	_, err = store.Respond(c, &db.RSVP{EventID: event.ID, UserID: rsvps[0].UserID, Response: db.RSVPYes, PlusOnes: 1})
+	a.Equal(ErrNoCapacity, err)
+
+	// Leaving gives the seat to the first waitlisted user
+	promoted, err := store.Remove(c, event.ID, rsvps[0].UserID)
+	a.Nil(err)
+	if a.Len(promoted, 1) {
+		a.Equal(rsvps[3].UserID, promoted[0].UserID)
+	}
+}
@@ -0,0 +1,248 @@
+package models
+
+import (
+    "context"
+
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+
+    "github.com/jinzhu/gorm"
+)
+
+// Relations of squads and memberships which SquadStore methods can load, by their gorm association name
+const (
+    // db.Squad.Owner
+    ExpandSquadOwner = "Owner"
+    // db.Squad.Memberships
+    ExpandSquadMembers = "Memberships"
+    // db.Squad.Memberships and the db.SquadMembership.User of each
+    ExpandSquadMemberUsers = "Memberships.User"
+    // db.SquadMembership.User
+    ExpandMembershipUser = "User"
+    // db.SquadMembership.Squad
+    ExpandMembershipSquad = "Squad"
+)
+
+// SquadStore loads and saves squads and their memberships.
+//
+// Methods which return squads or memberships take the names of the relations to load with them, see the Expand
+// constants. Relations which are not requested are left empty.
+type SquadStore interface {
+    // Create saves a new squad, setting its ID, and makes its owner a member with the owner role
+    Create (c context.Context, squad *db.Squad) error
+    // FindById returns the squad with the provided id. Returns ErrNotFound if no such squad exists.
+    FindById (c context.Context, id int, expand ...string) (*db.Squad, error)
+    // FindByMember returns the squads a user is a member of, sorted by name. Archived squads are only included if
+    // includeArchived is true.
+    FindByMember (c context.Context, userId int, includeArchived bool, expand ...string) ([]db.Squad, error)
+    // Update saves changes to an existing squad
+    Update (c context.Context, squad *db.Squad) error
+    // UpdateIfUnmodified saves changes to an existing squad if it was not changed since it was loaded. Returns
+    // ErrModified otherwise.
+    UpdateIfUnmodified (c context.Context, squad *db.Squad) error
+    // Delete permanently deletes a squad and its memberships. Returns ErrNotFound if no such squad exists.
+    Delete (c context.Context, id int) error
+
+    // FindMembership returns a user's membership in a squad. Returns ErrNotFound if they are not a member.
+    FindMembership (c context.Context, squadId, userId int, expand ...string) (*db.SquadMembership, error)
+    // FindMemberships returns the memberships of a squad, in the order users joined
+    FindMemberships (c context.Context, squadId int, expand ...string) ([]db.SquadMembership, error)
+    // FindMembershipsByUser returns all of a user's memberships
+    FindMembershipsByUser (c context.Context, userId int, expand ...string) ([]db.SquadMembership, error)
+    // AddMember saves a new membership, setting its ID. Returns ErrAlreadyExists if the user is already a member.
+    AddMember (c context.Context, membership *db.SquadMembership) error
+    // UpdateMembership saves changes to an existing membership
+    UpdateMembership (c context.Context, membership *db.SquadMembership) error
+    // RemoveMember deletes a user's membership in a squad. Returns ErrNotFound if they are not a member.
+    RemoveMember (c context.Context, squadId, userId int) error
+    // FindCoMemberIds returns the ids of users who share at least one squad with a user, including the user
+    FindCoMemberIds (c context.Context, userId int) ([]int, error)
+}
+
+// GormSquadStore is a SquadStore which uses a gorm database.
+type GormSquadStore struct {
+    db *gorm.DB
+}
+
+// NewGormSquadStore creates a GormSquadStore.
+func NewGormSquadStore (db *gorm.DB) *GormSquadStore {
+    return &GormSquadStore{db}
+}
+
+// preloadAll adds a Preload to a query for each relation.
+func preloadAll (q *gorm.DB, expand []string) *gorm.DB {
+    for _, assoc := range expand {
+        q = q.Preload(assoc)
+    }
+
+    return q
+}
+
+func (s *GormSquadStore) Create (c context.Context, squad *db.Squad) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    return inTransaction(s.db, func (tx *gorm.DB) error {
+        if err := tx.Create(squad).Error; err != nil {
+            return err
+        }
+
+        owner := db.SquadMembership{SquadID: squad.ID, UserID: squad.OwnerID, Role: db.SquadRoleOwner}
+        return tx.Create(&owner).Error
+    })
+}
+
+func (s *GormSquadStore) FindById (c context.Context, id int, expand ...string) (*db.Squad, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    var squad db.Squad
+    q := preloadAll(s.db, expand).Where("id = ?", id).First(&squad)
+    if q.RecordNotFound() {
+        return nil, ErrNotFound
+    } else if q.Error != nil {
+        return nil, q.Error
+    }
+
+    return &squad, nil
+}
+
+func (s *GormSquadStore) FindByMember (c context.Context, userId int, includeArchived bool, expand ...string) ([]db.Squad, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    q := preloadAll(s.db, expand).
+        Joins("JOIN squad_memberships ON squad_memberships.squad_id = squads.id").
+        Where("squad_memberships.user_id = ? AND squad_memberships.deleted_at IS NULL", userId)
+
+    if includeArchived == false {
+        q = q.Where("squads.archived_at IS NULL")
+    }
+
+    var squads []db.Squad
+    err := q.Order("squads.name").Find(&squads).Error
+
+    return squads, err
+}
+
+func (s *GormSquadStore) Update (c context.Context, squad *db.Squad) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    // Don't save loaded relations
+    return s.db.Set("gorm:save_associations", false).Save(squad).Error
+}
+
+func (s *GormSquadStore) UpdateIfUnmodified (c context.Context, squad *db.Squad) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    return updateIfUnmodified(s.db, squad, squad.UpdatedAt)
+}
+
+func (s *GormSquadStore) Delete (c context.Context, id int) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    return inTransaction(s.db, func (tx *gorm.DB) error {
+        if err := tx.Unscoped().Where("squad_id = ?", id).Delete(&db.SquadMembership{}).Error; err != nil {
+            return err
+        }
+
+        q := tx.Unscoped().Where("id = ?", id).Delete(&db.Squad{})
+        if q.Error == nil && q.RowsAffected == 0 {
+            return ErrNotFound
+        }
+
+        return q.Error
+    })
+}
+
+func (s *GormSquadStore) FindMembership (c context.Context, squadId, userId int, expand ...string) (*db.SquadMembership, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    var membership db.SquadMembership
+    q := preloadAll(s.db, expand).Where("squad_id = ? AND user_id = ?", squadId, userId).First(&membership)
+    if q.RecordNotFound() {
+        return nil, ErrNotFound
+    } else if q.Error != nil {
+        return nil, q.Error
+    }
+
+    return &membership, nil
+}
+
+func (s *GormSquadStore) FindMemberships (c context.Context, squadId int, expand ...string) ([]db.SquadMembership, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    var memberships []db.SquadMembership
+    err := preloadAll(s.db, expand).Where("squad_id = ?", squadId).Order("id").Find(&memberships).Error
+
+    return memberships, err
+}
+
+func (s *GormSquadStore) FindMembershipsByUser (c context.Context, userId int, expand ...string) ([]db.SquadMembership, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    var memberships []db.SquadMembership
+    err := preloadAll(s.db, expand).Where("user_id = ?", userId).Order("id").Find(&memberships).Error
+
+    return memberships, err
+}
+
+func (s *GormSquadStore) AddMember (c context.Context, membership *db.SquadMembership) error {
+    if _, err := s.FindMembership(c, membership.SquadID, membership.UserID); err == nil {
+        return ErrAlreadyExists
+    } else if err != ErrNotFound {
+        return err
+    }
+
+    return s.db.Create(membership).Error
+}
+
+func (s *GormSquadStore) UpdateMembership (c context.Context, membership *db.SquadMembership) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    return s.db.Set("gorm:save_associations", false).Save(membership).Error
+}
+
+func (s *GormSquadStore) RemoveMember (c context.Context, squadId, userId int) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    // Hard delete so the user can join again without violating the unique index
+    q := s.db.Unscoped().Where("squad_id = ? AND user_id = ?", squadId, userId).Delete(&db.SquadMembership{})
+    if q.Error == nil && q.RowsAffected == 0 {
+        return ErrNotFound
+    }
+
+    return q.Error
+}
+
+func (s *GormSquadStore) FindCoMemberIds (c context.Context, userId int) ([]int, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    var ids []int
+    err := s.db.Table("squad_memberships AS mine").
+        Joins("JOIN squad_memberships AS theirs ON theirs.squad_id = mine.squad_id AND theirs.deleted_at IS NULL").
+        Where("mine.user_id = ? AND mine.deleted_at IS NULL", userId).
+        Pluck("DISTINCT theirs.user_id", &ids).Error
+
+    return ids, err
+}
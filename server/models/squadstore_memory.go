@@ -0,0 +1,367 @@
+package models
+
+import (
+    "context"
+    "sort"
+    "sync"
+    "time"
+
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+)
+
+// MemorySquadStore is a SquadStore which keeps squads in memory. Used by tests.
+type MemorySquadStore struct {
+    mu sync.Mutex
+    // Used to load users for the Owner and User relations
+    users UserStore
+    squads map[int]db.Squad
+    memberships map[int]db.SquadMembership
+    nextSquadId int
+    nextMembershipId int
+}
+
+// NewMemorySquadStore creates an empty MemorySquadStore which loads users from the provided store.
+func NewMemorySquadStore (users UserStore) *MemorySquadStore {
+    return &MemorySquadStore{
+        users: users,
+        squads: make(map[int]db.Squad),
+        memberships: make(map[int]db.SquadMembership),
+        nextSquadId: 1,
+        nextMembershipId: 1,
+    }
+}
+
+// hasExpand reports if a relation was requested.
+func hasExpand (expand []string, assoc string) bool {
+    for _, e := range expand {
+        if e == assoc {
+            return true
+        }
+    }
+
+    return false
+}
+
+// loadUser returns the user with the provided id, or nil if they do not exist, like a gorm preload would.
+func (s *MemorySquadStore) loadUser (id int) *db.User {
+    user, err := s.users.FindById(context.Background(), id)
+    if err != nil {
+        return nil
+    }
+
+    return user
+}
+
+// expandSquad loads a squad's requested relations. Must be called with the lock held.
+func (s *MemorySquadStore) expandSquad (squad db.Squad, expand []string) db.Squad {
+    if hasExpand(expand, ExpandSquadOwner) {
+        squad.Owner = s.loadUser(squad.OwnerID)
+    }
+
+    if hasExpand(expand, ExpandSquadMembers) || hasExpand(expand, ExpandSquadMemberUsers) {
+        var memberExpand []string
+        if hasExpand(expand, ExpandSquadMemberUsers) {
+            memberExpand = []string{ExpandMembershipUser}
+        }
+
+        squad.Memberships = s.membershipsWhere(memberExpand, func (m db.SquadMembership) bool {
+            return m.SquadID == squad.ID
+        })
+    }
+
+    return squad
+}
+
+// expandMembership loads a membership's requested relations. Must be called with the lock held.
+func (s *MemorySquadStore) expandMembership (membership db.SquadMembership, expand []string) db.SquadMembership {
+    if hasExpand(expand, ExpandMembershipUser) {
+        membership.User = s.loadUser(membership.UserID)
+    }
+
+    if hasExpand(expand, ExpandMembershipSquad) {
+        if squad, ok := s.squads[membership.SquadID]; ok {
+            membership.Squad = &squad
+        }
+    }
+
+    return membership
+}
+
+// membershipsWhere returns memberships which match, in the order they were created. Must be called with the lock
+// held.
+func (s *MemorySquadStore) membershipsWhere (expand []string, match func (db.SquadMembership) bool) []db.SquadMembership {
+    var memberships []db.SquadMembership
+    for id := 1; id < s.nextMembershipId; id++ {
+        if m, ok := s.memberships[id]; ok && match(m) {
+            memberships = append(memberships, s.expandMembership(m, expand))
+        }
+    }
+
+    return memberships
+}
+
+func (s *MemorySquadStore) Create (c context.Context, squad *db.Squad) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    now := time.Now()
+    squad.ID = s.nextSquadId
+    squad.CreatedAt = now
+    squad.UpdatedAt = now
+    s.nextSquadId++
+
+    s.squads[squad.ID] = *squad
+
+    s.addMember(&db.SquadMembership{SquadID: squad.ID, UserID: squad.OwnerID, Role: db.SquadRoleOwner})
+
+    return nil
+}
+
+func (s *MemorySquadStore) FindById (c context.Context, id int, expand ...string) (*db.Squad, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    squad, ok := s.squads[id]
+    if ok == false {
+        return nil, ErrNotFound
+    }
+
+    squad = s.expandSquad(squad, expand)
+
+    return &squad, nil
+}
+
+// Sorts squads by name
+type squadsByName []db.Squad
+
+func (l squadsByName) Len () int { return len(l) }
+func (l squadsByName) Swap (i, j int) { l[i], l[j] = l[j], l[i] }
+func (l squadsByName) Less (i, j int) bool { return l[i].Name < l[j].Name }
+
+func (s *MemorySquadStore) FindByMember (c context.Context, userId int, includeArchived bool, expand ...string) ([]db.Squad, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    var squads []db.Squad
+    for _, m := range s.memberships {
+        squad := s.squads[m.SquadID]
+        if m.UserID == userId && (includeArchived || squad.Archived() == false) {
+            squads = append(squads, s.expandSquad(squad, expand))
+        }
+    }
+
+    sort.Stable(squadsByName(squads))
+
+    return squads, nil
+}
+
+func (s *MemorySquadStore) Update (c context.Context, squad *db.Squad) error {
+    return s.update(c, squad, false)
+}
+
+func (s *MemorySquadStore) UpdateIfUnmodified (c context.Context, squad *db.Squad) error {
+    return s.update(c, squad, true)
+}
+
+// update saves changes to a squad, only if it was not changed since it was loaded if unmodified is true.
+func (s *MemorySquadStore) update (c context.Context, squad *db.Squad, unmodified bool) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    current, ok := s.squads[squad.ID]
+    if ok == false {
+        return ErrNotFound
+    } else if unmodified && current.UpdatedAt.Equal(squad.UpdatedAt) == false {
+        return ErrModified
+    }
+
+    squad.UpdatedAt = time.Now()
+
+    saved := *squad
+    saved.Owner = nil
+    saved.Memberships = nil
+    s.squads[squad.ID] = saved
+
+    return nil
+}
+
+func (s *MemorySquadStore) Delete (c context.Context, id int) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if _, ok := s.squads[id]; ok == false {
+        return ErrNotFound
+    }
+
+    delete(s.squads, id)
+    for membershipId, m := range s.memberships {
+        if m.SquadID == id {
+            delete(s.memberships, membershipId)
+        }
+    }
+
+    return nil
+}
+
+func (s *MemorySquadStore) FindMembership (c context.Context, squadId, userId int, expand ...string) (*db.SquadMembership, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    memberships := s.membershipsWhere(expand, func (m db.SquadMembership) bool {
+        return m.SquadID == squadId && m.UserID == userId
+    })
+    if len(memberships) == 0 {
+        return nil, ErrNotFound
+    }
+
+    return &memberships[0], nil
+}
+
+func (s *MemorySquadStore) FindMemberships (c context.Context, squadId int, expand ...string) ([]db.SquadMembership, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    return s.membershipsWhere(expand, func (m db.SquadMembership) bool {
+        return m.SquadID == squadId
+    }), nil
+}
+
+func (s *MemorySquadStore) FindMembershipsByUser (c context.Context, userId int, expand ...string) ([]db.SquadMembership, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    return s.membershipsWhere(expand, func (m db.SquadMembership) bool {
+        return m.UserID == userId
+    }), nil
+}
+
+// addMember saves a membership. Must be called with the lock held.
+func (s *MemorySquadStore) addMember (membership *db.SquadMembership) {
+    now := time.Now()
+    membership.ID = s.nextMembershipId
+    membership.CreatedAt = now
+    membership.UpdatedAt = now
+    s.nextMembershipId++
+
+    s.memberships[membership.ID] = *membership
+}
+
+func (s *MemorySquadStore) AddMember (c context.Context, membership *db.SquadMembership) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    for _, m := range s.memberships {
+        if m.SquadID == membership.SquadID && m.UserID == membership.UserID {
+            return ErrAlreadyExists
+        }
+    }
+
+    s.addMember(membership)
+
+    return nil
+}
+
+func (s *MemorySquadStore) UpdateMembership (c context.Context, membership *db.SquadMembership) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if _, ok := s.memberships[membership.ID]; ok == false {
+        return ErrNotFound
+    }
+
+    membership.UpdatedAt = time.Now()
+
+    saved := *membership
+    saved.User = nil
+    saved.Squad = nil
+    s.memberships[membership.ID] = saved
+
+    return nil
+}
+
+func (s *MemorySquadStore) RemoveMember (c context.Context, squadId, userId int) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    for id, m := range s.memberships {
+        if m.SquadID == squadId && m.UserID == userId {
+            delete(s.memberships, id)
+            return nil
+        }
+    }
+
+    return ErrNotFound
+}
+
+func (s *MemorySquadStore) FindCoMemberIds (c context.Context, userId int) ([]int, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    squadIds := make(map[int]bool)
+    for _, m := range s.memberships {
+        if m.UserID == userId {
+            squadIds[m.SquadID] = true
+        }
+    }
+
+    seen := make(map[int]bool)
+    var ids []int
+    for _, m := range s.memberships {
+        if squadIds[m.SquadID] && seen[m.UserID] == false {
+            seen[m.UserID] = true
+            ids = append(ids, m.UserID)
+        }
+    }
+
+    sort.Ints(ids)
+
+    return ids, nil
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "time"
+
+    "github.com/jinzhu/gorm"
+)
+
+// Stores are the repository layer between endpoint handlers and the database. Each entity has a store interface, a
+// gorm implementation used by the server and an in-memory implementation used by tests.
+//
+// Store methods take the request's context. Gorm does not accept contexts, so the gorm implementations check it
+// before each query so abandoned requests stop early.
+
+// ErrNotFound is returned by stores when the requested record does not exist.
+var ErrNotFound = errors.New("record not found")
+
+// ErrModified is returned by stores when a record can not be saved because it was changed since it was loaded.
+var ErrModified = errors.New("record was modified")
+
+// ErrAlreadyExists is returned by stores when a record can not be created because it would duplicate an existing one.
+var ErrAlreadyExists = errors.New("record already exists")
+
+// checkContext returns the context's error if it was cancelled or timed out.
+func checkContext (c context.Context) error {
+    return c.Err()
+}
+
+// inTransaction calls fn with a transaction, which is committed if fn returns nil and rolled back otherwise. If db is
+// already a transaction fn joins it, so stores can group their own queries in transactions which callers can nest in
+// larger ones.
+func inTransaction (gdb *gorm.DB, fn func (tx *gorm.DB) error) error {
+    if _, ok := gdb.CommonDB().(*sql.Tx); ok {
+        return fn(gdb)
+    }
+
+    tx := gdb.Begin()
+    if tx.Error != nil {
+        return tx.Error
+    }
+
+    if err := fn(tx); err != nil {
+        tx.Rollback()
+        return err
+    }
+
+    return tx.Commit().Error
+}
+
+// updateIfUnmodified saves the columns of an existing record, but not its relations, if its updated_at column still
+// has the value the record was loaded with. Returns ErrModified otherwise. Save can not be used for this, as it creates
+// the record when no row is updated.
+func updateIfUnmodified (gdb *gorm.DB, value interface{}, loadedAt time.Time) error {
+    columns := make(map[string]interface{})
+    for _, field := range gdb.NewScope(value).Fields() {
+        if field.IsNormal == false || field.IsIgnored || field.IsPrimaryKey {
+            continue
+        }
+
+        switch field.DBName {
+        case "created_at", "updated_at", "deleted_at":
+        default:
+            columns[field.DBName] = field.Field.Interface()
+        }
+    }
+
+    q := gdb.Set("gorm:save_associations", false).Model(value).Where("updated_at = ?", loadedAt).Updates(columns)
+    if q.Error == nil && q.RowsAffected == 0 {
+        return ErrModified
+    }
+
+    return q.Error
+}
@@ -0,0 +1,168 @@
+package models
+
+import (
+    "context"
+    "time"
+
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+
+    "github.com/jinzhu/gorm"
+)
+
+// UserStore loads and saves users.
+type UserStore interface {
+    // FindById returns the user with the provided id. Returns ErrNotFound if no such user exists.
+    FindById (c context.Context, id int) (*db.User, error)
+    // FindByIdentity returns the user with the provided Google account id. Returns ErrNotFound if no user has logged
+    // in with the account.
+    FindByIdentity (c context.Context, googleId string) (*db.User, error)
+    // FindByEmail returns the user with the provided email. Returns ErrNotFound if no such user exists.
+    FindByEmail (c context.Context, email string) (*db.User, error)
+    // Create saves a new user, setting its ID
+    Create (c context.Context, user *db.User) error
+    // Update saves changes to an existing user
+    Update (c context.Context, user *db.User) error
+    // UpdateIfUnmodified saves changes to an existing user if it was not changed since it was loaded. Returns
+    // ErrModified otherwise.
+    UpdateIfUnmodified (c context.Context, user *db.User) error
+    // SoftDelete marks the user with the provided id as deleted. Deleted users are not returned by the Find methods.
+    SoftDelete (c context.Context, id int) error
+    // FindDeletedByIdentity returns the deleted user with the provided Google account id. Returns ErrNotFound if no
+    // such user exists or they have been purged.
+    FindDeletedByIdentity (c context.Context, googleId string) (*db.User, error)
+    // Restore un-deletes a deleted user which has not been purged yet
+    Restore (c context.Context, id int) error
+    // FindDeletedBefore returns users which were deleted before the provided time and have not been purged
+    FindDeletedBefore (c context.Context, cutoff time.Time) ([]db.User, error)
+    // Purge saves a deleted user whose personal data was removed, setting PurgedAt
+    Purge (c context.Context, user *db.User) error
+}
+
+// GormUserStore is a UserStore which uses a gorm database.
+type GormUserStore struct {
+    db *gorm.DB
+}
+
+// NewGormUserStore creates a GormUserStore.
+func NewGormUserStore (db *gorm.DB) *GormUserStore {
+    return &GormUserStore{db}
+}
+
+// findWhere returns the first user matching a query.
+func (s *GormUserStore) findWhere (c context.Context, query string, args ...interface{}) (*db.User, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    var user db.User
+    q := s.db.Where(query, args...).First(&user)
+    if q.RecordNotFound() {
+        return nil, ErrNotFound
+    } else if q.Error != nil {
+        return nil, q.Error
+    }
+
+    return &user, nil
+}
+
+func (s *GormUserStore) FindById (c context.Context, id int) (*db.User, error) {
+    return s.findWhere(c, "id = ?", id)
+}
+
+func (s *GormUserStore) FindByIdentity (c context.Context, googleId string) (*db.User, error) {
+    return s.findWhere(c, "google_id = ?", googleId)
+}
+
+func (s *GormUserStore) FindByEmail (c context.Context, email string) (*db.User, error) {
+    return s.findWhere(c, "email = ?", email)
+}
+
+func (s *GormUserStore) Create (c context.Context, user *db.User) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    return s.db.Create(user).Error
+}
+
+func (s *GormUserStore) Update (c context.Context, user *db.User) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    return s.db.Save(user).Error
+}
+
+func (s *GormUserStore) UpdateIfUnmodified (c context.Context, user *db.User) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    return updateIfUnmodified(s.db, user, user.UpdatedAt)
+}
+
+func (s *GormUserStore) SoftDelete (c context.Context, id int) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    q := s.db.Where("id = ?", id).Delete(&db.User{})
+    if q.Error == nil && q.RowsAffected == 0 {
+        return ErrNotFound
+    }
+
+    return q.Error
+}
+
+func (s *GormUserStore) FindDeletedByIdentity (c context.Context, googleId string) (*db.User, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    var user db.User
+    q := s.db.Unscoped().Where("google_id = ? AND deleted_at IS NOT NULL AND purged_at IS NULL", googleId).First(&user)
+    if q.RecordNotFound() {
+        return nil, ErrNotFound
+    } else if q.Error != nil {
+        return nil, q.Error
+    }
+
+    return &user, nil
+}
+
+func (s *GormUserStore) Restore (c context.Context, id int) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    q := s.db.Unscoped().Model(&db.User{}).
+        Where("id = ? AND deleted_at IS NOT NULL AND purged_at IS NULL", id).
+        Update("deleted_at", gorm.Expr("NULL"))
+    if q.Error == nil && q.RowsAffected == 0 {
+        return ErrNotFound
+    }
+
+    return q.Error
+}
+
+func (s *GormUserStore) FindDeletedBefore (c context.Context, cutoff time.Time) ([]db.User, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    var users []db.User
+    err := s.db.Unscoped().Where("deleted_at < ? AND purged_at IS NULL", cutoff).Find(&users).Error
+
+    return users, err
+}
+
+func (s *GormUserStore) Purge (c context.Context, user *db.User) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    now := time.Now()
+    user.PurgedAt = &now
+
+    return s.db.Unscoped().Save(user).Error
+}
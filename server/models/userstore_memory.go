@@ -0,0 +1,196 @@
+package models
+
+import (
+    "context"
+    "sync"
+    "time"
+
+    "github.com/Noah-Huppert/squad-up/server/models/db"
+)
+
+// MemoryUserStore is a UserStore which keeps users in memory. Used by tests.
+type MemoryUserStore struct {
+    mu sync.Mutex
+    users map[int]db.User
+    nextId int
+}
+
+// NewMemoryUserStore creates an empty MemoryUserStore.
+func NewMemoryUserStore () *MemoryUserStore {
+    return &MemoryUserStore{users: make(map[int]db.User), nextId: 1}
+}
+
+// findWhere returns a copy of the first user which has not been deleted and matches.
+func (s *MemoryUserStore) findWhere (c context.Context, match func (db.User) bool) (*db.User, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    for id := 1; id < s.nextId; id++ {
+        user, ok := s.users[id]
+        if ok && user.DeletedAt == nil && match(user) {
+            return &user, nil
+        }
+    }
+
+    return nil, ErrNotFound
+}
+
+func (s *MemoryUserStore) FindById (c context.Context, id int) (*db.User, error) {
+    return s.findWhere(c, func (u db.User) bool { return u.ID == id })
+}
+
+func (s *MemoryUserStore) FindByIdentity (c context.Context, googleId string) (*db.User, error) {
+    return s.findWhere(c, func (u db.User) bool { return googleId != "" && u.GoogleID == googleId })
+}
+
+func (s *MemoryUserStore) FindByEmail (c context.Context, email string) (*db.User, error) {
+    return s.findWhere(c, func (u db.User) bool { return u.Email == email })
+}
+
+func (s *MemoryUserStore) Create (c context.Context, user *db.User) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    now := time.Now()
+    user.ID = s.nextId
+    user.CreatedAt = now
+    user.UpdatedAt = now
+    s.nextId++
+
+    s.users[user.ID] = *user
+
+    return nil
+}
+
+func (s *MemoryUserStore) Update (c context.Context, user *db.User) error {
+    return s.update(c, user, false)
+}
+
+func (s *MemoryUserStore) UpdateIfUnmodified (c context.Context, user *db.User) error {
+    return s.update(c, user, true)
+}
+
+// update saves changes to a user, only if it was not changed since it was loaded if unmodified is true.
+func (s *MemoryUserStore) update (c context.Context, user *db.User, unmodified bool) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    saved, ok := s.users[user.ID]
+    if ok == false {
+        return ErrNotFound
+    } else if unmodified && saved.UpdatedAt.Equal(user.UpdatedAt) == false {
+        return ErrModified
+    }
+
+    user.UpdatedAt = time.Now()
+    s.users[user.ID] = *user
+
+    return nil
+}
+
+func (s *MemoryUserStore) SoftDelete (c context.Context, id int) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    user, ok := s.users[id]
+    if ok == false || user.DeletedAt != nil {
+        return ErrNotFound
+    }
+
+    now := time.Now()
+    user.DeletedAt = &now
+    s.users[id] = user
+
+    return nil
+}
+
+func (s *MemoryUserStore) FindDeletedByIdentity (c context.Context, googleId string) (*db.User, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    for id := 1; id < s.nextId; id++ {
+        user, ok := s.users[id]
+        if ok && googleId != "" && user.GoogleID == googleId && user.DeletedAt != nil && user.PurgedAt == nil {
+            return &user, nil
+        }
+    }
+
+    return nil, ErrNotFound
+}
+
+func (s *MemoryUserStore) Restore (c context.Context, id int) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    user, ok := s.users[id]
+    if ok == false || user.DeletedAt == nil || user.PurgedAt != nil {
+        return ErrNotFound
+    }
+
+    user.DeletedAt = nil
+    s.users[id] = user
+
+    return nil
+}
+
+func (s *MemoryUserStore) FindDeletedBefore (c context.Context, cutoff time.Time) ([]db.User, error) {
+    if err := checkContext(c); err != nil {
+        return nil, err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    var users []db.User
+    for id := 1; id < s.nextId; id++ {
+        user, ok := s.users[id]
+        if ok && user.DeletedAt != nil && user.DeletedAt.Before(cutoff) && user.PurgedAt == nil {
+            users = append(users, user)
+        }
+    }
+
+    return users, nil
+}
+
+func (s *MemoryUserStore) Purge (c context.Context, user *db.User) error {
+    if err := checkContext(c); err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if _, ok := s.users[user.ID]; ok == false {
+        return ErrNotFound
+    }
+
+    now := time.Now()
+    user.PurgedAt = &now
+    s.users[user.ID] = *user
+
+    return nil
+}
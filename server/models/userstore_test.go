@@ -0,0 +1,78 @@
+package models
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Noah-Huppert/squad-up/server/models/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryUserStore(t *testing.T) {
+	a := assert.New(t)
+	c := context.Background()
+	store := NewMemoryUserStore()
+
+	user := &db.User{GoogleID: "123", Email: "jane@example.com"}
+	a.Nil(store.Create(c, user))
+	a.Equal(1, user.ID)
+
+	found, err := store.FindByIdentity(c, "123")
+	a.Nil(err)
+	a.Equal("jane@example.com", found.Email)
+
+	found.FirstName = "Jane"
+	a.Nil(store.Update(c, found))
+
+	found, err = store.FindByEmail(c, "jane@example.com")
+	a.Nil(err)
+	a.Equal("Jane", found.FirstName)
+
+	// Copies which were changed since they were loaded are not saved
+	stale := *found
+	found.LastName = "Doe"
+	a.Nil(store.UpdateIfUnmodified(c, found))
+	a.Equal(ErrModified, store.UpdateIfUnmodified(c, &stale))
+
+	a.Nil(store.SoftDelete(c, user.ID))
+	_, err = store.FindById(c, user.ID)
+	a.Equal(ErrNotFound, err)
+	a.Equal(ErrNotFound, store.SoftDelete(c, user.ID))
+
+	// Cancelled requests do no work
+	cancelled, cancel := context.WithCancel(c)
+	cancel()
+	a.Equal(context.Canceled, store.Create(cancelled, &db.User{}))
+}
+
+func TestMemoryIdempotencyStore_Claim(t *testing.T) {
+	a := assert.New(t)
+	c := context.Background()
+	store := NewMemoryIdempotencyStore()
+
+	rec := &db.IdempotencyRecord{UserID: 1, Key: "abc", Route: "POST /"}
+	existing, err := store.Claim(c, rec)
+	a.Nil(err)
+	a.Nil(existing)
+
+	existing, err = store.Claim(c, &db.IdempotencyRecord{UserID: 1, Key: "abc", Route: "POST /"})
+	a.Nil(err)
+	a.Equal(rec.ID, existing.ID)
+
+	// Keys are scoped to users
+	existing, err = store.Claim(c, &db.IdempotencyRecord{UserID: 2, Key: "abc", Route: "POST /"})
+	a.Nil(err)
+	a.Nil(existing)
+
+	// Records are deleted by ID, a stale copy does not delete the key's newer record
+	a.Nil(store.Delete(c, rec))
+	newer := &db.IdempotencyRecord{UserID: 1, Key: "abc", Route: "POST /"}
+	existing, err = store.Claim(c, newer)
+	a.Nil(err)
+	a.Nil(existing)
+
+	a.Nil(store.Delete(c, rec))
+	existing, err = store.Claim(c, &db.IdempotencyRecord{UserID: 1, Key: "abc", Route: "POST /"})
+	a.Nil(err)
+	a.Equal(newer.ID, existing.ID)
+}
@@ -0,0 +1,91 @@
+package utils
+
+import "strings"
+
+// FieldSet is a tree of field names which should be kept when pruning a value. A nil FieldSet for a name means the
+// entire value under that name is kept.
+//
+// Example given:
+//
+// ParseFieldSet("id,owner.first_name,owner.last_name") => {
+//     id: nil,
+//     owner: {
+//         first_name: nil,
+//         last_name: nil,
+//     },
+// }
+type FieldSet map[string]FieldSet
+
+// ParseFieldSet parses a comma separated list of field names. Nested fields are specified by separating names with
+// dots. Returns nil if the list is empty, which means no fields should be pruned.
+func ParseFieldSet (list string) FieldSet {
+    var fs FieldSet
+
+    for _, path := range strings.Split(list, ",") {
+        path = strings.TrimSpace(path)
+        if path == "" {
+            continue
+        }
+
+        if fs == nil {
+            fs = make(FieldSet)
+        }
+
+        node := fs
+        parts := strings.Split(path, ".")
+        for i, part := range parts {
+            child, exists := node[part]
+
+            // Keeping entire value overrides keeping only some nested fields
+            if i == len(parts) - 1 {
+                node[part] = nil
+                break
+            }
+
+            if exists && child == nil {
+                break
+            }
+
+            if exists == false {
+                child = make(FieldSet)
+                node[part] = child
+            }
+
+            node = child
+        }
+    }
+
+    return fs
+}
+
+// Prune removes keys which are not in the field set from a value produced by ToMap. Maps have keys removed, each item
+// in a slice is pruned. Other values are returned as is.
+func Prune (value interface{}, fs FieldSet) interface{} {
+    if fs == nil {
+        return value
+    }
+
+    switch v := value.(type) {
+    case map[string]interface{}:
+        pruned := make(map[string]interface{}, len(fs))
+
+        for name, child := range fs {
+            if nested, ok := v[name]; ok {
+                pruned[name] = Prune(nested, child)
+            }
+        }
+
+        return pruned
+
+    case []interface{}:
+        pruned := make([]interface{}, len(v))
+
+        for i, item := range v {
+            pruned[i] = Prune(item, fs)
+        }
+
+        return pruned
+    }
+
+    return value
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+    "testing"
+
+    "github.com/stretchr/testify/assert"
+)
+
+func TestParseFieldSet(t *testing.T) {
+    a := assert.New(t)
+
+    a.Nil(ParseFieldSet(""))
+    a.Nil(ParseFieldSet(" , "))
+
+    a.Equal(FieldSet{
+        "id": nil,
+        "owner": FieldSet{
+            "first_name": nil,
+        },
+    }, ParseFieldSet("id, owner.first_name"))
+
+    // Keeping a whole value overrides nested fields, no matter the order
+    a.Equal(FieldSet{"owner": nil}, ParseFieldSet("owner.first_name,owner"))
+    a.Equal(FieldSet{"owner": nil}, ParseFieldSet("owner,owner.first_name"))
+}
+
+func TestPrune(t *testing.T) {
+    value := map[string]interface{}{
+        "id": 1,
+        "name": "Squad",
+        "owner": map[string]interface{}{
+            "id": 2,
+            "first_name": "Jane",
+        },
+        "members": []interface{}{
+            map[string]interface{}{"id": 3, "first_name": "John"},
+        },
+    }
+
+    assert.Equal(t, map[string]interface{}{
+        "id": 1,
+        "owner": map[string]interface{}{
+            "first_name": "Jane",
+        },
+        "members": []interface{}{
+            map[string]interface{}{"id": 3},
+        },
+    }, Prune(value, ParseFieldSet("id,owner.first_name,members.id,missing")))
+
+    assert.Equal(t, value, Prune(value, nil))
+    assert.Equal(t, "token", Prune("token", ParseFieldSet("id")))
+}
@@ -1,15 +1,27 @@
 package utils
 
 import (
-    "github.com/fatih/structs"
+    "encoding"
+    "encoding/json"
     "errors"
+    "fmt"
+    "reflect"
+    "strconv"
     "strings"
+    "sync"
+
+    "github.com/fatih/structs"
 )
 
 var RecursionMaxDepth = 20
 
 // Converts a struct into a map with string keys and interface{} values.
-// Takes a structs.Struct as input, this type was chosen to indicate that this method is for use on structs.
+// Takes a struct or a pointer to a struct as input.
+//
+// The resulting map marshals into the same JSON encoding/json.Marshal would produce for the struct, with the exception
+// of the embedded field semantics described below. Nested structs, slices, arrays and maps are converted recursively
+// into map[string]interface{} and []interface{} values. Values which implement json.Marshaler or
+// encoding.TextMarshaler (ex: time.Time) are left as is so encoding/json can marshal them as usual.
 //
 // Merges embedded types fields into main struct to mimic the implied "inheritance".
 // If an embedded type is not a struct than it will be treated like a normal KV pair.
@@ -46,130 +58,503 @@ var RecursionMaxDepth = 20
 //
 //  This method of merging is useful for presenting models which are meant to inherit properties.
 //
-// Note: Although I'm not sure this situation could actually occur given the semantics of Golang I will document it:
-//     If an embedded field has multiple of a key that collides with the main struct the key's value will be the last
-//     value in the struct. There is no special code that does this, this is just how the program runs (A loop over the
-//     struct to put it into a map).
+// If multiple embedded types have colliding keys the first embedded type in the struct wins, keys from later embedded
+// types are placed in an object named after their type.
+//
+// If the main struct has a key with the same name as the name of an embedded type and a collided key needs to be
+// merged an error will be returned.
 //
-// In the same realm of impossibility as above this issue is documented:
-//     If the main struct has a key with the same name as the name of an embedded type and a collided key needs to be
-//     merged an error will be thrown.
+// An error is also returned if values are nested deeper than recursionMax, which most likely means the value contains
+// a cycle, or if a value can not be represented in JSON (ex: channels and functions).
 //
 // Returns converted map and error
-func toMap (s *structs.Struct, recursionMax, recursionCounter int) (map[string]interface{}, error) {
-    result := make(map[string]interface{}, 0)
+func toMap (v interface{}, recursionMax int, viewer Viewer) (map[string]interface{}, error) {
+    rv := reflect.ValueOf(v)
+    for rv.IsValid() && rv.Kind() == reflect.Ptr {
+        if rv.IsNil() {
+            return nil, errors.New("Can not convert nil pointer into map")
+        }
+
+        rv = rv.Elem()
+    }
+
+    if rv.IsValid() == false || rv.Kind() != reflect.Struct {
+        return nil, fmt.Errorf("Can only convert structs into maps, got: %T", v)
+    }
+
+    e := &encoder{recursionMax: recursionMax, viewer: viewer}
+    return e.structToMap(rv, e.levelFor(rv, VisibilityPublic), 0)
+}
+
+// ToMap proxy caller. Allows user not specify recursion max depth and use default RecursionMaxDepth instead.
+func ToMap (v interface{}) (map[string]interface{}, error) {
+    return toMap(v, RecursionMaxDepth, nil)
+}
+
+// ToMapFor converts a struct into a map like ToMap, but leaves out fields the viewer is not allowed to see. See
+// Visibility for details.
+func ToMapFor (v interface{}, viewer Viewer) (map[string]interface{}, error) {
+    return toMap(v, RecursionMaxDepth, viewer)
+}
+
+// encoder holds the settings used while converting one value.
+type encoder struct {
+    // Max depth values can be nested
+    recursionMax int
+    // Viewer the value is being converted for, nil if all fields should be included
+    viewer Viewer
+}
+
+// fieldPlan describes how to serialize one field of a struct.
+type fieldPlan struct {
+    // Key field is placed under
+    name string
+    // Index of field in struct
+    index int
+    // If the "omitempty" json option was given
+    omitEmpty bool
+    // If the "string" json option was given and applies to the field's type
+    asString bool
+    // Who field is serialized for, set by the "visibility" tag
+    visibility Visibility
+}
+
+// structPlan describes how to serialize a struct type. Built once per type with reflection and cached in plans.
+type structPlan struct {
+    // Fields which are not merged embedded structs
+    fields []fieldPlan
+    // Embedded structs, in the order they are declared
+    embedded []fieldPlan
+    // Keys of fields, used to detect collisions with embedded fields
+    names map[string]bool
+    // Error which makes the type impossible to serialize, ex: a field with an unknown visibility
+    err error
+}
 
+// Cache of struct plans by type.
+var plans = struct {
+    sync.RWMutex
+    m map[reflect.Type]*structPlan
+}{m: make(map[reflect.Type]*structPlan)}
 
-    // Loop over fields
-    fields := s.Fields()
-    for _, field := range fields {
-        // Check that field is exported
-        if field.IsExported() == false {// If not then skip over
+// planFor returns the cached plan for a struct type, building it if this is the first time the type was seen.
+func planFor (t reflect.Type) *structPlan {
+    plans.RLock()
+    plan, ok := plans.m[t]
+    plans.RUnlock()
+
+    if ok {
+        return plan
+    }
+
+    plan = buildPlan(t)
+
+    plans.Lock()
+    plans.m[t] = plan
+    plans.Unlock()
+
+    return plan
+}
+
+// buildPlan uses reflection to determine how a struct type should be serialized.
+func buildPlan (t reflect.Type) *structPlan {
+    plan := &structPlan{names: make(map[string]bool)}
+
+    for i := 0; i < t.NumField(); i++ {
+        sf := t.Field(i)
+        exported := sf.PkgPath == ""
+
+        ft := sf.Type
+        if ft.Kind() == reflect.Ptr {
+            ft = ft.Elem()
+        }
+
+        // Same rules as encoding/json: Unexported fields are skipped unless they are embedded non pointer structs,
+        // which could have exported fields.
+        if sf.Anonymous {
+            if exported == false && (sf.Type.Kind() == reflect.Ptr || ft.Kind() != reflect.Struct) {
+                continue
+            }
+        } else if exported == false {
             continue
         }
 
-        // Check to see if field is embedded
-        if field.IsEmbedded() == true {// If field is embedded
-            // Check if embedded field is struct
-		    if structs.IsStruct(field.Value()) {// If it is handle recursively
-                // Call recursively to deal with this object
-                embeddedVals, err := toMap(structs.New(field.Value()), recursionMax, recursionCounter)
-                if err != nil {
-                    return nil, errors.New("Error while processing embedded field \"" + field.Name() + "\": " + err.Error())
-                }
-
-                var embeddedMap map[string]interface{}
-
-                // Merge map of embedded values with map of main struct
-                for key, value := range embeddedVals {
-                    // Check if key exists
-                    if _, ok := result[key]; ok == true {
-                        // If it does exist then put in object with key of embedded type's name
-                        embeddedMap[key] = value
-                    } else {
-                        // If the key does not exist in the main object then set it
-                        result[key] = value
-                    }
-                }
-
-                // Attach embeddedMap onto main struct map
-                // Check if main struct has field with same
-                // If main struct does have field with name of embedded type throw error
-                fieldName := FieldName(*field)
-                if _, ok := s.FieldOk(fieldName); ok == true {
-                    return nil, errors.New("[WTF] Main struct has seperate key with name of embedded type: \"" + field.Name() + "\"")
-                }
-
-                result[fieldName] = embeddedMap
+        tag := parseTag(sf.Tag.Get("json"))
+        if tag.skip {
+            continue
+        }
+
+        visibility, err := ParseVisibility(sf.Tag.Get("visibility"))
+        if err != nil {
+            plan.err = fmt.Errorf("%s.%s: %s", t, sf.Name, err)
+            return plan
+        }
+
+        fp := fieldPlan{
+            name: tag.name,
+            index: i,
+            omitEmpty: tag.omitEmpty,
+            visibility: visibility,
+        }
+
+        if tag.asString {
+            // Same as encoding/json, only unnamed pointers are followed when checking if the string option applies
+            st := sf.Type
+            if st.Name() == "" && st.Kind() == reflect.Ptr {
+                st = st.Elem()
+            }
+
+            switch st.Kind() {
+            case reflect.Bool,
+                reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+                reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+                reflect.Float32, reflect.Float64,
+                reflect.String:
+                fp.asString = true
             }
-        } else {// If field isn't embedded, aka normal
-            result[FieldName(*field)] = field.Value()
         }
+
+        // Embedded structs without a json name are merged into the parent
+        if sf.Anonymous && fp.name == "" && ft.Kind() == reflect.Struct {
+            fp.name = ft.Name()
+            plan.embedded = append(plan.embedded, fp)
+            continue
+        }
+
+        if fp.name == "" {
+            fp.name = sf.Name
+        }
+
+        plan.fields = append(plan.fields, fp)
+        plan.names[fp.name] = true
+    }
+
+    return plan
+}
+
+// structToMap converts a struct value into a map using the struct's plan.
+//
+// level is the visibility level the viewer has for the struct, fields which require a higher level are left out.
+func (e *encoder) structToMap (rv reflect.Value, level Visibility, recursionCounter int) (map[string]interface{}, error) {
+    if recursionCounter > e.recursionMax {
+        return nil, fmt.Errorf("Exceeded max recursion depth of %d while converting %s", e.recursionMax, rv.Type())
+    }
+
+    plan := planFor(rv.Type())
+    if plan.err != nil {
+        return nil, plan.err
+    }
+
+    result := make(map[string]interface{}, len(plan.fields))
+
+    // Normal fields
+    for _, fp := range plan.fields {
+        fv := rv.Field(fp.index)
+
+        if fp.omitEmpty && isEmptyValue(fv) {
+            continue
+        }
+
+        if fp.visibility > level {
+            continue
+        }
+
+        value, err := e.fieldValue(fv, fp, level, recursionCounter + 1)
+        if err != nil {
+            return nil, errors.New("Error while processing field \"" + fp.name + "\": " + err.Error())
+        }
+
+        result[fp.name] = value
+    }
+
+    // Keys merged in from embedded fields, used to detect collisions between embedded fields
+    merged := make(map[string]bool)
+
+    // Embedded fields
+    for _, fp := range plan.embedded {
+        if fp.visibility > level {
+            continue
+        }
+
+        fv := rv.Field(fp.index)
+
+        // Nil embedded pointers have no fields to merge
+        if fv.Kind() == reflect.Ptr {
+            if fv.IsNil() {
+                continue
+            }
+
+            fv = fv.Elem()
+        }
+
+        // Embedded fields belong to the main struct, so use its visibility level
+        embeddedVals, err := e.structToMap(fv, level, recursionCounter + 1)
+        if err != nil {
+            return nil, errors.New("Error while processing embedded field \"" + fp.name + "\": " + err.Error())
+        }
+
+        collided := make(map[string]interface{})
+
+        // Merge map of embedded values with map of main struct
+        for key, value := range embeddedVals {
+            if plan.names[key] || merged[key] {
+                // If key is taken put in object with key of embedded type's name
+                collided[key] = value
+            } else {
+                result[key] = value
+                merged[key] = true
+            }
+        }
+
+        if len(collided) == 0 {
+            continue
+        }
+
+        // Attach collided keys onto main struct map
+        // If main struct does have field with name of embedded type return error
+        if plan.names[fp.name] {
+            return nil, errors.New("[WTF] Main struct has seperate key with name of embedded type: \"" + fp.name + "\"")
+        }
+
+        result[fp.name] = collided
     }
 
     return result, nil
 }
 
+// fieldValue converts the value of a struct field, applying the "string" json option if set.
+func (e *encoder) fieldValue (fv reflect.Value, fp fieldPlan, level Visibility, recursionCounter int) (interface{}, error) {
+    if fp.asString == false {
+        return e.toValue(fv, level, recursionCounter)
+    }
+
+    if fv.Kind() == reflect.Ptr {
+        if fv.IsNil() {
+            return nil, nil
+        }
+
+        fv = fv.Elem()
+    }
+
+    // encoding/json places the JSON encoding of the value inside a string
+    bytes, err := json.Marshal(fv.Interface())
+    if err != nil {
+        return nil, err
+    }
+
+    return string(bytes), nil
+}
+
+var (
+    marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+    textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// implementsMarshaler reports if encoding/json would use a custom marshal method for the value.
+func implementsMarshaler (rv reflect.Value) bool {
+    t := rv.Type()
+
+    if t.Implements(marshalerType) || t.Implements(textMarshalerType) {
+        return true
+    }
+
+    // encoding/json also uses methods with pointer receivers if the value is addressable
+    pt := reflect.PtrTo(t)
+    return t.Kind() != reflect.Ptr && rv.CanAddr() && (pt.Implements(marshalerType) || pt.Implements(textMarshalerType))
+}
+
+// toValue converts any value into a JSON compatible representation.
+func (e *encoder) toValue (rv reflect.Value, level Visibility, recursionCounter int) (interface{}, error) {
+    if rv.IsValid() == false {
+        return nil, nil
+    }
+
+    // Nil values are never too deep
+    if (rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface) && rv.IsNil() {
+        return nil, nil
+    }
+
+    if recursionCounter > e.recursionMax {
+        return nil, fmt.Errorf("Exceeded max recursion depth of %d while converting %s", e.recursionMax, rv.Type())
+    }
+
+    // Let encoding/json call custom marshal methods
+    if implementsMarshaler(rv) {
+        if rv.Type().Implements(marshalerType) || rv.Type().Implements(textMarshalerType) {
+            return rv.Interface(), nil
+        }
+
+        return rv.Addr().Interface(), nil
+    }
+
+    switch rv.Kind() {
+    case reflect.Ptr, reflect.Interface:
+        return e.toValue(rv.Elem(), level, recursionCounter)
+
+    case reflect.Struct:
+        return e.structToMap(rv, e.levelFor(rv, level), recursionCounter)
+
+    case reflect.Map:
+        if rv.IsNil() {
+            return nil, nil
+        }
+
+        result := make(map[string]interface{}, rv.Len())
+        for _, key := range rv.MapKeys() {
+            keyStr, err := mapKey(key)
+            if err != nil {
+                return nil, err
+            }
+
+            value, err := e.toValue(rv.MapIndex(key), level, recursionCounter + 1)
+            if err != nil {
+                return nil, err
+            }
+
+            result[keyStr] = value
+        }
+
+        return result, nil
+
+    case reflect.Slice:
+        if rv.IsNil() {
+            return nil, nil
+        }
+
+        // Byte slices are base64 encoded by encoding/json
+        if rv.Type().Elem().Kind() == reflect.Uint8 {
+            return rv.Interface(), nil
+        }
+
+        fallthrough
+
+    case reflect.Array:
+        result := make([]interface{}, rv.Len())
+        for i := 0; i < rv.Len(); i++ {
+            value, err := e.toValue(rv.Index(i), level, recursionCounter + 1)
+            if err != nil {
+                return nil, err
+            }
+
+            result[i] = value
+        }
+
+        return result, nil
+
+    case reflect.Chan, reflect.Func, reflect.Complex64, reflect.Complex128, reflect.UnsafePointer:
+        return nil, fmt.Errorf("Type can not be represented in JSON: %s", rv.Type())
+    }
+
+    // Bools, numbers and strings
+    return rv.Interface(), nil
+}
+
+// mapKey converts a map key into a string the same way encoding/json does.
+func mapKey (key reflect.Value) (string, error) {
+    if key.Kind() == reflect.String {
+        return key.String(), nil
+    }
+
+    if tm, ok := key.Interface().(encoding.TextMarshaler); ok {
+        if key.Kind() == reflect.Ptr && key.IsNil() {
+            return "", nil
+        }
+
+        bytes, err := tm.MarshalText()
+        return string(bytes), err
+    }
+
+    switch key.Kind() {
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+        return strconv.FormatInt(key.Int(), 10), nil
+    case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+        return strconv.FormatUint(key.Uint(), 10), nil
+    }
+
+    return "", fmt.Errorf("Unsupported map key type: %s", key.Type())
+}
+
+// isEmptyValue reports if a value is considered empty by the "omitempty" json option.
+func isEmptyValue (rv reflect.Value) bool {
+    switch rv.Kind() {
+    case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+        return rv.Len() == 0
+    case reflect.Bool:
+        return rv.Bool() == false
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+        return rv.Int() == 0
+    case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+        return rv.Uint() == 0
+    case reflect.Float32, reflect.Float64:
+        return rv.Float() == 0
+    case reflect.Interface, reflect.Ptr:
+        return rv.IsNil()
+    }
+
+    return false
+}
+
+// jsonTag holds the parsed value of a "json" struct tag.
+type jsonTag struct {
+    // Name given in tag, empty if not provided
+    name string
+    // If field should never be serialized ("-")
+    skip bool
+    // If "omitempty" option was given
+    omitEmpty bool
+    // If "string" option was given
+    asString bool
+}
+
+// parseTag parses a "json" struct tag as described in encoding/json.Marshal.
+func parseTag (tag string) jsonTag {
+    if tag == "-" {
+        return jsonTag{skip: true}
+    }
+
+    parts := strings.Split(tag, ",")
+    parsed := jsonTag{name: parts[0]}
+
+    for _, opt := range parts[1:] {
+        switch opt {
+        case "omitempty":
+            parsed.omitEmpty = true
+        case "string":
+            parsed.asString = true
+        }
+    }
+
+    return parsed
+}
+
 // FieldName returns the name of a field or an empty string if the field should be omitted.
 //
 // Field should be omitted if specified by "json" tag or not exported.
 //
-// Method follows rules of the "json" tag as described in encoding/json.Marshal except for the "string" flag.
+// Method follows rules of the "json" tag as described in encoding/json.Marshal.
 func FieldName (field structs.Field) string {
     // Check that field is exported
     if field.IsExported() == false {// If not then return empty string
         return ""
     }
 
-    jsonTag := field.Tag("json")
-    jsonTagVals := strings.Split(jsonTag, ",")
-
-    // If "json" tag exists
-    if jsonTag != "" {
-        // If "json" tag has the value of "-" return empty string
-        if jsonTag == "-" {
-            return ""
-        }
-
-        // Check if only name is given
-        if strings.Contains(jsonTag, ",") == false {
-            return jsonTag
-        } else {// Parse into parts
-            var jsonName string
-            var jsonFlags []string
+    tag := parseTag(field.Tag("json"))
 
-            if len(jsonTagVals) == 1 {// 1 value but comma provided = only flag provided, ex: ",omitempty"
-                jsonFlags[0] = jsonTagVals[0]
-            } else if len(jsonTagVals) >= 2 {// 2 or more values and comma provided = flag and name provided, ex: "name,omitempty"
-                jsonName = jsonTagVals[0]
-                jsonFlags = jsonTagVals[1:]
-            }
+    // If "json" tag has the value of "-" return empty string
+    if tag.skip {
+        return ""
+    }
 
-            // Handle json flags
-            // Even though we only handle one, build in ability to handle more in future
-            // This design also allows us to have extra values of the "json" tag that we don't handle
-            for _, flagVal := range jsonFlags {
-                switch flagVal {
-                case "omitempty":
-                    // If "omitempty" json flag and empty field then return empty string
-                    if field.IsZero() {
-                        return ""
-                    }
-                }
-            }
+    // If "omitempty" json flag and empty field then return empty string
+    if tag.omitEmpty && isEmptyValue(reflect.ValueOf(field.Value())) {
+        return ""
+    }
 
-            // Now that all checks are complete return json name if exists
-            if jsonName != "" {
-                return jsonName
-            }
-        }
+    // Now that all checks are complete return json name if exists
+    if tag.name != "" {
+        return tag.name
     }
 
     // If "json" tag exists but name is not provided or if "json" tag doesn't exist at all then return normal field name
     return field.Name()
 }
-
-// ToMap proxy caller. Allows user not specify recursion max depth and use default RecursionMaxDepth instead.
-func ToMap (s *structs.Struct) (map[string]interface{}, error) {
-    return toMap(s, RecursionMaxDepth, 0)
-}
@@ -0,0 +1,224 @@
+package utils
+
+import (
+    "encoding/json"
+    "testing"
+    "time"
+
+    "github.com/stretchr/testify/assert"
+)
+
+type Clearance struct {
+    Id int
+    Level int
+}
+
+type Manager struct {
+    Clearance
+    Id int
+    Name string
+    Project string
+}
+
+type Metadata struct {
+    CreatedAt time.Time `json:"created_at"`
+    DeletedAt *time.Time `json:"deleted_at"`
+}
+
+type Address struct {
+    Street string `json:"street"`
+    Zip string `json:"zip,omitempty"`
+}
+
+type Person struct {
+    *Metadata
+    ID int `json:"id,string"`
+    Name string `json:"name"`
+    Nickname string `json:"nickname,omitempty"`
+    Admin bool `json:"admin,string"`
+    Secret string `json:"-"`
+    Dash string `json:"-,"`
+    hidden string
+    Home Address `json:"home"`
+    Work *Address `json:"work"`
+    Previous []Address `json:"previous"`
+    ByName map[string]Address `json:"by_name"`
+    ByNumber map[int]string `json:"by_number"`
+    Tags []string `json:"tags,omitempty"`
+    Avatar []byte `json:"avatar"`
+    Extra interface{} `json:"extra"`
+    Untagged float64
+}
+
+type Node struct {
+    Next *Node `json:"next"`
+}
+
+// assertSameJSON checks that a value converted by ToMap marshals into the same JSON as the value itself.
+func assertSameJSON(t *testing.T, v interface{}) {
+    m, err := ToMap(v)
+    assert.Nil(t, err)
+
+    expected, err := json.Marshal(v)
+    assert.Nil(t, err)
+
+    actual, err := json.Marshal(m)
+    assert.Nil(t, err)
+
+    assert.JSONEq(t, string(expected), string(actual))
+}
+
+func TestToMap_MatchesEncodingJSON(t *testing.T) {
+    now := time.Date(2017, 3, 1, 12, 30, 0, 0, time.UTC)
+
+    assertSameJSON(t, Person{})
+    assertSameJSON(t, &Person{
+        Metadata: &Metadata{CreatedAt: now, DeletedAt: &now},
+        ID: 42,
+        Name: "Jane <Doe>",
+        Nickname: "JD",
+        Admin: true,
+        Secret: "secret",
+        Dash: "dash",
+        hidden: "hidden",
+        Home: Address{"1 Main St", ""},
+        Work: &Address{"2 Main St", "01234"},
+        Previous: []Address{{"3 Main St", "56789"}},
+        ByName: map[string]Address{"cottage": {"4 Lake Rd", ""}},
+        ByNumber: map[int]string{1: "one"},
+        Tags: []string{"a", "b"},
+        Avatar: []byte{1, 2, 3},
+        Extra: Address{"5 Main St", ""},
+        Untagged: 1.5,
+    })
+}
+
+func TestToMap_EmbeddedCollision(t *testing.T) {
+    m, err := ToMap(Manager{Clearance{4534, 4}, 89243, "John Smith", "Secret project 3"})
+
+    assert.Nil(t, err)
+    assert.Equal(t, map[string]interface{}{
+        "Id": 89243,
+        "Name": "John Smith",
+        "Project": "Secret project 3",
+        "Level": 4,
+        "Clearance": map[string]interface{}{
+            "Id": 4534,
+        },
+    }, m)
+}
+
+func TestToMap_NoCollision(t *testing.T) {
+    m, err := ToMap(Person{})
+
+    assert.Nil(t, err)
+    assert.Contains(t, m, "name")
+    _, ok := m["Metadata"]
+    assert.False(t, ok, "Embedded type key should only exist if keys collided")
+}
+
+func TestToMap_RecursionMax(t *testing.T) {
+    n := &Node{}
+    n.Next = n
+
+    _, err := ToMap(n)
+    assert.NotNil(t, err)
+
+    _, err = toMap(Node{&Node{&Node{&Node{}}}}, 2, nil)
+    assert.NotNil(t, err)
+
+    _, err = toMap(Node{&Node{&Node{}}}, 2, nil)
+    assert.Nil(t, err)
+}
+
+func TestToMap_NotStruct(t *testing.T) {
+    _, err := ToMap(5)
+    assert.NotNil(t, err)
+
+    _, err = ToMap((*Person)(nil))
+    assert.NotNil(t, err)
+}
+
+type Profile struct {
+    Metadata `visibility:"self"`
+    OwnerId int `json:"owner_id"`
+    Name string `json:"name"`
+    Email string `json:"email" visibility:"members"`
+    Phone string `json:"phone" visibility:"self"`
+}
+
+type ProfileList struct {
+    Profiles []Profile `json:"profiles"`
+}
+
+// Viewer which is the owner of profiles with OwnerId self and a member of profiles with OwnerId members
+type testViewer struct {
+    self int
+    member int
+}
+
+func (v testViewer) Level(val interface{}) (Visibility, bool) {
+    p, ok := val.(Profile)
+    if ok == false {
+        return VisibilityPublic, false
+    }
+
+    switch p.OwnerId {
+    case v.self:
+        return VisibilitySelf, true
+    case v.member:
+        return VisibilityMembers, true
+    }
+
+    return VisibilityPublic, true
+}
+
+func TestToMapFor_Visibility(t *testing.T) {
+    a := assert.New(t)
+
+    list := ProfileList{[]Profile{
+        {OwnerId: 1, Name: "Self", Email: "self@example.com", Phone: "1"},
+        {OwnerId: 2, Name: "Member", Email: "member@example.com", Phone: "2"},
+        {OwnerId: 3, Name: "Stranger", Email: "stranger@example.com", Phone: "3"},
+    }}
+
+    m, err := ToMapFor(list, testViewer{1, 2})
+    a.Nil(err)
+
+    profiles := m["profiles"].([]interface{})
+    self := profiles[0].(map[string]interface{})
+    member := profiles[1].(map[string]interface{})
+    stranger := profiles[2].(map[string]interface{})
+
+    a.Contains(self, "email")
+    a.Contains(self, "phone")
+    a.Contains(self, "created_at")
+
+    a.Contains(member, "email")
+    a.NotContains(member, "phone")
+    a.NotContains(member, "created_at")
+
+    a.Equal(map[string]interface{}{"owner_id": 3, "name": "Stranger"}, stranger)
+
+    // Without a viewer every field is included
+    m, err = ToMap(list)
+    a.Nil(err)
+    a.Contains(m["profiles"].([]interface{})[2], "phone")
+}
+
+type Misspelled struct {
+    Phone string `json:"phone" visibility:"slef"`
+}
+
+func TestToMapFor_UnknownVisibility(t *testing.T) {
+    a := assert.New(t)
+
+    _, err := ToMapFor(Misspelled{"1"}, testViewer{1, 2})
+    if a.NotNil(err) {
+        a.Contains(err.Error(), "unknown visibility \"slef\"")
+    }
+
+    // Nested values fail too, instead of being left out
+    _, err = ToMapFor(map[string]interface{}{"user": []Misspelled{{"1"}}}, testViewer{1, 2})
+    a.NotNil(err)
+}
@@ -0,0 +1,71 @@
+package utils
+
+import (
+    "fmt"
+    "reflect"
+    "strings"
+)
+
+// Visibility is a level of access a viewer has to a value. Struct fields can require a level with the "visibility"
+// tag, ex:
+//
+// type User struct {
+//     Name string `json:"name"` // No tag means VisibilityPublic
+//     Email string `json:"email" visibility:"members"`
+//     Phone string `json:"phone" visibility:"self"`
+// }
+//
+// Fields are only included by ToMapFor if the viewer's level for the struct is at least the field's level. Levels are
+// ordered, a viewer with VisibilitySelf can see VisibilityMembers fields.
+type Visibility int
+
+const (
+    // Anyone can see value
+    VisibilityPublic Visibility = iota
+    // Only viewers who share a squad with the value's owner can see it
+    VisibilityMembers
+    // Only the value's owner can see it
+    VisibilitySelf
+)
+
+// ParseVisibility converts the value of a "visibility" struct tag into a Visibility. Empty values are considered
+// VisibilityPublic. Returns an error if the value is not a known level, so a misspelled tag does not make a field
+// public.
+func ParseVisibility (tag string) (Visibility, error) {
+    switch strings.TrimSpace(tag) {
+    case "":
+        return VisibilityPublic, nil
+    case "members":
+        return VisibilityMembers, nil
+    case "self":
+        return VisibilitySelf, nil
+    }
+
+    return VisibilityPublic, fmt.Errorf("unknown visibility \"%s\"", tag)
+}
+
+// Viewer determines the visibility level the requester of a value has.
+type Viewer interface {
+    // Level returns the level the viewer has for v. Returns false if v does not control its own visibility, in which
+    // case the level of the value v is nested in is used.
+    Level (v interface{}) (Visibility, bool)
+}
+
+// levelFor returns the visibility level the encoder's viewer has for a struct value. Returns parent if the struct
+// does not control its own visibility.
+func (e *encoder) levelFor (rv reflect.Value, parent Visibility) Visibility {
+    // Without a viewer everything is visible
+    if e.viewer == nil {
+        return VisibilitySelf
+    }
+
+    if rv.CanInterface() == false {
+        return parent
+    }
+
+    if level, ok := e.viewer.Level(rv.Interface()); ok {
+        return level
+    }
+
+    return parent
+}
@@ -0,0 +1,670 @@
+// Package recur parses RFC 5545 recurrence rules and expands them into occurrences.
+//
+// Occurrences are computed in the local time of the series' time zone, so a series which starts at 7 PM keeps
+// starting at 7 PM after daylight saving time begins or ends. The DAILY, WEEKLY, MONTHLY and YEARLY frequencies are
+// supported with the INTERVAL, COUNT, UNTIL, BYDAY, BYMONTHDAY, BYMONTH and WKST rule parts.
+package recur
+
+import (
+    "errors"
+    "fmt"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Frequency is how often a rule repeats.
+type Frequency int
+
+// Supported frequencies
+const (
+    Daily Frequency = iota + 1
+    Weekly
+    Monthly
+    Yearly
+)
+
+var frequencyNames = map[Frequency]string{Daily: "DAILY", Weekly: "WEEKLY", Monthly: "MONTHLY", Yearly: "YEARLY"}
+
+var weekdayNames = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// Format of UNTIL values
+const (
+    utcFormat = "20060102T150405Z"
+    floatingFormat = "20060102T150405"
+    dateFormat = "20060102"
+)
+
+// Max number of periods, ex: weeks of a WEEKLY rule, expanded before giving up. Bounds the work done for rules which
+// rarely match, Parse rejects rules which never do. Expansions which end at a time stop at its period instead.
+const maxPeriods = 10000
+
+// ErrInvalidRule is returned by Parse when a rule is not valid. Errors for specific rule parts wrap it in a RuleError.
+var ErrInvalidRule = errors.New("invalid recurrence rule")
+
+// RuleError describes which part of a rule is not valid or not supported.
+type RuleError struct {
+    Part string
+    Reason string
+}
+
+func (e RuleError) Error () string {
+    return fmt.Sprintf("%s: %s %s", ErrInvalidRule, e.Part, e.Reason)
+}
+
+// WeekdayNum is a BYDAY value, ex: 2TU is the second Tuesday of the period.
+type WeekdayNum struct {
+    // Which occurrence of the weekday in the period, negative values count from its end. 0 is every occurrence.
+    N int
+    Day time.Weekday
+}
+
+func (w WeekdayNum) String () string {
+    if w.N == 0 {
+        return weekdayNames[w.Day]
+    }
+
+    return strconv.Itoa(w.N) + weekdayNames[w.Day]
+}
+
+// Rule is a recurrence rule, the value of an iCalendar RRULE property.
+type Rule struct {
+    Freq Frequency
+    // Number of periods between occurrences, at least 1
+    Interval int
+    // Max number of occurrences, including the first. 0 if not limited.
+    Count int
+    // Time of the last possible occurrence, zero if not limited
+    Until time.Time
+    // If Until was a floating time or a date. Its wall clock time, kept in UTC, is then in the series' time zone.
+    UntilFloating bool
+    ByDay []WeekdayNum
+    ByMonthDay []int
+    ByMonth []time.Month
+    WeekStart time.Weekday
+}
+
+// Parse parses the value of an RRULE property, with or without the "RRULE:" prefix.
+func Parse (value string) (Rule, error) {
+    rule := Rule{Interval: 1, WeekStart: time.Monday}
+
+    value = strings.TrimPrefix(strings.TrimSpace(value), "RRULE:")
+    if value == "" {
+        return rule, ErrInvalidRule
+    }
+
+    for _, part := range strings.Split(value, ";") {
+        kv := strings.SplitN(part, "=", 2)
+        if len(kv) != 2 {
+            return rule, RuleError{part, "is not a NAME=VALUE pair"}
+        }
+
+        name, val := strings.ToUpper(kv[0]), strings.ToUpper(kv[1])
+        var err error
+
+        switch name {
+        case "FREQ":
+            err = parseFreq(val, &rule)
+        case "INTERVAL":
+            rule.Interval, err = parsePositive(val)
+        case "COUNT":
+            rule.Count, err = parsePositive(val)
+        case "UNTIL":
+            rule.Until, rule.UntilFloating, err = parseUntil(val)
+        case "BYDAY":
+            rule.ByDay, err = parseByDay(val)
+        case "BYMONTHDAY":
+            rule.ByMonthDay, err = parseInts(val, 1, 31)
+        case "BYMONTH":
+            var months []int
+            months, err = parseInts(val, 1, 12)
+            for _, m := range months {
+                if m < 0 {
+                    err = ErrInvalidRule
+                }
+                rule.ByMonth = append(rule.ByMonth, time.Month(m))
+            }
+        case "WKST":
+            var day WeekdayNum
+            day, err = parseWeekdayNum(val)
+            rule.WeekStart = day.Day
+            if day.N != 0 {
+                err = ErrInvalidRule
+            }
+        default:
+            return rule, RuleError{name, "is not supported"}
+        }
+
+        if err != nil {
+            return rule, RuleError{name, "has an invalid value"}
+        }
+    }
+
+    if rule.Freq == 0 {
+        return rule, RuleError{"FREQ", "is required"}
+    } else if rule.Count != 0 && rule.Until.IsZero() == false {
+        return rule, RuleError{"COUNT", "can not be used with UNTIL"}
+    }
+
+    // Ordinal weekdays only make sense in months and years
+    for _, day := range rule.ByDay {
+        if day.N != 0 && (rule.Freq == Daily || rule.Freq == Weekly) {
+            return rule, RuleError{"BYDAY", "can only have ordinals with MONTHLY and YEARLY"}
+        }
+    }
+
+    if rule.Freq == Weekly && len(rule.ByMonthDay) > 0 {
+        return rule, RuleError{"BYMONTHDAY", "can not be used with WEEKLY"}
+    }
+
+    if rule.canMatch() == false {
+        return rule, RuleError{"RRULE", "never matches a date"}
+    }
+
+    return rule, nil
+}
+
+// canMatch reports if any date matches the BYMONTH, BYMONTHDAY and BYDAY parts of a rule. Each month is checked over
+// 28 years, which include every weekday it can start on with each length it can have.
+func (r Rule) canMatch () bool {
+    if len(r.ByMonthDay) == 0 && len(r.ByDay) == 0 {
+        return true
+    }
+
+    // Ordinal weekdays of yearly rules without BYMONTH are counted within the year, only their weekday is checked
+    check := r
+    ordinals := r.Freq == Monthly || (r.Freq == Yearly && len(r.ByMonth) > 0)
+    if r.Freq == Yearly && len(r.ByMonth) == 0 {
+        check.ByDay = nil
+        for _, day := range r.ByDay {
+            check.ByDay = append(check.ByDay, WeekdayNum{Day: day.Day})
+        }
+    }
+
+    months := r.ByMonth
+    if len(months) == 0 {
+        for m := time.January; m <= time.December; m++ {
+            months = append(months, m)
+        }
+    }
+
+    for _, month := range months {
+        for year := 2000; year < 2028; year++ {
+            first := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+            if len(check.filterByMonthDay(check.filterByDay(days(first, first.AddDate(0, 1, 0)), ordinals))) > 0 {
+                return true
+            }
+        }
+    }
+
+    return false
+}
+
+func parseFreq (val string, rule *Rule) error {
+    for freq, name := range frequencyNames {
+        if name == val {
+            rule.Freq = freq
+            return nil
+        }
+    }
+
+    return ErrInvalidRule
+}
+
+func parsePositive (val string) (int, error) {
+    n, err := strconv.Atoi(val)
+    if err != nil || n < 1 {
+        return 0, ErrInvalidRule
+    }
+
+    return n, nil
+}
+
+// parseUntil parses an UNTIL value. Returns true if it is floating, the series' time zone is not known yet.
+func parseUntil (val string) (time.Time, bool, error) {
+    if t, err := time.Parse(utcFormat, val); err == nil {
+        return t, false, nil
+    }
+
+    if t, err := time.Parse(floatingFormat, val); err == nil {
+        return t, true, nil
+    }
+
+    // Dates include the whole day
+    t, err := time.Parse(dateFormat, val)
+    if err != nil {
+        return t, false, ErrInvalidRule
+    }
+
+    return t.Add(24 * time.Hour - time.Second), true, nil
+}
+
+// until returns the time of the last possible occurrence of a series which repeats in the loc time zone, zero if not
+// limited.
+func (r Rule) until (loc *time.Location) time.Time {
+    if r.UntilFloating == false || r.Until.IsZero() {
+        return r.Until
+    }
+
+    u := r.Until
+    return time.Date(u.Year(), u.Month(), u.Day(), u.Hour(), u.Minute(), u.Second(), u.Nanosecond(), loc)
+}
+
+// parseInts parses a list of numbers between -max and max, except 0.
+func parseInts (val string, min, max int) ([]int, error) {
+    var ints []int
+    for _, s := range strings.Split(val, ",") {
+        n, err := strconv.Atoi(s)
+        if err != nil || n == 0 || n < -max || n > max || (n > 0 && n < min) {
+            return nil, ErrInvalidRule
+        }
+
+        ints = append(ints, n)
+    }
+
+    return ints, nil
+}
+
+func parseByDay (val string) ([]WeekdayNum, error) {
+    var days []WeekdayNum
+    for _, s := range strings.Split(val, ",") {
+        day, err := parseWeekdayNum(s)
+        if err != nil {
+            return nil, err
+        }
+
+        days = append(days, day)
+    }
+
+    return days, nil
+}
+
+func parseWeekdayNum (val string) (WeekdayNum, error) {
+    if len(val) < 2 {
+        return WeekdayNum{}, ErrInvalidRule
+    }
+
+    name, num := val[len(val) - 2:], val[:len(val) - 2]
+
+    day := -1
+    for i, weekday := range weekdayNames {
+        if weekday == name {
+            day = i
+        }
+    }
+    if day < 0 {
+        return WeekdayNum{}, ErrInvalidRule
+    }
+
+    n := 0
+    if num != "" {
+        var err error
+        if n, err = strconv.Atoi(num); err != nil || n == 0 || n < -53 || n > 53 {
+            return WeekdayNum{}, ErrInvalidRule
+        }
+    }
+
+    return WeekdayNum{n, time.Weekday(day)}, nil
+}
+
+// String formats the rule as the value of an RRULE property, without the "RRULE:" prefix.
+func (r Rule) String () string {
+    parts := []string{"FREQ=" + frequencyNames[r.Freq]}
+
+    if r.Interval > 1 {
+        parts = append(parts, "INTERVAL=" + strconv.Itoa(r.Interval))
+    }
+    if r.Count > 0 {
+        parts = append(parts, "COUNT=" + strconv.Itoa(r.Count))
+    }
+    if r.Until.IsZero() == false && r.UntilFloating {
+        parts = append(parts, "UNTIL=" + r.Until.Format(floatingFormat))
+    } else if r.Until.IsZero() == false {
+        parts = append(parts, "UNTIL=" + r.Until.UTC().Format(utcFormat))
+    }
+    if len(r.ByMonth) > 0 {
+        var months []string
+        for _, m := range r.ByMonth {
+            months = append(months, strconv.Itoa(int(m)))
+        }
+        parts = append(parts, "BYMONTH=" + strings.Join(months, ","))
+    }
+    if len(r.ByMonthDay) > 0 {
+        var days []string
+        for _, d := range r.ByMonthDay {
+            days = append(days, strconv.Itoa(d))
+        }
+        parts = append(parts, "BYMONTHDAY=" + strings.Join(days, ","))
+    }
+    if len(r.ByDay) > 0 {
+        var days []string
+        for _, d := range r.ByDay {
+            days = append(days, d.String())
+        }
+        parts = append(parts, "BYDAY=" + strings.Join(days, ","))
+    }
+    if r.WeekStart != time.Monday {
+        parts = append(parts, "WKST=" + weekdayNames[r.WeekStart])
+    }
+
+    return strings.Join(parts, ";")
+}
+
+// Between returns the occurrences of a series which start at or after from and before to, in order. The series
+// starts at start, which is always its first occurrence, and repeats in the loc time zone. Returns at most max
+// occurrences.
+func (r Rule) Between (start time.Time, loc *time.Location, from, to time.Time, max int) []time.Time {
+    var occurrences []time.Time
+
+    r.each(start, loc, from, to, func (t time.Time) bool {
+        if t.Before(to) == false || len(occurrences) >= max {
+            return false
+        }
+
+        if t.Before(from) == false {
+            occurrences = append(occurrences, t)
+        }
+
+        return true
+    })
+
+    return occurrences
+}
+
+// Last returns the last occurrence of a series. Returns false if the series never ends.
+func (r Rule) Last (start time.Time, loc *time.Location) (time.Time, bool) {
+    if r.Count == 0 && r.Until.IsZero() {
+        return time.Time{}, false
+    }
+
+    last := start
+    r.each(start, loc, start, time.Time{}, func (t time.Time) bool {
+        last = t
+        return true
+    })
+
+    return last, true
+}
+
+// Includes reports if a series has an occurrence which starts at t.
+func (r Rule) Includes (start time.Time, loc *time.Location, t time.Time) bool {
+    found := false
+    r.each(start, loc, t, t, func (occurrence time.Time) bool {
+        found = occurrence.Equal(t)
+        return occurrence.Before(t)
+    })
+
+    return found
+}
+
+// Index returns how many occurrences of a series start before t.
+func (r Rule) Index (start time.Time, loc *time.Location, t time.Time) int {
+    n := 0
+    r.each(start, loc, start, t, func (occurrence time.Time) bool {
+        if occurrence.Before(t) {
+            n++
+            return true
+        }
+
+        return false
+    })
+
+    return n
+}
+
+// each calls fn with the occurrences of a series in order, in UTC, until fn returns false or the series ends.
+// Occurrences before from may be skipped, unless the series has a COUNT which requires counting them. Periods after
+// to, or after UNTIL, are not expanded even if fn is never called, so rules which rarely match stop early. to is
+// ignored if zero.
+func (r Rule) each (start time.Time, loc *time.Location, from, to time.Time, fn func (t time.Time) bool) {
+    local := start.In(loc)
+    until := r.until(loc)
+    count := 0
+
+    first := 0
+    if r.Count == 0 {
+        first = r.periodOf(local, from.In(loc))
+    }
+
+    if until.IsZero() == false && (to.IsZero() || until.Before(to)) {
+        to = until
+    }
+
+    // periodOf is at most one period early, and the local date of to can be a day after its UTC date
+    last := first + maxPeriods - 1
+    if to.IsZero() == false {
+        if n := r.periodOf(local, to.In(loc)) + 2; n < last {
+            last = n
+        }
+    }
+
+    emit := func (t time.Time) bool {
+        if (until.IsZero() == false && t.After(until)) || (r.Count > 0 && count >= r.Count) {
+            return false
+        }
+
+        count++
+        return fn(t.UTC())
+    }
+
+    // The start is always the first occurrence
+    if first == 0 && emit(start) == false {
+        return
+    }
+
+    for period := first; period <= last; period++ {
+        for _, date := range r.period(local, period) {
+            t := time.Date(date.Year(), date.Month(), date.Day(), local.Hour(), local.Minute(), local.Second(), local.Nanosecond(), loc)
+            if t.After(start) && emit(t) == false {
+                return
+            }
+        }
+    }
+}
+
+// periodOf returns a period of a series which starts before t, and is at most one period before the one containing
+// it. The extra period makes up for occurrences whose local date is not the date of the UTC time they start at.
+func (r Rule) periodOf (start, t time.Time) int {
+    startDay := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+    day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+    if day.After(startDay) == false {
+        return 0
+    }
+
+    var periods int
+    switch r.Freq {
+    case Daily:
+        periods = int(day.Sub(startDay).Hours() / 24)
+    case Weekly:
+        weekStart := startDay.AddDate(0, 0, -int((startDay.Weekday() - r.WeekStart + 7) % 7))
+        periods = int(day.Sub(weekStart).Hours() / 24) / 7
+    case Monthly:
+        periods = (day.Year() - startDay.Year()) * 12 + int(day.Month() - startDay.Month())
+    case Yearly:
+        periods = day.Year() - startDay.Year()
+    }
+
+    if n := periods / r.Interval; n > 1 {
+        return n - 1
+    }
+
+    return 0
+}
+
+// period returns the dates of occurrences in the nth period of a series, in order. Dates are midnight UTC, their
+// time of day is the series' local start time.
+func (r Rule) period (start time.Time, n int) []time.Time {
+    day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+    step := n * r.Interval
+
+    var candidates []time.Time
+    ordinals := true
+
+    switch r.Freq {
+    case Daily:
+        candidates = []time.Time{day.AddDate(0, 0, step)}
+        ordinals = false
+    case Weekly:
+        weekStart := day.AddDate(0, 0, -int((day.Weekday() - r.WeekStart + 7) % 7) + 7 * step)
+        candidates = days(weekStart, weekStart.AddDate(0, 0, 7))
+        if len(r.ByDay) == 0 {
+            candidates = onWeekday(candidates, start.Weekday())
+        }
+        ordinals = false
+    case Monthly:
+        month := time.Date(day.Year(), day.Month() + time.Month(step), 1, 0, 0, 0, 0, time.UTC)
+        candidates = days(month, month.AddDate(0, 1, 0))
+    case Yearly:
+        year := time.Date(day.Year() + step, 1, 1, 0, 0, 0, 0, time.UTC)
+        if len(r.ByMonth) > 0 && len(r.ByDay) > 0 {
+            // Ordinal weekdays are counted within each month
+            for _, month := range sortedMonths(r.ByMonth) {
+                first := time.Date(year.Year(), month, 1, 0, 0, 0, 0, time.UTC)
+                candidates = append(candidates, r.filterByDay(days(first, first.AddDate(0, 1, 0)), true)...)
+            }
+
+            return r.filterByMonthDay(candidates)
+        }
+
+
+        candidates = days(year, year.AddDate(1, 0, 0))
+        if len(r.ByMonth) == 0 && len(r.ByMonthDay) == 0 && len(r.ByDay) == 0 {
+            candidates = onMonthDay(candidates, start.Month(), start.Day())
+        }
+    }
+
+    if len(r.ByMonth) > 0 {
+        candidates = r.filterByMonth(candidates)
+    }
+
+    if r.Freq == Monthly || r.Freq == Yearly {
+        if len(r.ByMonthDay) == 0 && len(r.ByDay) == 0 {
+            candidates = onDay(candidates, start.Day())
+        }
+    }
+
+    // Ordinal weekdays are counted before BYMONTHDAY limits the dates
+    return r.filterByMonthDay(r.filterByDay(candidates, ordinals))
+}
+
+// days returns the dates from start until end.
+func days (start, end time.Time) []time.Time {
+    var dates []time.Time
+    for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+        dates = append(dates, d)
+    }
+
+    return dates
+}
+
+func onWeekday (dates []time.Time, weekday time.Weekday) []time.Time {
+    var matched []time.Time
+    for _, d := range dates {
+        if d.Weekday() == weekday {
+            matched = append(matched, d)
+        }
+    }
+
+    return matched
+}
+
+func onDay (dates []time.Time, day int) []time.Time {
+    var matched []time.Time
+    for _, d := range dates {
+        if d.Day() == day {
+            matched = append(matched, d)
+        }
+    }
+
+    return matched
+}
+
+func onMonthDay (dates []time.Time, month time.Month, day int) []time.Time {
+    var matched []time.Time
+    for _, d := range dates {
+        if d.Month() == month && d.Day() == day {
+            matched = append(matched, d)
+        }
+    }
+
+    return matched
+}
+
+type monthList []time.Month
+
+func (l monthList) Len () int { return len(l) }
+func (l monthList) Swap (i, j int) { l[i], l[j] = l[j], l[i] }
+func (l monthList) Less (i, j int) bool { return l[i] < l[j] }
+
+func sortedMonths (months []time.Month) []time.Month {
+    sorted := append([]time.Month(nil), months...)
+    sort.Sort(monthList(sorted))
+
+    return sorted
+}
+
+func (r Rule) filterByMonth (dates []time.Time) []time.Time {
+    var matched []time.Time
+    for _, d := range dates {
+        for _, m := range r.ByMonth {
+            if d.Month() == m {
+                matched = append(matched, d)
+                break
+            }
+        }
+    }
+
+    return matched
+}
+
+func (r Rule) filterByMonthDay (dates []time.Time) []time.Time {
+    if len(r.ByMonthDay) == 0 {
+        return dates
+    }
+
+    var matched []time.Time
+    for _, d := range dates {
+        // Days from the end of the month, -1 is the last day
+        fromEnd := d.Day() - time.Date(d.Year(), d.Month() + 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, -1).Day() - 1
+
+        for _, day := range r.ByMonthDay {
+            if day == d.Day() || day == fromEnd {
+                matched = append(matched, d)
+                break
+            }
+        }
+    }
+
+    return matched
+}
+
+// filterByDay keeps the dates which match BYDAY. If ordinals is true, ordinal weekdays are counted within the dates,
+// otherwise they are not allowed.
+func (r Rule) filterByDay (dates []time.Time, ordinals bool) []time.Time {
+    if len(r.ByDay) == 0 {
+        return dates
+    }
+
+    // Number of dates on each weekday, to count ordinals from the end
+    var total [7]int
+    for _, d := range dates {
+        total[d.Weekday()]++
+    }
+
+    var seen [7]int
+    var matched []time.Time
+    for _, d := range dates {
+        seen[d.Weekday()]++
+        fromStart, fromEnd := seen[d.Weekday()], seen[d.Weekday()] - total[d.Weekday()] - 1
+
+        for _, day := range r.ByDay {
+            if day.Day == d.Weekday() && (day.N == 0 || (ordinals && (day.N == fromStart || day.N == fromEnd))) {
+                matched = append(matched, d)
+                break
+            }
+        }
+    }
+
+    return matched
+}
@@ -0,0 +1,180 @@
+package recur
+
+import (
+    "testing"
+    "time"
+
+    "github.com/stretchr/testify/assert"
+)
+
+// Formats occurrences in loc, to compare them with expected wall clock times
+func local (times []time.Time, loc *time.Location) []string {
+    var formatted []string
+    for _, t := range times {
+        formatted = append(formatted, t.In(loc).Format("2006-01-02 15:04 MST"))
+    }
+
+    return formatted
+}
+
+func TestParse(t *testing.T) {
+    a := assert.New(t)
+
+    rule, err := Parse("RRULE:FREQ=MONTHLY;INTERVAL=2;BYDAY=1MO,-1FR;UNTIL=20240101T000000Z")
+    a.Nil(err)
+    a.Equal(Monthly, rule.Freq)
+    a.Equal(2, rule.Interval)
+    a.Equal([]WeekdayNum{{1, time.Monday}, {-1, time.Friday}}, rule.ByDay)
+    a.Equal("FREQ=MONTHLY;INTERVAL=2;UNTIL=20240101T000000Z;BYDAY=1MO,-1FR", rule.String())
+
+    for _, value := range []string{
+        "",
+        "INTERVAL=2",
+        "FREQ=HOURLY",
+        "FREQ=DAILY;COUNT=0",
+        "FREQ=DAILY;COUNT=2;UNTIL=20240101",
+        "FREQ=WEEKLY;BYDAY=2MO",
+        "FREQ=MONTHLY;BYSETPOS=1",
+        "FREQ=MONTHLY;BYMONTHDAY=32",
+        // Never match
+        "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=30",
+        "FREQ=DAILY;BYMONTH=4,6;BYMONTHDAY=-31",
+        "FREQ=MONTHLY;BYDAY=6MO",
+        "FREQ=MONTHLY;BYDAY=1MO;BYMONTHDAY=20",
+    } {
+        _, err := Parse(value)
+        a.NotNil(err, value)
+    }
+
+    // Rules which only match some years are allowed
+    for _, value := range []string{
+        "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=29",
+        "FREQ=YEARLY;BYDAY=53MO",
+        "FREQ=MONTHLY;BYDAY=FR;BYMONTHDAY=13",
+    } {
+        _, err := Parse(value)
+        a.Nil(err, value)
+    }
+}
+
+func TestRule_Between(t *testing.T) {
+    a := assert.New(t)
+    ny, err := time.LoadLocation("America/New_York")
+    a.Nil(err)
+
+    // Weekly on Tuesday and Thursday evenings across the start of DST
+    rule, _ := Parse("FREQ=WEEKLY;BYDAY=TU,TH;COUNT=4")
+    start := time.Date(2024, 3, 5, 19, 0, 0, 0, ny)
+    a.Equal([]string{
+        "2024-03-05 19:00 EST",
+        "2024-03-07 19:00 EST",
+        "2024-03-12 19:00 EDT",
+        "2024-03-14 19:00 EDT",
+    }, local(rule.Between(start, ny, start, start.AddDate(1, 0, 0), 100), ny))
+
+    last, ok := rule.Last(start, ny)
+    a.True(ok)
+    a.Equal(time.Date(2024, 3, 14, 19, 0, 0, 0, ny).UTC(), last)
+
+    // Last Friday of every month, only within the range
+    rule, _ = Parse("FREQ=MONTHLY;BYDAY=-1FR")
+    start = time.Date(2024, 1, 26, 12, 0, 0, 0, time.UTC)
+    a.Equal([]string{
+        "2024-03-29 12:00 UTC",
+        "2024-04-26 12:00 UTC",
+    }, local(rule.Between(start, time.UTC, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), 100), time.UTC))
+
+    _, ok = rule.Last(start, time.UTC)
+    a.False(ok)
+
+    // Months without a 31st are skipped
+    rule, _ = Parse("FREQ=MONTHLY;UNTIL=20240601")
+    start = time.Date(2024, 1, 31, 9, 0, 0, 0, time.UTC)
+    a.Len(rule.Between(start, time.UTC, start, start.AddDate(1, 0, 0), 100), 3)
+
+    // Results are limited
+    rule, _ = Parse("FREQ=DAILY")
+    a.Len(rule.Between(start, time.UTC, start, start.AddDate(1, 0, 0), 10), 10)
+
+    // Rules which rarely match end
+    rule, _ = Parse("FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=29")
+    a.Equal([]string{
+        "2024-01-31 09:00 UTC",
+        "2024-02-29 09:00 UTC",
+        "2028-02-29 09:00 UTC",
+    }, local(rule.Between(start, time.UTC, start, start.AddDate(5, 0, 0), 10), time.UTC))
+
+    // Intervals can make them never match after the start, the expansion stops at the end of the range
+    rule, _ = Parse("FREQ=YEARLY;INTERVAL=4;BYMONTH=2;BYMONTHDAY=29")
+    start = time.Date(2021, 2, 1, 9, 0, 0, 0, time.UTC)
+    a.Len(rule.Between(start, time.UTC, start, start.AddDate(5, 0, 0), 10), 1)
+    a.False(rule.Includes(start, time.UTC, start.AddDate(100, 0, 0)))
+}
+
+func TestRule_Between_FloatingUntil(t *testing.T) {
+    a := assert.New(t)
+    ny, err := time.LoadLocation("America/New_York")
+    a.Nil(err)
+
+    // Floating and date UNTIL values are in the series' time zone
+    start := time.Date(2024, 1, 8, 22, 0, 0, 0, ny)
+    for _, value := range []string{"FREQ=DAILY;UNTIL=20240110T220000", "FREQ=DAILY;UNTIL=20240110"} {
+        rule, err := Parse(value)
+        a.Nil(err, value)
+        a.Equal([]string{
+            "2024-01-08 22:00 EST",
+            "2024-01-09 22:00 EST",
+            "2024-01-10 22:00 EST",
+        }, local(rule.Between(start, ny, start, start.AddDate(0, 1, 0), 10), ny), value)
+    }
+
+    rule, _ := Parse("FREQ=DAILY;UNTIL=20240110T220000")
+    a.Equal("FREQ=DAILY;UNTIL=20240110T220000", rule.String())
+}
+
+func TestRule_Between_From(t *testing.T) {
+    a := assert.New(t)
+    ny, err := time.LoadLocation("America/New_York")
+    a.Nil(err)
+
+    start := time.Date(2020, 1, 31, 23, 30, 0, 0, ny)
+    from, to := time.Date(2031, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2033, 3, 1, 0, 0, 0, 0, time.UTC)
+
+    // Occurrences found by starting near from are the ones found by walking from the start of the series
+    for _, value := range []string{
+        "FREQ=DAILY;INTERVAL=3",
+        "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,SU;WKST=SU",
+        "FREQ=MONTHLY;BYDAY=-1FR",
+        "FREQ=MONTHLY;INTERVAL=5",
+        "FREQ=YEARLY;INTERVAL=2;BYMONTH=2,3;BYDAY=1SA",
+        "FREQ=MONTHLY;COUNT=300;BYMONTHDAY=1,-1",
+    } {
+        rule, err := Parse(value)
+        a.Nil(err, value)
+
+        var walked []time.Time
+        rule.each(start, ny, start, time.Time{}, func (t time.Time) bool {
+            if t.Before(from) == false && t.Before(to) {
+                walked = append(walked, t)
+            }
+
+            return t.Before(to)
+        })
+
+        a.NotEmpty(walked, value)
+        a.Equal(local(walked, ny), local(rule.Between(start, ny, from, to, 1000), ny), value)
+    }
+}
+
+func TestRule_Includes(t *testing.T) {
+    a := assert.New(t)
+
+    rule, _ := Parse("FREQ=DAILY;INTERVAL=2")
+    start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+
+    a.True(rule.Includes(start, time.UTC, start))
+    a.True(rule.Includes(start, time.UTC, start.AddDate(0, 0, 4)))
+    a.False(rule.Includes(start, time.UTC, start.AddDate(0, 0, 3)))
+    a.False(rule.Includes(start, time.UTC, start.Add(time.Hour)))
+    a.Equal(2, rule.Index(start, time.UTC, start.AddDate(0, 0, 4)))
+}
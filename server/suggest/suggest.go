@@ -0,0 +1,275 @@
+// Package suggest picks the times which work best for a group to meet.
+//
+// Every possible start time in a window is scored by who can attend and by how well it fits the attendees' preferred
+// hours, ex: their working hours, and their sleep. Suggestions only depend on the request, so the same request always
+// gives the same suggestions.
+package suggest
+
+import (
+    "errors"
+    "fmt"
+    "sort"
+    "strconv"
+    "time"
+
+    "github.com/Noah-Huppert/squad-up/server/freebusy"
+)
+
+// Weights of attendees in a slot's score
+const (
+    RequiredWeight = 3.0
+    OptionalWeight = 1.0
+)
+
+// Shares of a slot's score which come from attendance and from how well it fits the attendees' hours. A slot everyone
+// can attend during their preferred hours scores 1.
+const (
+    attendanceShare = 0.7
+    hoursShare = 0.3
+    // Time during an attendee's sleep counts this many times against the slot
+    sleepPenalty = 2.0
+)
+
+// Hours are a daily range of local time, from Start until End minutes after midnight. Ranges which end before they
+// start wrap past midnight, ex: 23:00-07:00. Hours which start and end at the same time are empty.
+type Hours struct {
+    Start int
+    End int
+}
+
+// Default hours of attendees who did not set theirs
+var (
+    DefaultPreferred = Hours{9 * 60, 17 * 60}
+    DefaultSleep = Hours{23 * 60, 7 * 60}
+)
+
+// ErrInvalidHours is returned by ParseHours if a value is not a range of times of day.
+var ErrInvalidHours = errors.New("hours must be formatted as HH:MM-HH:MM")
+
+// ParseHours parses a range of times of day formatted as HH:MM-HH:MM, ex: 09:00-17:00.
+func ParseHours (value string) (Hours, error) {
+    if len(value) != len("00:00-00:00") || value[2] != ':' || value[5] != '-' || value[8] != ':' {
+        return Hours{}, ErrInvalidHours
+    }
+
+    var times [2]int
+    for i := range times {
+        clock := value[i * 6:i * 6 + 5]
+        hours, errH := strconv.Atoi(clock[:2])
+        minutes, errM := strconv.Atoi(clock[3:])
+        if errH != nil || errM != nil || clock[0] == '+' || clock[3] == '+' || hours < 0 || hours > 23 || minutes < 0 || minutes > 59 {
+            return Hours{}, ErrInvalidHours
+        }
+
+        times[i] = hours * 60 + minutes
+    }
+
+    return Hours{times[0], times[1]}, nil
+}
+
+// String formats the hours like ParseHours parses them.
+func (h Hours) String () string {
+    return fmt.Sprintf("%02d:%02d-%02d:%02d", h.Start / 60, h.Start % 60, h.End / 60, h.End % 60)
+}
+
+// overlap returns how much of an interval is during the hours, in the loc time zone.
+func (h Hours) overlap (interval freebusy.Interval, loc *time.Location) time.Duration {
+    if h.Start == h.End {
+        return 0
+    }
+
+    length := h.End - h.Start
+    if length < 0 {
+        length += 24 * 60
+    }
+
+    // Hours starting the day before the interval can run into it
+    first := interval.Start.In(loc).AddDate(0, 0, -1)
+    day := time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, loc)
+
+    var total time.Duration
+    for day.Before(interval.End) {
+        // Dates are used so hours keep their wall clock times when daylight saving time changes
+        start := time.Date(day.Year(), day.Month(), day.Day(), 0, h.Start, 0, 0, loc)
+        end := time.Date(day.Year(), day.Month(), day.Day(), 0, h.Start + length, 0, 0, loc)
+
+        for _, part := range freebusy.Clip([]freebusy.Interval{{Start: start, End: end}}, interval.Start, interval.End) {
+            total += part.End.Sub(part.Start)
+        }
+
+        day = time.Date(day.Year(), day.Month(), day.Day() + 1, 0, 0, 0, 0, loc)
+    }
+
+    return total
+}
+
+// Attendee is someone invited to meet.
+type Attendee struct {
+    ID int
+    // Required attendees count RequiredWeight times, others OptionalWeight
+    Required bool
+    // Time zone of the attendee's hours
+    Location *time.Location
+    // Hours the attendee prefers to meet during
+    Preferred Hours
+    // Hours the attendee is usually asleep
+    Sleep Hours
+    // Times the attendee is busy, merged with freebusy.Merge
+    Busy []freebusy.Interval
+}
+
+// weight returns how much the attendee counts in a slot's score.
+func (a Attendee) weight () float64 {
+    if a.Required {
+        return RequiredWeight
+    }
+
+    return OptionalWeight
+}
+
+// busyDuring reports if the attendee is busy for any of an interval.
+func (a Attendee) busyDuring (interval freebusy.Interval) bool {
+    i := sort.Search(len(a.Busy), func (i int) bool {
+        return a.Busy[i].End.After(interval.Start)
+    })
+
+    return i < len(a.Busy) && a.Busy[i].Overlaps(interval)
+}
+
+// Request describes the meeting suggestions are made for.
+type Request struct {
+    Attendees []Attendee
+    // Length of the meeting
+    Duration time.Duration
+    // Meetings start at or after From and end at or before To
+    From time.Time
+    To time.Time
+    // Time between start times, starts are multiples of Step since the zero time
+    Step time.Duration
+    // Max number of suggestions
+    Count int
+}
+
+// Suggestion is a time to meet.
+type Suggestion struct {
+    freebusy.Interval
+    Score float64 `json:"score"`
+    // Ids of the attendees who are free and busy
+    Available []int `json:"available"`
+    Unavailable []int `json:"unavailable"`
+    // Number of required attendees who are busy
+    MissingRequired int `json:"missing_required"`
+    // Ids of the available attendees for whom the slot is partly outside their preferred hours
+    OutsideHours []int `json:"outside_hours"`
+    // Ids of the available attendees for whom the slot is partly during their sleep
+    Asleep []int `json:"asleep"`
+}
+
+// score scores a slot. Attendees who are busy count against attendance, the others by how much of the slot is during
+// their preferred hours and their sleep.
+func score (attendees []Attendee, slot freebusy.Interval) Suggestion {
+    suggestion := Suggestion{
+        Interval: slot,
+        Available: []int{},
+        Unavailable: []int{},
+        OutsideHours: []int{},
+        Asleep: []int{},
+    }
+
+    length := slot.End.Sub(slot.Start).Seconds()
+    var total, available, comfort float64
+
+    for _, attendee := range attendees {
+        weight := attendee.weight()
+        total += weight
+
+        if attendee.busyDuring(slot) {
+            suggestion.Unavailable = append(suggestion.Unavailable, attendee.ID)
+            if attendee.Required {
+                suggestion.MissingRequired++
+            }
+
+            continue
+        }
+
+        suggestion.Available = append(suggestion.Available, attendee.ID)
+        available += weight
+
+        loc := attendee.Location
+        if loc == nil {
+            loc = time.UTC
+        }
+
+        preferred := attendee.Preferred.overlap(slot, loc).Seconds() / length
+        asleep := attendee.Sleep.overlap(slot, loc).Seconds() / length
+        if preferred < 1 {
+            suggestion.OutsideHours = append(suggestion.OutsideHours, attendee.ID)
+        }
+        if asleep > 0 {
+            suggestion.Asleep = append(suggestion.Asleep, attendee.ID)
+        }
+
+        comfort += weight * (preferred - sleepPenalty * asleep)
+    }
+
+    if total > 0 {
+        suggestion.Score = (attendanceShare * available + hoursShare * comfort) / total
+    }
+
+    return suggestion
+}
+
+// ranking sorts suggestions from best to worst: by the number of required attendees missing, then by score, then by
+// start time.
+type ranking []Suggestion
+
+func (l ranking) Len () int { return len(l) }
+func (l ranking) Swap (i, j int) { l[i], l[j] = l[j], l[i] }
+func (l ranking) Less (i, j int) bool {
+    a, b := l[i], l[j]
+    switch {
+    case a.MissingRequired != b.MissingRequired:
+        return a.MissingRequired < b.MissingRequired
+    case a.Score != b.Score:
+        return a.Score > b.Score
+    }
+
+    return a.Start.Before(b.Start)
+}
+
+// Suggest returns the best times to meet, best first. Slots which miss a required attendee always rank below slots
+// which do not. Suggestions do not overlap, so a good time is not suggested again shifted by a few minutes.
+func Suggest (req Request) []Suggestion {
+    suggestions := []Suggestion{}
+    if req.Step <= 0 || req.Duration <= 0 || req.Count <= 0 {
+        return suggestions
+    }
+
+    start := req.From.Truncate(req.Step)
+    if start.Before(req.From) {
+        start = start.Add(req.Step)
+    }
+
+    var candidates []Suggestion
+    for ; start.Add(req.Duration).After(req.To) == false; start = start.Add(req.Step) {
+        candidates = append(candidates, score(req.Attendees, freebusy.Interval{Start: start, End: start.Add(req.Duration)}))
+    }
+
+    sort.Sort(ranking(candidates))
+
+    for _, candidate := range candidates {
+        overlaps := false
+        for _, picked := range suggestions {
+            overlaps = overlaps || picked.Overlaps(candidate.Interval)
+        }
+
+        if overlaps == false {
+            suggestions = append(suggestions, candidate)
+            if len(suggestions) == req.Count {
+                break
+            }
+        }
+    }
+
+    return suggestions
+}
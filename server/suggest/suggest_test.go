@@ -0,0 +1,141 @@
+package suggest
+
+import (
+    "testing"
+    "time"
+
+    "github.com/Noah-Huppert/squad-up/server/freebusy"
+    "github.com/stretchr/testify/assert"
+)
+
+// Returns a time of 2030-06-03 UTC, a Monday, hours after midnight
+func monday (hours float64) time.Time {
+    return time.Date(2030, 6, 3, 0, 0, 0, 0, time.UTC).Add(time.Duration(hours * float64(time.Hour)))
+}
+
+// Creates an attendee in UTC with the default hours
+func attendee (id int, required bool, busy ...freebusy.Interval) Attendee {
+    return Attendee{ID: id, Required: required, Location: time.UTC, Preferred: DefaultPreferred, Sleep: DefaultSleep, Busy: freebusy.Merge(busy)}
+}
+
+// Returns the start times of suggestions, in hours after midnight
+func starts (suggestions []Suggestion) []float64 {
+    var hours []float64
+    for _, s := range suggestions {
+        hours = append(hours, s.Start.Sub(monday(0)).Hours())
+    }
+
+    return hours
+}
+
+func TestParseHours(t *testing.T) {
+    a := assert.New(t)
+
+    hours, err := ParseHours("22:30-06:45")
+    a.Nil(err)
+    a.Equal(Hours{22 * 60 + 30, 6 * 60 + 45}, hours)
+    a.Equal("22:30-06:45", hours.String())
+
+    for _, value := range []string{"", "9:00-17:00", "09:00-24:00", "09:60-17:00", "09:00 17:00", "+9:00-17:00", "09:00-17:00 "} {
+        _, err := ParseHours(value)
+        a.Equal(ErrInvalidHours, err, value)
+    }
+}
+
+func TestHours_overlap(t *testing.T) {
+    a := assert.New(t)
+    ny, _ := time.LoadLocation("America/New_York")
+
+    // Sleep wraps past midnight, both nights are counted
+    night := freebusy.Interval{Start: monday(-2), End: monday(8)}
+    a.Equal(8 * time.Hour, DefaultSleep.overlap(night, time.UTC))
+    a.Equal(time.Duration(0), Hours{}.overlap(night, time.UTC))
+
+    // Hours keep their wall clock time when daylight saving time begins, 2030-03-10 in New York
+    day := freebusy.Interval{Start: time.Date(2030, 3, 10, 12, 0, 0, 0, time.UTC), End: time.Date(2030, 3, 10, 23, 0, 0, 0, time.UTC)}
+    a.Equal(8 * time.Hour, DefaultPreferred.overlap(day, ny))
+    a.Equal(time.Date(2030, 3, 10, 13, 0, 0, 0, time.UTC), time.Date(2030, 3, 10, 9, 0, 0, 0, ny).UTC())
+}
+
+func TestSuggest(t *testing.T) {
+    a := assert.New(t)
+
+    req := Request{
+        Attendees: []Attendee{
+            attendee(1, false, freebusy.Interval{Start: monday(9), End: monday(12)}),
+            attendee(2, false),
+        },
+        Duration: time.Hour,
+        From: monday(8),
+        To: monday(18),
+        Step: 30 * time.Minute,
+        Count: 3,
+    }
+
+    // Everyone is free during their hours from noon, suggestions do not overlap
+    suggestions := Suggest(req)
+    a.Equal([]float64{12, 13, 14}, starts(suggestions))
+    a.Equal(1.0, suggestions[0].Score)
+    a.Equal([]int{1, 2}, suggestions[0].Available)
+    a.Equal([]int{}, suggestions[0].Unavailable)
+
+    // Reproducible
+    a.Equal(suggestions, Suggest(req))
+
+    // Starts are aligned to the step, the last one ends at the end of the window
+    req.From, req.Count = monday(16).Add(10 * time.Minute), 10
+    a.Equal([]float64{16.5}, starts(Suggest(req)))
+
+    a.Len(Suggest(Request{Attendees: req.Attendees, From: monday(8), To: monday(9), Duration: 2 * time.Hour, Step: time.Hour, Count: 1}), 0)
+}
+
+func TestSuggest_Required(t *testing.T) {
+    a := assert.New(t)
+
+    // The optional attendee is only free when the required one is busy
+    suggestions := Suggest(Request{
+        Attendees: []Attendee{
+            attendee(1, true, freebusy.Interval{Start: monday(13), End: monday(17)}),
+            attendee(2, false, freebusy.Interval{Start: monday(9), End: monday(13)}),
+        },
+        Duration: time.Hour,
+        From: monday(9),
+        To: monday(17),
+        Step: time.Hour,
+        Count: 8,
+    })
+
+    a.Len(suggestions, 8)
+    a.Equal(0, suggestions[3].MissingRequired)
+    a.Equal(1, suggestions[4].MissingRequired)
+    a.Equal([]float64{9, 10, 11, 12, 13, 14, 15, 16}, starts(suggestions))
+    a.Equal([]int{2}, suggestions[0].Unavailable)
+    a.InDelta(0.75, suggestions[0].Score, 1e-9)
+    a.InDelta(0.25, suggestions[4].Score, 1e-9)
+}
+
+func TestSuggest_Hours(t *testing.T) {
+    a := assert.New(t)
+    ny, _ := time.LoadLocation("America/New_York")
+    tokyo, _ := time.LoadLocation("Asia/Tokyo")
+
+    newYorker := Attendee{ID: 1, Location: ny, Preferred: DefaultPreferred, Sleep: DefaultSleep}
+    tokyoite := Attendee{ID: 2, Location: tokyo, Preferred: DefaultPreferred, Sleep: DefaultSleep}
+
+    // 9 AM to 5 PM in New York is 10 PM to 6 AM in Tokyo, no hour suits both. The first hour of the New Yorker's day,
+    // before the Tokyoite goes to sleep, scores the same as the first hour of the Tokyoite's day, before the New Yorker
+    // goes to sleep. The earliest comes first.
+    suggestions := Suggest(Request{
+        Attendees: []Attendee{newYorker, tokyoite},
+        Duration: time.Hour,
+        From: monday(12),
+        To: monday(27),
+        Step: time.Hour,
+        Count: 2,
+    })
+
+    a.Equal([]float64{13, 24}, starts(suggestions))
+    a.Equal([]int{2}, suggestions[0].OutsideHours)
+    a.Equal([]int{}, suggestions[0].Asleep)
+    a.Equal([]int{1}, suggestions[1].OutsideHours)
+}
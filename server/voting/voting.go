@@ -0,0 +1,247 @@
+// Package voting counts the ballots of polls.
+//
+// Options are identified by ids and passed in the order the poll lists them. Ties are always broken the same way, in
+// favor of the option listed first, so counting the same ballots twice gives the same result.
+package voting
+
+import (
+    "errors"
+    "sort"
+)
+
+// Method is how ballots are cast and counted.
+type Method string
+
+// Supported methods
+const (
+    // Each voter picks one option, the option picked most wins
+    Single Method = "single"
+    // Each voter picks every option they approve of, the option approved most wins
+    Approval Method = "approval"
+    // Each voter ranks options, counted by instant-runoff
+    Ranked Method = "ranked"
+    // Each voter scores options, the option with the highest total wins
+    Score Method = "score"
+)
+
+// Methods lists the supported methods.
+var Methods = []Method{Single, Approval, Ranked, Score}
+
+// ErrUnknownMethod is returned by Count if a method is not supported.
+var ErrUnknownMethod = errors.New("unknown voting method")
+
+// Ballot is one voter's vote.
+type Ballot struct {
+    // Options picked. For ranked polls from most to least preferred, options which are not included are not ranked.
+    Choices []int
+    // Score given to each option, for score polls. Options which are not included score 0.
+    Scores map[int]int
+}
+
+// Tally is the number of votes an option got. For score polls, the sum of its scores.
+type Tally struct {
+    Option int `json:"option_id"`
+    Votes int `json:"votes"`
+}
+
+// Round is a round of instant-runoff counting.
+type Round struct {
+    // Votes of the options still in the running, in the poll's order
+    Tallies []Tally `json:"tallies"`
+    // Ballots which rank none of the options still in the running
+    Exhausted int `json:"exhausted"`
+    // Option eliminated at the end of the round, 0 in the last round
+    Eliminated int `json:"eliminated"`
+}
+
+// Result is the outcome of a poll.
+type Result struct {
+    Method Method `json:"method"`
+    // Number of ballots counted
+    Ballots int `json:"ballots"`
+    // Winning option, 0 if no option got a vote
+    Winner int `json:"winner"`
+    // Every option from best to worst. For ranked polls options are ordered by the round they were eliminated in, and
+    // have their votes in that round.
+    Standings []Tally `json:"standings"`
+    // Rounds of ranked polls
+    Rounds []Round `json:"rounds,omitempty"`
+}
+
+// Count counts the ballots of a poll whose options are listed in order.
+func Count (method Method, options []int, ballots []Ballot) (Result, error) {
+    result := Result{Method: method, Ballots: len(ballots)}
+
+    order := make(map[int]int)
+    for i, option := range options {
+        order[option] = i
+    }
+
+    votes := make(map[int]int)
+    switch method {
+    case Single, Approval:
+        for _, ballot := range ballots {
+            for _, option := range ballot.Choices {
+                if _, ok := order[option]; ok == false {
+                    continue
+                }
+
+                votes[option]++
+
+                // Single choice ballots count for their first option which still exists
+                if method == Single {
+                    break
+                }
+            }
+        }
+    case Score:
+        for _, ballot := range ballots {
+            for option, score := range ballot.Scores {
+                if _, ok := order[option]; ok {
+                    votes[option] += score
+                }
+            }
+        }
+    case Ranked:
+        return instantRunoff(result, options, order, ballots), nil
+    default:
+        return result, ErrUnknownMethod
+    }
+
+    result.Standings = rank(options, order, votes)
+    if len(result.Standings) > 0 && result.Standings[0].Votes > 0 {
+        result.Winner = result.Standings[0].Option
+    }
+
+    return result, nil
+}
+
+// byVotes sorts tallies by votes, ties going to the option listed first.
+type byVotes struct {
+    tallies []Tally
+    order map[int]int
+}
+
+func (l byVotes) Len () int { return len(l.tallies) }
+func (l byVotes) Swap (i, j int) { l.tallies[i], l.tallies[j] = l.tallies[j], l.tallies[i] }
+func (l byVotes) Less (i, j int) bool {
+    a, b := l.tallies[i], l.tallies[j]
+    if a.Votes != b.Votes {
+        return a.Votes > b.Votes
+    }
+
+    return l.order[a.Option] < l.order[b.Option]
+}
+
+// rank returns the tallies of options from most to least votes.
+func rank (options []int, order map[int]int, votes map[int]int) []Tally {
+    tallies := make([]Tally, len(options))
+    for i, option := range options {
+        tallies[i] = Tally{option, votes[option]}
+    }
+
+    sort.Sort(byVotes{tallies, order})
+
+    return tallies
+}
+
+// instantRunoff counts ranked ballots in rounds. Each round, ballots count for their most preferred option still in
+// the running. An option with more than half of the ballots which are not exhausted wins, otherwise the option with
+// the fewest votes is eliminated.
+//
+// Ties for the fewest votes are broken by the votes the tied options had in earlier rounds, latest first, then the
+// option listed last is eliminated.
+func instantRunoff (result Result, options []int, order map[int]int, ballots []Ballot) Result {
+    running := append([]int{}, options...)
+    // Votes of each option in each round
+    var history []map[int]int
+    // Options in the order they were eliminated, with their votes in their last round
+    var eliminated []Tally
+
+    for len(running) > 0 {
+        votes := make(map[int]int)
+        round := Round{}
+
+        for _, ballot := range ballots {
+            if choice, ok := firstRunning(ballot.Choices, running); ok {
+                votes[choice]++
+            } else {
+                round.Exhausted++
+            }
+        }
+
+        for _, option := range running {
+            round.Tallies = append(round.Tallies, Tally{option, votes[option]})
+        }
+        history = append(history, votes)
+
+        standings := rank(running, order, votes)
+        leader := standings[0]
+        active := len(ballots) - round.Exhausted
+
+        if active == 0 || leader.Votes * 2 > active || len(running) == 1 {
+            if leader.Votes > 0 {
+                result.Winner = leader.Option
+            }
+
+            result.Rounds = append(result.Rounds, round)
+            result.Standings = standings
+            break
+        }
+
+        loser := weakest(running, order, history)
+        round.Eliminated = loser
+        result.Rounds = append(result.Rounds, round)
+        eliminated = append(eliminated, Tally{loser, votes[loser]})
+
+        remaining := running[:0]
+        for _, option := range running {
+            if option != loser {
+                remaining = append(remaining, option)
+            }
+        }
+        running = remaining
+    }
+
+    for i := len(eliminated) - 1; i >= 0; i-- {
+        result.Standings = append(result.Standings, eliminated[i])
+    }
+
+    return result
+}
+
+// firstRunning returns a ballot's most preferred option which is still in the running.
+func firstRunning (choices []int, running []int) (int, bool) {
+    for _, choice := range choices {
+        for _, option := range running {
+            if choice == option {
+                return choice, true
+            }
+        }
+    }
+
+    return 0, false
+}
+
+// weakest returns the option to eliminate at the end of the last round in history.
+func weakest (running []int, order map[int]int, history []map[int]int) int {
+    loser := running[0]
+    for _, option := range running[1:] {
+        if weaker(option, loser, order, history) {
+            loser = option
+        }
+    }
+
+    return loser
+}
+
+// weaker reports if option a should be eliminated before option b.
+func weaker (a, b int, order map[int]int, history []map[int]int) bool {
+    for i := len(history) - 1; i >= 0; i-- {
+        if history[i][a] != history[i][b] {
+            return history[i][a] < history[i][b]
+        }
+    }
+
+    return order[a] > order[b]
+}
@@ -0,0 +1,83 @@
+package voting
+
+import (
+    "testing"
+
+    "github.com/stretchr/testify/assert"
+)
+
+// Creates ranked ballots from lists of choices
+func ranked (choices ...[]int) []Ballot {
+    ballots := make([]Ballot, len(choices))
+    for i, c := range choices {
+        ballots[i] = Ballot{Choices: c}
+    }
+
+    return ballots
+}
+
+func TestCount(t *testing.T) {
+    a := assert.New(t)
+    options := []int{1, 2, 3}
+
+    // Ties go to the option listed first
+    result, err := Count(Single, options, ranked([]int{2}, []int{3}, []int{1, 3}))
+    a.Nil(err)
+    a.Equal(1, result.Winner)
+    a.Equal([]Tally{{1, 1}, {2, 1}, {3, 1}}, result.Standings)
+
+    // Options which were deleted are skipped
+    result, _ = Count(Single, options, ranked([]int{4, 2}, []int{2}, []int{4}))
+    a.Equal(2, result.Winner)
+    a.Equal([]Tally{{2, 2}, {1, 0}, {3, 0}}, result.Standings)
+
+    result, _ = Count(Approval, options, ranked([]int{2, 3}, []int{3}, []int{1, 3}))
+    a.Equal(3, result.Winner)
+    a.Equal([]Tally{{3, 3}, {1, 1}, {2, 1}}, result.Standings)
+
+    result, _ = Count(Score, options, []Ballot{
+        {Scores: map[int]int{1: 5, 2: 3}},
+        {Scores: map[int]int{1: 0, 2: 4, 3: 1}},
+    })
+    a.Equal(2, result.Winner)
+    a.Equal([]Tally{{2, 7}, {1, 5}, {3, 1}}, result.Standings)
+
+    // No votes, no winner
+    result, _ = Count(Approval, options, nil)
+    a.Equal(0, result.Winner)
+    a.Len(result.Standings, 3)
+
+    _, err = Count("borda", options, nil)
+    a.Equal(ErrUnknownMethod, err)
+}
+
+func TestCount_Ranked(t *testing.T) {
+    a := assert.New(t)
+    options := []int{1, 2, 3, 4}
+
+    // 3 has the fewest first choices and goes first, its ballot moves to 2. 4 goes next and its ballots move to 2,
+    // except one which is exhausted.
+    result, err := Count(Ranked, options, ranked(
+        []int{1}, []int{1}, []int{1},
+        []int{2}, []int{2},
+        []int{3, 2},
+        []int{4, 2}, []int{4},
+    ))
+    a.Nil(err)
+    a.Equal(2, result.Winner)
+    a.Equal(8, result.Ballots)
+    a.Len(result.Rounds, 3)
+
+    a.Equal(Round{Tallies: []Tally{{1, 3}, {2, 2}, {3, 1}, {4, 2}}, Eliminated: 3}, result.Rounds[0])
+    a.Equal(Round{Tallies: []Tally{{1, 3}, {2, 3}, {4, 2}}, Eliminated: 4}, result.Rounds[1])
+    a.Equal(Round{Tallies: []Tally{{1, 3}, {2, 4}}, Exhausted: 1}, result.Rounds[2])
+    a.Equal([]Tally{{2, 4}, {1, 3}, {4, 2}, {3, 1}}, result.Standings)
+
+    // Ties for last are broken by earlier rounds, then against the option listed last
+    result, _ = Count(Ranked, []int{1, 2}, ranked([]int{1}, []int{2}))
+    a.Equal(1, result.Winner)
+    a.Equal(2, result.Rounds[0].Eliminated)
+
+    result, _ = Count(Ranked, []int{1, 2, 3}, ranked([]int{1}, []int{1}, []int{2}, []int{2}, []int{3, 2}, []int{3, 2}, []int{1}))
+    a.Equal(2, result.Winner)
+}